@@ -0,0 +1,152 @@
+// Package apigateway calls API Gateway APIs protected by IAM authorization,
+// signing requests with github.com/raff/aws4, such as to test private APIs
+// with the credentials of the roles allowed to call them:
+//
+//	c := &apigateway.Client{
+//		URL: "https://abc123.execute-api.us-east-1.amazonaws.com/prod",
+//		Client: &aws4.Client{Credentials: aws4.NewCredentials(&aws4.AssumeRoleProvider{
+//			RoleArn: "arn:aws:iam::123456789012:role/api-caller",
+//		})},
+//	}
+//	err := c.DoJSON(ctx, "GET", "/orders/42", nil, &order)
+package apigateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A Client calls the API of a stage.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// URL is the invoke URL of the stage, such as
+	// https://abc123.execute-api.us-east-1.amazonaws.com/prod, or its
+	// custom domain.
+	URL string
+
+	// Region, if empty, is taken from URL, which must then be an
+	// execute-api URL.
+	Region string
+}
+
+// An Error is an error response of the API. Errors of API Gateway itself,
+// rather than of the integration, have a Type, such as AccessDeniedException
+// when the caller isn't allowed by the IAM authorizer.
+type Error struct {
+	StatusCode int
+	Type       string
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("apigateway: %d - %q", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("apigateway: %d - %s - %q", e.StatusCode, e.Type, e.Message)
+}
+
+// IsAuthorizationError returns true if err is an *Error reporting that the
+// request was rejected by the IAM authorizer: the caller isn't allowed, or
+// its signature or credentials are invalid.
+func IsAuthorizationError(err error) bool {
+	e, ok := err.(*Error)
+	if !ok || (e.StatusCode != 403 && e.StatusCode != 401) {
+		return false
+	}
+	switch e.Type {
+	case "AccessDeniedException", "IncompleteSignatureException", "InvalidSignatureException",
+		"MissingAuthenticationTokenException", "UnrecognizedClientException", "ExpiredTokenException":
+		return true
+	}
+	return false
+}
+
+func (c *Client) region() (string, error) {
+	if c.Region != "" {
+		return c.Region, nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", err
+	}
+	// abc123.execute-api.us-east-1.amazonaws.com
+	parts := strings.Split(u.Hostname(), ".")
+	if len(parts) < 4 || parts[1] != "execute-api" {
+		return "", errors.New("apigateway: Region required for " + u.Hostname())
+	}
+	return parts[2], nil
+}
+
+// Do sends a request for path, relative to the stage, and returns the
+// response, or an *Error for responses with a status other than 2xx.
+func (c *Client) Do(ctx context.Context, method, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	region, err := c.region()
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+"/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	cl := c.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+	resp, err := cl.DoService("execute-api", region, r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		defer io.Copy(ioutil.Discard, resp.Body)
+		e := aws4.ParseError(resp)
+		typ := resp.Header.Get("X-Amzn-Errortype")
+		if i := strings.IndexByte(typ, ':'); i >= 0 {
+			typ = typ[:i]
+		}
+		return nil, &Error{resp.StatusCode, typ, e.Message, e.RequestID}
+	}
+	return resp, nil
+}
+
+// DoJSON sends in, unless it is nil, as JSON and decodes the response into
+// out, unless it is nil.
+func (c *Client) DoJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	header := http.Header{"Accept": {"application/json"}}
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Do(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
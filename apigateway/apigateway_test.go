@@ -0,0 +1,60 @@
+package apigateway_test
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/apigateway"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sts/":
+			b, _ := ioutil.ReadAll(r.Body)
+			if !strings.Contains(string(b), "RoleArn=arn%3Aaws%3Aiam%3A%3A123456789012%3Arole%2Ftester") {
+				t.Errorf("AssumeRole request %s", b)
+			}
+			w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials><AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>s</SecretAccessKey><SessionToken>role-token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+		case "/prod/orders/42":
+			if r.Header.Get("X-Amz-Security-Token") != "role-token" || !strings.Contains(r.Header.Get("Authorization"), "Credential=ASIA/") ||
+				!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/execute-api/") {
+				t.Errorf("request headers %v", r.Header)
+			}
+			w.Write([]byte(`{"id":"42"}`))
+		default:
+			w.Header().Set("X-Amzn-ErrorType", "AccessDeniedException")
+			w.Header().Set("X-Amzn-RequestId", "req-1")
+			w.WriteHeader(403)
+			w.Write([]byte(`{"Message":"User: arn:aws:sts::123456789012:assumed-role/tester/aws4 is not authorized to perform: execute-api:Invoke"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &apigateway.Client{
+		URL:    srv.URL + "/prod",
+		Region: "eu-west-1",
+		Client: &aws4.Client{Credentials: aws4.NewCredentials(&aws4.AssumeRoleProvider{
+			Client:  &aws4.Client{Keys: &aws4.Keys{AccessKey: "AKID", SecretKey: "secret"}},
+			RoleArn: "arn:aws:iam::123456789012:role/tester",
+			STSURL:  srv.URL + "/sts/",
+		})},
+	}
+	var order struct{ ID string }
+	if err := c.DoJSON(context.Background(), "GET", "/orders/42", nil, &order); err != nil || order.ID != "42" {
+		t.Fatalf("order = %+v, %v", order, err)
+	}
+
+	err := c.DoJSON(context.Background(), "POST", "admin", map[string]string{"a": "b"}, nil)
+	if !apigateway.IsAuthorizationError(err) || !strings.Contains(err.Error(), "not authorized") || err.(*apigateway.Error).RequestID != "req-1" {
+		t.Errorf("err = %#v", err)
+	}
+
+	if _, err := (&apigateway.Client{URL: "https://api.example.com/v1"}).Do(context.Background(), "GET", "/", nil, nil); err == nil {
+		t.Error("custom domain without Region accepted")
+	}
+}
@@ -0,0 +1,113 @@
+package aws4
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An AssumeRoleProvider is a Provider of the temporary keys of an IAM role,
+// assumed with STS AssumeRole by Client. Use it with Credentials, which
+// assumes the role again before the keys expire:
+//
+//	cl := &aws4.Client{Credentials: aws4.NewCredentials(&aws4.AssumeRoleProvider{
+//		RoleArn: "arn:aws:iam::123456789012:role/tester",
+//	})}
+type AssumeRoleProvider struct {
+	// Client assumes the role. If nil, DefaultClient is used.
+	Client *Client
+
+	RoleArn string
+
+	// SessionName identifies the session in CloudTrail. If empty, "aws4"
+	// is used.
+	SessionName string
+
+	// ExternalID, if not empty, is the external ID the role's trust policy
+	// requires.
+	ExternalID string
+
+	// Duration is how long the keys are valid. If zero, STS uses an hour.
+	Duration time.Duration
+
+	// Region is the region of the STS endpoint. If empty, the global
+	// endpoint is used.
+	Region string
+
+	// If empty, the STS endpoint of Region is used.
+	STSURL string
+}
+
+// Retrieve implements Provider.
+func (p *AssumeRoleProvider) Retrieve(ctx context.Context) (*Keys, time.Time, error) {
+	if p.RoleArn == "" {
+		return nil, time.Time{}, errors.New("aws4: AssumeRoleProvider without a RoleArn")
+	}
+	v := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {p.RoleArn},
+		"RoleSessionName": {p.SessionName},
+	}
+	if p.SessionName == "" {
+		v.Set("RoleSessionName", "aws4")
+	}
+	if p.ExternalID != "" {
+		v.Set("ExternalId", p.ExternalID)
+	}
+	if p.Duration > 0 {
+		v.Set("DurationSeconds", strconv.Itoa(int(p.Duration/time.Second)))
+	}
+
+	u, region := p.STSURL, p.Region
+	if u == "" {
+		u = "https://sts.amazonaws.com/"
+		if region != "" {
+			u = "https://sts." + region + ".amazonaws.com/"
+		}
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	r, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	cl := p.Client
+	if cl == nil {
+		cl = DefaultClient
+	}
+	resp, err := cl.DoService("sts", region, r)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, time.Time{}, ParseError(resp)
+	}
+
+	var res struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, time.Time{}, err
+	}
+	c := res.Credentials
+	return &Keys{AccessKey: c.AccessKeyId, SecretKey: c.SecretAccessKey, SessionToken: c.SessionToken}, c.Expiration, nil
+}
@@ -0,0 +1,263 @@
+// Package athena runs Amazon Athena queries and decodes their results,
+// signing requests with github.com/raff/aws4.
+package athena
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// Defaults of Client.
+const (
+	DefaultPollInterval = time.Second
+	DefaultRetries      = 3
+)
+
+// MaxResults is the maximum number of rows of a page of GetQueryResults.
+const MaxResults = 1000
+
+// States of a query execution.
+const (
+	Queued    = "QUEUED"
+	Running   = "RUNNING"
+	Succeeded = "SUCCEEDED"
+	Failed    = "FAILED"
+	Cancelled = "CANCELLED"
+)
+
+// A Client runs queries.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the Athena endpoint of Region is used.
+	URL string
+
+	// WorkGroup, Catalog and Database, if not empty, are the workgroup the
+	// queries run in, and the catalog and database of unqualified tables.
+	WorkGroup string
+	Catalog   string
+	Database  string
+
+	// OutputLocation, if not empty, is the S3 URL of the results, such as
+	// "s3://bucket/prefix/". It is required unless set by WorkGroup.
+	OutputLocation string
+
+	// If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// Retries is the number of attempts of requests failing with throttling
+	// or server errors. If zero, DefaultRetries is used.
+	Retries uint
+}
+
+// An Error is an error reported by Athena.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name, such as
+// "InvalidRequestException".
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+// A QueryError reports a query execution that failed or was cancelled.
+type QueryError struct {
+	ID     string
+	State  string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	msg := "athena: query " + e.ID + " " + e.State
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// A QueryExecution describes a query execution.
+type QueryExecution struct {
+	QueryExecutionId string
+	Query            string
+
+	// StatementType is DDL, DML or UTILITY.
+	StatementType string
+
+	ResultConfiguration struct {
+		OutputLocation string
+	}
+
+	Status struct {
+		State              string
+		StateChangeReason  string
+		SubmissionDateTime float64
+		CompletionDateTime float64
+	}
+
+	Statistics struct {
+		DataScannedInBytes          int64
+		EngineExecutionTimeInMillis int64
+		TotalExecutionTimeInMillis  int64
+	}
+}
+
+// Done returns true if q has ended.
+func (q *QueryExecution) Done() bool {
+	switch q.Status.State {
+	case Succeeded, Failed, Cancelled:
+		return true
+	}
+	return false
+}
+
+// Err returns a *QueryError if q failed or was cancelled, or else nil.
+func (q *QueryExecution) Err() error {
+	switch q.Status.State {
+	case Failed, Cancelled:
+		return &QueryError{q.QueryExecutionId, q.Status.State, q.Status.StateChangeReason}
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "athena",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "AmazonAthena",
+		Version: "1.1",
+	}
+
+	// The requests of Client are reads, or made idempotent by a token.
+	ctx = aws4.WithIdempotency(ctx, true)
+	retries := c.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	var err error
+	for retry := uint(0); retry < retries; retry++ {
+		if serr := awsjson.Sleep(ctx, retry, err); serr != nil {
+			return serr
+		}
+		if err = jc.Do(ctx, action, in, out); !awsjson.Retryable(ctx, err) {
+			break
+		}
+	}
+	return err
+}
+
+// StartQueryExecution starts query, with params as the values of its ?
+// placeholders, in the form of SQL literals such as 'text' or 42, and
+// returns its query execution ID.
+func (c *Client) StartQueryExecution(ctx context.Context, query string, params ...string) (string, error) {
+	// The token makes the retries of the request idempotent.
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	type execContext struct {
+		Catalog  string `json:",omitempty"`
+		Database string `json:",omitempty"`
+	}
+	type resultConfig struct {
+		OutputLocation string `json:",omitempty"`
+	}
+	req := struct {
+		QueryString           string
+		ClientRequestToken    string
+		QueryExecutionContext *execContext  `json:",omitempty"`
+		ResultConfiguration   *resultConfig `json:",omitempty"`
+		WorkGroup             string        `json:",omitempty"`
+		ExecutionParameters   []string      `json:",omitempty"`
+	}{QueryString: query, ClientRequestToken: hex.EncodeToString(token), WorkGroup: c.WorkGroup, ExecutionParameters: params}
+	if c.Catalog != "" || c.Database != "" {
+		req.QueryExecutionContext = &execContext{c.Catalog, c.Database}
+	}
+	if c.OutputLocation != "" {
+		req.ResultConfiguration = &resultConfig{c.OutputLocation}
+	}
+
+	var resp struct{ QueryExecutionId string }
+	if err := c.do(ctx, "StartQueryExecution", &req, &resp); err != nil {
+		return "", err
+	}
+	return resp.QueryExecutionId, nil
+}
+
+// GetQueryExecution returns the query execution id.
+func (c *Client) GetQueryExecution(ctx context.Context, id string) (*QueryExecution, error) {
+	var resp struct{ QueryExecution QueryExecution }
+	if err := c.do(ctx, "GetQueryExecution", map[string]string{"QueryExecutionId": id}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.QueryExecution, nil
+}
+
+// StopQueryExecution cancels the query execution id.
+func (c *Client) StopQueryExecution(ctx context.Context, id string) error {
+	return c.do(ctx, "StopQueryExecution", map[string]string{"QueryExecutionId": id}, nil)
+}
+
+// Wait polls the query execution id until it ends, and returns it. It fails
+// with a *QueryError if the query failed or was cancelled, and cancels the
+// query if ctx is done first.
+func (c *Client) Wait(ctx context.Context, id string) (*QueryExecution, error) {
+	poll := c.PollInterval
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+	// Queries often end within a second: poll quickly at first.
+	d := poll / 8
+	for {
+		q, err := c.GetQueryExecution(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.StopQueryExecution(context.Background(), id)
+			}
+			return nil, err
+		}
+		if q.Done() {
+			return q, q.Err()
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			c.StopQueryExecution(context.Background(), id)
+			return nil, ctx.Err()
+		}
+		if d *= 2; d > poll {
+			d = poll
+		}
+	}
+}
+
+// Query runs query, with params as StartQueryExecution, waits for it to
+// succeed and returns its results.
+func (c *Client) Query(ctx context.Context, query string, params ...string) (*Rows, error) {
+	id, err := c.StartQueryExecution(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	q, err := c.Wait(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.Results(q), nil
+}
@@ -0,0 +1,123 @@
+package athena_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/athena"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAthena runs a query that throttles its start, runs for a poll, and
+// has results over two pages, the first starting with a header row.
+type fakeAthena struct {
+	t      *testing.T
+	starts int
+	polls  int
+}
+
+func (f *fakeAthena) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonAthena.StartQueryExecution":
+		if f.starts++; f.starts == 1 {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"__type":"ThrottlingException","message":"slow down"}`)
+			return
+		}
+		if req["WorkGroup"] != "reports" || fmt.Sprint(req["ExecutionParameters"]) != "['eu']" || len(req["ClientRequestToken"].(string)) != 64 {
+			f.t.Errorf("StartQueryExecution %v", req)
+		}
+		fmt.Fprint(w, `{"QueryExecutionId":"q1"}`)
+	case "AmazonAthena.GetQueryExecution":
+		state := athena.Running
+		if f.polls++; f.polls > 1 {
+			state = athena.Succeeded
+		}
+		fmt.Fprintf(w, `{"QueryExecution":{"QueryExecutionId":"q1","StatementType":"DML","Status":{"State":%q}}}`, state)
+	case "AmazonAthena.GetQueryResults":
+		columns := `"ResultSetMetadata":{"ColumnInfo":[{"Name":"day","Type":"date"},{"Name":"region","Type":"varchar"},{"Name":"requests","Type":"bigint"},{"Name":"latency","Type":"double"}]}`
+		if req["NextToken"] == nil {
+			fmt.Fprintf(w, `{"NextToken":"p2","ResultSet":{%s,"Rows":[
+				{"Data":[{"VarCharValue":"day"},{"VarCharValue":"region"},{"VarCharValue":"requests"},{"VarCharValue":"latency"}]},
+				{"Data":[{"VarCharValue":"2024-05-01"},{"VarCharValue":"eu"},{"VarCharValue":"42"},{"VarCharValue":"1.5"}]}]}}`, columns)
+			return
+		}
+		fmt.Fprintf(w, `{"ResultSet":{%s,"Rows":[
+			{"Data":[{"VarCharValue":"2024-05-02"},{"VarCharValue":"eu"},{"VarCharValue":"7"},{}]}]}}`, columns)
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+type report struct {
+	Day      time.Time
+	Region   string
+	Requests int
+	Latency  *float64 `athena:"latency"`
+}
+
+func TestQuery(t *testing.T) {
+	f := &fakeAthena{t: t}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &athena.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, WorkGroup: "reports", PollInterval: time.Millisecond}
+
+	ctx := context.Background()
+	rows, err := c.Query(ctx, "SELECT * FROM requests WHERE region = ?", "'eu'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []report
+	for rows.Next(ctx) {
+		var r report
+		if err := rows.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) != 2 || f.polls != 2 {
+		t.Fatalf("reports %+v after %d polls", reports, f.polls)
+	}
+	if r := reports[0]; r.Day.Day() != 1 || r.Region != "eu" || r.Requests != 42 || r.Latency == nil || *r.Latency != 1.5 {
+		t.Errorf("first report %+v", r)
+	}
+	if r := reports[1]; r.Requests != 7 || r.Latency != nil {
+		t.Errorf("second report %+v", r)
+	}
+
+	var day, region, requests, latency interface{}
+	if err := rows.Scan(&day, &region, &requests, &latency); err != nil {
+		t.Fatal(err)
+	}
+	if requests != int64(7) || latency != nil || day.(time.Time).Day() != 2 {
+		t.Errorf("scanned %v %v %v %v", day, region, requests, latency)
+	}
+}
+
+func TestQueryFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonAthena.StartQueryExecution":
+			fmt.Fprint(w, `{"QueryExecutionId":"q2"}`)
+		default:
+			fmt.Fprint(w, `{"QueryExecution":{"QueryExecutionId":"q2","Status":{"State":"FAILED","StateChangeReason":"TABLE_NOT_FOUND"}}}`)
+		}
+	}))
+	defer srv.Close()
+	c := &athena.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	_, err := c.Query(context.Background(), "SELECT * FROM missing")
+	if e, ok := err.(*athena.QueryError); !ok || e.ID != "q2" || e.Reason != "TABLE_NOT_FOUND" {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package athena
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of the date and timestamp values of query results.
+const (
+	DateLayout      = "2006-01-02"
+	TimestampLayout = "2006-01-02 15:04:05.999999999"
+)
+
+// A Column describes a column of query results.
+type Column struct {
+	Name string
+
+	// Type is the Athena type of the column, such as varchar, bigint,
+	// double, boolean, date, timestamp or decimal.
+	Type string
+}
+
+type datum struct {
+	VarCharValue *string
+}
+
+// A ResultSet is a page of the results of a query.
+type ResultSet struct {
+	Columns []Column
+
+	// Rows hold the values of the rows, nil for NULL.
+	Rows [][]*string
+}
+
+// GetQueryResults returns a page of up to max rows (MaxResults if zero) of
+// the results of the successful query execution id, from token, and the
+// token of the next page, or "" after the last page. The first row of the
+// results of SELECT queries holds the names of the columns.
+func (c *Client) GetQueryResults(ctx context.Context, id, token string, max int) (*ResultSet, string, error) {
+	if max <= 0 {
+		max = MaxResults
+	}
+	req := struct {
+		QueryExecutionId string
+		NextToken        string `json:",omitempty"`
+		MaxResults       int
+	}{id, token, max}
+	var resp struct {
+		ResultSet struct {
+			Rows []struct {
+				Data []datum
+			}
+			ResultSetMetadata struct {
+				ColumnInfo []Column
+			}
+		}
+		NextToken string
+	}
+	if err := c.do(ctx, "GetQueryResults", &req, &resp); err != nil {
+		return nil, "", err
+	}
+
+	rs := &ResultSet{Columns: resp.ResultSet.ResultSetMetadata.ColumnInfo}
+	for _, r := range resp.ResultSet.Rows {
+		row := make([]*string, len(r.Data))
+		for i, d := range r.Data {
+			row[i] = d.VarCharValue
+		}
+		rs.Rows = append(rs.Rows, row)
+	}
+	return rs, resp.NextToken, nil
+}
+
+// Rows iterates over the results of a query, fetching their pages as
+// needed:
+//
+//	rows := c.Results(q)
+//	for rows.Next(ctx) {
+//		var r Report
+//		if err := rows.Decode(&r); err != nil {
+//			...
+//		}
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+type Rows struct {
+	c      *Client
+	id     string
+	header bool // the first row holds the names of the columns
+
+	columns []Column
+	page    [][]*string
+	row     []*string
+	token   string
+	started bool
+	err     error
+}
+
+// Results returns the rows of the results of the successful query
+// execution q.
+func (c *Client) Results(q *QueryExecution) *Rows {
+	return &Rows{c: c, id: q.QueryExecutionId, header: q.StatementType == "DML"}
+}
+
+// Next advances to the next row, fetching the next page if needed, and
+// returns false after the last row or on failure.
+func (r *Rows) Next(ctx context.Context) bool {
+	for len(r.page) == 0 {
+		if r.err != nil || (r.started && r.token == "") {
+			return false
+		}
+		rs, token, err := r.c.GetQueryResults(ctx, r.id, r.token, 0)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		r.page, r.token = rs.Rows, token
+		if !r.started {
+			r.started, r.columns = true, rs.Columns
+			if r.header && len(r.page) > 0 {
+				r.page = r.page[1:]
+			}
+		}
+	}
+	r.row, r.page = r.page[0], r.page[1:]
+	return true
+}
+
+// Err returns the error that ended Next, if any.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Columns returns the columns of the results, once Next has been called.
+func (r *Rows) Columns() []Column {
+	return r.columns
+}
+
+// Values returns the values of the current row, nil for NULL.
+func (r *Rows) Values() []*string {
+	return r.row
+}
+
+// Scan stores the values of the current row in dest, pointers to the
+// values of its columns in order, which may be *string, *bool, integers,
+// floats, *time.Time for dates and timestamps, pointers to these for NULL
+// values, or *interface{} for the value of Value. NULL values are stored
+// as zero values otherwise.
+func (r *Rows) Scan(dest ...interface{}) error {
+	if len(dest) != len(r.row) {
+		return fmt.Errorf("athena: %d destinations for %d columns", len(dest), len(r.row))
+	}
+	for i, d := range dest {
+		v := reflect.ValueOf(d)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return errors.New("athena: Scan of a non-pointer")
+		}
+		if err := r.set(v.Elem(), i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode stores the current row in the struct pointed to by v, storing
+// each column in the field named by its `athena:"name"` tag, or else the
+// field whose name matches it regardless of case, as Scan. Columns
+// without a field are skipped.
+func (r *Rows) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("athena: Decode of a non-pointer to a struct")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := range r.row {
+		if i >= len(r.columns) {
+			break
+		}
+		name := r.columns[i].Name
+		for j := 0; j < rt.NumField(); j++ {
+			f := rt.Field(j)
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+			tag := f.Tag.Get("athena")
+			if tag == "-" || (tag != "" && tag != name) || (tag == "" && !strings.EqualFold(f.Name, name)) {
+				continue
+			}
+			if err := r.set(rv.Field(j), i); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// set stores the value of column i of the current row in v.
+func (r *Rows) set(v reflect.Value, i int) error {
+	s := r.row[i]
+	name, typ := strconv.Itoa(i), ""
+	if i < len(r.columns) {
+		name, typ = r.columns[i].Name, r.columns[i].Type
+	}
+	if s == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := r.set(p.Elem(), i); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Interface:
+		var x interface{}
+		if x, err = Value(*s, typ); err == nil {
+			if !reflect.TypeOf(x).AssignableTo(v.Type()) {
+				return fmt.Errorf("athena: cannot store column %s in %s", name, v.Type())
+			}
+			v.Set(reflect.ValueOf(x))
+		}
+	case reflect.String:
+		v.SetString(*s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(*s)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(*s, 10, v.Type().Bits())
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(*s, 10, v.Type().Bits())
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(*s, v.Type().Bits())
+		v.SetFloat(f)
+	default:
+		if v.Type() != timeType {
+			return fmt.Errorf("athena: cannot store column %s in %s", name, v.Type())
+		}
+		var t time.Time
+		t, err = parseTime(*s)
+		v.Set(reflect.ValueOf(t))
+	}
+	if err != nil {
+		return fmt.Errorf("athena: column %s: %v", name, err)
+	}
+	return nil
+}
+
+// parseTime parses a date or timestamp, with or without a time zone.
+func parseTime(s string) (time.Time, error) {
+	if len(s) == len(DateLayout) {
+		return time.Parse(DateLayout, s)
+	}
+	if i := strings.LastIndexByte(s, ' '); i > len(DateLayout) {
+		// timestamp with time zone, such as "... UTC" or "... Europe/Rome"
+		if loc, err := time.LoadLocation(s[i+1:]); err == nil {
+			return time.ParseInLocation(TimestampLayout, s[:i], loc)
+		}
+	}
+	return time.Parse(TimestampLayout, s)
+}
+
+// Value returns s, a value of the Athena type typ, as a Go value: an int64
+// for integers, a float64 for double and real, a bool for boolean, a
+// time.Time for dates and timestamps, and a string otherwise, including
+// decimal, to keep its precision.
+func Value(s, typ string) (interface{}, error) {
+	switch typ {
+	case "tinyint", "smallint", "integer", "int", "bigint":
+		return strconv.ParseInt(s, 10, 64)
+	case "double", "float", "real":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		return strconv.ParseBool(s)
+	case "date", "timestamp", "timestamp with time zone":
+		return parseTime(s)
+	}
+	return s, nil
+}
@@ -0,0 +1,78 @@
+package aws4
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A SignEvent describes a request signed by a Service, to attribute the
+// calls made with a set of keys. It holds nothing secret: not the secret
+// key, session token or signature.
+type SignEvent struct {
+	// Time is the signing time of the request.
+	Time time.Time
+
+	AccessKey string
+	Service   string
+	Region    string
+	Method    string
+	Host      string
+	Path      string
+
+	SignedHeaders []string
+
+	// CanonicalRequestHash is the hex SHA-256 of the canonical request, as
+	// in the string to sign, which AWS reports in signature mismatch errors
+	// and can be matched with CloudTrail.
+	CanonicalRequestHash string
+
+	// Presigned is true for requests signed by Presign.
+	Presigned bool
+}
+
+func (s *Service) signEvent(keys *Keys, t time.Time, r *http.Request, hs []string, crh [2 * sha256.Size]byte, presigned bool) *SignEvent {
+	return &SignEvent{
+		Time:                 t,
+		AccessKey:            keys.AccessKey,
+		Service:              s.Name,
+		Region:               s.Region,
+		Method:               r.Method,
+		Host:                 r.Host,
+		Path:                 r.URL.Path,
+		SignedHeaders:        hs,
+		CanonicalRequestHash: string(crh[:]),
+		Presigned:            presigned,
+	}
+}
+
+// An AuditLog writes SignEvents as JSON lines. It is safe for concurrent
+// use:
+//
+//	log := aws4.NewAuditLog(f)
+//	client.OnSign = log.Record
+type AuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+
+	// OnError, if not nil, is called when writing an event fails.
+	OnError func(error)
+}
+
+// NewAuditLog returns an AuditLog writing to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{enc: json.NewEncoder(w)}
+}
+
+// Record writes e.
+func (l *AuditLog) Record(e *SignEvent) {
+	l.mu.Lock()
+	err := l.enc.Encode(e)
+	l.mu.Unlock()
+	if err != nil && l.OnError != nil {
+		l.OnError(err)
+	}
+}
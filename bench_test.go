@@ -2,7 +2,10 @@ package aws4
 
 import (
 	"bytes"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,3 +33,64 @@ func BenchmarkSign(b *testing.B) {
 		s.Sign(k, r)
 	}
 }
+
+func benchRequest() *http.Request {
+	r, _ := http.NewRequest("POST", "https://dynamodb.us-east-1.amazonaws.com/", nil)
+	r.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	r.Header.Set("X-Amz-Target", "DynamoDB_20120810.GetItem")
+	r.Header.Set("X-Amz-Date", time.Now().UTC().Format(iSO8601BasicFormat))
+	r.Header.Set("X-Amz-Content-Sha256", EmptyPayloadHash)
+	return r
+}
+
+var benchKeys = &Keys{
+	AccessKey: "AKIDEXAMPLE",
+	SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+func BenchmarkSignDynamoDB(b *testing.B) {
+	r := benchRequest()
+	s := &Service{Name: "dynamodb", Region: "us-east-1"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Sign(benchKeys, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignDynamoDBBody(b *testing.B) {
+	body := []byte(`{"TableName":"T","Key":{"id":{"S":"a"}}}`)
+	s := &Service{Name: "dynamodb", Region: "us-east-1"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := benchRequest()
+		r.Header.Del("X-Amz-Content-Sha256")
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		if err := s.Sign(benchKeys, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkClientDo(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	c := &Client{Keys: benchKeys}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, _ := http.NewRequest("POST", srv.URL, strings.NewReader(`{}`))
+		resp, err := c.DoService("dynamodb", "us-east-1", r)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+}
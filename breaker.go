@@ -0,0 +1,194 @@
+package aws4
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker for requests to a host whose
+// circuit is open.
+var ErrCircuitOpen = errors.New("aws4: circuit breaker open")
+
+// Defaults for CircuitBreaker.
+const (
+	DefaultFailureRate = 0.5
+	DefaultMinRequests = 10
+	DefaultWindow      = 10 * time.Second
+	DefaultCooldown    = 30 * time.Second
+)
+
+// Circuit states, as reported by CircuitBreaker.State.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// A CircuitBreaker is an http.RoundTripper that fails fast with
+// ErrCircuitOpen while a host is misbehaving, so that requests to a bad
+// regional endpoint don't tie up connections and goroutines. Use it as the
+// Transport of a Client's http.Client:
+//
+//	c := &aws4.Client{Keys: keys, Client: &http.Client{
+//		Transport: &aws4.CircuitBreaker{},
+//	}}
+//
+// Each host has its own circuit. A closed circuit opens when, within Window,
+// at least MinRequests requests were made and the proportion of failures
+// reached FailureRate. After Cooldown an open circuit turns half-open and
+// lets a single probe request through: if it succeeds the circuit closes,
+// otherwise it opens again.
+type CircuitBreaker struct {
+	// Transport makes the requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// FailureRate, MinRequests, Window and Cooldown default to
+	// DefaultFailureRate, DefaultMinRequests, DefaultWindow and
+	// DefaultCooldown if zero.
+	FailureRate float64
+	MinRequests int
+	Window      time.Duration
+	Cooldown    time.Duration
+
+	// IsFailure reports whether a request failed. If nil, transport errors
+	// and 5xx responses are failures. Requests whose context was cancelled
+	// are never counted.
+	IsFailure func(resp *http.Response, err error) bool
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	state    string
+	start    time.Time // of the current window, or when the circuit opened
+	requests int
+	failures int
+	probing  bool
+}
+
+// State returns the state of the circuit of host.
+func (b *CircuitBreaker) State(host string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(host, time.Now())
+	return c.state
+}
+
+func (b *CircuitBreaker) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := r.URL.Host
+	probe, err := b.allow(host)
+	if err != nil {
+		return nil, err
+	}
+
+	t := b.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	resp, err := t.RoundTrip(r)
+
+	if r.Context().Err() != nil {
+		if probe {
+			b.mu.Lock()
+			b.hosts[host].probing = false
+			b.mu.Unlock()
+		}
+		return resp, err
+	}
+
+	failed := err != nil || resp.StatusCode >= 500
+	if b.IsFailure != nil {
+		failed = b.IsFailure(resp, err)
+	}
+	b.record(host, probe, failed)
+	return resp, err
+}
+
+// allow reports whether a request to host may be sent, and whether it is
+// the probe of a half-open circuit.
+func (b *CircuitBreaker) allow(host string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host, time.Now())
+	switch {
+	case c.state == CircuitClosed:
+		return false, nil
+	case c.state == CircuitHalfOpen && !c.probing:
+		c.probing = true
+		return true, nil
+	}
+	return false, ErrCircuitOpen
+}
+
+func (b *CircuitBreaker) record(host string, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	c := b.circuit(host, now)
+	if probe {
+		c.probing = false
+		if failed {
+			c.state, c.start = CircuitOpen, now
+		} else {
+			*c = circuit{state: CircuitClosed, start: now}
+		}
+		return
+	}
+	if c.state != CircuitClosed {
+		return
+	}
+
+	c.requests++
+	if failed {
+		c.failures++
+	}
+	min := b.MinRequests
+	if min <= 0 {
+		min = DefaultMinRequests
+	}
+	rate := b.FailureRate
+	if rate <= 0 {
+		rate = DefaultFailureRate
+	}
+	if c.requests >= min && float64(c.failures) >= rate*float64(c.requests) {
+		c.state, c.start = CircuitOpen, now
+	}
+}
+
+// circuit returns the circuit of host, updated for the current time. b.mu
+// must be held.
+func (b *CircuitBreaker) circuit(host string, now time.Time) *circuit {
+	if b.hosts == nil {
+		b.hosts = make(map[string]*circuit)
+	}
+	c := b.hosts[host]
+	if c == nil {
+		c = &circuit{state: CircuitClosed, start: now}
+		b.hosts[host] = c
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		window := b.Window
+		if window <= 0 {
+			window = DefaultWindow
+		}
+		if now.Sub(c.start) >= window {
+			c.start, c.requests, c.failures = now, 0, 0
+		}
+	case CircuitOpen:
+		cooldown := b.Cooldown
+		if cooldown <= 0 {
+			cooldown = DefaultCooldown
+		}
+		if now.Sub(c.start) >= cooldown {
+			c.state = CircuitHalfOpen
+		}
+	}
+	return c
+}
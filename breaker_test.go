@@ -0,0 +1,67 @@
+package aws4
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestCircuitBreaker(t *testing.T) {
+	var fail bool
+	var calls int
+	b := &CircuitBreaker{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			if fail {
+				return nil, errors.New("connection reset")
+			}
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}),
+		MinRequests: 4,
+		Cooldown:    10 * time.Millisecond,
+	}
+	do := func(url string) error {
+		r, _ := http.NewRequest("GET", url, nil)
+		_, err := b.RoundTrip(r)
+		return err
+	}
+
+	const bad = "https://dynamodb.us-east-1.amazonaws.com/"
+	do(bad)
+	fail = true
+	for i := 0; i < 3; i++ {
+		do(bad)
+	}
+	if s := b.State("dynamodb.us-east-1.amazonaws.com"); s != CircuitOpen {
+		t.Fatalf("state = %s, want open", s)
+	}
+	calls = 0
+	if err := do(bad); err != ErrCircuitOpen || calls != 0 {
+		t.Errorf("open circuit: err = %v after %d calls", err, calls)
+	}
+	if s := b.State("dynamodb.us-west-2.amazonaws.com"); s != CircuitClosed {
+		t.Errorf("other host state = %s, want closed", s)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := do(bad); err == nil || err == ErrCircuitOpen {
+		t.Errorf("failed probe: err = %v", err)
+	}
+	if s := b.State("dynamodb.us-east-1.amazonaws.com"); s != CircuitOpen {
+		t.Errorf("state after failed probe = %s, want open", s)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	fail = false
+	if err := do(bad); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.State("dynamodb.us-east-1.amazonaws.com"); s != CircuitClosed {
+		t.Errorf("state after probe = %s, want closed", s)
+	}
+}
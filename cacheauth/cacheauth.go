@@ -0,0 +1,103 @@
+// Package cacheauth builds the tokens that authenticate to ElastiCache for
+// Redis and MemoryDB with IAM, signed with github.com/raff/aws4.
+package cacheauth
+
+import (
+	"context"
+	"errors"
+	"github.com/raff/aws4"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Services of TokenSource.
+const (
+	ElastiCache = "elasticache"
+	MemoryDB    = "memorydb"
+)
+
+// TokenExpiry is how long tokens are valid. A token is only checked when a
+// connection is opened or re-authenticated.
+const TokenExpiry = 15 * time.Minute
+
+// refreshBefore is how long before their expiry tokens are replaced.
+const refreshBefore = 5 * time.Minute
+
+// A TokenSource builds the tokens of a user of a cache, for use as the
+// password of Redis clients, such as in their credentials callbacks. It
+// reuses a token until shortly before it expires, and is safe for
+// concurrent use.
+type TokenSource struct {
+	// Service is ElastiCache or MemoryDB. If empty, ElastiCache is used.
+	Service string
+
+	// Name is the ID of the ElastiCache replication group or serverless
+	// cache, or the name of the MemoryDB cluster.
+	Name string
+
+	// Serverless must be set for ElastiCache serverless caches.
+	Serverless bool
+
+	Region string
+
+	// User is the user ID, which is also the user name of the connection.
+	User string
+
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// BuildAuthToken returns a new token signed with keys.
+func (s *TokenSource) BuildAuthToken(keys *aws4.Keys) (string, error) {
+	if s.Name == "" || s.User == "" || s.Region == "" {
+		return "", errors.New("cacheauth: Name, User and Region are required")
+	}
+	service := s.Service
+	if service == "" {
+		service = ElastiCache
+	}
+	q := url.Values{"Action": {"connect"}, "User": {strings.ToLower(s.User)}}
+	if s.Serverless {
+		q.Set("ResourceType", "ServerlessCache")
+	}
+	r, err := http.NewRequest("GET", "http://"+strings.ToLower(s.Name)+"/?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if err := aws4.PresignService(service, s.Region, keys, r, TokenExpiry); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(r.URL.String(), "http://"), nil
+}
+
+// Credentials returns the user name and a token to authenticate with,
+// signed with the current keys of the Client.
+func (s *TokenSource) Credentials(ctx context.Context) (user, password string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires.Add(-refreshBefore)) {
+		return s.User, s.token, nil
+	}
+
+	cl := s.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+	keys, err := cl.CurrentKeys(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := s.BuildAuthToken(keys)
+	if err != nil {
+		return "", "", err
+	}
+	s.token, s.expires = token, time.Now().Add(TokenExpiry)
+	return s.User, token, nil
+}
@@ -0,0 +1,43 @@
+package cacheauth_test
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/cacheauth"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTokenSource(t *testing.T) {
+	s := &cacheauth.TokenSource{
+		Name:       "My-Cache",
+		Serverless: true,
+		Region:     "us-east-1",
+		User:       "app",
+		Client:     &aws4.Client{Keys: &aws4.Keys{AccessKey: "AKID", SecretKey: "secret"}},
+	}
+	user, token, err := s.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "app" || !strings.HasPrefix(token, "my-cache/?") {
+		t.Fatalf("credentials = %s, %s", user, token)
+	}
+	u, _ := url.Parse("http://" + token)
+	q := u.Query()
+	if q.Get("Action") != "connect" || q.Get("User") != "app" || q.Get("ResourceType") != "ServerlessCache" ||
+		!strings.HasSuffix(q.Get("X-Amz-Credential"), "/us-east-1/elasticache/aws4_request") || q.Get("X-Amz-Expires") != "900" {
+		t.Errorf("token = %s", token)
+	}
+
+	if _, again, _ := s.Credentials(context.Background()); again != token {
+		t.Error("token not reused")
+	}
+
+	s = &cacheauth.TokenSource{Service: cacheauth.MemoryDB, Name: "cluster", Region: "eu-west-1", User: "app"}
+	token, err = s.BuildAuthToken(&aws4.Keys{AccessKey: "AKID", SecretKey: "secret"})
+	if err != nil || strings.Contains(token, "ResourceType") || !strings.Contains(token, "%2Fmemorydb%2F") {
+		t.Errorf("MemoryDB token = %s, %v", token, err)
+	}
+}
@@ -1,30 +1,115 @@
 package aws4
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 var DefaultClient = &Client{Keys: KeysFromEnvironment()}
 
 // Initializes and returns a Keys using the AWS_ACCESS_KEY and AWS_SECRET_KEY
-// environment variables.
+// environment variables, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, and
+// AWS_SESSION_TOKEN.
 func KeysFromEnvironment() *Keys {
-	return &Keys{
-		AccessKey: os.Getenv("AWS_ACCESS_KEY"),
-		SecretKey: os.Getenv("AWS_SECRET_KEY"),
+	env := make(map[string]string)
+	for _, name := range []string{"AWS_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		env[name] = os.Getenv(name)
 	}
+	return KeysFromMap(env)
 }
 
 // Client is like http.Client, but signs all requests using Keys.
 type Client struct {
 	Keys *Keys
 
+	// Service and Region, if not empty, are used by Do and DoAuto in place
+	// of the ones inferred from request URLs.
+	Service string
+	Region  string
+
+	// Credentials, if not nil, supplies the keys to sign with in place of
+	// Keys, refreshing them as they expire.
+	Credentials *Credentials
+
 	// The http client to make requests with. If nil, http.DefaultClient is used.
 	Client *http.Client
+
+	// MaxConcurrentRequests, if not zero, limits the number of requests in
+	// flight. A request holds its slot until its response body is closed.
+	// Other requests wait for a slot until their context is done or, if
+	// QueueTimeout is not zero, fail with ErrQueueTimeout after waiting
+	// QueueTimeout.
+	MaxConcurrentRequests int
+	QueueTimeout          time.Duration
+
+	// OnRequest, if not nil, is called after every request with its
+	// metrics, such as to publish them with cloudwatch.Sink.
+	OnRequest func(*RequestMetrics)
+
+	// OnSign, if not nil, is called with every request the Client signs,
+	// such as to keep an AuditLog of the calls made with its keys.
+	OnSign func(*SignEvent)
+
+	// XRay, if not nil, sends an X-Ray subsegment for every request made
+	// within a sampled trace. The trace header of requests (see WithTrace)
+	// is propagated either way.
+	XRay *XRayEmitter
+
+	// UnsignedPayload skips hashing the body of HTTPS requests to services
+	// whose Profile allows it, such as S3, to save reading large uploads
+	// twice.
+	UnsignedPayload bool
+
+	// StreamingTrailer sends the body of HTTPS requests to services whose
+	// Profile allows it, such as S3, with its hash computed as it is sent,
+	// in a trailer, so that uploads are read once but still verified. The
+	// ContentLength of requests with a body must be known.
+	StreamingTrailer bool
+
+	// BehindProxy signs only StableHeaders besides the headers always
+	// signed, and never ProxyHeaders, for requests sent through proxies
+	// that add headers such as Via and X-Forwarded-For, or rewrite others
+	// such as User-Agent and Accept-Encoding, which would break their
+	// signature. TLS-intercepting proxies can do so with HTTPS requests
+	// too. See NewProxyTransport for sending requests through a proxy.
+	BehindProxy bool
+
+	// FIPS sends requests to AWS endpoints to their FIPS 140 endpoint (see
+	// FIPSHost). Hosts EndpointInfo doesn't know, or that are registered
+	// with RegisterEndpoint, are left as they are. Build with
+	// GOEXPERIMENT=boringcrypto for the signing and TLS to use a FIPS
+	// validated module too (see BoringCrypto).
+	FIPS bool
+
+	// UserAgent builds the User-Agent header of requests that don't set
+	// one. If nil, a UserAgent with no AppID or Features is used.
+	UserAgent *UserAgent
+
+	// DisableDecompression makes the Client ask for uncompressed responses
+	// and return responses as they are sent. Otherwise it asks for gzip or
+	// deflate responses, with a signed Accept-Encoding header, and
+	// decompresses them. Requests that set Accept-Encoding, and requests to
+	// services whose Profile has DisableDecompression, such as S3, are never
+	// decompressed.
+	DisableDecompression bool
+
+	// MaxResponseSize, if not zero, limits the size of response bodies,
+	// after decompression. Reading past it fails with a
+	// *ResponseTooLargeError, as do requests whose response declares a
+	// larger Content-Length.
+	MaxResponseSize int64
+
+	semOnce sync.Once
+	sem     Semaphore
 }
 
 // Post works like http.Post, but signs the request with Keys.
@@ -44,18 +129,249 @@ func (c *Client) client() *http.Client {
 	return c.Client
 }
 
+// RequestMetrics describes a request made by a Client.
+type RequestMetrics struct {
+	Service string
+	Region  string
+	Method  string
+	Host    string
+
+	// StatusCode is 0 if the request failed without a response, with Err.
+	StatusCode int
+	Err        error
+
+	// Latency is the time until the response headers were read, including
+	// any wait for a MaxConcurrentRequests slot.
+	Latency time.Duration
+
+	// RetryAfter is the delay requested by the Retry-After header of an
+	// error response, which retrying callers honor in place of their
+	// backoff, or 0.
+	RetryAfter time.Duration
+}
+
+// do sends a signed request, within the MaxConcurrentRequests limit.
+func (c *Client) do(service, region string, req *http.Request) (resp *http.Response, err error) {
+	if c.OnRequest != nil {
+		start := time.Now()
+		defer func() {
+			m := &RequestMetrics{
+				Service: service,
+				Region:  region,
+				Method:  req.Method,
+				Host:    req.URL.Host,
+				Err:     err,
+				Latency: time.Since(start),
+			}
+			if resp != nil {
+				m.StatusCode = resp.StatusCode
+				if resp.StatusCode/100 != 2 {
+					m.RetryAfter = RetryAfter(resp.Header)
+				}
+			}
+			c.OnRequest(m)
+		}()
+	}
+
+	c.semOnce.Do(func() {
+		if c.MaxConcurrentRequests > 0 {
+			c.sem = NewSemaphore(c.MaxConcurrentRequests)
+		}
+	})
+	if err := c.sem.Acquire(req.Context(), c.QueueTimeout); err != nil {
+		return nil, err
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		ua := c.UserAgent
+		if ua == nil {
+			ua = defaultUserAgent
+		}
+		req.Header.Set("User-Agent", ua.String())
+	}
+	if end := c.XRay.begin(service, region, req); end != nil {
+		defer func() { end(resp, err) }()
+	}
+
+	resp, err = c.client().Do(req)
+	if err != nil {
+		c.sem.Release()
+		// Errors of a canceled request are the caller's own, and kept.
+		if req.Context().Err() == nil {
+			err = ClassifyError(err)
+		}
+		return nil, err
+	}
+	resp.Body = c.sem.ReleaseOnClose(resp.Body)
+	return resp, nil
+}
+
+// CurrentKeys returns the keys requests are signed with: the current keys of
+// Credentials if set, or else Keys.
+func (c *Client) CurrentKeys(ctx context.Context) (*Keys, error) {
+	if c.Credentials != nil {
+		return c.Credentials.Keys(ctx)
+	}
+	return c.Keys, nil
+}
+
+// DoService signs req for the service name in region, applying the Profile
+// of the service, and sends it.
 func (c *Client) DoService(name, region string, req *http.Request) (resp *http.Response, err error) {
-	if err := SignService(name, region, c.Keys, req); err != nil {
+	keys, err := c.CurrentKeys(req.Context())
+	if err != nil {
 		return nil, err
 	}
-	return c.client().Do(req)
+	if c.FIPS {
+		if err := fipsRequest(req); err != nil {
+			return nil, err
+		}
+	}
+	p := ProfileFor(name)
+	sv := p.Service(name, region)
+	sv.UnsignedPayload = c.UnsignedPayload && p.AllowUnsignedPayload && req.URL.Scheme == "https"
+	sv.StreamingTrailer = c.StreamingTrailer && p.AllowStreamingTrailer && req.URL.Scheme == "https"
+	sv.OnSign = c.OnSign
+	// The trace header is set or rewritten after signing, by c.do.
+	sv.UnsignedHeaders = append(append([]string(nil), sv.UnsignedHeaders...), TraceHeader)
+	if c.BehindProxy {
+		sv.SignedHeaders = StableHeaders
+		sv.UnsignedHeaders = append(sv.UnsignedHeaders, ProxyHeaders...)
+	}
+
+	// Accept-Encoding is set before signing, since it is signed, and keeps
+	// http.Transport from adding its own and decompressing responses.
+	decompress := false
+	if req.Header.Get("Accept-Encoding") == "" {
+		decompress = !c.DisableDecompression && !p.DisableDecompression
+		if decompress {
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+		} else {
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+	}
+	if err := sv.Sign(keys, req); err != nil {
+		return nil, err
+	}
+	resp, err = c.do(name, region, req)
+	if err == nil && decompress {
+		err = decompressBody(req, resp)
+	}
+	if err == nil && c.MaxResponseSize > 0 {
+		if resp.ContentLength > c.MaxResponseSize {
+			resp.Body.Close()
+			return nil, &ResponseTooLargeError{Limit: c.MaxResponseSize, ContentLength: resp.ContentLength}
+		}
+		resp.Body = LimitBody(resp.Body, c.MaxResponseSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// A ResponseTooLargeError is returned when a response body exceeds a size
+// limit, such as Client.MaxResponseSize.
+type ResponseTooLargeError struct {
+	Limit int64
+
+	// ContentLength is the length the response declared, or -1 if the body
+	// was cut short while being read.
+	ContentLength int64
 }
 
+func (e *ResponseTooLargeError) Error() string {
+	if e.ContentLength < 0 {
+		return fmt.Sprintf("aws4: response body larger than %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("aws4: response body of %d bytes larger than %d", e.ContentLength, e.Limit)
+}
+
+// LimitBody returns rc, reading at most limit bytes of it. Reading more
+// fails with a *ResponseTooLargeError.
+func LimitBody(rc io.ReadCloser, limit int64) io.ReadCloser {
+	return &limitedBody{ReadCloser: rc, limit: limit}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	limit, n int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n > b.limit {
+		return 0, &ResponseTooLargeError{Limit: b.limit, ContentLength: -1}
+	}
+	// Read a byte more than allowed to tell a body of exactly the limit
+	// from a larger one.
+	if left := b.limit - b.n + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.n > b.limit {
+		// Only the extra byte can be past the limit.
+		return n - 1, &ResponseTooLargeError{Limit: b.limit, ContentLength: -1}
+	}
+	return n, err
+}
+
+// decompressBody replaces the body of a gzip or deflate response with its
+// decompressed content, as http.Transport does for the requests it adds
+// Accept-Encoding to.
+func decompressBody(req *http.Request, resp *http.Response) error {
+	if req.Method == "HEAD" || resp.ContentLength == 0 {
+		return nil
+	}
+	var r io.Reader
+	var err error
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		r, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		r, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{r, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// Do is DoAuto.
 func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
-	if err := Sign(c.Keys, req); err != nil {
-		return nil, err
+	return c.DoAuto(req)
+}
+
+// DoAuto signs and sends req, inferring the service and region from the
+// host of req.URL with EndpointInfo, unless the Service and Region fields
+// of c are set. Hosts EndpointInfo doesn't know, such as local emulators,
+// need those fields or RegisterEndpoint.
+func (c *Client) DoAuto(req *http.Request) (resp *http.Response, err error) {
+	service, region := c.Service, c.Region
+	if service == "" || region == "" {
+		e, err := EndpointInfo(req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		if service == "" {
+			service = e.Service
+		}
+		if region == "" {
+			region = e.Region
+		}
 	}
-	return c.client().Do(req)
+	return c.DoService(service, region, req)
 }
 
 func (c *Client) Get(url string) (resp *http.Response, err error) {
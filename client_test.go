@@ -0,0 +1,340 @@
+package aws4
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDoAuto(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	c := &Client{Keys: testKeys}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := c.DoAuto(req); err == nil {
+		t.Error("unknown host: no error")
+	}
+
+	c.Service, c.Region = "execute-api", "eu-west-1"
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	resp, err := c.DoAuto(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(auth, "/eu-west-1/execute-api/aws4_request") {
+		t.Errorf("Authorization = %s", auth)
+	}
+}
+
+func TestDecompression(t *testing.T) {
+	var acceptEncoding, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding, auth = r.Header.Get("Accept-Encoding"), r.Header.Get("Authorization")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(`{"ok":true}`))
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	c := &Client{Keys: testKeys}
+	get := func(service string) string {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		resp, err := c.DoService(service, "us-east-1", req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	if b := get("dynamodb"); b != `{"ok":true}` {
+		t.Errorf("body = %q", b)
+	}
+	if acceptEncoding != "gzip, deflate" || !strings.Contains(auth, "accept-encoding") {
+		t.Errorf("Accept-Encoding = %q, Authorization = %s", acceptEncoding, auth)
+	}
+	if b := get("s3"); b == `{"ok":true}` {
+		t.Error("S3 response decompressed")
+	}
+	c.DisableDecompression = true
+	if b := get("dynamodb"); b == `{"ok":true}` {
+		t.Error("response decompressed with DisableDecompression")
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	c := &Client{Keys: testKeys, MaxResponseSize: 100}
+	get := func(path string) ([]byte, error) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		resp, err := c.DoService("execute-api", "us-east-1", req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	if b, err := get("/chunked"); err != nil || len(b) != 100 {
+		t.Errorf("body of the limit: %d bytes, %v", len(b), err)
+	}
+	c.MaxResponseSize = 99
+	if _, err := get("/"); err == nil || err.(*ResponseTooLargeError).ContentLength != 100 {
+		t.Errorf("declared length: err = %v", err)
+	}
+	b, err := get("/chunked")
+	if e, ok := err.(*ResponseTooLargeError); !ok || e.Limit != 99 || len(b) != 99 {
+		t.Errorf("chunked: %d bytes, err = %v", len(b), err)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	body := LimitBody(ioutil.NopCloser(strings.NewReader("0123456789")), 8)
+	p := make([]byte, 4)
+	var got []int
+	for i := 0; i < 5; i++ {
+		n, err := body.Read(p)
+		got = append(got, n)
+		if i < 2 && err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if i >= 2 {
+			if e, ok := err.(*ResponseTooLargeError); !ok || e.Limit != 8 {
+				t.Errorf("read %d: err = %v", i, err)
+			}
+		}
+	}
+	if want := []int{4, 4, 0, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counts = %v, want %v", got, want)
+	}
+}
+
+func TestConnErrors(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer reset.Close()
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+
+	c := &Client{Keys: testKeys}
+	for _, tt := range []struct {
+		url        string
+		kind       ConnErrorKind
+		connecting bool
+		terminal   bool
+	}{
+		{"http://" + addr, ConnRefused, true, false},
+		{reset.URL, ConnReset, false, false},
+		{tlsSrv.URL, ConnTLS, true, true},
+	} {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		_, err := c.DoService("execute-api", "us-east-1", req)
+		var ce *ConnError
+		if !errors.As(err, &ce) || ce.Kind != tt.kind || ce.Connecting != tt.connecting || ce.Terminal != tt.terminal {
+			t.Errorf("%s: err = %#v", tt.url, err)
+			continue
+		}
+		if ce.Retryable(false) != (tt.connecting && !tt.terminal) || ce.Retryable(true) == tt.terminal {
+			t.Errorf("%s: wrong retryability", tt.url)
+		}
+	}
+
+	dns := ClassifyError(&url.Error{Op: "Get", URL: "https://x.invalid", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "x.invalid", IsNotFound: true}}})
+	if dns.Kind != ConnDNS || !dns.Terminal {
+		t.Errorf("DNS error = %#v", dns)
+	}
+	dial := ClassifyError(&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded})
+	read := ClassifyError(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded})
+	if dial.Kind != ConnTimeout || !dial.Connecting || read.Kind != ConnTimeout || read.Connecting {
+		t.Errorf("timeouts = %#v, %#v", dial, read)
+	}
+}
+
+func TestLambdaClient(t *testing.T) {
+	for k, v := range map[string]string{
+		"AWS_LAMBDA_FUNCTION_NAME": "fn",
+		"AWS_ACCESS_KEY_ID":        "AKID",
+		"AWS_SECRET_ACCESS_KEY":    "SECRET",
+		"AWS_SESSION_TOKEN":        "TOKEN",
+		"AWS_SDK_UA_APP_ID":        "",
+	} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	if !InLambda() {
+		t.Error("not in Lambda")
+	}
+	c := NewLambdaClient()
+	if c.Keys.AccessKey != "AKID" || c.Keys.SecretKey != "SECRET" || c.Keys.SessionToken != "TOKEN" {
+		t.Errorf("keys %+v", c.Keys)
+	}
+	if tr := c.Client.Transport.(*http.Transport); tr.TLSHandshakeTimeout != LambdaDialTimeout {
+		t.Errorf("TLSHandshakeTimeout = %v", tr.TLSHandshakeTimeout)
+	}
+	if ua := c.UserAgent.String(); !strings.Contains(ua, "app/fn") {
+		t.Errorf("User-Agent = %s", ua)
+	}
+	if LambdaClient() != LambdaClient() {
+		t.Error("LambdaClient not shared")
+	}
+}
+
+func TestClientSet(t *testing.T) {
+	assumed := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sts" {
+			w.Write([]byte(r.Header.Get("Authorization")))
+			return
+		}
+		r.ParseForm()
+		arn := r.PostForm.Get("RoleArn")
+		assumed[arn]++
+		w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>AK` + arn[len(arn)-1:] + `</AccessKeyId><SecretAccessKey>S</SecretAccessKey><SessionToken>T</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer srv.Close()
+
+	set := &ClientSet{Client: &Client{Keys: &Keys{AccessKey: "BASE", SecretKey: "S"}}, STSURL: srv.URL + "/sts", MaxClients: 2}
+	key := func(n string) AccountKey {
+		return AccountKey{RoleArn: "arn:aws:iam::12345678901" + n + ":role/r" + n, Region: "eu-west-1"}
+	}
+	get := func(cl *Client) string {
+		r, _ := http.NewRequest("GET", srv.URL+"/", nil)
+		resp, err := cl.DoService("sqs", "eu-west-1", r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	a := set.Get(key("1"))
+	if set.Get(key("1")) != a || a.Region != "eu-west-1" {
+		t.Error("client of key 1 not cached")
+	}
+	if auth := get(a); !strings.Contains(auth, "Credential=AK1/") {
+		t.Errorf("Authorization = %s", auth)
+	}
+	if auth := get(set.Get(key("2"))); !strings.Contains(auth, "Credential=AK2/") {
+		t.Errorf("Authorization = %s", auth)
+	}
+	get(a)
+	if assumed[key("1").RoleArn] != 1 {
+		t.Errorf("assumed %v", assumed)
+	}
+	set.Expire(key("1"))
+	get(a)
+	if assumed[key("1").RoleArn] != 2 {
+		t.Errorf("assumed after Expire %v", assumed)
+	}
+
+	// Key 2 is the least recently used.
+	set.Get(key("1"))
+	set.Get(key("3"))
+	if set.Get(key("1")) != a {
+		t.Error("key 1 dropped")
+	}
+	set.Remove(key("1"))
+	if set.Get(key("1")) == a {
+		t.Error("key 1 not removed")
+	}
+}
+
+func TestBehindProxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer target.Close()
+
+	var connects int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			t.Errorf("proxy got %s", r.Method)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) || r.Header.Get("X-Proxy-Token") != "token" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		connects++
+		dst, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		src, buf, _ := w.(http.Hijacker).Hijack()
+		buf.WriteString("HTTP/1.1 200 OK\r\n\r\n")
+		buf.Flush()
+		go func() {
+			io.Copy(dst, src)
+			dst.Close()
+		}()
+		io.Copy(src, dst)
+		src.Close()
+	}))
+	defer proxy.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	u.User = url.UserPassword("user", "pass")
+	tr, err := NewProxyTransport(u.String(), http.Header{"X-Proxy-Token": {"token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.TLSClientConfig = target.Client().Transport.(*http.Transport).TLSClientConfig
+	c := &Client{Keys: testKeys, BehindProxy: true, Client: &http.Client{Transport: tr}}
+
+	r, _ := http.NewRequest("GET", target.URL+"/key", nil)
+	r.Header.Set("Range", "bytes=0-9")
+	r.Header.Set("Via", "1.1 proxy")
+	resp, err := c.DoService("s3", "us-east-1", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(b), "SignedHeaders=date;host;range;x-amz-content-sha256,") {
+		t.Errorf("Authorization = %s", b)
+	}
+	if connects != 1 {
+		t.Errorf("%d CONNECTs", connects)
+	}
+}
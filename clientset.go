@@ -0,0 +1,125 @@
+package aws4
+
+import (
+	"sync"
+	"time"
+)
+
+// An AccountKey identifies the Clients of a ClientSet: the role they assume
+// and the region they sign for.
+type AccountKey struct {
+	RoleArn string
+
+	// ExternalID, if not empty, is the external ID the role's trust policy
+	// requires, as customers usually set for third parties.
+	ExternalID string
+
+	// Region is the region of requests sent with Do and DoAuto, and of the
+	// STS endpoint the role is assumed with.
+	Region string
+}
+
+// A ClientSet makes and caches Clients signing with the temporary keys of
+// IAM roles, such as the roles customers of a SaaS backend create in their
+// accounts. The keys of each role are assumed on first use and again
+// before they expire. It is safe for concurrent use.
+//
+//	set := &aws4.ClientSet{SessionName: "backend"}
+//	cl := set.Get(aws4.AccountKey{RoleArn: arn, ExternalID: id, Region: "eu-west-1"})
+type ClientSet struct {
+	// Client assumes the roles. If nil, DefaultClient is used.
+	Client *Client
+
+	// NewClient, if not nil, returns the Client of key, which must sign
+	// with creds, such as to set its http.Client or OnRequest. Otherwise
+	// the Client of key only has creds, Region and the http.Client of
+	// Client.
+	NewClient func(key AccountKey, creds *Credentials) *Client
+
+	// SessionName and Duration are those of the AssumeRoleProviders.
+	SessionName string
+	Duration    time.Duration
+
+	// If empty, the STS endpoint of the Region of a key is used.
+	STSURL string
+
+	// MaxClients, if not zero, limits the number of Clients kept; the least
+	// recently used one is dropped to make room for a new one.
+	MaxClients int
+
+	mu      sync.Mutex
+	clients map[AccountKey]*clientSetEntry
+}
+
+type clientSetEntry struct {
+	client   *Client
+	creds    *Credentials
+	lastUsed time.Time
+}
+
+// Get returns the Client of key, making it if needed. Its keys are only
+// assumed when it first signs a request, so that errors (such as a role
+// that can't be assumed) are returned by requests.
+func (s *ClientSet) Get(key AccountKey) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.clients[key]; ok {
+		e.lastUsed = time.Now()
+		return e.client
+	}
+
+	base := s.Client
+	if base == nil {
+		base = DefaultClient
+	}
+	creds := NewCredentials(&AssumeRoleProvider{
+		Client:      base,
+		RoleArn:     key.RoleArn,
+		SessionName: s.SessionName,
+		ExternalID:  key.ExternalID,
+		Duration:    s.Duration,
+		Region:      key.Region,
+		STSURL:      s.STSURL,
+	})
+	var cl *Client
+	if s.NewClient != nil {
+		cl = s.NewClient(key, creds)
+	} else {
+		cl = &Client{Credentials: creds, Region: key.Region, Client: base.Client}
+	}
+
+	if s.clients == nil {
+		s.clients = make(map[AccountKey]*clientSetEntry)
+	}
+	if s.MaxClients > 0 && len(s.clients) >= s.MaxClients {
+		var oldest AccountKey
+		var t time.Time
+		for k, e := range s.clients {
+			if t.IsZero() || e.lastUsed.Before(t) {
+				oldest, t = k, e.lastUsed
+			}
+		}
+		delete(s.clients, oldest)
+	}
+	s.clients[key] = &clientSetEntry{client: cl, creds: creds, lastUsed: time.Now()}
+	return cl
+}
+
+// Expire forces the keys of key to be assumed again, such as after the
+// customer changed the role's policies.
+func (s *ClientSet) Expire(key AccountKey) {
+	s.mu.Lock()
+	e, ok := s.clients[key]
+	s.mu.Unlock()
+	if ok {
+		e.creds.Expire()
+	}
+}
+
+// Remove drops the Client of key, such as when a customer leaves.
+func (s *ClientSet) Remove(key AccountKey) {
+	s.mu.Lock()
+	delete(s.clients, key)
+	s.mu.Unlock()
+}
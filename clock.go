@@ -0,0 +1,86 @@
+package aws4
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and waits, for code that retries, polls or expires
+// things. Tests can use a FakeClock in place of SystemClock to run such code
+// instantly and deterministically.
+type Clock interface {
+	Now() time.Time
+
+	// Sleep waits for d, or until ctx is done, and returns ctx.Err() in
+	// that case. It returns ctx.Err() at once if d <= 0.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// SystemClock is the Clock of package time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A FakeClock is a Clock whose time only moves when it sleeps or is
+// advanced, so that sleeping returns immediately. It records the sleeps, to
+// check backoff schedules. It is safe for concurrent use.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// NewFakeClock returns a FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now returns the time of c.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep advances c by d, unless ctx is done.
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	return nil
+}
+
+// Advance moves c forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Sleeps returns the durations of the sleeps so far.
+func (c *FakeClock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
@@ -0,0 +1,176 @@
+// Package cloudfront signs URLs and cookies granting access to private
+// CloudFront content. Unlike the rest of github.com/raff/aws4 it doesn't use
+// SigV4 but the RSA key pairs of CloudFront key groups.
+package cloudfront
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Signer signs URLs and cookies with the private key of a public key
+// registered in a CloudFront key group.
+type Signer struct {
+	// KeyID is the ID of the public key, such as K2JCJMDEHXQW5F.
+	KeyID string
+	Key   *rsa.PrivateKey
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key, in PKCS #1 or
+// PKCS #8 form, as generated for CloudFront key pairs.
+func ParsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("cloudfront: no PEM data")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("cloudfront: not an RSA private key")
+	}
+	return rk, nil
+}
+
+// A Policy is a custom policy, which allows access to resources matching a
+// pattern, from a given time or from some IP addresses only.
+type Policy struct {
+	// Resource is the URL of the content, which may contain the wildcards
+	// "*" and "?", such as "https://d111111abcdef8.cloudfront.net/videos/*".
+	Resource string
+
+	Expires time.Time
+
+	// NotBefore, if not zero, is when access starts.
+	NotBefore time.Time
+
+	// IPAddress, if not empty, is the CIDR of the clients allowed, such as
+	// "192.0.2.0/24".
+	IPAddress string
+}
+
+// MarshalJSON returns the policy document of p.
+func (p *Policy) MarshalJSON() ([]byte, error) {
+	type epoch struct {
+		EpochTime int64 `json:"AWS:EpochTime"`
+	}
+	type ip struct {
+		SourceIp string `json:"AWS:SourceIp"`
+	}
+	var st struct {
+		Resource  string
+		Condition struct {
+			DateLessThan    epoch
+			DateGreaterThan *epoch `json:",omitempty"`
+			IpAddress       *ip    `json:",omitempty"`
+		}
+	}
+	st.Resource = p.Resource
+	st.Condition.DateLessThan.EpochTime = p.Expires.Unix()
+	if !p.NotBefore.IsZero() {
+		st.Condition.DateGreaterThan = &epoch{p.NotBefore.Unix()}
+	}
+	if p.IPAddress != "" {
+		st.Condition.IpAddress = &ip{p.IPAddress}
+	}
+	// CloudFront rebuilds canned policies from URLs, so "&" in query
+	// strings must not be escaped.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(map[string]interface{}{"Statement": []interface{}{st}}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// encode is the URL-safe base64 of CloudFront.
+func encode(b []byte) string {
+	return strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(base64.StdEncoding.EncodeToString(b))
+}
+
+// sign returns the parameters granting access by p: Expires (if canned,
+// for a canned policy) or Policy, Signature and Key-Pair-Id.
+func (s *Signer) sign(p *Policy, canned bool) ([][2]string, error) {
+	if s.Key == nil || s.KeyID == "" {
+		return nil, errors.New("cloudfront: signer without a key")
+	}
+	if p.Expires.IsZero() {
+		return nil, errors.New("cloudfront: policy without expiry")
+	}
+	doc, err := p.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum(doc)
+	sig, err := rsa.SignPKCS1v15(nil, s.Key, crypto.SHA1, h[:])
+	if err != nil {
+		return nil, err
+	}
+
+	params := [][2]string{{"Policy", encode(doc)}}
+	if canned {
+		params = [][2]string{{"Expires", strconv.FormatInt(p.Expires.Unix(), 10)}}
+	}
+	return append(params, [2]string{"Signature", encode(sig)}, [2]string{"Key-Pair-Id", s.KeyID}), nil
+}
+
+// SignURL returns rawurl signed with a canned policy, valid until expires.
+func (s *Signer) SignURL(rawurl string, expires time.Time) (string, error) {
+	return s.SignURLWithPolicy(rawurl, &Policy{Resource: rawurl, Expires: expires})
+}
+
+// SignURLWithPolicy returns rawurl signed with p, whose Resource must match
+// rawurl. p is sent as a canned policy, which makes shorter URLs, if its
+// Resource is rawurl and it has no other condition than Expires.
+func (s *Signer) SignURLWithPolicy(rawurl string, p *Policy) (string, error) {
+	if _, err := url.Parse(rawurl); err != nil {
+		return "", err
+	}
+	canned := p.Resource == rawurl && p.NotBefore.IsZero() && p.IPAddress == ""
+	params, err := s.sign(p, canned)
+	if err != nil {
+		return "", err
+	}
+	sep := "?"
+	if strings.Contains(rawurl, "?") {
+		sep = "&"
+	}
+	for _, kv := range params {
+		rawurl += sep + kv[0] + "=" + kv[1]
+		sep = "&"
+	}
+	return rawurl, nil
+}
+
+// SignedCookies returns the cookies granting access by p, such as to all the
+// segments of a video stream, with a custom policy. The caller sets their
+// Domain and Path.
+func (s *Signer) SignedCookies(p *Policy) ([]*http.Cookie, error) {
+	params, err := s.sign(p, false)
+	if err != nil {
+		return nil, err
+	}
+	cookies := make([]*http.Cookie, len(params))
+	for i, kv := range params {
+		cookies[i] = &http.Cookie{Name: "CloudFront-" + kv[0], Value: kv[1], Secure: true, HttpOnly: true}
+	}
+	return cookies, nil
+}
@@ -0,0 +1,67 @@
+package cloudfront_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/raff/aws4/cloudfront"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decode(s string) []byte {
+	b, _ := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(s))
+	return b
+}
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if key, err = cloudfront.ParsePrivateKey(pemKey); err != nil {
+		t.Fatal(err)
+	}
+	s := &cloudfront.Signer{KeyID: "K2JCJMDEHXQW5F", Key: key}
+	expires := time.Unix(1700000000, 0)
+
+	raw := "https://d111111abcdef8.cloudfront.net/image.jpg?size=large&v=2"
+	signed, err := s.SignURL(raw, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	q := u.Query()
+	if q.Get("Expires") != "1700000000" || q.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" || q.Get("Policy") != "" {
+		t.Fatalf("signed URL = %s", signed)
+	}
+	canned := `{"Statement":[{"Resource":"` + raw + `","Condition":{"DateLessThan":{"AWS:EpochTime":1700000000}}}]}`
+	h := sha1.Sum([]byte(canned))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, h[:], decode(q.Get("Signature"))); err != nil {
+		t.Errorf("canned signature: %v", err)
+	}
+
+	p := &cloudfront.Policy{Resource: "https://d111111abcdef8.cloudfront.net/videos/*", Expires: expires, IPAddress: "192.0.2.0/24"}
+	cookies, err := s.SignedCookies(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 3 || cookies[0].Name != "CloudFront-Policy" || cookies[2].Value != "K2JCJMDEHXQW5F" {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	doc := decode(cookies[0].Value)
+	if !strings.Contains(string(doc), `"IpAddress":{"AWS:SourceIp":"192.0.2.0/24"}`) {
+		t.Errorf("policy = %s", doc)
+	}
+	h = sha1.Sum(doc)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, h[:], decode(cookies[1].Value)); err != nil {
+		t.Errorf("custom signature: %v", err)
+	}
+}
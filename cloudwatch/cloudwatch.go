@@ -0,0 +1,199 @@
+// Package cloudwatch publishes custom metrics to Amazon CloudWatch with
+// PutMetricData, signing requests with github.com/raff/aws4.
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRegion = "us-east-1"
+	Version       = "2010-08-01"
+
+	// MaxDataPerRequest is the number of data PutMetricData sends in one
+	// request; more are split across several requests.
+	MaxDataPerRequest = 1000
+)
+
+// Units, for Datum.Unit.
+const (
+	Seconds      = "Seconds"
+	Milliseconds = "Milliseconds"
+	Microseconds = "Microseconds"
+	Bytes        = "Bytes"
+	Count        = "Count"
+	Percent      = "Percent"
+	CountSecond  = "Count/Second"
+	BytesSecond  = "Bytes/Second"
+	None         = "None"
+)
+
+// A Client publishes metrics to CloudWatch.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the CloudWatch endpoint of Region is used.
+	URL string
+
+	// Namespace is the namespace of the metrics, such as "MyApp".
+	Namespace string
+}
+
+// A Dimension qualifies a metric, such as by host or table.
+type Dimension struct {
+	Name  string
+	Value string
+}
+
+// A StatisticSet summarizes several samples, for publishing pre-aggregated
+// data.
+type StatisticSet struct {
+	SampleCount float64
+	Sum         float64
+	Minimum     float64
+	Maximum     float64
+}
+
+// Add adds the sample v to s.
+func (s *StatisticSet) Add(v float64) {
+	if s.SampleCount == 0 || v < s.Minimum {
+		s.Minimum = v
+	}
+	if s.SampleCount == 0 || v > s.Maximum {
+		s.Maximum = v
+	}
+	s.SampleCount++
+	s.Sum += v
+}
+
+// A Datum is a value, or a set of statistics, of a metric.
+type Datum struct {
+	MetricName string
+	Dimensions []Dimension
+
+	// If zero, the time the data is received is used.
+	Timestamp time.Time
+
+	// Value is ignored if Statistics is not nil.
+	Value      float64
+	Statistics *StatisticSet
+
+	// If empty, None is used.
+	Unit string
+
+	// StorageResolution is 1 for high-resolution metrics, or 60.
+	StorageResolution int
+}
+
+// An Error is an error reported by CloudWatch.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cloudwatch: %d - %s - %q", e.StatusCode, e.Code, e.Message)
+}
+
+// PutMetricData publishes data to the Namespace of c.
+func (c *Client) PutMetricData(ctx context.Context, data ...Datum) error {
+	for len(data) > 0 {
+		n := len(data)
+		if n > MaxDataPerRequest {
+			n = MaxDataPerRequest
+		}
+		if err := c.put(ctx, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (c *Client) put(ctx context.Context, data []Datum) error {
+	v := url.Values{}
+	v.Set("Action", "PutMetricData")
+	v.Set("Version", Version)
+	v.Set("Namespace", c.Namespace)
+	for i, d := range data {
+		p := "MetricData.member." + strconv.Itoa(i+1) + "."
+		v.Set(p+"MetricName", d.MetricName)
+		for j, dim := range d.Dimensions {
+			dp := p + "Dimensions.member." + strconv.Itoa(j+1) + "."
+			v.Set(dp+"Name", dim.Name)
+			v.Set(dp+"Value", dim.Value)
+		}
+		if !d.Timestamp.IsZero() {
+			v.Set(p+"Timestamp", d.Timestamp.UTC().Format(time.RFC3339))
+		}
+		if s := d.Statistics; s != nil {
+			v.Set(p+"StatisticValues.SampleCount", formatFloat(s.SampleCount))
+			v.Set(p+"StatisticValues.Sum", formatFloat(s.Sum))
+			v.Set(p+"StatisticValues.Minimum", formatFloat(s.Minimum))
+			v.Set(p+"StatisticValues.Maximum", formatFloat(s.Maximum))
+		} else {
+			v.Set(p+"Value", formatFloat(d.Value))
+		}
+		if d.Unit != "" {
+			v.Set(p+"Unit", d.Unit)
+		}
+		if d.StorageResolution > 0 {
+			v.Set(p+"StorageResolution", strconv.Itoa(d.StorageResolution))
+		}
+	}
+
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	u := c.URL
+	if u == "" {
+		u = "https://monitoring." + region + ".amazonaws.com/"
+		if strings.HasPrefix(region, "cn-") {
+			u = "https://monitoring." + region + ".amazonaws.com.cn/"
+		}
+	}
+	cl := c.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+
+	r, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := cl.DoService("monitoring", region, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		e := aws4.ParseError(resp)
+		io.Copy(ioutil.Discard, resp.Body)
+		return &Error{resp.StatusCode, e.Code, e.Message}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
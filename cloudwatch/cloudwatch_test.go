@@ -0,0 +1,89 @@
+package cloudwatch_test
+
+import (
+	"context"
+	"errors"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/cloudwatch"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPutMetricData(t *testing.T) {
+	var forms []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		v, _ := url.ParseQuery(string(b))
+		forms = append(forms, v)
+		if v.Get("Namespace") == "Bad" {
+			w.WriteHeader(400)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>InvalidParameterValue</Code><Message>bad namespace</Message></Error></ErrorResponse>`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &cloudwatch.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, Namespace: "App"}
+	err := c.PutMetricData(context.Background(), cloudwatch.Datum{
+		MetricName: "Latency",
+		Dimensions: []cloudwatch.Dimension{{Name: "Host", Value: "a"}},
+		Timestamp:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Statistics: &cloudwatch.StatisticSet{SampleCount: 2, Sum: 3, Minimum: 1, Maximum: 2},
+		Unit:       cloudwatch.Milliseconds,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Action": "PutMetricData",
+		"MetricData.member.1.Dimensions.member.1.Name":    "Host",
+		"MetricData.member.1.Timestamp":                   "2024-01-02T03:04:05Z",
+		"MetricData.member.1.StatisticValues.SampleCount": "2",
+		"MetricData.member.1.StatisticValues.Maximum":     "2",
+		"MetricData.member.1.Unit":                        "Milliseconds",
+	}
+	for k, v := range want {
+		if got := forms[0].Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	c.Namespace = "Bad"
+	err = c.PutMetricData(context.Background(), cloudwatch.Datum{MetricName: "x", Value: 1})
+	if e, ok := err.(*cloudwatch.Error); !ok || e.Code != "InvalidParameterValue" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestSink(t *testing.T) {
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+	}))
+	defer srv.Close()
+
+	s := &cloudwatch.Sink{Client: &cloudwatch.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, Namespace: "App"}}
+	s.Record(&aws4.RequestMetrics{Service: "dynamodb", Region: "us-east-1", StatusCode: 200, Latency: 10 * time.Millisecond})
+	s.Record(&aws4.RequestMetrics{Service: "dynamodb", Region: "us-east-1", Err: errors.New("reset"), Latency: 30 * time.Millisecond})
+
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for i := 1; i <= 4; i++ {
+		p := "MetricData.member." + string(rune('0'+i)) + "."
+		values[form.Get(p+"MetricName")] = form.Get(p+"Value") + form.Get(p+"StatisticValues.Sum")
+	}
+	if values["Requests"] != "2" || values["Errors"] != "1" || values["ClientErrors"] != "0" || values["Latency"] != "40" {
+		t.Errorf("published %v", values)
+	}
+
+	form = nil
+	if err := s.Flush(context.Background()); err != nil || form != nil {
+		t.Errorf("empty flush sent %v, %v", form, err)
+	}
+}
@@ -0,0 +1,125 @@
+package cloudwatch
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"sync"
+	"time"
+)
+
+// DefaultSinkInterval is how often a Sink publishes by default.
+const DefaultSinkInterval = time.Minute
+
+// A Sink aggregates the request metrics of aws4.Clients and publishes them
+// to CloudWatch as statistic sets, so that each interval costs a single
+// PutMetricData request. Install it with:
+//
+//	client.OnRequest = sink.Record
+//
+// and start Run. For each service and region it publishes the metrics
+// Requests, Errors (failed requests and 5xx responses), ClientErrors (4xx
+// responses, which include throttling) and Latency, in milliseconds.
+type Sink struct {
+	// Client publishes the metrics. Its Namespace is used.
+	Client *Client
+
+	// Interval is how often Run publishes. If zero, DefaultSinkInterval is
+	// used.
+	Interval time.Duration
+
+	mu    sync.Mutex
+	stats map[sinkKey]*sinkStats
+}
+
+type sinkKey struct {
+	service string
+	region  string
+}
+
+type sinkStats struct {
+	requests   float64
+	errors     float64
+	clientErrs float64
+	latency    StatisticSet
+}
+
+// Record adds m to the metrics of the current interval. It is safe for
+// concurrent use.
+func (s *Sink) Record(m *aws4.RequestMetrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stats == nil {
+		s.stats = make(map[sinkKey]*sinkStats)
+	}
+	k := sinkKey{m.Service, m.Region}
+	st := s.stats[k]
+	if st == nil {
+		st = new(sinkStats)
+		s.stats[k] = st
+	}
+
+	st.requests++
+	switch {
+	case m.Err != nil || m.StatusCode >= 500:
+		st.errors++
+	case m.StatusCode >= 400:
+		st.clientErrs++
+	}
+	st.latency.Add(float64(m.Latency) / float64(time.Millisecond))
+}
+
+// Flush publishes the metrics recorded since the previous Flush.
+func (s *Sink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	stats := s.stats
+	s.stats = nil
+	s.mu.Unlock()
+
+	now := time.Now()
+	var data []Datum
+	for k, st := range stats {
+		dims := []Dimension{{"Service", k.service}, {"Region", k.region}}
+		latency := st.latency
+		data = append(data,
+			Datum{MetricName: "Requests", Dimensions: dims, Timestamp: now, Value: st.requests, Unit: Count},
+			Datum{MetricName: "Errors", Dimensions: dims, Timestamp: now, Value: st.errors, Unit: Count},
+			Datum{MetricName: "ClientErrors", Dimensions: dims, Timestamp: now, Value: st.clientErrs, Unit: Count},
+			Datum{MetricName: "Latency", Dimensions: dims, Timestamp: now, Statistics: &latency, Unit: Milliseconds},
+		)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return s.Client.PutMetricData(ctx, data...)
+}
+
+// Run calls Flush every Interval until ctx is done, then flushes a last
+// time and returns ctx.Err(). Errors of Flush are passed to onError, if not
+// nil.
+func (s *Sink) Run(ctx context.Context, onError func(error)) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSinkInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			s.report(s.Flush(flushCtx), onError)
+			cancel()
+			return ctx.Err()
+		}
+		s.report(s.Flush(ctx), onError)
+	}
+}
+
+func (s *Sink) report(err error, onError func(error)) {
+	if err != nil && onError != nil {
+		onError(err)
+	}
+}
@@ -0,0 +1,140 @@
+package aws4
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// A ConnErrorKind classifies the failure of a connection.
+type ConnErrorKind int
+
+const (
+	ConnOther ConnErrorKind = iota
+	ConnDNS
+	ConnRefused
+	ConnTLS
+	ConnTimeout
+	ConnReset
+)
+
+func (k ConnErrorKind) String() string {
+	switch k {
+	case ConnDNS:
+		return "dns"
+	case ConnRefused:
+		return "refused"
+	case ConnTLS:
+		return "tls"
+	case ConnTimeout:
+		return "timeout"
+	case ConnReset:
+		return "reset"
+	}
+	return "other"
+}
+
+// A ConnError is returned by Client when a request fails without a
+// response. It wraps the error of the http.Client, and can be found with
+// errors.As:
+//
+//	var ce *aws4.ConnError
+//	if errors.As(err, &ce) && ce.Kind == aws4.ConnDNS {
+type ConnError struct {
+	Kind ConnErrorKind
+
+	// Connecting is true if the request failed while connecting, before any
+	// of it was sent, so that sending it again can't apply it twice.
+	Connecting bool
+
+	// Terminal is true for failures that retrying won't fix, such as a host
+	// that doesn't exist or an invalid certificate.
+	Terminal bool
+
+	Err error
+}
+
+func (e *ConnError) Error() string {
+	return "aws4: " + e.Kind.String() + " error: " + e.Err.Error()
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable returns true if the request may be sent again: always after a
+// failure while connecting, unless it is Terminal, and otherwise only if
+// the request is idempotent, since it may have been applied.
+func (e *ConnError) Retryable(idempotent bool) bool {
+	if e.Terminal {
+		return false
+	}
+	return e.Connecting || idempotent
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotency returns a copy of ctx telling the retrying clients that
+// send requests with it whether those requests are idempotent, overriding
+// what they assume from the operation. Non-idempotent requests are only
+// sent again after connection errors while Connecting, as ConnError
+// Retryable decides.
+func WithIdempotency(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, idempotent)
+}
+
+// Idempotency returns whether the requests made with ctx are idempotent, and
+// whether WithIdempotency said so.
+func Idempotency(ctx context.Context) (idempotent, ok bool) {
+	idempotent, ok = ctx.Value(idempotencyKey{}).(bool)
+	return
+}
+
+// ClassifyError returns err as a *ConnError, classifying the errors of
+// http.Client and the net package, or nil if err is nil.
+func ClassifyError(err error) *ConnError {
+	if err == nil {
+		return nil
+	}
+	var ce *ConnError
+	if errors.As(err, &ce) {
+		return ce
+	}
+
+	ce = &ConnError{Err: err}
+	var (
+		dnsErr       *net.DNSError
+		opErr        *net.OpError
+		netErr       net.Error
+		recordErr    tls.RecordHeaderError
+		hostErr      x509.HostnameError
+		authorityErr x509.UnknownAuthorityError
+		invalidErr   x509.CertificateInvalidError
+		verifyErr    *tls.CertificateVerificationError
+	)
+	dialing := errors.As(err, &opErr) && opErr.Op == "dial"
+	switch {
+	case errors.As(err, &dnsErr):
+		ce.Kind, ce.Connecting = ConnDNS, true
+		ce.Terminal = dnsErr.IsNotFound
+	case errors.Is(err, syscall.ECONNREFUSED):
+		ce.Kind, ce.Connecting = ConnRefused, true
+	case errors.As(err, &hostErr), errors.As(err, &authorityErr), errors.As(err, &invalidErr), errors.As(err, &verifyErr):
+		ce.Kind, ce.Connecting, ce.Terminal = ConnTLS, true, true
+	case errors.As(err, &recordErr), strings.Contains(err.Error(), "tls: "):
+		ce.Kind, ce.Connecting = ConnTLS, true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		ce.Kind, ce.Connecting = ConnTimeout, dialing
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		ce.Kind = ConnReset
+	default:
+		ce.Connecting = dialing
+	}
+	return ce
+}
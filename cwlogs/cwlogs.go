@@ -0,0 +1,193 @@
+// Package cwlogs sends log events to Amazon CloudWatch Logs, and queries
+// them with CloudWatch Logs Insights, signing requests with
+// github.com/raff/aws4.
+package cwlogs
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const DefaultRegion = "us-east-1"
+
+// Limits of PutLogEvents.
+const (
+	MaxBatchEvents = 10000
+	MaxBatchBytes  = 1048576
+	MaxEventBytes  = 262144 - EventOverhead
+	MaxBatchSpan   = 24 * time.Hour
+
+	// EventOverhead is the number of bytes each event adds to a batch on
+	// top of its message.
+	EventOverhead = 26
+)
+
+// A Client sends requests to CloudWatch Logs.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the CloudWatch Logs endpoint of Region is used.
+	URL string
+}
+
+// An Error is an error reported by CloudWatch Logs.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name, such as
+// "ResourceAlreadyExistsException".
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+// An Event is a log event.
+type Event struct {
+	Timestamp time.Time
+	Message   string
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "logs",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "Logs_20140328",
+		Version: "1.1",
+	}
+	return jc.Do(ctx, action, in, out)
+}
+
+// CreateLogGroup creates the log group group. It does nothing if the group
+// exists.
+func (c *Client) CreateLogGroup(ctx context.Context, group string) error {
+	err := c.do(ctx, "CreateLogGroup", map[string]string{"logGroupName": group}, nil)
+	if IsException(err, "ResourceAlreadyExistsException") {
+		return nil
+	}
+	return err
+}
+
+// CreateLogStream creates the log stream stream in group. It does nothing if
+// the stream exists.
+func (c *Client) CreateLogStream(ctx context.Context, group, stream string) error {
+	req := map[string]string{"logGroupName": group, "logStreamName": stream}
+	err := c.do(ctx, "CreateLogStream", req, nil)
+	if IsException(err, "ResourceAlreadyExistsException") {
+		return nil
+	}
+	return err
+}
+
+// PutLogEvents uploads events to stream in group, sorting them by time and
+// splitting them into batches within the limits of the service. Streams
+// created before sequence tokens were retired may still require one:
+// token is the token to start with, if known, and the token to use for the
+// next call is returned. A wrong token is corrected and the batch is sent
+// again.
+func (c *Client) PutLogEvents(ctx context.Context, group, stream string, events []Event, token string) (string, error) {
+	events = append([]Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	for len(events) > 0 {
+		n := batchLen(events)
+		var err error
+		if token, err = c.putBatch(ctx, group, stream, events[:n], token); err != nil {
+			return token, err
+		}
+		events = events[n:]
+	}
+	return token, nil
+}
+
+// batchLen returns the number of events, sorted by time, that fit in a
+// batch.
+func batchLen(events []Event) int {
+	size := 0
+	for i, e := range events {
+		size += len(e.Message) + EventOverhead
+		if i == MaxBatchEvents || size > MaxBatchBytes || e.Timestamp.Sub(events[0].Timestamp) > MaxBatchSpan {
+			if i == 0 {
+				return 1
+			}
+			return i
+		}
+	}
+	return len(events)
+}
+
+type inputEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+func (c *Client) putBatch(ctx context.Context, group, stream string, events []Event, token string) (string, error) {
+	req := struct {
+		LogGroupName  string       `json:"logGroupName"`
+		LogStreamName string       `json:"logStreamName"`
+		LogEvents     []inputEvent `json:"logEvents"`
+		SequenceToken string       `json:"sequenceToken,omitempty"`
+	}{LogGroupName: group, LogStreamName: stream, SequenceToken: token}
+	for _, e := range events {
+		msg := e.Message
+		if len(msg) > MaxEventBytes {
+			// Cut at the start of a rune, not to send invalid UTF-8.
+			n := MaxEventBytes
+			for n > 0 && !utf8.RuneStart(msg[n]) {
+				n--
+			}
+			msg = msg[:n]
+		}
+		req.LogEvents = append(req.LogEvents, inputEvent{e.Timestamp.UnixNano() / int64(time.Millisecond), msg})
+	}
+
+	for attempt := 0; ; attempt++ {
+		var resp struct {
+			NextSequenceToken string `json:"nextSequenceToken"`
+		}
+		err := c.do(ctx, "PutLogEvents", &req, &resp)
+		if err == nil {
+			return resp.NextSequenceToken, nil
+		}
+		expected, ok := expectedToken(err)
+		switch {
+		case ok && IsException(err, "DataAlreadyAcceptedException"):
+			return expected, nil
+		case ok && attempt == 0:
+			req.SequenceToken = expected
+		default:
+			return req.SequenceToken, err
+		}
+	}
+}
+
+// expectedToken returns the sequence token named by an
+// InvalidSequenceTokenException or DataAlreadyAcceptedException.
+func expectedToken(err error) (string, bool) {
+	if !IsException(err, "InvalidSequenceTokenException") && !IsException(err, "DataAlreadyAcceptedException") {
+		return "", false
+	}
+	msg := err.(*Error).Message
+	const marker = "sequenceToken is: "
+	i := strings.Index(msg, marker)
+	if i < 0 {
+		return "", true
+	}
+	tok := strings.TrimSpace(msg[i+len(marker):])
+	if tok == "null" {
+		tok = ""
+	}
+	return tok, true
+}
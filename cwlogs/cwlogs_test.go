@@ -0,0 +1,170 @@
+package cwlogs_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/cwlogs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type putRequest struct {
+	LogEvents []struct {
+		Timestamp int64
+		Message   string
+	}
+	SequenceToken string
+}
+
+// fakeLogs accepts PutLogEvents requests, requiring sequence tokens.
+type fakeLogs struct {
+	mu       sync.Mutex
+	token    int
+	requests []putRequest
+}
+
+func (f *fakeLogs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var req putRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	if want := fmt.Sprint(f.token); req.SequenceToken != want {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, `{"__type":"InvalidSequenceTokenException","message":"The given sequenceToken is invalid. The next expected sequenceToken is: %s"}`, want)
+		return
+	}
+	f.requests = append(f.requests, req)
+	f.token++
+	fmt.Fprintf(w, `{"nextSequenceToken":"%d"}`, f.token)
+}
+
+func TestPutLogEvents(t *testing.T) {
+	f := &fakeLogs{token: 7}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &cwlogs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	now := time.Now()
+	events := []cwlogs.Event{{now.Add(time.Second), "b"}, {now, "a"}}
+	for i := 0; i < cwlogs.MaxBatchEvents; i++ {
+		events = append(events, cwlogs.Event{now.Add(2 * time.Second), "x"})
+	}
+	token, err := c.PutLogEvents(context.Background(), "g", "s", events, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "9" || len(f.requests) != 2 {
+		t.Fatalf("token %q after %d batches", token, len(f.requests))
+	}
+	if first := f.requests[0].LogEvents; len(first) != cwlogs.MaxBatchEvents || first[0].Message != "a" {
+		t.Errorf("first batch has %d events starting with %q", len(first), first[0].Message)
+	}
+}
+
+func TestPutLogEventsTruncate(t *testing.T) {
+	f := &fakeLogs{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &cwlogs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	// A 3-byte rune straddles the limit.
+	msg := strings.Repeat("x", cwlogs.MaxEventBytes-1) + "€" + "tail"
+	if _, err := c.PutLogEvents(context.Background(), "g", "s", []cwlogs.Event{{time.Now(), msg}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	got := f.requests[0].LogEvents[0].Message
+	if len(got) != cwlogs.MaxEventBytes-1 || !utf8.ValidString(got) {
+		t.Errorf("sent %d bytes, valid UTF-8: %v", len(got), utf8.ValidString(got))
+	}
+}
+
+func TestWriter(t *testing.T) {
+	f := &fakeLogs{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &cwlogs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	w := cwlogs.NewWriter(c, "g", "s")
+	logger := log.New(w, "", 0)
+	logger.Print("hello")
+	logger.Print("world")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []string
+	for _, r := range f.requests {
+		for _, e := range r.LogEvents {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	if strings.Join(msgs, ",") != "hello,world" {
+		t.Errorf("got %v", msgs)
+	}
+	if _, err := w.Write([]byte("late")); err != cwlogs.ErrClosed {
+		t.Errorf("err = %v, want ErrClosed", err)
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	var mu sync.Mutex
+	var starts, polls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.Header.Get("X-Amz-Target") {
+		case "Logs_20140328.StartQuery":
+			if starts++; starts == 1 {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `{"__type":"LimitExceededException","message":"too many queries"}`)
+				return
+			}
+			if req["queryString"] != "stats count() as n by bin(1h)" || req["startTime"] != 3600.0 {
+				t.Errorf("StartQuery %v", req)
+			}
+			fmt.Fprint(w, `{"queryId":"q1"}`)
+		case "Logs_20140328.GetQueryResults":
+			if polls++; polls == 1 {
+				fmt.Fprint(w, `{"status":"Running","results":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"status":"Complete","statistics":{"recordsMatched":3},"results":[
+				[{"field":"bin(1h)","value":"2024-05-01 10:00:00.000"},{"field":"n","value":"3"}]]}`)
+		default:
+			w.WriteHeader(400)
+		}
+	}))
+	defer srv.Close()
+	c := &cwlogs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	res, err := c.RunQuery(context.Background(), &cwlogs.Query{
+		LogGroups:    []string{"g"},
+		Query:        "stats count() as n by bin(1h)",
+		Start:        time.Unix(3600, 0),
+		End:          time.Unix(7200, 0),
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 1 || res.Statistics.RecordsMatched != 3 || polls != 2 {
+		t.Fatalf("results %+v after %d polls", res, polls)
+	}
+	if n, err := res.Rows[0].Int("n"); n != 3 || err != nil {
+		t.Errorf("n = %d, %v", n, err)
+	}
+	if v := res.Rows[0].Value("bin(1h)"); v != "2024-05-01 10:00:00.000" {
+		t.Errorf("bin = %q", v)
+	}
+}
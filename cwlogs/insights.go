@@ -0,0 +1,211 @@
+package cwlogs
+
+import (
+	"context"
+	"errors"
+	"github.com/raff/aws4/internal/awsjson"
+	"strconv"
+	"time"
+)
+
+// DefaultQueryPollInterval is how often RunQuery polls the results of a
+// query by default.
+const DefaultQueryPollInterval = time.Second
+
+// Statuses of an Insights query.
+const (
+	QueryScheduled = "Scheduled"
+	QueryRunning   = "Running"
+	QueryComplete  = "Complete"
+	QueryFailed    = "Failed"
+	QueryCancelled = "Cancelled"
+	QueryTimeout   = "Timeout"
+	QueryUnknown   = "Unknown"
+)
+
+// TimestampLayout is the layout of the @timestamp field of query results,
+// in UTC.
+const TimestampLayout = "2006-01-02 15:04:05.000"
+
+// A Query is a CloudWatch Logs Insights query.
+type Query struct {
+	// LogGroups are the names of the log groups to query.
+	LogGroups []string
+
+	// Query is the query, such as
+	// "fields @timestamp, @message | filter @message like /ERROR/".
+	Query string
+
+	// Start and End bound the time of the events queried.
+	Start, End time.Time
+
+	// Limit, if not zero, is the maximum number of rows returned, unless
+	// set by a limit command of Query.
+	Limit int
+
+	// If zero, DefaultQueryPollInterval is used.
+	PollInterval time.Duration
+}
+
+// A Field is a field of a row of query results.
+type Field struct {
+	Name  string `json:"field"`
+	Value string `json:"value"`
+}
+
+// A Row is a row of query results, holding its fields in the order of the
+// query.
+type Row []Field
+
+// Value returns the value of the field name, or "" if r has none.
+func (r Row) Value(name string) string {
+	for _, f := range r {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Map returns the values of r by field name.
+func (r Row) Map() map[string]string {
+	m := make(map[string]string, len(r))
+	for _, f := range r {
+		m[f.Name] = f.Value
+	}
+	return m
+}
+
+// Time returns the value of the @timestamp field of r, or the zero time.
+func (r Row) Time() time.Time {
+	t, _ := time.Parse(TimestampLayout, r.Value("@timestamp"))
+	return t
+}
+
+// Int returns the value of the field name as an integer, such as the result
+// of count().
+func (r Row) Int(name string) (int64, error) {
+	return strconv.ParseInt(r.Value(name), 10, 64)
+}
+
+// Float returns the value of the field name as a number, such as the result
+// of avg().
+func (r Row) Float(name string) (float64, error) {
+	return strconv.ParseFloat(r.Value(name), 64)
+}
+
+// QueryStatistics are the statistics of a query.
+type QueryStatistics struct {
+	RecordsMatched float64 `json:"recordsMatched"`
+	RecordsScanned float64 `json:"recordsScanned"`
+	BytesScanned   float64 `json:"bytesScanned"`
+}
+
+// QueryResults are the results of a query.
+type QueryResults struct {
+	// Status is the status of the query, such as QueryRunning. The rows of a
+	// query that is not complete are partial.
+	Status     string          `json:"status"`
+	Rows       []Row           `json:"results"`
+	Statistics QueryStatistics `json:"statistics"`
+}
+
+// A QueryError reports a query that ended without completing.
+type QueryError struct {
+	ID     string
+	Status string
+}
+
+func (e *QueryError) Error() string {
+	return "cwlogs: query " + e.ID + " " + e.Status
+}
+
+// StartQuery starts q and returns its query ID. It fails with
+// LimitExceededException when too many queries are running.
+func (c *Client) StartQuery(ctx context.Context, q *Query) (string, error) {
+	if q.Start.After(q.End) {
+		return "", errors.New("cwlogs: query starts after its end")
+	}
+	req := struct {
+		LogGroupNames []string `json:"logGroupNames"`
+		QueryString   string   `json:"queryString"`
+		StartTime     int64    `json:"startTime"`
+		EndTime       int64    `json:"endTime"`
+		Limit         int      `json:"limit,omitempty"`
+	}{q.LogGroups, q.Query, q.Start.Unix(), q.End.Unix(), q.Limit}
+	var resp struct {
+		QueryId string `json:"queryId"`
+	}
+	if err := c.do(ctx, "StartQuery", &req, &resp); err != nil {
+		return "", err
+	}
+	return resp.QueryId, nil
+}
+
+// GetQueryResults returns the results of the query id so far.
+func (c *Client) GetQueryResults(ctx context.Context, id string) (*QueryResults, error) {
+	var res QueryResults
+	if err := c.do(ctx, "GetQueryResults", map[string]string{"queryId": id}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// StopQuery stops the query id.
+func (c *Client) StopQuery(ctx context.Context, id string) error {
+	return c.do(ctx, "StopQuery", map[string]string{"queryId": id}, nil)
+}
+
+// RunQuery runs q and polls its results until it completes. It waits for
+// running queries to end when too many are running, and stops q if ctx is
+// done first. A query that fails, is cancelled or times out returns a
+// *QueryError.
+func (c *Client) RunQuery(ctx context.Context, q *Query) (*QueryResults, error) {
+	var id string
+	for retry := uint(0); ; retry++ {
+		var err error
+		if id, err = c.StartQuery(ctx, q); err == nil {
+			break
+		}
+		if !IsException(err, "LimitExceededException") && !awsjson.Retryable(ctx, err) {
+			return nil, err
+		}
+		if retry > 5 {
+			retry = 5 // back off up to 3.2s
+		}
+		if awsjson.Sleep(ctx, retry+1, err) != nil {
+			return nil, err
+		}
+	}
+
+	poll := q.PollInterval
+	if poll <= 0 {
+		poll = DefaultQueryPollInterval
+	}
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			c.StopQuery(context.Background(), id)
+			return nil, ctx.Err()
+		}
+
+		res, err := c.GetQueryResults(ctx, id)
+		if err != nil {
+			if ctx.Err() == nil && awsjson.Retryable(ctx, err) {
+				continue
+			}
+			c.StopQuery(context.Background(), id)
+			return nil, err
+		}
+		switch res.Status {
+		case QueryScheduled, QueryRunning:
+		case QueryComplete:
+			return res, nil
+		default:
+			return nil, &QueryError{id, res.Status}
+		}
+	}
+}
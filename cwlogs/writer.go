@@ -0,0 +1,127 @@
+package cwlogs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is the default maximum age of buffered events.
+const DefaultFlushInterval = 5 * time.Second
+
+// ErrClosed is returned by writes to a closed Writer.
+var ErrClosed = errors.New("cwlogs: writer closed")
+
+// A Writer is an io.Writer that sends every Write, such as a line written by
+// a log.Logger, as a log event. Events are buffered and uploaded once they
+// fill a batch or the oldest is FlushInterval old. Upload errors are
+// returned by the next Write, Flush or Close.
+//
+// A Writer is safe for concurrent use.
+type Writer struct {
+	c      *Client
+	group  string
+	stream string
+
+	mu      sync.Mutex
+	events  []Event
+	size    int
+	token   string
+	err     error
+	closed  bool
+	timer   *time.Timer
+	flushMu sync.Mutex // serializes uploads, which must use tokens in order
+
+	// FlushInterval is the maximum age of buffered events. If zero,
+	// DefaultFlushInterval is used. Set it before the first Write.
+	FlushInterval time.Duration
+}
+
+// NewWriter returns a Writer sending events to stream in group, which must
+// exist.
+func NewWriter(c *Client, group, stream string) *Writer {
+	return &Writer{c: c, group: group, stream: stream}
+}
+
+// Write adds p, without a trailing newline, as an event timestamped now.
+func (w *Writer) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if msg == "" {
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, ErrClosed
+	}
+	if err := w.err; err != nil {
+		w.err = nil
+		w.mu.Unlock()
+		return 0, err
+	}
+	w.events = append(w.events, Event{time.Now(), msg})
+	w.size += len(msg) + EventOverhead
+	full := len(w.events) >= MaxBatchEvents || w.size >= MaxBatchBytes
+	if !full && w.timer == nil {
+		d := w.FlushInterval
+		if d <= 0 {
+			d = DefaultFlushInterval
+		}
+		w.timer = time.AfterFunc(d, func() { w.flush(context.Background()) })
+	}
+	w.mu.Unlock()
+
+	if full {
+		w.flush(context.Background())
+	}
+	return len(p), nil
+}
+
+// Flush uploads the buffered events.
+func (w *Writer) Flush(ctx context.Context) error {
+	w.flush(ctx)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// flush uploads the buffered events, recording any error in w.err.
+func (w *Writer) flush(ctx context.Context) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	events, token := w.events, w.token
+	w.events, w.size = nil, 0
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	token, err := w.c.PutLogEvents(ctx, w.group, w.stream, events, token)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.token = token
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// Close flushes the buffered events and stops the Writer.
+func (w *Writer) Close() error {
+	err := w.Flush(context.Background())
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	return err
+}
@@ -0,0 +1,301 @@
+package dydb
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Table classes, for SetTableClass.
+const (
+	TableClassStandard                 = "STANDARD"
+	TableClassStandardInfrequentAccess = "STANDARD_INFREQUENT_ACCESS"
+)
+
+// ContributorInsights describes the CloudWatch Contributor Insights
+// configuration of a table or index.
+type ContributorInsights struct {
+	TableName  string
+	IndexName  string
+	Status     string // ENABLING, ENABLED, DISABLING, DISABLED or FAILED
+	Rules      []string
+	LastUpdate time.Time
+
+	// Failure explains why Status is FAILED.
+	Failure string
+}
+
+// UpdateContributorInsights enables or disables Contributor Insights for
+// table, or for its index if index is not empty. It returns the new status.
+func (db *DB) UpdateContributorInsights(ctx context.Context, table, index string, enable bool) (string, error) {
+	req := map[string]string{"TableName": table, "ContributorInsightsAction": "DISABLE"}
+	if enable {
+		req["ContributorInsightsAction"] = "ENABLE"
+	}
+	if index != "" {
+		req["IndexName"] = index
+	}
+
+	var resp struct{ ContributorInsightsStatus string }
+	if err := db.QueryContext(ctx, "UpdateContributorInsights", req).Decode(&resp); err != nil {
+		return "", err
+	}
+	return resp.ContributorInsightsStatus, nil
+}
+
+// DescribeContributorInsights returns the Contributor Insights configuration
+// of table, or of its index if index is not empty.
+func (db *DB) DescribeContributorInsights(ctx context.Context, table, index string) (*ContributorInsights, error) {
+	req := map[string]string{"TableName": table}
+	if index != "" {
+		req["IndexName"] = index
+	}
+
+	var resp struct {
+		TableName                   string
+		IndexName                   string
+		ContributorInsightsStatus   string
+		ContributorInsightsRuleList []string
+		LastUpdateDateTime          float64
+		FailureException            struct {
+			ExceptionName        string
+			ExceptionDescription string
+		}
+	}
+	if err := db.QueryContext(ctx, "DescribeContributorInsights", req).Decode(&resp); err != nil {
+		return nil, err
+	}
+
+	ci := &ContributorInsights{
+		TableName: resp.TableName,
+		IndexName: resp.IndexName,
+		Status:    resp.ContributorInsightsStatus,
+		Rules:     resp.ContributorInsightsRuleList,
+	}
+	if resp.LastUpdateDateTime > 0 {
+		sec, frac := math.Modf(resp.LastUpdateDateTime)
+		ci.LastUpdate = time.Unix(int64(sec), int64(frac*1e9)).UTC()
+	}
+	if e := resp.FailureException; e.ExceptionName != "" {
+		ci.Failure = e.ExceptionName + ": " + e.ExceptionDescription
+	}
+	return ci, nil
+}
+
+// SetTableClass changes the class of table to TableClassStandard or
+// TableClassStandardInfrequentAccess. The change is applied in the
+// background; the table stays available meanwhile.
+func (db *DB) SetTableClass(ctx context.Context, table, class string) error {
+	req := map[string]string{"TableName": table, "TableClass": class}
+	return db.ExecContext(ctx, "UpdateTable", req)
+}
+
+// TableARN returns the ARN of table, as needed by the tagging methods.
+func (db *DB) TableARN(ctx context.Context, table string) (string, error) {
+	var resp struct{ Table struct{ TableArn string } }
+	if err := db.QueryContext(ctx, "DescribeTable", map[string]string{"TableName": table}).Decode(&resp); err != nil {
+		return "", err
+	}
+	return resp.Table.TableArn, nil
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+// TagResource adds tags to the table, index or backup with ARN arn,
+// replacing the values of existing keys.
+func (db *DB) TagResource(ctx context.Context, arn string, tags map[string]string) error {
+	req := struct {
+		ResourceArn string
+		Tags        []tag
+	}{ResourceArn: arn}
+	for k, v := range tags {
+		req.Tags = append(req.Tags, tag{k, v})
+	}
+	return db.ExecContext(ctx, "TagResource", req)
+}
+
+// UntagResource removes the tags with keys from the resource with ARN arn.
+func (db *DB) UntagResource(ctx context.Context, arn string, keys ...string) error {
+	req := map[string]interface{}{"ResourceArn": arn, "TagKeys": keys}
+	return db.ExecContext(ctx, "UntagResource", req)
+}
+
+// ListTagsOfResource returns all the tags of the resource with ARN arn.
+func (db *DB) ListTagsOfResource(ctx context.Context, arn string) (map[string]string, error) {
+	tags := make(map[string]string)
+	req := map[string]string{"ResourceArn": arn}
+	for {
+		var resp struct {
+			Tags      []tag
+			NextToken string
+		}
+		if err := db.QueryContext(ctx, "ListTagsOfResource", req).Decode(&resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Tags {
+			tags[t.Key] = t.Value
+		}
+		if resp.NextToken == "" {
+			return tags, nil
+		}
+		req["NextToken"] = resp.NextToken
+	}
+}
+
+// Precisions of the ApproximateCreationDateTime of the records sent to
+// Kinesis streaming destinations.
+const (
+	PrecisionMillisecond = "MILLISECOND"
+	PrecisionMicrosecond = "MICROSECOND"
+)
+
+// A KinesisDestination is a Kinesis data stream receiving the changes of a
+// table.
+type KinesisDestination struct {
+	StreamArn string
+	Status    string // ENABLING, ACTIVE, DISABLING, DISABLED, ENABLE_FAILED or UPDATING
+
+	// StatusDescription explains Status, such as why enabling failed.
+	StatusDescription string
+
+	// Precision is PrecisionMillisecond or PrecisionMicrosecond.
+	Precision string
+}
+
+// EnableKinesisStreamingDestination starts sending the changes of table to
+// the Kinesis data stream with ARN streamArn. precision, if not empty, is the
+// precision of the creation time of records. It returns the new status.
+func (db *DB) EnableKinesisStreamingDestination(ctx context.Context, table, streamArn, precision string) (string, error) {
+	return db.kinesisDestination(ctx, "EnableKinesisStreamingDestination", table, streamArn, precision)
+}
+
+// DisableKinesisStreamingDestination stops sending the changes of table to
+// the Kinesis data stream with ARN streamArn. It returns the new status.
+func (db *DB) DisableKinesisStreamingDestination(ctx context.Context, table, streamArn string) (string, error) {
+	return db.kinesisDestination(ctx, "DisableKinesisStreamingDestination", table, streamArn, "")
+}
+
+func (db *DB) kinesisDestination(ctx context.Context, action, table, streamArn, precision string) (string, error) {
+	req := map[string]interface{}{"TableName": table, "StreamArn": streamArn}
+	if precision != "" {
+		req["EnableKinesisStreamingConfiguration"] = map[string]string{"ApproximateCreationDateTimePrecision": precision}
+	}
+
+	var resp struct{ DestinationStatus string }
+	if err := db.QueryContext(ctx, action, req).Decode(&resp); err != nil {
+		return "", err
+	}
+	return resp.DestinationStatus, nil
+}
+
+// DescribeKinesisStreamingDestination returns the Kinesis data streams that
+// receive, or received, the changes of table.
+func (db *DB) DescribeKinesisStreamingDestination(ctx context.Context, table string) ([]KinesisDestination, error) {
+	var resp struct {
+		KinesisDataStreamDestinations []struct {
+			StreamArn                            string
+			DestinationStatus                    string
+			DestinationStatusDescription         string
+			ApproximateCreationDateTimePrecision string
+		}
+	}
+	req := map[string]string{"TableName": table}
+	if err := db.QueryContext(ctx, "DescribeKinesisStreamingDestination", req).Decode(&resp); err != nil {
+		return nil, err
+	}
+
+	dests := make([]KinesisDestination, len(resp.KinesisDataStreamDestinations))
+	for i, d := range resp.KinesisDataStreamDestinations {
+		dests[i] = KinesisDestination{
+			StreamArn:         d.StreamArn,
+			Status:            d.DestinationStatus,
+			StatusDescription: d.DestinationStatusDescription,
+			Precision:         d.ApproximateCreationDateTimePrecision,
+		}
+	}
+	return dests, nil
+}
+
+// ContinuousBackups describes the continuous backups and point-in-time
+// recovery (PITR) of a table.
+type ContinuousBackups struct {
+	Status string // ENABLED or DISABLED
+
+	// PITRStatus is ENABLED or DISABLED.
+	PITRStatus string
+
+	// RecoveryPeriodDays is how many days back the table can be restored to.
+	RecoveryPeriodDays int
+
+	// EarliestRestorable and LatestRestorable bound the times the table can
+	// be restored to, if PITR is enabled.
+	EarliestRestorable time.Time
+	LatestRestorable   time.Time
+}
+
+// PITREnabled returns true if point-in-time recovery is enabled.
+func (c *ContinuousBackups) PITREnabled() bool {
+	return c.PITRStatus == "ENABLED"
+}
+
+type continuousBackupsResponse struct {
+	ContinuousBackupsDescription struct {
+		ContinuousBackupsStatus        string
+		PointInTimeRecoveryDescription struct {
+			PointInTimeRecoveryStatus  string
+			RecoveryPeriodInDays       int
+			EarliestRestorableDateTime float64
+			LatestRestorableDateTime   float64
+		}
+	}
+}
+
+func (r *continuousBackupsResponse) backups() *ContinuousBackups {
+	d := r.ContinuousBackupsDescription
+	p := d.PointInTimeRecoveryDescription
+	epoch := func(f float64) time.Time {
+		if f <= 0 {
+			return time.Time{}
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+	}
+	return &ContinuousBackups{
+		Status:             d.ContinuousBackupsStatus,
+		PITRStatus:         p.PointInTimeRecoveryStatus,
+		RecoveryPeriodDays: p.RecoveryPeriodInDays,
+		EarliestRestorable: epoch(p.EarliestRestorableDateTime),
+		LatestRestorable:   epoch(p.LatestRestorableDateTime),
+	}
+}
+
+// UpdateContinuousBackups enables or disables point-in-time recovery for
+// table. recoveryDays, if not zero, is the recovery period, from 1 to 35
+// days. It returns the new configuration.
+func (db *DB) UpdateContinuousBackups(ctx context.Context, table string, enable bool, recoveryDays int) (*ContinuousBackups, error) {
+	spec := map[string]interface{}{"PointInTimeRecoveryEnabled": enable}
+	if recoveryDays != 0 {
+		spec["RecoveryPeriodInDays"] = recoveryDays
+	}
+	req := map[string]interface{}{"TableName": table, "PointInTimeRecoverySpecification": spec}
+
+	var resp continuousBackupsResponse
+	if err := db.QueryContext(ctx, "UpdateContinuousBackups", req).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp.backups(), nil
+}
+
+// DescribeContinuousBackups returns the continuous backups configuration of
+// table, such as to audit that PITR is enabled.
+func (db *DB) DescribeContinuousBackups(ctx context.Context, table string) (*ContinuousBackups, error) {
+	var resp continuousBackupsResponse
+	req := map[string]string{"TableName": table}
+	if err := db.QueryContext(ctx, "DescribeContinuousBackups", req).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp.backups(), nil
+}
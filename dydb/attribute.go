@@ -0,0 +1,90 @@
+package dydb
+
+import (
+	"encoding/json"
+)
+
+// An AttributeValue is the DynamoDB JSON encoding of a single attribute, as
+// found in the Item, Items and Key members of requests and responses.
+// Exactly one of its fields should be set.
+type AttributeValue struct {
+	S    *string
+	N    *string
+	B    []byte
+	SS   []string
+	NS   []string
+	BS   [][]byte
+	M    map[string]*AttributeValue
+	L    []*AttributeValue
+	NULL *bool
+	BOOL *bool
+}
+
+// An Item is a DynamoDB item (or key) in DynamoDB JSON form.
+type Item map[string]*AttributeValue
+
+// StringValue returns an S attribute value holding s.
+func StringValue(s string) *AttributeValue {
+	return &AttributeValue{S: &s}
+}
+
+// BoolValue returns a BOOL attribute value holding b.
+func BoolValue(b bool) *AttributeValue {
+	return &AttributeValue{BOOL: &b}
+}
+
+// NullValue returns a NULL attribute value.
+func NullValue() *AttributeValue {
+	t := true
+	return &AttributeValue{NULL: &t}
+}
+
+// BinaryValue returns a B attribute value holding b, for use in keys and
+// expression attribute values. The value is base64-encoded on the wire.
+func BinaryValue(b []byte) *AttributeValue {
+	if b == nil {
+		b = []byte{}
+	}
+	return &AttributeValue{B: b}
+}
+
+// BinarySetValue returns a BS attribute value holding bs.
+func BinarySetValue(bs ...[]byte) *AttributeValue {
+	if bs == nil {
+		bs = [][]byte{}
+	}
+	return &AttributeValue{BS: bs}
+}
+
+// MarshalJSON encodes av with its single type descriptor. Empty but non-nil
+// B, M and L values are kept, since DynamoDB distinguishes them from absent
+// ones.
+func (av *AttributeValue) MarshalJSON() ([]byte, error) {
+	var v interface{}
+	var k string
+	switch {
+	case av.NULL != nil:
+		k, v = "NULL", *av.NULL
+	case av.BOOL != nil:
+		k, v = "BOOL", *av.BOOL
+	case av.S != nil:
+		k, v = "S", *av.S
+	case av.N != nil:
+		k, v = "N", *av.N
+	case av.B != nil:
+		k, v = "B", av.B
+	case av.SS != nil:
+		k, v = "SS", av.SS
+	case av.NS != nil:
+		k, v = "NS", av.NS
+	case av.BS != nil:
+		k, v = "BS", av.BS
+	case av.M != nil:
+		k, v = "M", av.M
+	case av.L != nil:
+		k, v = "L", av.L
+	default:
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]interface{}{k: v})
+}
@@ -0,0 +1,104 @@
+package dydb
+
+import (
+	"context"
+	"fmt"
+)
+
+// MaxBatchWriteItems is the largest number of requests DynamoDB accepts in
+// a single BatchWriteItem call.
+const MaxBatchWriteItems = 25
+
+// A WriteRequest is a single put or delete in a BatchWriteItem request.
+// Exactly one of its fields should be set.
+type WriteRequest struct {
+	PutRequest    *PutRequest    `json:",omitempty"`
+	DeleteRequest *DeleteRequest `json:",omitempty"`
+}
+
+type PutRequest struct {
+	Item Item
+}
+
+type DeleteRequest struct {
+	Key Item
+}
+
+// An UnprocessedError is returned by BatchWrite when DynamoDB still reports
+// unprocessed requests after all retries.
+type UnprocessedError struct {
+	Table    string
+	Requests []WriteRequest
+}
+
+func (e *UnprocessedError) Error() string {
+	return fmt.Sprintf("dydb: %d unprocessed write requests for table %s", len(e.Requests), e.Table)
+}
+
+// BatchWrite writes reqs to table using BatchWriteItem calls of at most
+// MaxBatchWriteItems requests. Throttled calls and unprocessed requests are
+// retried with backoff, making up to retries attempts each.
+func (db *DB) BatchWrite(ctx context.Context, table string, reqs []WriteRequest, retries uint) error {
+	_, err := db.batchWrite(ctx, table, reqs, retries)
+	return err
+}
+
+// batchWrite is BatchWrite, also returning the number of requests written,
+// including on failure.
+func (db *DB) batchWrite(ctx context.Context, table string, reqs []WriteRequest, retries uint) (int, error) {
+	if retries == 0 {
+		retries = 1
+	}
+
+	written := 0
+	for len(reqs) > 0 {
+		n := len(reqs)
+		if n > MaxBatchWriteItems {
+			n = MaxBatchWriteItems
+		}
+		batch := reqs[:n]
+		reqs = reqs[n:]
+
+		var err error
+		for i := uint(0); len(batch) > 0; i++ {
+			if i == retries {
+				if err != nil {
+					return written, err
+				}
+				return written, &UnprocessedError{Table: table, Requests: append(batch, reqs...)}
+			}
+			if i > 0 {
+				d := retryDelay(i, err)
+				if err := db.clock().Sleep(ctx, d); err != nil {
+					return written, err
+				}
+			}
+
+			req := map[string]interface{}{
+				"RequestItems": map[string][]WriteRequest{table: batch},
+			}
+			if db.OnItemCollectionMetrics != nil {
+				req["ReturnItemCollectionMetrics"] = "SIZE"
+			}
+			var resp struct {
+				UnprocessedItems      map[string][]WriteRequest
+				ItemCollectionMetrics map[string][]*ItemCollectionMetrics
+			}
+			// Each call is made once; this loop owns the retries.
+			err = db.RetryQueryContext(ctx, "BatchWriteItem", req, 1).Decode(&resp)
+			if isThrottle(err) || db.retryableConn(ctx, "BatchWriteItem", err) {
+				continue
+			}
+			if err != nil {
+				return written, err
+			}
+			for _, m := range resp.ItemCollectionMetrics[table] {
+				db.OnItemCollectionMetrics(table, m)
+			}
+			written += len(batch) - len(resp.UnprocessedItems[table])
+			batch = resp.UnprocessedItems[table]
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,248 @@
+package dydb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBatchFlushInterval is the default maximum age of the requests
+	// buffered by a BatchWriter.
+	DefaultBatchFlushInterval = time.Second
+
+	// DefaultMaxBuffered is the default number of requests a BatchWriter
+	// buffers before Put and Delete block.
+	DefaultMaxBuffered = 1000
+
+	// DefaultBatchRetries is the default number of attempts a BatchWriter
+	// makes for each batch.
+	DefaultBatchRetries = 5
+
+	// DefaultBatchWriteTimeout is the default time limit of the batches a
+	// BatchWriter writes in the background.
+	DefaultBatchWriteTimeout = 30 * time.Second
+)
+
+// ErrWriterClosed is returned by the methods of a closed BatchWriter.
+var ErrWriterClosed = errors.New("dydb: batch writer closed")
+
+// A BatchWriter buffers puts and deletes to a table and writes them in the
+// background with BatchWrite, in batches of MaxBatchWriteItems requests or
+// once the oldest request is FlushInterval old. Write errors are passed to
+// OnError or, if it is nil, returned by the next Flush or Close.
+//
+// A batch may not hold two requests for the same item, so callers writing
+// an item repeatedly should Flush in between.
+//
+// A BatchWriter is safe for concurrent use. Set its fields before the first
+// Put or Delete.
+type BatchWriter struct {
+	// FlushInterval is the maximum age of buffered requests. If zero,
+	// DefaultBatchFlushInterval is used.
+	FlushInterval time.Duration
+
+	// MaxBuffered bounds the requests held in memory: Put and Delete block
+	// while MaxBuffered requests wait to be written. If zero,
+	// DefaultMaxBuffered is used.
+	MaxBuffered int
+
+	// Retries is passed to BatchWrite. If zero, DefaultBatchRetries is
+	// used.
+	Retries uint
+
+	// WriteTimeout bounds the time spent writing a batch in the background,
+	// when full or FlushInterval old; the batches of Flush and Close are
+	// bounded by their context instead. If zero, DefaultBatchWriteTimeout
+	// is used.
+	WriteTimeout time.Duration
+
+	// OnError, if not nil, is called with the error of every failed batch,
+	// such as an *UnprocessedError.
+	OnError func(error)
+
+	db    *DB
+	table string
+
+	once sync.Once
+	ops  chan batchOp
+	done chan struct{}
+
+	mu       sync.RWMutex
+	closed   bool
+	closeCtx context.Context // of Close, read by run once ops is closed
+	errMu    sync.Mutex
+	err      error
+}
+
+type batchOp struct {
+	req     WriteRequest
+	ctx     context.Context // for flushes, of the write
+	flushed chan struct{}   // for flushes, closed once written
+}
+
+// NewBatchWriter returns a BatchWriter writing to table.
+func NewBatchWriter(db *DB, table string) *BatchWriter {
+	return &BatchWriter{db: db, table: table}
+}
+
+// Put buffers a put of item, waiting for room until ctx is done.
+func (w *BatchWriter) Put(ctx context.Context, item Item) error {
+	return w.send(ctx, batchOp{req: WriteRequest{PutRequest: &PutRequest{Item: item}}})
+}
+
+// Delete buffers a delete of the item with key, waiting for room until ctx
+// is done.
+func (w *BatchWriter) Delete(ctx context.Context, key Item) error {
+	return w.send(ctx, batchOp{req: WriteRequest{DeleteRequest: &DeleteRequest{Key: key}}})
+}
+
+// Flush writes the buffered requests and returns the errors of writes since
+// the last Flush, unless OnError is set.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	op := batchOp{ctx: ctx, flushed: make(chan struct{})}
+	if err := w.send(ctx, op); err != nil {
+		return err
+	}
+	select {
+	case <-op.flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return w.takeErr()
+}
+
+// Close writes the buffered requests within ctx, stops the BatchWriter and
+// returns the errors of writes since the last Flush, unless OnError is set.
+func (w *BatchWriter) Close(ctx context.Context) error {
+	w.start()
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	w.closed = true
+	w.closeCtx = ctx
+	close(w.ops)
+	w.mu.Unlock()
+
+	<-w.done
+	return w.takeErr()
+}
+
+func (w *BatchWriter) start() {
+	w.once.Do(func() {
+		n := w.MaxBuffered
+		if n <= 0 {
+			n = DefaultMaxBuffered
+		}
+		w.ops = make(chan batchOp, n)
+		w.done = make(chan struct{})
+		go w.run()
+	})
+}
+
+func (w *BatchWriter) send(ctx context.Context, op batchOp) error {
+	w.start()
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	select {
+	case w.ops <- op:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+
+	interval := w.FlushInterval
+	if interval <= 0 {
+		interval = DefaultBatchFlushInterval
+	}
+
+	var batch []WriteRequest
+	var timer *time.Timer
+	var expired <-chan time.Time
+	// write writes batch within ctx, or WriteTimeout if ctx is nil.
+	write := func(ctx context.Context) {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if ctx == nil {
+			timeout := w.WriteTimeout
+			if timeout <= 0 {
+				timeout = DefaultBatchWriteTimeout
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+		}
+		w.write(ctx, batch)
+		batch = nil
+	}
+
+	for {
+		select {
+		case op, ok := <-w.ops:
+			switch {
+			case !ok:
+				write(w.closeCtx)
+				return
+			case op.flushed != nil:
+				write(op.ctx)
+				close(op.flushed)
+			default:
+				batch = append(batch, op.req)
+				if len(batch) == MaxBatchWriteItems {
+					write(nil)
+				} else if timer == nil {
+					timer = time.NewTimer(interval)
+					expired = timer.C
+				}
+			}
+		case <-expired:
+			timer, expired = nil, nil
+			write(nil)
+		}
+	}
+}
+
+func (w *BatchWriter) write(ctx context.Context, batch []WriteRequest) {
+	retries := w.Retries
+	if retries == 0 {
+		retries = DefaultBatchRetries
+	}
+	err := w.db.BatchWrite(ctx, w.table, batch, retries)
+	if err == nil {
+		return
+	}
+	if w.OnError != nil {
+		w.OnError(err)
+		return
+	}
+	w.errMu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.errMu.Unlock()
+}
+
+func (w *BatchWriter) takeErr() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	err := w.err
+	w.err = nil
+	return err
+}
@@ -0,0 +1,237 @@
+package dydb
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// A Cache is an in-process LRU cache of GetItem and Query responses, for
+// read-heavy workloads that can tolerate slightly stale data. Set it as
+// DB.Cache to use it.
+//
+// Responses are cached by action and request body, which covers the table,
+// key, key condition and projection. Strongly consistent reads bypass the
+// cache. Any other action sent through the same DB, apart from a few known
+// read-only ones, invalidates every entry of the tables it names; writes made
+// by other clients are only seen once entries expire.
+//
+// A Cache is safe for concurrent use and may be shared by several DBs.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	gen     uint64 // incremented by every invalidation
+	ll      *list.List
+	entries map[string]*list.Element
+	tables  map[string]map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	table   string
+	body    []byte
+	expires time.Time
+}
+
+// NewCache returns a Cache holding up to size responses for at most ttl
+// each.
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+		tables:  make(map[string]map[string]*list.Element),
+	}
+}
+
+// Invalidate drops all cached responses for tables.
+func (c *Cache) Invalidate(tables ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, t := range tables {
+		for _, e := range c.tables[t] {
+			c.remove(e)
+		}
+	}
+}
+
+// Purge drops all cached responses.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.ll.Init()
+	c.entries = make(map[string]*list.Element)
+	c.tables = make(map[string]map[string]*list.Element)
+}
+
+// Len returns the number of cached responses.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) get(key string) ([]byte, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		ce := e.Value.(*cacheEntry)
+		if time.Now().Before(ce.expires) {
+			c.ll.MoveToFront(e)
+			return ce.body, c.gen, true
+		}
+		c.remove(e)
+	}
+	return nil, c.gen, false
+}
+
+// put caches body unless an invalidation happened since gen was read.
+func (c *Cache) put(gen uint64, key, table string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen || c.size <= 0 {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	e := c.ll.PushFront(&cacheEntry{key: key, table: table, body: body, expires: time.Now().Add(c.ttl)})
+	c.entries[key] = e
+	if c.tables[table] == nil {
+		c.tables[table] = make(map[string]*list.Element)
+	}
+	c.tables[table][key] = e
+
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *Cache) remove(e *list.Element) {
+	ce := c.ll.Remove(e).(*cacheEntry)
+	delete(c.entries, ce.key)
+	if t := c.tables[ce.table]; t != nil {
+		delete(t, ce.key)
+		if len(t) == 0 {
+			delete(c.tables, ce.table)
+		}
+	}
+}
+
+// readOnlyActions don't change items, so they never invalidate the cache.
+var readOnlyActions = map[string]bool{
+	"BatchGetItem":                true,
+	"DescribeContributorInsights": true,
+	"DescribeLimits":              true,
+	"DescribeTable":               true,
+	"DescribeTimeToLive":          true,
+	"GetItem":                     true,
+	"ListTables":                  true,
+	"ListTagsOfResource":          true,
+	"Query":                       true,
+	"Scan":                        true,
+	"TagResource":                 true,
+	"TransactGetItems":            true,
+	"UntagResource":               true,
+	"UpdateContributorInsights":   true,
+}
+
+// cachingTransport serves GetItem and Query from a Cache. Responses larger
+// than limit, if not zero, fail rather than being read into memory.
+type cachingTransport struct {
+	cache *Cache
+	limit int64
+	next  Transport
+}
+
+func (t *cachingTransport) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	var req struct {
+		TableName      string
+		ConsistentRead bool
+	}
+	json.Unmarshal(body, &req)
+
+	if !readOnlyActions[action] {
+		// Invalidate again once the write is done, in case a concurrent
+		// read cached the old data meanwhile.
+		t.invalidate(body)
+		defer t.invalidate(body)
+		return t.next.RoundTrip(ctx, action, body)
+	}
+	if (action != "GetItem" && action != "Query") || req.ConsistentRead {
+		return t.next.RoundTrip(ctx, action, body)
+	}
+
+	key := action + "\x00" + string(body)
+	b, gen, ok := t.cache.get(key)
+	if ok {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	rc, err := t.next.RoundTrip(ctx, action, body)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if t.limit > 0 {
+		rc = aws4.LimitBody(rc, t.limit)
+	}
+	if b, err = ioutil.ReadAll(rc); err != nil {
+		return nil, err
+	}
+	t.cache.put(gen, key, req.TableName, b)
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (t *cachingTransport) invalidate(body []byte) {
+	if tables := writeTables(body); tables != nil {
+		t.cache.Invalidate(tables...)
+	} else {
+		t.cache.Purge()
+	}
+}
+
+// writeTables returns the tables named by a write request, or nil if they
+// can't be determined.
+func writeTables(body []byte) []string {
+	var req struct {
+		TableName     string
+		RequestItems  map[string]json.RawMessage
+		TransactItems []map[string]struct{ TableName string }
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return nil
+	}
+
+	var tables []string
+	switch {
+	case req.TableName != "":
+		tables = append(tables, req.TableName)
+	case req.RequestItems != nil:
+		for t := range req.RequestItems {
+			tables = append(tables, t)
+		}
+	case req.TransactItems != nil:
+		for _, ti := range req.TransactItems {
+			for _, op := range ti {
+				tables = append(tables, op.TableName)
+			}
+		}
+	}
+	return tables
+}
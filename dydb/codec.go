@@ -0,0 +1,726 @@
+package dydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Marshal returns the DynamoDB encoding of v as an item. v must be a struct,
+// a map with string keys, or a pointer to one.
+//
+// Booleans, strings and numbers map to BOOL, S and N; json.Number, big.Int
+// and big.Float are kept verbatim so numbers survive without loss of
+// precision. []byte and byte arrays map to B, other slices and arrays to L,
+// maps and structs to M, and nil pointers, interfaces, slices and maps to
+// NULL. Lists and maps may nest up to MaxDepth levels. Empty strings, binary
+// values, lists and maps are kept, as DynamoDB allows them outside of keys.
+//
+// Struct fields are encoded under their Go name unless a `dynamo:"name"` tag
+// says otherwise. The name "-" skips the field, the tag option "omitempty"
+// skips zero values, and "nullempty" encodes zero values as NULL, which keeps
+// empty strings out of attributes used as index keys.
+//
+// Types implementing Marshaler control their own encoding. Other types
+// implementing encoding.TextMarshaler, such as time.Time, are encoded as S.
+// Unmarshal honors Unmarshaler and encoding.TextUnmarshaler the same way.
+//
+// The tag option "set" encodes a slice of strings, numbers or byte slices as
+// an SS, NS or BS set instead of a list. Maps with empty struct values, like
+// map[string]struct{}, are always encoded as sets. Empty sets are omitted,
+// since DynamoDB does not store them. Sets decode into slices and set maps.
+func Marshal(v interface{}) (Item, error) {
+	av, err := MarshalValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if av.M == nil {
+		return nil, fmt.Errorf("dydb: cannot marshal %T as an item", v)
+	}
+	return av.M, nil
+}
+
+// MarshalValue returns the DynamoDB encoding of v as a single attribute
+// value. See Marshal for the mapping rules.
+func MarshalValue(v interface{}) (*AttributeValue, error) {
+	rv := reflect.ValueOf(v)
+	if rv.IsValid() && rv.Kind() != reflect.Ptr {
+		// Make the value addressable so pointer methods are found.
+		p := reflect.New(rv.Type()).Elem()
+		p.Set(rv)
+		rv = p
+	}
+	return marshalValue(rv, 0)
+}
+
+// Unmarshal decodes item into the struct or map pointed to by v, using the
+// inverse of the rules described for Marshal. Attributes without a matching
+// struct field are ignored.
+func Unmarshal(item Item, v interface{}) error {
+	return UnmarshalValue(&AttributeValue{M: item}, v)
+}
+
+// UnmarshalValue decodes av into the value pointed to by v. Into an empty
+// interface, S decodes to string, N to json.Number, B to []byte, SS, NS and
+// BS to []string, []json.Number and [][]byte, L to []interface{} and M to
+// map[string]interface{}.
+func UnmarshalValue(av *AttributeValue, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("dydb: Unmarshal(non-pointer %T)", v)
+	}
+	return unmarshalValue(av, rv.Elem())
+}
+
+// ItemToMap converts item to a plain Go document, as UnmarshalValue does for
+// an empty interface.
+func ItemToMap(item Item) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := Unmarshal(item, &m)
+	return m, err
+}
+
+// MapToItem converts a plain Go document to an item.
+func MapToItem(m map[string]interface{}) (Item, error) {
+	return Marshal(m)
+}
+
+// ItemToJSON converts item from DynamoDB JSON to an ordinary JSON document.
+// Numbers are written verbatim, sets as arrays and binary values as base64
+// strings.
+func ItemToJSON(item Item) ([]byte, error) {
+	m, err := ItemToMap(item)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// JSONToItem converts an ordinary JSON object to an item. Numbers keep their
+// original text, arrays become lists and null becomes NULL.
+func JSONToItem(data []byte) (Item, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return MapToItem(m)
+}
+
+// An UnmarshalTypeError describes an attribute value that can't be decoded
+// into a Go value of a specific type.
+type UnmarshalTypeError struct {
+	Value string // the DynamoDB type, or a description of the value
+	Type  reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "dydb: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+}
+
+var errTooDeep = fmt.Errorf("dydb: value nested deeper than %d levels", MaxDepth)
+
+var (
+	numberType         = reflect.TypeOf(json.Number(""))
+	bigIntType         = reflect.TypeOf(big.Int{})
+	bigFloatType       = reflect.TypeOf(big.Float{})
+	attributeValueType = reflect.TypeOf((*AttributeValue)(nil))
+)
+
+func numberValue(s string) *AttributeValue {
+	return &AttributeValue{N: &s}
+}
+
+// MaxDepth is the deepest nesting of lists and maps DynamoDB stores.
+const MaxDepth = 32
+
+func marshalValue(v reflect.Value, depth int) (*AttributeValue, error) {
+	if !v.IsValid() {
+		return NullValue(), nil
+	}
+
+	switch v.Type() {
+	case attributeValueType:
+		if v.IsNil() {
+			return NullValue(), nil
+		}
+		return v.Interface().(*AttributeValue), nil
+	case numberType:
+		if v.String() == "" {
+			return nil, errors.New("dydb: cannot marshal empty json.Number")
+		}
+		return numberValue(v.String()), nil
+	case bigIntType:
+		n := v.Interface().(big.Int)
+		return numberValue(n.String()), nil
+	case bigFloatType:
+		f := v.Interface().(big.Float)
+		if f.IsInf() {
+			return nil, fmt.Errorf("dydb: cannot marshal %v", &f)
+		}
+		return numberValue(f.Text('g', -1)), nil
+	}
+
+	if k := v.Kind(); k != reflect.Ptr && k != reflect.Interface {
+		if av, ok, err := marshalCustom(v); ok {
+			return av, err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NullValue(), nil
+		}
+		return marshalValue(v.Elem(), depth)
+
+	case reflect.Bool:
+		b := v.Bool()
+		return &AttributeValue{BOOL: &b}, nil
+
+	case reflect.String:
+		s := v.String()
+		return &AttributeValue{S: &s}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return numberValue(strconv.FormatInt(v.Int(), 10)), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return numberValue(strconv.FormatUint(v.Uint(), 10)), nil
+
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("dydb: cannot marshal %v", f)
+		}
+		return numberValue(strconv.FormatFloat(f, 'g', -1, v.Type().Bits())), nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return NullValue(), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return &AttributeValue{B: v.Bytes()}, nil
+		}
+		fallthrough
+	case reflect.Array:
+		if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			for i := range b {
+				b[i] = byte(v.Index(i).Uint())
+			}
+			return &AttributeValue{B: b}, nil
+		}
+		if depth == MaxDepth {
+			return nil, errTooDeep
+		}
+		l := make([]*AttributeValue, v.Len())
+		for i := range l {
+			av, err := marshalValue(v.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = av
+		}
+		return &AttributeValue{L: l}, nil
+
+	case reflect.Map:
+		if isSetMap(v.Type()) {
+			return marshalSet(v)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			return NullValue(), nil
+		}
+		if depth == MaxDepth {
+			return nil, errTooDeep
+		}
+		m := make(Item, v.Len())
+		for _, k := range v.MapKeys() {
+			av, err := marshalValue(v.MapIndex(k), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[k.String()] = av
+		}
+		return &AttributeValue{M: m}, nil
+
+	case reflect.Struct:
+		if depth == MaxDepth {
+			return nil, errTooDeep
+		}
+		m := make(Item)
+		for _, f := range structFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitempty && isEmptyValue(fv)) {
+				continue
+			}
+			if f.set || isSetMap(fv.Type()) {
+				av, err := marshalSet(fv)
+				if err != nil {
+					return nil, err
+				}
+				if av.NULL == nil {
+					m[f.name] = av
+				}
+				continue
+			}
+			if f.nullempty && isEmptyValue(fv) {
+				m[f.name] = NullValue()
+				continue
+			}
+			av, err := marshalValue(fv, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[f.name] = av
+		}
+		return &AttributeValue{M: m}, nil
+	}
+
+	return nil, fmt.Errorf("dydb: cannot marshal %s", v.Type())
+}
+
+func unmarshalValue(av *AttributeValue, v reflect.Value) error {
+	if av == nil || av.NULL != nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Type() {
+	case attributeValueType:
+		v.Set(reflect.ValueOf(av))
+		return nil
+	case numberType:
+		if av.N == nil {
+			return &UnmarshalTypeError{av.typeName(), v.Type()}
+		}
+		v.SetString(*av.N)
+		return nil
+	case bigIntType:
+		n, err := av.BigInt()
+		if err != nil {
+			return &UnmarshalTypeError{av.typeName(), v.Type()}
+		}
+		v.Set(reflect.ValueOf(*n))
+		return nil
+	case bigFloatType:
+		f, err := av.BigFloat()
+		if err != nil {
+			return &UnmarshalTypeError{av.typeName(), v.Type()}
+		}
+		v.Set(reflect.ValueOf(*f))
+		return nil
+	}
+
+	if k := v.Kind(); k != reflect.Ptr && k != reflect.Interface {
+		if ok, err := unmarshalCustom(av, v); ok {
+			return err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalValue(av, v.Elem())
+
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		x, err := interfaceValue(av)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+
+	case reflect.Bool:
+		if av.BOOL == nil {
+			break
+		}
+		v.SetBool(*av.BOOL)
+		return nil
+
+	case reflect.String:
+		if av.S == nil {
+			break
+		}
+		v.SetString(*av.S)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if av.N == nil {
+			break
+		}
+		n, err := strconv.ParseInt(*av.N, 10, v.Type().Bits())
+		if err != nil {
+			return &UnmarshalTypeError{"number " + *av.N, v.Type()}
+		}
+		v.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if av.N == nil {
+			break
+		}
+		n, err := strconv.ParseUint(*av.N, 10, v.Type().Bits())
+		if err != nil {
+			return &UnmarshalTypeError{"number " + *av.N, v.Type()}
+		}
+		v.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		if av.N == nil {
+			break
+		}
+		f, err := strconv.ParseFloat(*av.N, v.Type().Bits())
+		if err != nil {
+			return &UnmarshalTypeError{"number " + *av.N, v.Type()}
+		}
+		v.SetFloat(f)
+		return nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && av.B != nil {
+			v.SetBytes(append([]byte(nil), av.B...))
+			return nil
+		}
+		l, ok := av.elements()
+		if !ok {
+			break
+		}
+		s := reflect.MakeSlice(v.Type(), len(l), len(l))
+		for i, e := range l {
+			if err := unmarshalValue(e, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && av.B != nil {
+			if len(av.B) != v.Len() {
+				return &UnmarshalTypeError{fmt.Sprintf("B of length %d", len(av.B)), v.Type()}
+			}
+			for i, b := range av.B {
+				v.Index(i).SetUint(uint64(b))
+			}
+			return nil
+		}
+		l, ok := av.elements()
+		if !ok {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i < len(l) {
+				if err := unmarshalValue(l[i], v.Index(i)); err != nil {
+					return err
+				}
+			} else {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if isSetMap(v.Type()) {
+			return unmarshalSetMap(av, v)
+		}
+		if av.M == nil || v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		kt, et := v.Type().Key(), v.Type().Elem()
+		for k, e := range av.M {
+			ev := reflect.New(et).Elem()
+			if err := unmarshalValue(e, ev); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(kt), ev)
+		}
+		return nil
+
+	case reflect.Struct:
+		if av.M == nil {
+			break
+		}
+		for _, f := range structFields(v.Type()) {
+			e, ok := av.M[f.name]
+			if !ok {
+				continue
+			}
+			fv, err := allocFieldByIndex(v, f.index)
+			if err != nil {
+				return err
+			}
+			if err := unmarshalValue(e, fv); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return &UnmarshalTypeError{av.typeName(), v.Type()}
+}
+
+// interfaceValue returns av as a plain Go value.
+func interfaceValue(av *AttributeValue) (interface{}, error) {
+	switch {
+	case av == nil || av.NULL != nil:
+		return nil, nil
+	case av.BOOL != nil:
+		return *av.BOOL, nil
+	case av.S != nil:
+		return *av.S, nil
+	case av.N != nil:
+		return json.Number(*av.N), nil
+	case av.B != nil:
+		return av.B, nil
+	case av.SS != nil:
+		return av.SS, nil
+	case av.NS != nil:
+		ns := make([]json.Number, len(av.NS))
+		for i, n := range av.NS {
+			ns[i] = json.Number(n)
+		}
+		return ns, nil
+	case av.BS != nil:
+		return av.BS, nil
+	case av.M != nil:
+		m := make(map[string]interface{}, len(av.M))
+		for k, e := range av.M {
+			x, err := interfaceValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = x
+		}
+		return m, nil
+	case av.L != nil:
+		l := make([]interface{}, len(av.L))
+		for i, e := range av.L {
+			x, err := interfaceValue(e)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = x
+		}
+		return l, nil
+	}
+	return nil, errors.New("dydb: attribute value has no type")
+}
+
+// typeName returns the DynamoDB type descriptor of av.
+func (av *AttributeValue) typeName() string {
+	switch {
+	case av.NULL != nil:
+		return "NULL"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.B != nil:
+		return "B"
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	case av.M != nil:
+		return "M"
+	case av.L != nil:
+		return "L"
+	}
+	return "empty value"
+}
+
+// elements returns the members of a list or set value.
+func (av *AttributeValue) elements() ([]*AttributeValue, bool) {
+	switch {
+	case av.L != nil:
+		return av.L, true
+	case av.SS != nil:
+		l := make([]*AttributeValue, len(av.SS))
+		for i := range av.SS {
+			l[i] = &AttributeValue{S: &av.SS[i]}
+		}
+		return l, true
+	case av.NS != nil:
+		l := make([]*AttributeValue, len(av.NS))
+		for i := range av.NS {
+			l[i] = &AttributeValue{N: &av.NS[i]}
+		}
+		return l, true
+	case av.BS != nil:
+		l := make([]*AttributeValue, len(av.BS))
+		for i := range av.BS {
+			l[i] = &AttributeValue{B: av.BS[i]}
+		}
+		return l, true
+	}
+	return nil, false
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitempty bool
+	nullempty bool
+	set       bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the encoded fields of struct type t. Fields of
+// embedded structs are promoted unless shadowed by an outer field.
+func structFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	fields := typeFields(t, map[reflect.Type]bool{t: true})
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// typeFields returns the fields of t, skipping the embedded structs of
+// visiting, the types being visited, which embed themselves.
+func typeFields(t reflect.Type, visiting map[reflect.Type]bool) []field {
+	var fields, embedded []field
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("dynamo")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if visiting[ft] {
+				continue
+			}
+			visiting[ft] = true
+			for _, f := range typeFields(ft, visiting) {
+				f.index = append([]int{i}, f.index...)
+				embedded = append(embedded, f)
+			}
+			delete(visiting, ft)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		seen[name] = true
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			omitempty: hasOption(opts, "omitempty"),
+			nullempty: hasOption(opts, "nullempty"),
+			set:       hasOption(opts, "set"),
+		})
+	}
+	for _, f := range embedded {
+		if !seen[f.name] {
+			seen[f.name] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func hasOption(opts, name string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex is like v.FieldByIndex, but reports false instead of
+// panicking when it meets a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// allocFieldByIndex is like v.FieldByIndex, but allocates nil embedded
+// pointers on the way. It fails if one is a pointer to an unexported
+// struct, which can't be set, as encoding/json does.
+func allocFieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("dydb: cannot set embedded pointer to unexported struct: %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,432 @@
+package dydb_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4/dydb"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type post struct {
+	Slug    string `dynamo:"slug"`
+	Title   string
+	Views   int64
+	Rating  float64 `dynamo:",omitempty"`
+	Tags    []string
+	Body    []byte
+	Draft   bool
+	Author  *string
+	Ignored string `dynamo:"-"`
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	in := post{
+		Slug:    "hello",
+		Title:   "Hello, World",
+		Views:   9007199254740993, // not representable as a float64
+		Tags:    []string{"go", "aws"},
+		Body:    []byte{0, 1, 2},
+		Draft:   true,
+		Ignored: "x",
+	}
+
+	item, err := dydb.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := item["Ignored"]; ok {
+		t.Error("Ignored field was marshaled")
+	}
+	if _, ok := item["Rating"]; ok {
+		t.Error("empty omitempty field was marshaled")
+	}
+	if item["Author"].NULL == nil {
+		t.Errorf("Author = %+v, want NULL", item["Author"])
+	}
+	if got := *item["Views"].N; got != "9007199254740993" {
+		t.Errorf("Views = %s", got)
+	}
+
+	var out post
+	if err := dydb.Unmarshal(item, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Ignored = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	item := dydb.Item{"Views": {N: strPtr("1.5")}}
+	var out post
+	err := dydb.Unmarshal(item, &out)
+	if _, ok := err.(*dydb.UnmarshalTypeError); !ok {
+		t.Errorf("err = %v, want *UnmarshalTypeError", err)
+	}
+}
+
+func TestJSONConversion(t *testing.T) {
+	const doc = `{"a":12345678901234567890.5,"b":[true,null,"x"],"c":{"d":1}}`
+
+	item, err := dydb.JSONToItem([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *item["a"].N; got != "12345678901234567890.5" {
+		t.Errorf("a = %s", got)
+	}
+
+	b, err := dydb.ItemToJSON(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != doc {
+		t.Errorf("got %s, want %s", b, doc)
+	}
+}
+
+func TestItemToMapSets(t *testing.T) {
+	item := dydb.Item{
+		"ss": {SS: []string{"a", "b"}},
+		"ns": {NS: []string{"1", "2.5"}},
+	}
+
+	m, err := dydb.ItemToMap(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"ss": []string{"a", "b"},
+		"ns": []json.Number{"1", "2.5"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %#v, want %#v", m, want)
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	const n = "123456789012345678901234567890123456.78"
+
+	var v struct{ F *big.Float }
+	if err := dydb.Unmarshal(dydb.Item{"F": {N: strPtr(n)}}, &v); err != nil {
+		t.Fatal(err)
+	}
+	item, err := dydb.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := item["F"].BigFloat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Cmp(v.F) != 0 {
+		t.Errorf("got %s, want %s", f.Text('g', -1), n)
+	}
+
+	if _, err := (&dydb.AttributeValue{N: strPtr("1e400")}).Int64(); err == nil {
+		t.Error("Int64 accepted 1e400")
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type blob struct {
+		ID     [4]byte
+		Chunks [][]byte
+	}
+	in := blob{ID: [4]byte{1, 2, 3, 4}}
+
+	item, err := dydb.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(item["ID"].B, []byte{1, 2, 3, 4}) {
+		t.Errorf("ID = %+v, want B", item["ID"])
+	}
+
+	item["Chunks"] = dydb.BinarySetValue([]byte("a"), []byte("b"))
+	b, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Chunks":{"BS":["YQ==","Yg=="]},"ID":{"B":"AQIDBA=="}}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	var decoded dydb.Item
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var out blob
+	if err := dydb.Unmarshal(decoded, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Chunks = [][]byte{[]byte("a"), []byte("b")}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestSets(t *testing.T) {
+	type tagged struct {
+		Tags   []string `dynamo:",set"`
+		Scores []int    `dynamo:",set"`
+		Seen   map[string]struct{}
+		Empty  []string `dynamo:",set"`
+	}
+	in := tagged{
+		Tags:   []string{"a", "b"},
+		Scores: []int{1, 2},
+		Seen:   map[string]struct{}{"y": {}, "x": {}},
+		Empty:  []string{},
+	}
+
+	item, err := dydb.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(item)
+	if want := `{"Scores":{"NS":["1","2"]},"Seen":{"SS":["x","y"]},"Tags":{"SS":["a","b"]}}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	var out tagged
+	if err := dydb.Unmarshal(item, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Empty = nil
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	av, err := dydb.MarshalSet([]string{"a", "b", "a"})
+	if err != nil || fmt.Sprint(av.SS) != "[a b]" {
+		t.Errorf("got %v, %v for duplicate members", av, err)
+	}
+	if av, err = dydb.MarshalSet([]float64{1, 1.0, 2}); err != nil || fmt.Sprint(av.NS) != "[1 2]" {
+		t.Errorf("got %v, %v for duplicate numbers", av, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	var u dydb.Update
+	u.Set("status", "done").Set("meta.count", 3).Remove("draft", "#d").Names(map[string]string{"#d": "a.b"})
+	u.Add("tags", []string{"x"}).Delete("tags", map[string]struct{}{"y": {}}).Set("last-seen", 1)
+
+	expr, err := u.Expression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SET #status = :v0, meta.#count = :v1, #xf0db30bb = :v4 REMOVE draft, #d ADD tags :v2 DELETE tags :v3"; expr.UpdateExpression != want {
+		t.Errorf("got %q, want %q", expr.UpdateExpression, want)
+	}
+	if len(expr.ExpressionAttributeNames) != 4 || expr.ExpressionAttributeNames["#count"] != "count" ||
+		expr.ExpressionAttributeNames["#d"] != "a.b" || expr.ExpressionAttributeValues[":v3"].SS[0] != "y" {
+		t.Errorf("unexpected names %v or values %v", expr.ExpressionAttributeNames, expr.ExpressionAttributeValues)
+	}
+
+	if _, err := new(dydb.Update).Add("n", "x").Expression(); err == nil {
+		t.Error("ADD of a string succeeded")
+	}
+	expr, err = new(dydb.Update).Names(map[string]string{"#status": "state"}).Set("status", 1).Expression()
+	if err != nil || expr.UpdateExpression != "SET #statusx = :v0" {
+		t.Errorf("got %+v, %v with a placeholder taken", expr, err)
+	}
+	if _, err := new(dydb.Update).Set("status", 1).Names(map[string]string{"#status": "state"}).Expression(); err == nil {
+		t.Error("conflicting placeholder accepted")
+	}
+}
+
+func TestNested(t *testing.T) {
+	type leaf struct {
+		Name string
+		Note string `dynamo:",nullempty"`
+	}
+	type tree struct {
+		Leaves []*leaf
+		Index  map[string][]leaf
+		Extra  map[string]interface{}
+		Empty  []int
+		None   []int
+	}
+	in := tree{
+		Leaves: []*leaf{{Name: "a"}, nil},
+		Index:  map[string][]leaf{"x": {{Name: "", Note: "n"}}},
+		Extra:  map[string]interface{}{"l": []interface{}{"s", nil, map[string]interface{}{}}},
+		Empty:  []int{},
+	}
+
+	item, err := dydb.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item["Leaves"].L[0].M["Note"].NULL == nil || item["None"].NULL == nil {
+		t.Errorf("empty values not encoded as NULL: %+v", item)
+	}
+
+	var out tree
+	if err := dydb.Unmarshal(item, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	var deep interface{} = "x"
+	for i := 0; i <= dydb.MaxDepth; i++ {
+		deep = []interface{}{deep}
+	}
+	if _, err := dydb.MarshalValue(deep); err == nil {
+		t.Error("marshaled a value nested too deeply")
+	}
+}
+
+type inner struct{ A string }
+
+type Outer struct {
+	*inner
+	B string
+}
+
+type Node struct {
+	*Node
+	Name string
+}
+
+func TestEmbedded(t *testing.T) {
+	item := dydb.Item{"A": dydb.StringValue("a"), "B": dydb.StringValue("b")}
+	var out Outer
+	if err := dydb.Unmarshal(item, &out); err == nil {
+		t.Error("set an embedded pointer to an unexported struct")
+	}
+
+	// A struct embedding itself has the fields of the outer one.
+	item, err := dydb.Marshal(Node{Name: "n"})
+	if err != nil || len(item) != 1 || *item["Name"].S != "n" {
+		t.Fatalf("Marshal = %v, %v", item, err)
+	}
+	var n Node
+	if err := dydb.Unmarshal(item, &n); err != nil || n.Name != "n" {
+		t.Errorf("Unmarshal = %+v, %v", n, err)
+	}
+}
+
+type cents int64
+
+func (c cents) MarshalDynamo() (*dydb.AttributeValue, error) {
+	return dydb.MarshalValue(fmt.Sprintf("%d.%02d", c/100, c%100))
+}
+
+func (c *cents) UnmarshalDynamo(av *dydb.AttributeValue) error {
+	if av.S == nil {
+		return fmt.Errorf("cents: not a string")
+	}
+	var units, frac int64
+	if _, err := fmt.Sscanf(*av.S, "%d.%d", &units, &frac); err != nil {
+		return err
+	}
+	*c = cents(units*100 + frac)
+	return nil
+}
+
+func TestMarshaler(t *testing.T) {
+	type order struct {
+		Total   cents
+		Placed  time.Time
+		Shipped *time.Time
+	}
+	in := order{Total: 1234, Placed: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+	item, err := dydb.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *item["Total"].S != "12.34" || *item["Placed"].S != "2024-06-01T12:00:00Z" {
+		t.Errorf("unexpected encoding %+v", item)
+	}
+
+	var out order
+	if err := dydb.Unmarshal(item, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestProjection(t *testing.T) {
+	var p dydb.Projection
+	p.Fields(post{}, "Slug", "Title").Add("status", "meta.tags[0]", "slug")
+
+	expr, err := p.Expression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "slug, Title, #status, meta.tags[0]"; expr.ProjectionExpression != want {
+		t.Errorf("got %q, want %q", expr.ProjectionExpression, want)
+	}
+	names, err := dydb.MergeNames(expr.ExpressionAttributeNames, map[string]string{"#t": "type"})
+	if err != nil || len(names) != 2 || names["#status"] != "status" {
+		t.Errorf("names = %v, %v", names, err)
+	}
+
+	if _, err := new(dydb.Projection).Fields(post{}, "Ignored").Expression(); err == nil {
+		t.Error("projected a field that isn't encoded")
+	}
+	if _, err := new(dydb.Projection).Fields(&post{}).Expression(); err != nil {
+		t.Error(err)
+	}
+
+	// Tag names with dots are single attributes, not paths.
+	type dotted struct {
+		Host string `dynamo:"host.name"`
+	}
+	expr, err = new(dydb.Projection).Fields(dotted{}).Expression()
+	if err != nil || strings.Contains(expr.ProjectionExpression, ".") || len(expr.ExpressionAttributeNames) != 1 {
+		t.Errorf("got %+v, %v", expr, err)
+	}
+	for _, name := range expr.ExpressionAttributeNames {
+		if name != "host.name" {
+			t.Errorf("names %v", expr.ExpressionAttributeNames)
+		}
+	}
+}
+
+func TestKeyCondition(t *testing.T) {
+	for _, tt := range []struct {
+		sort *dydb.SortCondition
+		want string
+	}{
+		{nil, "pk = :v0"},
+		{dydb.Eq(dydb.NumberKey("sk", 3)), "pk = :v0 AND sk = :v1"},
+		{dydb.GE(dydb.StringKey("date", "2024")), "pk = :v0 AND #date >= :v1"},
+		{dydb.Between(dydb.NumberKey("sk", 1), dydb.NumberKey("sk", 9)), "pk = :v0 AND sk BETWEEN :v1 AND :v2"},
+		{dydb.BeginsWith(dydb.StringKey("sk", "order#")), "pk = :v0 AND begins_with(sk, :v1)"},
+		{dydb.Between(dydb.NumberKey("a", 1), dydb.NumberKey("b", 9)), ""},
+		{dydb.BeginsWith(dydb.NumberKey("sk", 1)), ""},
+		{dydb.LT(dydb.StringKey("pk", "x")), ""},
+	} {
+		c := &dydb.KeyCondition{Partition: dydb.StringKey("pk", "user#1"), Sort: tt.sort}
+		expr, err := c.Expression()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%+v accepted", tt.sort)
+			}
+			continue
+		}
+		if err != nil || expr.KeyConditionExpression != tt.want || *expr.ExpressionAttributeValues[":v0"].S != "user#1" {
+			t.Errorf("got %+v, %v, want %q", expr, err, tt.want)
+		}
+	}
+
+	key := dydb.Key{Partition: dydb.StringKey("pk", "a"), Sort: dydb.NumberKey("sk", 2)}.Item()
+	if len(key) != 2 || *key["sk"].N != "2" {
+		t.Errorf("key item %v", key)
+	}
+}
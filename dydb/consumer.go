@@ -0,0 +1,347 @@
+package dydb
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultShardSyncInterval is how often a StreamConsumer looks for new
+// shards by default.
+const DefaultShardSyncInterval = time.Minute
+
+// shardEnd is the checkpoint of a shard read to its end.
+const shardEnd = "SHARD_END"
+
+// A StreamConsumer delivers the records of a DynamoDB stream to Handler, in
+// the manner of the Kinesis Client Library:
+//
+//   - shards are discovered every ShardSyncInterval, and a child shard is
+//     only read once its parent has been read to its end;
+//   - after Handler returns nil for a batch of records, the sequence number
+//     of the last one is checkpointed; if Handler fails the batch is
+//     delivered again, so delivery is at least once;
+//   - with Leases set, several consumers share the shards of a stream:
+//     each holds a lease (a LockClient lock) on the shards it reads,
+//     leases of dead consumers are taken over, and every consumer aims for
+//     an equal share of the shards. Checkpoints are stored in the lease
+//     table, so that a new holder resumes where the last one stopped.
+//
+// Without Leases, a single consumer reads every shard and keeps its
+// checkpoints in memory.
+type StreamConsumer struct {
+	// Streams is a DynamoDB Streams DB, such as one from NewStreamsDB.
+	Streams   *DB
+	StreamArn string
+
+	// Handler is called with the records of each GetRecords call of a
+	// shard, one call at a time per shard.
+	Handler func(ctx context.Context, shard string, records []StreamRecord) error
+
+	// Leases, if not nil, holds the shard leases and checkpoints.
+	Leases *LockClient
+
+	// StartingPosition is the iterator type of shards without a
+	// checkpoint, TrimHorizon or Latest. If empty, TrimHorizon is used.
+	StartingPosition string
+
+	// If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// If zero, DefaultShardSyncInterval is used.
+	ShardSyncInterval time.Duration
+
+	mu          sync.Mutex
+	running     map[string]*shardReader
+	checkpoints map[string]string // without Leases
+}
+
+// A shardReader is the goroutine acquiring and reading a shard.
+type shardReader struct {
+	stop context.CancelFunc
+}
+
+// Run consumes the stream until ctx is done, then releases the leases held
+// and returns ctx.Err().
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	c.mu.Lock()
+	c.running = make(map[string]*shardReader)
+	if c.checkpoints == nil {
+		c.checkpoints = make(map[string]string)
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		// Failures are retried at the next sync.
+		c.syncShards(ctx, &wg)
+		if err := c.Streams.clock().Sleep(ctx, c.syncInterval()); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *StreamConsumer) syncInterval() time.Duration {
+	if c.ShardSyncInterval <= 0 {
+		return DefaultShardSyncInterval
+	}
+	return c.ShardSyncInterval
+}
+
+// syncShards starts reading the shards this consumer should read, and stops
+// reading those beyond its share.
+func (c *StreamConsumer) syncShards(ctx context.Context, wg *sync.WaitGroup) error {
+	shards, err := c.Streams.DescribeShards(ctx, c.StreamArn)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(shards))
+	for _, s := range shards {
+		present[s.ShardId] = true
+	}
+	var ready []string
+	for _, s := range shards {
+		if cp, err := c.checkpoint(ctx, s.ShardId); err != nil || cp == shardEnd {
+			continue
+		}
+		if s.ParentShardId != "" && present[s.ParentShardId] {
+			if cp, err := c.checkpoint(ctx, s.ParentShardId); err != nil || cp != shardEnd {
+				continue
+			}
+		}
+		ready = append(ready, s.ShardId)
+	}
+
+	target := len(ready)
+	if c.Leases != nil {
+		workers, err := c.registerWorker(ctx)
+		if err != nil {
+			return err
+		}
+		target = (len(ready) + workers - 1) / workers
+	}
+
+	c.mu.Lock()
+	held := len(c.running)
+	// Give up the shards beyond our share, for other consumers to take.
+	for shard, r := range c.running {
+		if held <= target {
+			break
+		}
+		r.stop()
+		delete(c.running, shard)
+		held--
+	}
+	for _, shard := range ready {
+		if held >= target {
+			break
+		}
+		if c.running[shard] != nil {
+			continue
+		}
+		held++
+		sctx, stop := context.WithCancel(ctx)
+		r := &shardReader{stop: stop}
+		c.running[shard] = r
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			defer stop()
+			if lease, err := c.acquire(sctx, shard); err == nil {
+				c.readShard(sctx, shard, lease)
+			}
+			c.mu.Lock()
+			if c.running[shard] == r {
+				delete(c.running, shard)
+			}
+			c.mu.Unlock()
+		}(shard)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// acquire takes the lease of shard, waiting long enough to take over the
+// lease of a dead consumer. It returns a nil Lock without Leases.
+func (c *StreamConsumer) acquire(ctx context.Context, shard string) (*Lock, error) {
+	if c.Leases == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*c.Leases.leaseDuration())
+	defer cancel()
+	return c.Leases.Acquire(ctx, "lease/"+c.StreamArn+"/"+shard, nil)
+}
+
+// readShard delivers the records of shard until it ends, the lease is lost
+// or ctx is done.
+func (c *StreamConsumer) readShard(ctx context.Context, shard string, lease *Lock) {
+	if lease != nil {
+		defer lease.Release(context.Background())
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-lease.Lost():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	poll := c.PollInterval
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+
+	iter := ""
+	for ctx.Err() == nil {
+		if iter == "" {
+			var err error
+			if iter, err = c.iterator(ctx, shard); err != nil {
+				c.Streams.clock().Sleep(ctx, poll)
+				continue
+			}
+		}
+
+		records, next, err := c.Streams.GetRecords(ctx, iter, 0)
+		if IsException(err, "ExpiredIteratorException") {
+			iter = ""
+			continue
+		}
+		if err != nil {
+			c.Streams.clock().Sleep(ctx, poll)
+			continue
+		}
+
+		if len(records) > 0 {
+			if err := c.Handler(ctx, shard, records); err != nil {
+				// Deliver the same records again.
+				iter = ""
+				c.Streams.clock().Sleep(ctx, poll)
+				continue
+			}
+			c.setCheckpoint(ctx, shard, records[len(records)-1].Dynamodb.SequenceNumber)
+		}
+		if next == "" {
+			c.setCheckpoint(ctx, shard, shardEnd)
+			return
+		}
+		iter = next
+		if len(records) == 0 {
+			c.Streams.clock().Sleep(ctx, poll)
+		}
+	}
+}
+
+// iterator returns an iterator resuming shard from its checkpoint.
+func (c *StreamConsumer) iterator(ctx context.Context, shard string) (string, error) {
+	cp, err := c.checkpoint(ctx, shard)
+	if err != nil {
+		return "", err
+	}
+	if cp != "" {
+		return c.Streams.GetShardIterator(ctx, c.StreamArn, shard, AfterSequenceNumber, cp)
+	}
+	start := c.StartingPosition
+	if start == "" {
+		start = TrimHorizon
+	}
+	return c.Streams.GetShardIterator(ctx, c.StreamArn, shard, start, "")
+}
+
+func (c *StreamConsumer) checkpointKey(shard string) Item {
+	return Item{c.Leases.partitionKey(): StringValue("checkpoint/" + c.StreamArn + "/" + shard)}
+}
+
+// checkpoint returns the checkpoint of shard, or "" if it has none.
+func (c *StreamConsumer) checkpoint(ctx context.Context, shard string) (string, error) {
+	if c.Leases == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.checkpoints[shard], nil
+	}
+	var resp struct{ Item Item }
+	err := c.Leases.db().RetryQueryContext(ctx, "GetItem", map[string]interface{}{
+		"TableName":      c.Leases.Table,
+		"Key":            c.checkpointKey(shard),
+		"ConsistentRead": true,
+	}, DefaultStreamRetries).Decode(&resp)
+	if err != nil {
+		return "", err
+	}
+	if av := resp.Item["sequenceNumber"]; av != nil && av.S != nil {
+		return *av.S, nil
+	}
+	return "", nil
+}
+
+func (c *StreamConsumer) setCheckpoint(ctx context.Context, shard, seq string) error {
+	if c.Leases == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.checkpoints[shard] = seq
+		return nil
+	}
+	item := c.checkpointKey(shard)
+	item["sequenceNumber"] = StringValue(seq)
+	return c.Leases.db().RetryQueryContext(ctx, "PutItem", map[string]interface{}{
+		"TableName": c.Leases.Table,
+		"Item":      item,
+	}, DefaultStreamRetries).Decode(&struct{}{})
+}
+
+// registerWorker records this consumer as alive and returns the number of
+// live consumers of the stream.
+func (c *StreamConsumer) registerWorker(ctx context.Context) (int, error) {
+	now := c.Leases.db().clock().Now()
+	prefix := "worker/" + c.StreamArn + "/"
+	pk := c.Leases.partitionKey()
+
+	err := c.Leases.db().RetryQueryContext(ctx, "PutItem", map[string]interface{}{
+		"TableName": c.Leases.Table,
+		"Item": Item{
+			pk:        StringValue(prefix + c.Leases.owner()),
+			"expires": unixValue(now.Add(3 * c.syncInterval())),
+		},
+	}, DefaultStreamRetries).Decode(&struct{}{})
+	if err != nil {
+		return 0, err
+	}
+
+	workers := 0
+	req := map[string]interface{}{
+		"TableName":                 c.Leases.Table,
+		"FilterExpression":          "begins_with(#k, :p) AND expires > :now",
+		"ExpressionAttributeNames":  map[string]string{"#k": pk},
+		"ExpressionAttributeValues": Item{":p": StringValue(prefix), ":now": unixValue(now)},
+		"Select":                    "COUNT",
+	}
+	for {
+		var resp struct {
+			Count            int
+			LastEvaluatedKey Item
+		}
+		if err := c.Leases.db().RetryQueryContext(ctx, "Scan", req, DefaultStreamRetries).Decode(&resp); err != nil {
+			return 0, err
+		}
+		workers += resp.Count
+		if resp.LastEvaluatedKey == nil {
+			break
+		}
+		req["ExclusiveStartKey"] = resp.LastEvaluatedKey
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers, nil
+}
+
+// unixValue returns an N attribute value holding t in seconds.
+func unixValue(t time.Time) *AttributeValue {
+	n := strconv.FormatInt(t.Unix(), 10)
+	return &AttributeValue{N: &n}
+}
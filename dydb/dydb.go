@@ -4,13 +4,15 @@ package dydb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	//"github.com/bmizerany/aws4"
 	"github.com/raff/aws4"
-	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +22,12 @@ type ResponseError struct {
 	StatusCode int
 	Type       string
 	Message    string
+
+	// RequestID is the ID DynamoDB gave the request, if known.
+	RequestID string
+
+	// RetryAfter is the delay DynamoDB asked for before a retry, or 0.
+	RetryAfter time.Duration
 }
 
 // IsException returns true if err is a ResponseError whos TypeName() equals
@@ -52,20 +60,144 @@ func (e *errorDecoder) Decode(v interface{}) error {
 	return e.err
 }
 
+func (e *errorDecoder) DecodeItems(v interface{}, fn func(json.RawMessage) error) error {
+	return e.err
+}
+
+func (e *errorDecoder) Body() (io.ReadCloser, error) {
+	return nil, e.err
+}
+
 type closeDecoder struct {
-	c io.Closer
+	c io.ReadCloser
 	d *json.Decoder
 }
 
+func (cd *closeDecoder) Body() (io.ReadCloser, error) {
+	return cd.c, nil
+}
+
 func (cd *closeDecoder) Decode(v interface{}) error {
 	defer cd.c.Close()
 	return cd.d.Decode(v)
 }
 
+func (cd *closeDecoder) DecodeItems(v interface{}, fn func(json.RawMessage) error) error {
+	defer cd.c.Close()
+
+	if _, err := cd.d.Token(); err != nil { // {
+		return err
+	}
+	rest := make(map[string]json.RawMessage)
+	for cd.d.More() {
+		t, err := cd.d.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := t.(string)
+		if key != "Items" {
+			var raw json.RawMessage
+			if err := cd.d.Decode(&raw); err != nil {
+				return err
+			}
+			rest[key] = raw
+			continue
+		}
+
+		if _, err := cd.d.Token(); err != nil { // [
+			return err
+		}
+		for cd.d.More() {
+			var item json.RawMessage
+			if err := cd.d.Decode(&item); err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if _, err := cd.d.Token(); err != nil { // ]
+			return err
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
 type Decoder interface {
 	Decode(v interface{}) error
 }
 
+// A BodyDecoder is a Decoder that can return its response undecoded. The
+// Decoders returned by DB implement it.
+type BodyDecoder interface {
+	Decoder
+
+	// Body returns the response undecoded, for callers that forward it
+	// verbatim, such as proxies; the caller must close it. It is an
+	// alternative to the other methods, and to decoding into a
+	// *json.RawMessage, which holds the whole response in memory.
+	Body() (io.ReadCloser, error)
+}
+
+// Body calls the Body method of d if it is a BodyDecoder, or else decodes
+// the response of d into a json.RawMessage and returns it.
+func Body(d Decoder) (io.ReadCloser, error) {
+	if bd, ok := d.(BodyDecoder); ok {
+		return bd.Body()
+	}
+	var raw json.RawMessage
+	if err := d.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(raw)), nil
+}
+
+// An ItemsDecoder is a Decoder that can stream the Items of a response. The
+// Decoders returned by DB implement it.
+type ItemsDecoder interface {
+	Decoder
+
+	// DecodeItems streams the Items of a Query or Scan response, passing
+	// each to fn as it is read rather than building a slice of them all,
+	// and decodes the other members of the response (such as Count and
+	// LastEvaluatedKey) into v, unless it is nil. It stops at the first
+	// error of fn, and returns it.
+	DecodeItems(v interface{}, fn func(item json.RawMessage) error) error
+}
+
+// DecodeItems calls the DecodeItems method of d if it is an ItemsDecoder,
+// or else decodes the whole response of d and passes its Items to fn.
+func DecodeItems(d Decoder, v interface{}, fn func(item json.RawMessage) error) error {
+	if id, ok := d.(ItemsDecoder); ok {
+		return id.DecodeItems(v, fn)
+	}
+	var raw json.RawMessage
+	if err := d.Decode(&raw); err != nil {
+		return err
+	}
+	var resp struct{ Items []json.RawMessage }
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return err
+	}
+	for _, item := range resp.Items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
 const (
 	DefaultURL     = "https://dynamodb.us-east-1.amazonaws.com/"
 	DefaultVersion = "20120810"
@@ -92,6 +224,76 @@ type DB struct {
 
 	// If empty, use default target
 	Target string
+
+	// If nil, requests are sent to URL over HTTP and signed by Client.
+	// Otherwise URL, Region, Service, Version, Target and Client are
+	// ignored and every request goes through Transport.
+	Transport Transport
+
+	// If non-nil, GetItem and Query responses are served from Cache, and
+	// writes made through this DB invalidate it.
+	Cache *Cache
+
+	// If not zero, MaxConcurrentRequests limits the number of requests in
+	// flight through this DB, as aws4.Client does. Cache hits don't count.
+	MaxConcurrentRequests int
+	QueueTimeout          time.Duration
+
+	// If not zero, AttemptTimeout limits each attempt of a request, and
+	// attempts that time out are retried like throttled ones.
+	// OperationTimeout limits a request as a whole, including all of its
+	// attempts and the backoff between them, and reading the response.
+	AttemptTimeout   time.Duration
+	OperationTimeout time.Duration
+
+	// MaxResponseSize, if not zero, limits the size of responses. Decoding
+	// a larger one fails with an *aws4.ResponseTooLargeError, rather than
+	// holding it all in memory.
+	MaxResponseSize int64
+
+	// PageTokenTTL is how long the page tokens of QueryPage and ScanPage
+	// are valid. If zero, DefaultPageTokenTTL is used.
+	PageTokenTTL time.Duration
+
+	// Idempotent overrides by action whether requests are idempotent, which
+	// decides whether they are sent again after a connection error that
+	// may have happened once DynamoDB received them. By default reads, and
+	// TransactWriteItems (which are given a ClientRequestToken), are
+	// idempotent, and other writes aren't: an UpdateItem that adds to a
+	// counter, or a conditional PutItem, would not have the same outcome
+	// twice. The context of a request can override both with
+	// aws4.WithIdempotency.
+	Idempotent map[string]bool
+
+	// OnItemCollectionMetrics, if not nil, makes the writes of Table and
+	// BatchWrite ask for the size of the item collections they write to,
+	// and is called with it, such as to alert on collections nearing
+	// MaxItemCollectionSizeGB. DynamoDB only reports it for tables with
+	// local secondary indexes.
+	OnItemCollectionMetrics func(table string, m *ItemCollectionMetrics)
+
+	// RequireTenant makes requests fail with ErrNoTenant unless their
+	// context has a Tenant (see WithTenant), so that no request of a
+	// multi-tenant application escapes the check of its tables.
+	RequireTenant bool
+
+	// EndpointDiscovery sends requests to the endpoint returned by
+	// DescribeEndpoints, which is asked for at URL and cached for as long
+	// as DynamoDB says, as the AWS SDKs do. If discovery fails, URL is used.
+	// It is ignored if Transport is set.
+	EndpointDiscovery bool
+
+	// OnRetry, if not nil, is called before every retry of a request, such
+	// as to count throttling in metrics.
+	OnRetry func(*RetryEvent)
+
+	// Clock times the backoff of retries and the polling of waiters and
+	// locks. If nil, aws4.SystemClock is used.
+	Clock Clock
+
+	semOnce   sync.Once
+	sem       aws4.Semaphore
+	discovery discovery
 }
 
 // getDetails returns the configuration details to execute a request:
@@ -124,12 +326,12 @@ func (db *DB) getDetails() (url, target, service, region string, err error) {
 	if len(db.Region) > 1 {
 		region = db.Region
 	} else {
-		parts := strings.Split(url, ".")
-		if len(parts) < 4 {
+		e, err := aws4.EndpointInfo(url)
+		if err != nil {
 			return "", "", "", "", fmt.Errorf("Invalid DynamoDB Endpoint: %s", url)
 		}
 
-		region = parts[1]
+		region = e.Region
 	}
 
 	return
@@ -142,24 +344,50 @@ func (db *DB) Exec(action string, v interface{}) error {
 	return db.Query(action, v).Decode(&x)
 }
 
+// ExecContext is like Exec, but the request is bound to ctx.
+func (db *DB) ExecContext(ctx context.Context, action string, v interface{}) error {
+	var x struct{}
+	return db.QueryContext(ctx, action, v).Decode(&x)
+}
+
 // Query executes an action with a JSON-encoded v as the body.  A nil v is
 // represented as the JSON value {}. If an error occurs while communicating
 // with DynamoDB, Query returns a Decoder that returns only the error,
-// otherwise a json.Decoder is returned.
+// otherwise a json.Decoder is returned. The json.Decoder decodes numbers into
+// interface{} values as json.Number, so they are never rounded to float64.
 func (db *DB) Query(action string, v interface{}) Decoder {
 	return db.RetryQuery(action, v, uint(1))
 }
 
+// QueryContext is like Query, but the request is bound to ctx.
+func (db *DB) QueryContext(ctx context.Context, action string, v interface{}) Decoder {
+	return db.RetryQueryContext(ctx, action, v, uint(1))
+}
+
+// RetryQuery is like Query, but makes up to retries attempts while DynamoDB
+// reports that the request was throttled, an attempt exceeds
+// AttemptTimeout, or the connection fails in a way that allows sending the
+// request again (see aws4.ConnError.Retryable). TransactWriteItems requests
+// without a ClientRequestToken are given one, so the attempts are
+// idempotent.
 func (db *DB) RetryQuery(action string, v interface{}, retries uint) Decoder {
-	cl := db.Client
-	if cl == nil {
-		cl = aws4.DefaultClient
-	}
+	return db.RetryQueryContext(context.Background(), action, v, retries)
+}
 
-	url, target, svc, region, err := db.getDetails()
+// RetryQueryContext is like RetryQuery, but the requests and the backoff
+// between them are bound to ctx.
+func (db *DB) RetryQueryContext(ctx context.Context, action string, v interface{}, retries uint) Decoder {
+	t, err := db.transport()
 	if err != nil {
 		return &errorDecoder{err: err}
 	}
+	if db.MaxConcurrentRequests > 0 {
+		db.semOnce.Do(func() { db.sem = aws4.NewSemaphore(db.MaxConcurrentRequests) })
+		t = &limitTransport{sem: db.sem, timeout: db.QueueTimeout, next: t}
+	}
+	if db.Cache != nil {
+		t = &cachingTransport{cache: db.Cache, limit: db.MaxResponseSize, next: t}
+	}
 
 	if v == nil {
 		v = struct{}{}
@@ -169,50 +397,137 @@ func (db *DB) RetryQuery(action string, v interface{}, retries uint) Decoder {
 	if err != nil {
 		return &errorDecoder{err: err}
 	}
+	if action == "TransactWriteItems" {
+		b = withRequestToken(b)
+	}
+	if err := db.checkTenant(ctx, action, b); err != nil {
+		return &errorDecoder{err: err}
+	}
 
-	var errorResponse *ResponseError
+	if retries == 0 {
+		retries = 1
+	}
 
+	ctx, cancel := withTimeout(ctx, db.OperationTimeout)
 	for i := uint(0); i < retries; i++ {
-		retry_sleep(i)
-
-		r, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
-		if err != nil {
-			return &errorDecoder{err: err}
-		}
-		r.Header.Set("Content-Type", "application/x-amz-json-1.0")
-		r.Header.Set("X-Amz-Target", target+"."+action)
-
-		resp, err := cl.DoService(svc, region, r)
-		if err != nil {
-			return &errorDecoder{err: err}
-		}
-
-		if code := resp.StatusCode; code != 200 {
-			// Read the whole body in so that Keep-Alives may be released back to the pool.
-			var e struct {
-				Message string
-				Type    string `json:"__type"`
+		if i > 0 {
+			d := retryDelay(i, err)
+			if db.OnRetry != nil {
+				db.OnRetry(&RetryEvent{Action: action, Attempt: i, Delay: d, Err: err})
 			}
-			defer resp.Body.Close()
-			json.NewDecoder(resp.Body).Decode(&e)
-			errorResponse = &ResponseError{code, e.Type, e.Message}
-			if !IsException(errorResponse, "ProvisionedThroughputExceededException") {
+			if err = db.clock().Sleep(ctx, d); err != nil {
 				break
-			} else {
-				continue
 			}
 		}
-		return &closeDecoder{c: resp.Body, d: json.NewDecoder(resp.Body)}
+
+		actx, acancel := withTimeout(ctx, db.AttemptTimeout)
+		var body io.ReadCloser
+		body, err = t.RoundTrip(actx, action, b)
+		if err == nil {
+			if db.MaxResponseSize > 0 {
+				body = aws4.LimitBody(body, db.MaxResponseSize)
+			}
+			body = &cancelCloser{body, func() { acancel(); cancel() }}
+			d := json.NewDecoder(body)
+			d.UseNumber()
+			return &closeDecoder{c: body, d: d}
+		}
+		timedOut := actx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		acancel()
+		if !isThrottle(err) && !timedOut && !db.retryableConn(ctx, action, err) {
+			break
+		}
 	}
+	cancel()
 
-	return &errorDecoder{err: errorResponse}
+	return &errorDecoder{err: err}
 }
 
-func retry_sleep(retry uint) {
-	if retry <= 0 {
-		return
+// withTimeout is like context.WithTimeout, but a zero timeout means none.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	t := (2 << (retry - 1)) * 50 * time.Millisecond
-	time.Sleep(t)
+// isThrottle returns true if err reports that DynamoDB throttled the request.
+func isThrottle(err error) bool {
+	return IsException(err, "ProvisionedThroughputExceededException") ||
+		IsException(err, "ThrottlingException") ||
+		IsException(err, "RequestLimitExceeded")
+}
+
+// retryableConn returns true if err is a connection error after which
+// action may be sent again: any failure to connect, or a failure after
+// sending the request for idempotent requests.
+func (db *DB) retryableConn(ctx context.Context, action string, err error) bool {
+	ce, ok := err.(*aws4.ConnError)
+	return ok && ce.Retryable(db.idempotent(ctx, action))
+}
+
+// idempotent returns true if sending action twice has the same outcome as
+// sending it once.
+func (db *DB) idempotent(ctx context.Context, action string) bool {
+	if v, ok := aws4.Idempotency(ctx); ok {
+		return v
+	}
+	if v, ok := db.Idempotent[action]; ok {
+		return v
+	}
+	switch action {
+	case "GetItem", "BatchGetItem", "Query", "Scan", "TransactGetItems":
+		return true
+	case "TransactWriteItems":
+		return true // RetryQuery adds a ClientRequestToken
+	}
+	return strings.HasPrefix(action, "Describe") || strings.HasPrefix(action, "List")
+}
+
+// A RetryEvent describes a retry of a request, for DB.OnRetry.
+type RetryEvent struct {
+	Action string
+
+	// Attempt is the attempt about to be made, counting from 0.
+	Attempt uint
+
+	// Delay is the wait before the attempt: the RetryAfter of Err if set,
+	// up to aws4.MaxRetryAfter, or else the exponential backoff.
+	Delay time.Duration
+
+	// Err is the error of the previous attempt.
+	Err error
+}
+
+// retryDelay returns the wait before attempt retry (counting from 0) of a
+// request whose last attempt failed with err: the delay DynamoDB asked for,
+// up to aws4.MaxRetryAfter, or else an exponential backoff from 100ms.
+func retryDelay(retry uint, err error) time.Duration {
+	if retry == 0 {
+		return 0
+	}
+	if e, ok := err.(*ResponseError); ok && e.RetryAfter > 0 {
+		if e.RetryAfter > aws4.MaxRetryAfter {
+			return aws4.MaxRetryAfter
+		}
+		return e.RetryAfter
+	}
+	return (2 << (retry - 1)) * 50 * time.Millisecond
+}
+
+func (db *DB) retry_sleep(ctx context.Context, retry uint) error {
+	if retry == 0 {
+		return nil
+	}
+	return db.clock().Sleep(ctx, retryDelay(retry, nil))
+}
+
+// A Clock is an aws4.Clock, such as an aws4.FakeClock for tests.
+type Clock = aws4.Clock
+
+func (db *DB) clock() Clock {
+	if db.Clock == nil {
+		return aws4.SystemClock
+	}
+	return db.Clock
 }
@@ -0,0 +1,1701 @@
+package dydb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/dydb"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTransport answers each action with the next canned response.
+type fakeTransport struct {
+	t         *testing.T
+	responses []interface{} // string bodies or errors
+	actions   []string
+	bodies    []string
+}
+
+func (f *fakeTransport) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	f.actions = append(f.actions, action)
+	f.bodies = append(f.bodies, string(body))
+	if len(f.responses) == 0 {
+		f.t.Fatalf("unexpected %s request: %s", action, body)
+	}
+	r := f.responses[0]
+	f.responses = f.responses[1:]
+	if err, ok := r.(error); ok {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(r.(string))), nil
+}
+
+func TestTransportRetriesThrottled(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		&dydb.ResponseError{StatusCode: 400, Type: "com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException", Message: "slow down"},
+		`{"TableNames":["Posts"]}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	var resp struct{ TableNames []string }
+	if err := db.RetryQuery("ListTables", nil, 2).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.TableNames) != 1 || len(ft.actions) != 2 {
+		t.Errorf("got %v after %d requests", resp.TableNames, len(ft.actions))
+	}
+
+	ft.responses = []interface{}{&dydb.ResponseError{StatusCode: 400, Type: "x#ValidationException", Message: "bad"}}
+	if err := db.RetryQuery("ListTables", nil, 5).Decode(&resp); !dydb.IsException(err, "ValidationException") {
+		t.Errorf("err = %v, want ValidationException", err)
+	}
+
+	var delays []time.Duration
+	db.OnRetry = func(e *dydb.RetryEvent) { delays = append(delays, e.Delay) }
+	ft.responses = []interface{}{
+		&dydb.ResponseError{StatusCode: 400, Type: "com.amazonaws.dynamodb.v20120810#ThrottlingException", RetryAfter: 10 * time.Millisecond},
+		&dydb.ResponseError{StatusCode: 400, Type: "com.amazonaws.dynamodb.v20120810#ThrottlingException"},
+		`{"TableNames":[]}`,
+	}
+	if err := db.RetryQuery("ListTables", nil, 3).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(delays) != "[10ms 200ms]" {
+		t.Errorf("retry delays %v", delays)
+	}
+
+	// Longer delays are capped.
+	delays = nil
+	db.Clock = aws4.NewFakeClock(time.Now())
+	ft.responses = []interface{}{
+		&dydb.ResponseError{StatusCode: 400, Type: "com.amazonaws.dynamodb.v20120810#ThrottlingException", RetryAfter: time.Hour},
+		`{"TableNames":[]}`,
+	}
+	if err := db.RetryQuery("ListTables", nil, 3).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(delays) != 1 || delays[0] != aws4.MaxRetryAfter {
+		t.Errorf("retry delays %v", delays)
+	}
+}
+
+func TestScanStream(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Items":[{"id":{"S":"a"}},{"id":{"S":"b"}}],"LastEvaluatedKey":{"id":{"S":"b"}}}`,
+		`{"Items":[{"id":{"S":"c"}}]}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	items, errc := db.ScanStream(context.Background(), "T", nil)
+	var ids []string
+	for item := range items {
+		ids = append(ids, *item["id"].S)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Errorf("got %v", ids)
+	}
+
+	var second map[string]json.RawMessage
+	json.Unmarshal([]byte(ft.bodies[1]), &second)
+	if string(second["ExclusiveStartKey"]) != `{"id":{"S":"b"}}` {
+		t.Errorf("second page request = %s", ft.bodies[1])
+	}
+}
+
+func TestScanStreamSegments(t *testing.T) {
+	var mu sync.Mutex
+	pages := map[int][]string{
+		0: {`{"Items":[{"id":{"S":"a"}}],"LastEvaluatedKey":{"id":{"S":"a"}}}`, `{"Items":[{"id":{"S":"b"}}]}`},
+		1: {`{"Items":[{"id":{"S":"c"}}]}`},
+	}
+	db := &dydb.DB{Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+		var req struct{ Segment, TotalSegments int }
+		json.Unmarshal(body, &req)
+		if req.TotalSegments != 2 {
+			t.Errorf("request %s", body)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		resp := pages[req.Segment][0]
+		pages[req.Segment] = pages[req.Segment][1:]
+		return ioutil.NopCloser(strings.NewReader(resp)), nil
+	})}
+
+	var wg sync.WaitGroup
+	ids := make([][]string, 2)
+	for segment := range ids {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			items, errc := db.ScanStream(context.Background(), "T", &dydb.ScanOptions{Segment: segment, TotalSegments: 2})
+			for item := range items {
+				ids[segment] = append(ids[segment], *item["id"].S)
+			}
+			if err := <-errc; err != nil {
+				t.Error(err)
+			}
+		}(segment)
+	}
+	wg.Wait()
+	if fmt.Sprint(ids) != "[[a b] [c]]" {
+		t.Errorf("got %v", ids)
+	}
+}
+
+func TestScanStreamError(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Items":[{"id":{"S":"a"}}],"LastEvaluatedKey":{"id":{"S":"a"}}}`,
+		&dydb.ResponseError{StatusCode: 400, Type: "x#ValidationException"},
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	items, errc := db.ScanStream(context.Background(), "T", nil)
+	n := 0
+	for range items {
+		n++
+	}
+	if err := <-errc; !dydb.IsException(err, "ValidationException") || n != 1 {
+		t.Errorf("got %v after %d items", err, n)
+	}
+
+	// A canceled scan stops sending items.
+	ft.responses = []interface{}{`{"Items":[{"id":{"S":"a"}},{"id":{"S":"b"}}]}`}
+	ctx, cancel := context.WithCancel(context.Background())
+	items, errc = db.ScanStream(ctx, "T", nil)
+	<-items
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("canceled scan: %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Item":{"id":{"S":"a"},"v":{"N":"1"}}}`,
+		`{}`,
+		`{"Item":{"id":{"S":"a"},"v":{"N":"2"}}}`,
+	}}
+	db := &dydb.DB{Transport: ft, Cache: dydb.NewCache(10, time.Minute)}
+
+	get := func() string {
+		var resp struct{ Item dydb.Item }
+		req := map[string]interface{}{"TableName": "T", "Key": dydb.Item{"id": {S: strPtr("a")}}}
+		if err := db.Query("GetItem", req).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return *resp.Item["v"].N
+	}
+
+	if v := get(); v != "1" {
+		t.Errorf("first read = %s", v)
+	}
+	if v := get(); v != "1" || len(ft.actions) != 1 {
+		t.Errorf("cached read = %s after %d requests", v, len(ft.actions))
+	}
+	if err := db.Exec("PutItem", map[string]interface{}{"TableName": "T"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := get(); v != "2" {
+		t.Errorf("read after write = %s", v)
+	}
+}
+
+func TestTransactWriteToken(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		errors.New("connection reset"),
+		`{}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	put := dydb.TransactWriteItem{Put: &dydb.TransactOp{TableName: "T", Item: dydb.Item{"id": {S: strPtr("a")}}}}
+	if err := db.TransactWrite(context.Background(), "", put); err != nil {
+		t.Fatal(err)
+	}
+
+	var first, second struct{ ClientRequestToken string }
+	json.Unmarshal([]byte(ft.bodies[0]), &first)
+	json.Unmarshal([]byte(ft.bodies[1]), &second)
+	if first.ClientRequestToken == "" || first.ClientRequestToken != second.ClientRequestToken {
+		t.Errorf("tokens %q and %q, want the same non-empty token", first.ClientRequestToken, second.ClientRequestToken)
+	}
+}
+
+func TestWaitForItem(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{}`,
+		`{"Item":{"id":{"S":"a"},"state":{"S":"pending"}}}`,
+		`{"Item":{"id":{"S":"a"},"state":{"S":"done"}}}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	done := func(item dydb.Item) bool {
+		return item != nil && *item["state"].S == "done"
+	}
+	key := dydb.Item{"id": {S: strPtr("a")}}
+	item, err := db.WaitForItem(context.Background(), "T", key, done, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *item["state"].S != "done" || len(ft.actions) != 3 {
+		t.Errorf("got %v after %d polls", item, len(ft.actions))
+	}
+
+	ft.responses = nil
+	for i := 0; i < 100; i++ {
+		ft.responses = append(ft.responses, `{}`)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+	if _, err := db.WaitForItem(ctx, "T", key, dydb.ItemExists, 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	held := &dydb.ResponseError{StatusCode: 400, Type: "x#ConditionalCheckFailedException"}
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		held,
+		`{"Item":{"key":{"S":"job"},"recordVersionNumber":{"S":"v1"},"leaseDuration":{"S":"10"}}}`,
+		held,
+		`{"Item":{"key":{"S":"job"},"recordVersionNumber":{"S":"v1"},"leaseDuration":{"S":"10"}}}`,
+		`{}`, // takeover after the lease expired
+		`{}`, // heartbeat
+		held, // release after another owner took over
+	}}
+	c := &dydb.LockClient{DB: &dydb.DB{Transport: ft}, Table: "locks", Owner: "me", HeartbeatPeriod: -1}
+
+	l, err := c.Acquire(context.Background(), "job", []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ft.bodies[4], `#rvn = :rvn`) || !strings.Contains(ft.bodies[4], `":rvn":{"S":"v1"}`) {
+		t.Errorf("takeover request = %s", ft.bodies[4])
+	}
+
+	before := l.RecordVersion()
+	if err := l.Heartbeat(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if l.RecordVersion() == before {
+		t.Error("heartbeat did not change the record version")
+	}
+
+	if err := l.Release(context.Background()); err != dydb.ErrLockLost {
+		t.Errorf("err = %v, want ErrLockLost", err)
+	}
+	select {
+	case <-l.Lost():
+	default:
+		t.Error("Lost channel not closed")
+	}
+}
+
+func TestLockForeignItem(t *testing.T) {
+	held := &dydb.ResponseError{StatusCode: 400, Type: "x#ConditionalCheckFailedException"}
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		held,
+		`{"Item":{"key":{"S":"job"}}}`, // no recordVersionNumber
+		`{}`,
+	}}
+	clock := aws4.NewFakeClock(time.Now())
+	c := &dydb.LockClient{DB: &dydb.DB{Transport: ft, Clock: clock}, Table: "locks", Owner: "me", HeartbeatPeriod: -1}
+
+	if _, err := c.Acquire(context.Background(), "job", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(clock.Sleeps()); got != "[1s]" {
+		t.Errorf("sleeps %s", got)
+	}
+}
+
+func TestLockReleaseFailure(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{}`, // acquire
+		&dydb.ResponseError{StatusCode: 400, Type: "x#ThrottlingException"},
+		`{}`, // heartbeat
+		`{}`, // release
+	}}
+	c := &dydb.LockClient{DB: &dydb.DB{Transport: ft}, Table: "locks", Owner: "me", HeartbeatPeriod: -1}
+	ctx := context.Background()
+
+	l, err := c.Acquire(ctx, "job", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(ctx); !dydb.IsException(err, "ThrottlingException") {
+		t.Fatalf("err = %v, want ThrottlingException", err)
+	}
+	// The lock is still held.
+	if err := l.Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ft.bodies[3], l.RecordVersion()) || len(ft.responses) != 0 {
+		t.Errorf("release request = %s", ft.bodies[3])
+	}
+	select {
+	case <-l.Lost():
+		t.Error("Lost channel closed")
+	default:
+	}
+
+	// Background heartbeats go on after a failed release.
+	var deletes, updates int32
+	c.DB.Transport = dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+		switch action {
+		case "DeleteItem":
+			if atomic.AddInt32(&deletes, 1) == 1 {
+				return nil, &dydb.ResponseError{StatusCode: 400, Type: "x#ThrottlingException"}
+			}
+		case "UpdateItem":
+			atomic.AddInt32(&updates, 1)
+		}
+		return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+	})
+	c.HeartbeatPeriod = 5 * time.Millisecond
+	if l, err = c.Acquire(ctx, "job", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(ctx); err == nil {
+		t.Fatal("release succeeded")
+	}
+	n := atomic.LoadInt32(&updates)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&updates) == n {
+		t.Error("no heartbeat after the failed release")
+	}
+	if err := l.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Attributes":{"score":{"N":"15"}}}`,
+		`{"Attributes":{"score":{"N":"99999999999999999999"}}}`,
+		&dydb.ResponseError{StatusCode: 400, Type: "x#ConditionalCheckFailedException"},
+		`{"Attributes":{"stats":{"M":{"daily":{"L":[{"N":"1"},{"N":"7"}]}}}}}`,
+	}}
+	tbl := (&dydb.DB{Transport: ft}).Table("scores")
+	key := dydb.Item{"player": dydb.StringValue("p1")}
+
+	n, err := tbl.Increment(context.Background(), key, "score", 5)
+	if err != nil || n != 15 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if !strings.Contains(ft.bodies[0], `"UpdateExpression":"ADD score :v0"`) || !strings.Contains(ft.bodies[0], `":v0":{"N":"5"}`) {
+		t.Errorf("request = %s", ft.bodies[0])
+	}
+
+	if _, err := tbl.Increment(context.Background(), key, "score", 1); err != dydb.ErrCounterRange {
+		t.Errorf("err = %v, want ErrCounterRange", err)
+	}
+	if _, err := tbl.IncrementExisting(context.Background(), key, "score", 1); err != dydb.ErrNotFound {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+	if n, err := tbl.Increment(context.Background(), key, "stats.daily[1]", 2); err != nil || n != 7 {
+		t.Errorf("nested path: got %d, %v", n, err)
+	}
+}
+
+func TestReturnValues(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Attributes":{"id":{"S":"a"},"Version":{"N":"3"}}}`,
+		`{}`,
+		`{"Attributes":{"Version":{"N":"4"}}}`,
+		`{}`,
+	}}
+	tbl := (&dydb.DB{Transport: ft}).Table("docs")
+	ctx := context.Background()
+	type doc struct {
+		ID      string `dynamo:"id"`
+		Version int
+	}
+
+	res, err := tbl.PutItemReturn(ctx, doc{"a", 4}, dydb.ReturnAllOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var old doc
+	if err := res.Unmarshal(&old); err != nil || old.Version != 3 {
+		t.Errorf("old = %+v, %v", old, err)
+	}
+	if !strings.Contains(ft.bodies[0], `"ReturnValues":"ALL_OLD"`) {
+		t.Errorf("request = %s", ft.bodies[0])
+	}
+
+	res, err = tbl.DeleteItemReturn(ctx, dydb.Item{"id": dydb.StringValue("b")}, dydb.ReturnAllOld)
+	if err != nil || res.Unmarshal(&old) != dydb.ErrNotFound {
+		t.Errorf("delete of a missing item: %+v, %v", res, err)
+	}
+
+	var u dydb.Update
+	u.Add("Version", 1)
+	res, err = tbl.UpdateItemReturn(ctx, dydb.Item{"id": dydb.StringValue("a")}, &u, dydb.ReturnUpdatedNew)
+	var updated doc
+	if err != nil || res.Unmarshal(&updated) != nil || updated.Version != 4 {
+		t.Errorf("updated = %+v, %v", updated, err)
+	}
+
+	var remove dydb.Update
+	remove.Remove("Version")
+	if _, err := tbl.UpdateItemReturn(ctx, dydb.Item{"id": dydb.StringValue("a")}, &remove, dydb.ReturnNone); err != nil {
+		t.Fatal(err)
+	}
+	if body := ft.bodies[3]; strings.Contains(body, "ExpressionAttributeValues") {
+		t.Errorf("REMOVE-only request = %s", body)
+	}
+}
+
+func TestItemCollectionMetrics(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"ItemCollectionMetrics":{"ItemCollectionKey":{"pk":{"S":"a"}},"SizeEstimateRangeGB":[8.5,9.5]}}`,
+		`{"ItemCollectionMetrics":{"T":[{"ItemCollectionKey":{"pk":{"S":"b"}},"SizeEstimateRangeGB":[0.5,1]}]}}`,
+	}}
+	var sizes []string
+	db := &dydb.DB{Transport: ft, OnItemCollectionMetrics: func(table string, m *dydb.ItemCollectionMetrics) {
+		sizes = append(sizes, fmt.Sprintf("%s/%s:%v", table, *m.ItemCollectionKey["pk"].S, m.SizeGB()))
+	}}
+
+	res, err := db.Table("T").PutItemReturn(context.Background(), map[string]string{"pk": "a"}, dydb.ReturnNone)
+	if err != nil || res.ItemCollectionMetrics == nil {
+		t.Fatalf("result = %+v, %v", res, err)
+	}
+	if !strings.Contains(ft.bodies[0], `"ReturnItemCollectionMetrics":"SIZE"`) {
+		t.Errorf("request = %s", ft.bodies[0])
+	}
+	reqs := []dydb.WriteRequest{{PutRequest: &dydb.PutRequest{Item: dydb.Item{"pk": dydb.StringValue("b")}}}}
+	if err := db.BatchWrite(context.Background(), "T", reqs, 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sizes, " ") != "T/a:9.5 T/b:1" {
+		t.Errorf("metrics = %v", sizes)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var primaryUp int32
+	var mu sync.Mutex
+	var served []string
+	replica := func(name string, up func() bool) *dydb.DB {
+		return &dydb.DB{Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+			if !up() {
+				return nil, errors.New("connection refused")
+			}
+			if action != "DescribeLimits" {
+				mu.Lock()
+				served = append(served, name)
+				mu.Unlock()
+			}
+			return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+		})}
+	}
+	f := &dydb.Failover{
+		Replicas: []*dydb.DB{
+			replica("primary", func() bool { return atomic.LoadInt32(&primaryUp) == 1 }),
+			replica("secondary", func() bool { return true }),
+		},
+		MaxFailures:   2,
+		ProbeInterval: time.Millisecond,
+	}
+	db := &dydb.DB{Transport: f}
+
+	for i := 0; i < 3; i++ {
+		if err := db.Exec("GetItem", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(f.Healthy()) != 1 {
+		t.Errorf("healthy replicas = %d, want 1", len(f.Healthy()))
+	}
+
+	atomic.StoreInt32(&primaryUp, 1)
+	for deadline := time.Now().Add(time.Second); len(f.Healthy()) != 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("primary was not probed back up")
+		}
+		db.Exec("GetItem", nil)
+		time.Sleep(time.Millisecond)
+	}
+	served = nil
+	db.Exec("GetItem", nil)
+	if len(served) != 1 || served[0] != "primary" {
+		t.Errorf("served by %v, want primary", served)
+	}
+}
+
+func TestHedgedGetItem(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := &dydb.DB{Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})}
+	fast := &dydb.DB{Transport: &fakeTransport{t: t, responses: []interface{}{
+		`{"Item":{"id":{"S":"a"},"N":{"N":"1"}}}`,
+	}}}
+
+	tbl := slow.Table("T")
+	tbl.HedgeDelay = time.Millisecond
+	tbl.HedgeDB = fast
+
+	var v struct{ N int }
+	if err := tbl.GetItem(context.Background(), dydb.Item{"id": dydb.StringValue("a")}, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.N != 1 {
+		t.Errorf("N = %d, want 1", v.N)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("slow request was not cancelled")
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	db := &dydb.DB{
+		Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+			started <- struct{}{}
+			<-release
+			return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+		}),
+		MaxConcurrentRequests: 1,
+		QueueTimeout:          10 * time.Millisecond,
+	}
+
+	done := make(chan error)
+	go func() { done <- db.Exec("GetItem", nil) }()
+	<-started
+	if err := db.Exec("GetItem", nil); err != aws4.ErrQueueTimeout {
+		t.Errorf("err = %v, want ErrQueueTimeout", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("GetItem", nil); err != nil {
+		t.Errorf("slot was not released: %v", err)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	var attempts int
+	db := &dydb.DB{
+		Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+			if attempts++; attempts < 3 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+		}),
+		AttemptTimeout: 5 * time.Millisecond,
+	}
+	if err := db.RetryQuery("GetItem", nil, 3).Decode(&struct{}{}); err != nil || attempts != 3 {
+		t.Errorf("err = %v after %d attempts, want success after 3", err, attempts)
+	}
+
+	attempts = -100
+	db.OperationTimeout = 50 * time.Millisecond
+	start := time.Now()
+	if err := db.RetryQuery("GetItem", nil, 100).Decode(&struct{}{}); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("operation took %v", d)
+	}
+}
+
+func TestPageTokens(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Items":[{"id":{"S":"a"}}],"Count":1,"ScannedCount":3,"LastEvaluatedKey":{"id":{"S":"a"}}}`,
+		`{"Items":[{"id":{"S":"b"}}],"Count":1,"ScannedCount":1}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+	opts := &dydb.QueryOptions{KeyConditionExpression: "pk = :pk"}
+	opts.ExpressionAttributeValues = dydb.Item{":pk": dydb.StringValue("x")}
+	ctx := context.Background()
+
+	p, err := db.QueryPage(ctx, "T", opts, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Next == "" {
+		t.Fatal("no next page token")
+	}
+	if p.Count != 1 || p.ScannedCount != 3 || *p.LastEvaluatedKey["id"].S != "a" {
+		t.Errorf("page metadata = %+v", p)
+	}
+	tok, err := dydb.ParsePageToken(p.Next)
+	if err != nil || tok.Table != "T" || *tok.Key["id"].S != "a" {
+		t.Fatalf("ParsePageToken = %+v, %v", tok, err)
+	}
+
+	other := &dydb.QueryOptions{KeyConditionExpression: "pk = :pk"}
+	other.ExpressionAttributeValues = dydb.Item{":pk": dydb.StringValue("y")}
+	if _, err := db.QueryPage(ctx, "T", other, p.Next); err != dydb.ErrInvalidPageToken {
+		t.Errorf("token of another query: err = %v", err)
+	}
+	if _, err := db.ScanPage(ctx, "T", nil, "garbage"); err != dydb.ErrInvalidPageToken {
+		t.Errorf("malformed token: err = %v", err)
+	}
+
+	opts.Limit = 10
+	p, err = db.QueryPage(ctx, "T", opts, p.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Next != "" || len(p.Items) != 1 {
+		t.Errorf("last page = %+v", p)
+	}
+	if !strings.Contains(ft.bodies[1], `"ExclusiveStartKey":{"id":{"S":"a"}}`) {
+		t.Errorf("second request = %s", ft.bodies[1])
+	}
+
+	tok.Expires = time.Now().Add(-time.Minute)
+	opts.Limit = 0
+	if _, err := db.QueryPage(ctx, "T", opts, tok.String()); err != dydb.ErrPageTokenExpired {
+		t.Errorf("expired token: err = %v", err)
+	}
+}
+
+func TestQueryKeyCondition(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{`{"Items":[],"Count":0}`}}
+	db := &dydb.DB{Transport: ft}
+	opts := &dydb.QueryOptions{
+		KeyCondition: &dydb.KeyCondition{
+			Partition: dydb.StringKey("pk", "x"),
+			Sort:      dydb.GT(dydb.NumberKey("sk", 5)),
+		},
+	}
+	opts.FilterExpression = "qty > :v0"
+	opts.ExpressionAttributeValues = dydb.Item{":v0": dydb.StringValue("1")}
+	if _, err := db.QueryPage(context.Background(), "T", opts, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"KeyConditionExpression":"pk = :v1 AND sk \u003e :v2"`, `":v0":{"S":"1"}`, `":v2":{"N":"5"}`} {
+		if !strings.Contains(ft.bodies[0], want) {
+			t.Errorf("request %s lacks %s", ft.bodies[0], want)
+		}
+	}
+	if len(opts.ExpressionAttributeValues) != 1 {
+		t.Errorf("options modified: %v", opts.ExpressionAttributeValues)
+	}
+}
+
+func TestOverloadedIndex(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Items":[{"Type":{"S":"user"},"Name":{"S":"bob"}},{"Type":{"S":"project"},"Name":{"S":"x"}}],"LastEvaluatedKey":{"GSI1PK":{"S":"ORG#acme"}}}`,
+		`{"Items":[{"Type":{"S":"user"},"Name":{"S":"eve"}},{"Name":{"S":"?"}}]}`,
+	}}
+	x := &dydb.OverloadedIndex{DB: &dydb.DB{Transport: ft}, Table: "T"}
+	c, err := x.Query(context.Background(), "ORG#acme", "USER#", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ft.bodies[0], `"IndexName":"GSI1"`) || !strings.Contains(ft.bodies[0], `begins_with(GSI1SK, :v1)`) {
+		t.Errorf("request = %s", ft.bodies[0])
+	}
+	if !strings.Contains(ft.bodies[1], `"ExclusiveStartKey"`) {
+		t.Errorf("second request = %s", ft.bodies[1])
+	}
+
+	var users []struct{ Name string }
+	if err := c.Unmarshal("user", &users); err != nil || len(users) != 2 || users[1].Name != "eve" {
+		t.Errorf("users = %v, %v", users, err)
+	}
+	if len(c["project"]) != 1 || len(c[""]) != 1 {
+		t.Errorf("collection = %v", c)
+	}
+
+	attrs := x.Attributes("user", "ORG#acme", "USER#bob")
+	if *attrs["GSI1SK"].S != "USER#bob" || *attrs["Type"].S != "user" {
+		t.Errorf("attributes = %v", attrs)
+	}
+}
+
+// tableTransport answers Query and CreateTable requests per table, and can
+// be used concurrently.
+type tableTransport struct {
+	mu      sync.Mutex
+	items   map[string]string // Query responses by table
+	created []string
+}
+
+func (f *tableTransport) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	var req struct{ TableName string }
+	json.Unmarshal(body, &req)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if action == "CreateTable" {
+		f.created = append(f.created, req.TableName)
+		if _, ok := f.items[req.TableName]; ok {
+			return nil, &dydb.ResponseError{StatusCode: 400, Type: "x#ResourceInUseException"}
+		}
+		return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+	}
+	resp, ok := f.items[req.TableName]
+	if !ok {
+		return nil, &dydb.ResponseError{StatusCode: 400, Type: "x#ResourceNotFoundException"}
+	}
+	return ioutil.NopCloser(strings.NewReader(resp)), nil
+}
+
+func TestTimeSeries(t *testing.T) {
+	ft := &tableTransport{items: map[string]string{
+		"events_2024_05": `{"Items":[{"t":{"N":"1"}},{"t":{"N":"2"}}]}`,
+		"events_2024_07": `{"Items":[{"t":{"N":"3"}}]}`,
+	}}
+	ts := &dydb.TimeSeries{DB: &dydb.DB{Transport: ft}, Prefix: "events_"}
+
+	from := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	names := ts.TableNames(from, to)
+	if strings.Join(names, ",") != "events_2024_04,events_2024_05,events_2024_06,events_2024_07" {
+		t.Errorf("TableNames = %v", names)
+	}
+	if name := ts.Table(to).Name; name != "events_2024_07" {
+		t.Errorf("Table = %s", name)
+	}
+
+	items, err := ts.Query(context.Background(), from, to, &dydb.QueryOptions{KeyConditionExpression: "pk = :pk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || *items[0]["t"].N != "1" || *items[2]["t"].N != "3" {
+		t.Errorf("items = %v", items)
+	}
+	items, err = ts.Query(context.Background(), from, to, &dydb.QueryOptions{KeyConditionExpression: "pk = :pk", Descending: true})
+	if err != nil || len(items) != 3 || *items[0]["t"].N != "3" {
+		t.Errorf("descending items = %v, %v", items, err)
+	}
+
+	ts.Period = dydb.Daily
+	if err := ts.CreateTables(context.Background(), time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC), 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ft.created, ",") != "events_2024_05_31,events_2024_06_01" {
+		t.Errorf("created %v", ft.created)
+	}
+}
+
+func TestConnErrorRetries(t *testing.T) {
+	reset := &aws4.ConnError{Kind: aws4.ConnReset, Err: io.EOF}
+	refused := &aws4.ConnError{Kind: aws4.ConnRefused, Connecting: true, Err: errors.New("refused")}
+	ft := &fakeTransport{t: t, responses: []interface{}{reset, `{}`}}
+	db := &dydb.DB{Transport: ft, Clock: aws4.NewFakeClock(time.Now())}
+
+	if err := db.RetryQuery("GetItem", nil, 3).Decode(&struct{}{}); err != nil || len(ft.actions) != 2 {
+		t.Errorf("GetItem: %v after %d attempts", err, len(ft.actions))
+	}
+
+	ft.actions, ft.responses = nil, []interface{}{reset}
+	if err := db.RetryQuery("PutItem", nil, 3).Decode(&struct{}{}); err != reset || len(ft.actions) != 1 {
+		t.Errorf("PutItem after reset: %v after %d attempts", err, len(ft.actions))
+	}
+
+	ft.actions, ft.responses = nil, []interface{}{refused, `{}`}
+	if err := db.RetryQuery("PutItem", nil, 3).Decode(&struct{}{}); err != nil || len(ft.actions) != 2 {
+		t.Errorf("PutItem after refused: %v after %d attempts", err, len(ft.actions))
+	}
+
+	db.Idempotent = map[string]bool{"PutItem": true, "Query": false}
+	ft.actions, ft.responses = nil, []interface{}{reset, `{}`}
+	if err := db.RetryQuery("PutItem", nil, 3).Decode(&struct{}{}); err != nil || len(ft.actions) != 2 {
+		t.Errorf("idempotent PutItem: %v after %d attempts", err, len(ft.actions))
+	}
+	ft.actions, ft.responses = nil, []interface{}{reset}
+	if err := db.RetryQuery("Query", nil, 3).Decode(&struct{}{}); err != reset || len(ft.actions) != 1 {
+		t.Errorf("non-idempotent Query: %v after %d attempts", err, len(ft.actions))
+	}
+	ft.actions, ft.responses = nil, []interface{}{reset}
+	ctx := aws4.WithIdempotency(context.Background(), false)
+	if err := db.RetryQueryContext(ctx, "PutItem", nil, 3).Decode(&struct{}{}); err != reset || len(ft.actions) != 1 {
+		t.Errorf("PutItem tagged non-idempotent: %v after %d attempts", err, len(ft.actions))
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"TableNames":["a","b"]}`,
+		`{"TableNames":["a","b","c","d","e","f"]}`,
+	}}
+	db := &dydb.DB{Transport: ft, MaxResponseSize: 30}
+
+	var resp struct{ TableNames []string }
+	if err := db.Query("ListTables", nil).Decode(&resp); err != nil || len(resp.TableNames) != 2 {
+		t.Errorf("small response: %v, %v", resp.TableNames, err)
+	}
+	err := db.Query("ListTables", nil).Decode(&resp)
+	if e, ok := err.(*aws4.ResponseTooLargeError); !ok || e.Limit != 30 {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestMaxResponseSizeCache(t *testing.T) {
+	body := `{"Item":{"id":{"S":"` + strings.Repeat("x", 1<<20) + `"}}}`
+	var r *strings.Reader
+	calls := 0
+	db := &dydb.DB{
+		Transport: dydb.TransportFunc(func(ctx context.Context, action string, b []byte) (io.ReadCloser, error) {
+			calls++
+			r = strings.NewReader(body)
+			return ioutil.NopCloser(r), nil
+		}),
+		Cache:           dydb.NewCache(10, time.Minute),
+		MaxResponseSize: 30,
+	}
+
+	req := map[string]interface{}{"TableName": "T", "Key": dydb.Item{"id": {S: strPtr("a")}}}
+	for i := 0; i < 2; i++ {
+		err := db.Query("GetItem", req).Decode(&struct{}{})
+		if e, ok := err.(*aws4.ResponseTooLargeError); !ok || e.Limit != 30 {
+			t.Errorf("err = %v", err)
+		}
+		if read := len(body) - r.Len(); read > 31 {
+			t.Errorf("read %d bytes into the cache", read)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("%d requests, want 2", calls)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	// The handler holds the pings until all have arrived, so that each
+	// needs its own connection.
+	var conns, pings int32
+	var arrived sync.WaitGroup
+	arrived.Add(3)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		if atomic.AddInt32(&pings, 1) <= 3 {
+			arrived.Done()
+			arrived.Wait()
+		}
+		io.WriteString(w, "healthy: dynamodb.us-east-1.amazonaws.com")
+	}))
+	srv.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	hc := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 3}}
+	db := &dydb.DB{Client: &aws4.Client{Keys: &aws4.Keys{}, Client: hc}, URL: srv.URL, Region: "us-east-1"}
+	if err := db.WarmUp(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&conns); n != 3 {
+		t.Errorf("%d connections", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := db.KeepWarm(ctx, 3, 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("KeepWarm: %v", err)
+	}
+	if n := atomic.LoadInt32(&conns); n != 3 {
+		t.Errorf("%d connections after KeepWarm", n)
+	}
+	if n := atomic.LoadInt32(&pings); n < 6 {
+		t.Errorf("%d pings", n)
+	}
+}
+
+func TestTenant(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{`{}`, `{}`}}
+	db := &dydb.DB{Transport: ft, RequireTenant: true}
+	acme := &dydb.Tenant{DB: db, Prefix: "acme."}
+	other := &dydb.Tenant{DB: db, Prefix: "other."}
+	ctx := dydb.WithTenant(context.Background(), acme)
+
+	if name := acme.TableName("orders"); name != "acme.orders" || !acme.Owns(name) || other.Owns(name) || acme.Owns("acme.") {
+		t.Errorf("TableName = %s", name)
+	}
+	if err := acme.Table("orders").PutItem(ctx, map[string]string{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.ExecContext(ctx, "BatchGetItem", map[string]interface{}{"RequestItems": map[string]interface{}{
+		"acme.orders": map[string]interface{}{}, "acme.users": map[string]interface{}{},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []struct {
+		action string
+		v      interface{}
+	}{
+		{"PutItem", map[string]interface{}{"TableName": "other.orders"}},
+		{"DescribeTable", map[string]interface{}{"TableArn": "arn:aws:dynamodb:us-east-1:123456789012:table/other.orders"}},
+		{"BatchWriteItem", map[string]interface{}{"RequestItems": map[string]interface{}{"acme.orders": nil, "other.orders": nil}}},
+		{"TransactWriteItems", map[string]interface{}{"TransactItems": []interface{}{
+			map[string]interface{}{"Put": map[string]string{"TableName": "acme.orders"}},
+			map[string]interface{}{"Delete": map[string]string{"TableName": "other.orders"}},
+		}}},
+	} {
+		err := db.ExecContext(ctx, req.action, req.v)
+		if e, ok := err.(*dydb.TenantError); !ok || e.Table != "other.orders" {
+			t.Errorf("%s: err = %v", req.action, err)
+		}
+	}
+	if err := db.ExecContext(ctx, "ExecuteStatement", map[string]string{"Statement": `SELECT * FROM "other.orders"`}); err == nil {
+		t.Error("PartiQL statement allowed")
+	}
+	for _, action := range []string{"ListTables", "ListBackups", "ListGlobalTables"} {
+		if err := db.ExecContext(ctx, action, nil); err == nil {
+			t.Errorf("%s allowed", action)
+		}
+	}
+	err = db.ExecContext(ctx, "TagResource", map[string]string{"ResourceArn": "arn:aws:dynamodb:us-east-1:123456789012:global-table/acme.orders"})
+	if _, ok := err.(*dydb.TenantError); !ok {
+		t.Errorf("TagResource of a global table: err = %v", err)
+	}
+
+	// Tenants must be separated from one another.
+	t1, t12 := &dydb.Tenant{DB: db, Prefix: "t1"}, &dydb.Tenant{DB: db, Prefix: "t12."}
+	if t1.Owns("t12.orders") || t12.Owns("t12.orders") != true || (&dydb.Tenant{}).Owns("orders") {
+		t.Error("tenant without a separator owns tables")
+	}
+	if err := t1.Table("orders").PutItem(dydb.WithTenant(context.Background(), t1), map[string]string{"id": "1"}); err == nil {
+		t.Error("request of a tenant without a separator allowed")
+	}
+	if err := db.ExecContext(context.Background(), "ListTables", nil); err != dydb.ErrNoTenant {
+		t.Errorf("no tenant: err = %v", err)
+	}
+	if len(ft.actions) != 2 {
+		t.Errorf("sent %v", ft.actions)
+	}
+}
+
+func TestEndpointDiscovery(t *testing.T) {
+	var discoveries, sent int32
+	account := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&sent, 1) == 2 {
+			w.WriteHeader(421)
+			io.WriteString(w, `{"__type":"com.amazonaws.dynamodb.v20120810#InvalidEndpointException","message":"moved"}`)
+			return
+		}
+		io.WriteString(w, `{"TableNames":[]}`)
+	}))
+	defer account.Close()
+	regional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "DynamoDB_20120810.DescribeEndpoints" {
+			t.Errorf("%s sent to the regional endpoint", r.Header.Get("X-Amz-Target"))
+		}
+		atomic.AddInt32(&discoveries, 1)
+		fmt.Fprintf(w, `{"Endpoints":[{"Address":%q,"CachePeriodInMinutes":1440}]}`, strings.TrimPrefix(account.URL, "http://"))
+	}))
+	defer regional.Close()
+
+	db := &dydb.DB{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: regional.URL, Region: "us-east-1", MaxConcurrentRequests: 1}
+	endpoints, err := db.DescribeEndpoints(context.Background())
+	if err != nil || len(endpoints) != 1 || endpoints[0].CachePeriod != 24*time.Hour {
+		t.Fatalf("DescribeEndpoints = %v, %v", endpoints, err)
+	}
+
+	db.EndpointDiscovery = true
+	for i := 0; i < 3; i++ {
+		err := db.Exec("ListTables", nil)
+		if i == 1 {
+			if !dydb.IsException(err, "InvalidEndpointException") {
+				t.Errorf("err = %v", err)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once by DescribeEndpoints, once at first, and once after the
+	// endpoint was reported invalid.
+	if n := atomic.LoadInt32(&discoveries); n != 3 || atomic.LoadInt32(&sent) != 3 {
+		t.Errorf("%d discoveries, %d requests", n, sent)
+	}
+}
+
+func TestEndpointDiscoveryShared(t *testing.T) {
+	var discoveries int32
+	account := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"TableNames":[]}`)
+	}))
+	defer account.Close()
+	release := make(chan struct{})
+	regional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "DynamoDB_20120810.DescribeEndpoints" {
+			t.Errorf("%s sent to the regional endpoint", r.Header.Get("X-Amz-Target"))
+		}
+		atomic.AddInt32(&discoveries, 1)
+		<-release
+		fmt.Fprintf(w, `{"Endpoints":[{"Address":%q,"CachePeriodInMinutes":1440}]}`, strings.TrimPrefix(account.URL, "http://"))
+	}))
+	defer regional.Close()
+	db := &dydb.DB{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: regional.URL, Region: "us-east-1", EndpointDiscovery: true}
+
+	// A caller giving up does not stop the discovery.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := db.ExecContext(ctx, "ListTables", nil); err == nil {
+		t.Error("ListTables succeeded after its context expired")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := db.Exec("ListTables", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&discoveries); n != 1 {
+		t.Errorf("%d discoveries", n)
+	}
+}
+
+func TestTableSpec(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{}`, `{}`,
+		`{"Table":{"TableName":"T","TableStatus":"ACTIVE","BillingModeSummary":{"BillingMode":"PAY_PER_REQUEST"},"ProvisionedThroughput":{"ReadCapacityUnits":0,"WriteCapacityUnits":0},"ItemCount":3,"CreationDateTime":1.5e9}}`,
+		`{"Table":{"TableName":"U","ProvisionedThroughput":{"ReadCapacityUnits":5,"WriteCapacityUnits":10}}}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+	ctx := context.Background()
+
+	spec := &dydb.TableSpec{
+		Name:         "T",
+		PartitionKey: dydb.KeyDefinition{Name: "PK", Type: "S"},
+		SortKey:      dydb.KeyDefinition{Name: "SK", Type: "S"},
+		Indexes: []dydb.IndexSpec{
+			{Name: "GSI1", PartitionKey: dydb.KeyDefinition{Name: "SK", Type: "S"}, SortKey: dydb.KeyDefinition{Name: "N", Type: "N"}, ProjectionType: "KEYS_ONLY"},
+		},
+	}
+	if err := db.CreateTable(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	var req map[string]interface{}
+	json.Unmarshal([]byte(ft.bodies[0]), &req)
+	if req["BillingMode"] != "PAY_PER_REQUEST" || req["ProvisionedThroughput"] != nil || len(req["AttributeDefinitions"].([]interface{})) != 3 {
+		t.Errorf("CreateTable %s", ft.bodies[0])
+	}
+	if !strings.Contains(ft.bodies[0], `"Projection":{"ProjectionType":"KEYS_ONLY"}`) {
+		t.Errorf("CreateTable %s", ft.bodies[0])
+	}
+
+	for _, bad := range []*dydb.TableSpec{
+		{Name: "T", PartitionKey: spec.PartitionKey, BillingMode: dydb.BillingModePayPerRequest, Throughput: &dydb.Throughput{ReadCapacityUnits: 1, WriteCapacityUnits: 1}},
+		{Name: "T", PartitionKey: spec.PartitionKey, BillingMode: dydb.BillingModeProvisioned},
+		{Name: "T", PartitionKey: spec.PartitionKey, Throughput: &dydb.Throughput{ReadCapacityUnits: 1, WriteCapacityUnits: 1}, Indexes: spec.Indexes},
+	} {
+		if err := db.CreateTable(ctx, bad); err == nil {
+			t.Errorf("%+v: no error", bad)
+		}
+	}
+	if err := db.SetBillingMode(ctx, "T", dydb.BillingModePayPerRequest, &dydb.Throughput{ReadCapacityUnits: 1, WriteCapacityUnits: 1}); err == nil {
+		t.Error("SetBillingMode with throughput: no error")
+	}
+	if err := db.SetBillingMode(ctx, "T", dydb.BillingModeProvisioned, &dydb.Throughput{ReadCapacityUnits: 1, WriteCapacityUnits: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if ft.bodies[1] != `{"BillingMode":"PROVISIONED","ProvisionedThroughput":{"ReadCapacityUnits":1,"WriteCapacityUnits":2},"TableName":"T"}` {
+		t.Errorf("UpdateTable %s", ft.bodies[1])
+	}
+
+	d, err := db.DescribeTable(ctx, "T")
+	if err != nil || !d.PayPerRequest() || d.ItemCount != 3 || d.Created.Unix() != 1.5e9 {
+		t.Errorf("DescribeTable = %+v, %v", d, err)
+	}
+	d, err = db.DescribeTable(ctx, "U")
+	if err != nil || d.PayPerRequest() || d.BillingMode != dydb.BillingModeProvisioned || d.Throughput.WriteCapacityUnits != 10 {
+		t.Errorf("DescribeTable = %+v, %v", d, err)
+	}
+}
+
+func TestKinesisStreamingDestination(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"TableName":"T","StreamArn":"arn:aws:kinesis:us-east-1:123456789012:stream/S","DestinationStatus":"ENABLING"}`,
+		`{"TableName":"T","KinesisDataStreamDestinations":[{"StreamArn":"arn:aws:kinesis:us-east-1:123456789012:stream/S","DestinationStatus":"ACTIVE","ApproximateCreationDateTimePrecision":"MICROSECOND"}]}`,
+		`{"DestinationStatus":"DISABLING"}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+	// The Kinesis stream ARN isn't a table of the tenant.
+	ctx := dydb.WithTenant(context.Background(), &dydb.Tenant{DB: db, Prefix: "acme."})
+	arn := "arn:aws:kinesis:us-east-1:123456789012:stream/S"
+
+	status, err := db.EnableKinesisStreamingDestination(ctx, "acme.T", arn, dydb.PrecisionMicrosecond)
+	if err != nil || status != "ENABLING" {
+		t.Errorf("Enable = %s, %v", status, err)
+	}
+	if ft.bodies[0] != `{"EnableKinesisStreamingConfiguration":{"ApproximateCreationDateTimePrecision":"MICROSECOND"},"StreamArn":"`+arn+`","TableName":"acme.T"}` {
+		t.Errorf("request %s", ft.bodies[0])
+	}
+	dests, err := db.DescribeKinesisStreamingDestination(ctx, "acme.T")
+	if err != nil || len(dests) != 1 || dests[0].Status != "ACTIVE" || dests[0].Precision != dydb.PrecisionMicrosecond || dests[0].StreamArn != arn {
+		t.Errorf("Describe = %+v, %v", dests, err)
+	}
+	if status, err := db.DisableKinesisStreamingDestination(ctx, "acme.T", arn); err != nil || status != "DISABLING" {
+		t.Errorf("Disable = %s, %v", status, err)
+	}
+	if _, err := db.EnableKinesisStreamingDestination(ctx, "other.T", arn, ""); err == nil {
+		t.Error("Enable for the table of another tenant allowed")
+	}
+}
+
+func TestContinuousBackups(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"ContinuousBackupsDescription":{"ContinuousBackupsStatus":"ENABLED","PointInTimeRecoveryDescription":{"PointInTimeRecoveryStatus":"ENABLED","RecoveryPeriodInDays":7,"EarliestRestorableDateTime":1.7e9,"LatestRestorableDateTime":1.7000003e9}}}`,
+		`{"ContinuousBackupsDescription":{"ContinuousBackupsStatus":"ENABLED","PointInTimeRecoveryDescription":{"PointInTimeRecoveryStatus":"DISABLED"}}}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+	ctx := context.Background()
+
+	c, err := db.UpdateContinuousBackups(ctx, "T", true, 7)
+	if err != nil || !c.PITREnabled() || c.RecoveryPeriodDays != 7 || c.EarliestRestorable.Unix() != 1.7e9 || c.LatestRestorable.Sub(c.EarliestRestorable) != 300*time.Second {
+		t.Errorf("Update = %+v, %v", c, err)
+	}
+	if ft.bodies[0] != `{"PointInTimeRecoverySpecification":{"PointInTimeRecoveryEnabled":true,"RecoveryPeriodInDays":7},"TableName":"T"}` {
+		t.Errorf("request %s", ft.bodies[0])
+	}
+	c, err = db.DescribeContinuousBackups(ctx, "T")
+	if err != nil || c.PITREnabled() || c.Status != "ENABLED" || !c.EarliestRestorable.IsZero() {
+		t.Errorf("Describe = %+v, %v", c, err)
+	}
+}
+
+func TestGovernor(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Table":{"ProvisionedThroughput":{"ReadCapacityUnits":5,"WriteCapacityUnits":100}}}`,
+		`{"Table":{"BillingModeSummary":{"BillingMode":"PAY_PER_REQUEST"}}}`,
+		`{"AccountMaxReadCapacityUnits":80000,"AccountMaxWriteCapacityUnits":80000,"TableMaxReadCapacityUnits":40000,"TableMaxWriteCapacityUnits":40000}`,
+	}}
+	g := &dydb.Governor{DB: &dydb.DB{Transport: ft}, Table: "T", Write: true, Share: 0.5}
+
+	if rate, err := g.Update(context.Background()); err != nil || rate != 50 {
+		t.Errorf("provisioned: rate = %v, %v", rate, err)
+	}
+	if rate, err := g.Update(context.Background()); err != nil || rate != 20000 {
+		t.Errorf("on demand: rate = %v, %v", rate, err)
+	}
+	if g.Limiter == nil || ft.actions[2] != "DescribeLimits" {
+		t.Errorf("actions = %v", ft.actions)
+	}
+}
+
+func TestContributorInsights(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"TableName":"T","ContributorInsightsStatus":"ENABLING"}`,
+		`{"TableName":"T","ContributorInsightsStatus":"ENABLED","ContributorInsightsRuleList":["r1"],"LastUpdateDateTime":1.7e9}`,
+		`{}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+	ctx := context.Background()
+
+	if status, err := db.UpdateContributorInsights(ctx, "T", "", true); err != nil || status != "ENABLING" {
+		t.Errorf("UpdateContributorInsights = %q, %v", status, err)
+	}
+	ci, err := db.DescribeContributorInsights(ctx, "T", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci.Status != "ENABLED" || len(ci.Rules) != 1 || ci.LastUpdate.Unix() != 1.7e9 {
+		t.Errorf("got %+v", ci)
+	}
+	if err := db.SetTableClass(ctx, "T", dydb.TableClassStandardInfrequentAccess); err != nil {
+		t.Fatal(err)
+	}
+	if ft.bodies[2] != `{"TableClass":"STANDARD_INFREQUENT_ACCESS","TableName":"T"}` {
+		t.Errorf("UpdateTable request = %s", ft.bodies[2])
+	}
+}
+
+func TestTags(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{}`,
+		`{"Tags":[{"Key":"env","Value":"prod"}],"NextToken":"n1"}`,
+		`{"Tags":[{"Key":"team","Value":"core"}]}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+	ctx := context.Background()
+	const arn = "arn:aws:dynamodb:us-east-1:123456789012:table/T"
+
+	if err := db.TagResource(ctx, arn, map[string]string{"env": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"ResourceArn":"` + arn + `","Tags":[{"Key":"env","Value":"prod"}]}`; ft.bodies[0] != want {
+		t.Errorf("TagResource request = %s", ft.bodies[0])
+	}
+
+	tags, err := db.ListTagsOfResource(ctx, arn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags["team"] != "core" || !strings.Contains(ft.bodies[2], `"NextToken":"n1"`) {
+		t.Errorf("got %v after %v", tags, ft.bodies)
+	}
+}
+
+func TestWithHeader(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte(`{"TableNames":[]}`))
+	}))
+	defer srv.Close()
+	db := &dydb.DB{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, Region: "us-east-1"}
+
+	ctx := dydb.WithHeader(context.Background(), "X-Amz-Client-Context", "e30=")
+	ctx = dydb.WithHeader(ctx, "X-Amz-Target", "ignored")
+	if err := db.RetryQueryContext(ctx, "ListTables", nil, 1).Decode(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Amz-Client-Context") != "e30=" || got.Get("X-Amz-Target") != "DynamoDB_20120810.ListTables" {
+		t.Errorf("headers %v", got)
+	}
+	if !strings.Contains(got.Get("Authorization"), "x-amz-client-context") {
+		t.Error("custom header was not signed")
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Requestid", "r-1")
+		w.WriteHeader(400)
+		w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"bad key"}`))
+	}))
+	defer srv.Close()
+	db := &dydb.DB{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, Region: "us-east-1"}
+
+	err := db.Query("GetItem", nil).Decode(&struct{}{})
+	e, ok := err.(*dydb.ResponseError)
+	if !ok {
+		t.Fatalf("got %v", err)
+	}
+	if e.Type != "com.amazonaws.dynamodb.v20120810#ValidationException" || e.TypeName() != "ValidationException" ||
+		e.Message != "bad key" || e.RequestID != "r-1" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestDecodeItems(t *testing.T) {
+	f := &fakeTransport{t: t, responses: []interface{}{
+		`{"Count":2,"Items":[{"id":{"S":"a"}},{"id":{"S":"b"}}],"LastEvaluatedKey":{"id":{"S":"b"}}}`,
+		`{"Items":[{"id":{"S":"a"}},{"id":{"S":"b"}}]}`,
+	}}
+	db := &dydb.DB{Transport: f}
+
+	var ids []string
+	var rest struct {
+		Count            int
+		LastEvaluatedKey dydb.Item
+	}
+	err := dydb.DecodeItems(db.Query("Scan", nil), &rest, func(raw json.RawMessage) error {
+		var item struct{ Id struct{ S string } }
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		ids = append(ids, item.Id.S)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "a,b" || rest.Count != 2 || rest.LastEvaluatedKey == nil {
+		t.Errorf("ids %v, rest %+v", ids, rest)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = dydb.DecodeItems(db.Query("Scan", nil), nil, func(json.RawMessage) error { n++; return stop })
+	if err != stop || n != 1 {
+		t.Errorf("got %v after %d items", err, n)
+	}
+
+	// A Decoder that is not an ItemsDecoder is decoded whole.
+	ids, rest.Count = nil, 0
+	err = dydb.DecodeItems(rawDecoder(`{"Count":1,"Items":[{"id":{"S":"c"}}]}`), &rest, func(raw json.RawMessage) error {
+		ids = append(ids, string(raw))
+		return nil
+	})
+	if err != nil || len(ids) != 1 || rest.Count != 1 {
+		t.Errorf("got %v, ids %v, rest %+v", err, ids, rest)
+	}
+}
+
+// rawDecoder is a Decoder of a response, without DecodeItems or Body.
+type rawDecoder string
+
+func (d rawDecoder) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(d), v)
+}
+
+func TestBody(t *testing.T) {
+	const resp = `{"Item": {"id": {"S": "a"}}}`
+	db := &dydb.DB{Transport: &fakeTransport{t: t, responses: []interface{}{resp, errors.New("boom")}}}
+
+	body, err := dydb.Body(db.Query("GetItem", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(b) != resp {
+		t.Errorf("body %s", b)
+	}
+
+	if _, err := dydb.Body(db.Query("GetItem", nil)); err == nil || err.Error() != "boom" {
+		t.Errorf("expected the transport error, got %v", err)
+	}
+
+	body, err = dydb.Body(rawDecoder(resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = ioutil.ReadAll(body); string(b) != resp {
+		t.Errorf("body %s", b)
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	db := &dydb.DB{Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+		var req struct {
+			RequestItems map[string][]dydb.WriteRequest
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		json.Unmarshal(body, &req)
+		mu.Lock()
+		sizes = append(sizes, len(req.RequestItems["t"]))
+		mu.Unlock()
+		return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+	})}
+
+	w := dydb.NewBatchWriter(db, "t")
+	w.FlushInterval = 20 * time.Millisecond
+	ctx := context.Background()
+	for i := 0; i < 30; i++ {
+		if err := w.Put(ctx, dydb.Item{"id": {N: strPtr(fmt.Sprint(i))}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond) // the remaining 5 are written by the timer
+	w.Delete(ctx, dydb.Item{"id": {N: strPtr("0")}})
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sizes) != "[25 5 1]" {
+		t.Errorf("batches %v", sizes)
+	}
+	if err := w.Put(ctx, dydb.Item{}); err != dydb.ErrWriterClosed {
+		t.Errorf("Put after Close: %v", err)
+	}
+
+	// The last batch is written within the context of Close.
+	w = dydb.NewBatchWriter(db, "t")
+	w.Put(ctx, dydb.Item{"id": {N: strPtr("1")}})
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := w.Close(canceled); err != context.Canceled {
+		t.Errorf("Close with a canceled context: %v", err)
+	}
+}
+
+func TestStreamConsumer(t *testing.T) {
+	records := map[string]string{
+		"p/TRIM_HORIZON": `{"Records":[{"eventID":"p1","dynamodb":{"SequenceNumber":"1"}},{"eventID":"p2","dynamodb":{"SequenceNumber":"2"}}],"NextShardIterator":"p/end"}`,
+		"p/end":          `{"Records":[]}`,
+		"c/TRIM_HORIZON": `{"Records":[{"eventID":"c1","dynamodb":{"SequenceNumber":"3"}}],"NextShardIterator":"c/tail"}`,
+		"c/tail":         `{"Records":[],"NextShardIterator":"c/tail"}`,
+	}
+	db := &dydb.DB{Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+		var req struct{ ShardId, ShardIteratorType, ShardIterator string }
+		json.Unmarshal(body, &req)
+		resp := ""
+		switch action {
+		case "DescribeStream":
+			resp = `{"StreamDescription":{"Shards":[{"ShardId":"c","ParentShardId":"p"},{"ShardId":"p"}]}}`
+		case "GetShardIterator":
+			resp = `{"ShardIterator":"` + req.ShardId + "/" + req.ShardIteratorType + `"}`
+		case "GetRecords":
+			resp = records[req.ShardIterator]
+		}
+		return ioutil.NopCloser(strings.NewReader(resp)), nil
+	})}
+
+	var mu sync.Mutex
+	var delivered []string
+	failed := false
+	c := &dydb.StreamConsumer{
+		Streams:   db,
+		StreamArn: "arn",
+		Handler: func(ctx context.Context, shard string, records []dydb.StreamRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !failed {
+				failed = true
+				return errors.New("retry me")
+			}
+			for _, r := range records {
+				delivered = append(delivered, r.EventID)
+			}
+			return nil
+		},
+		PollInterval:      5 * time.Millisecond,
+		ShardSyncInterval: 10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run: %v", err)
+	}
+	if fmt.Sprint(delivered) != "[p1 p2 c1]" {
+		t.Errorf("delivered %v", delivered)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	throttled := &dydb.ResponseError{StatusCode: 400, Type: "com.amazonaws.dynamodb.v20120810#ThrottlingException"}
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		throttled, throttled, throttled, `{}`,
+		`{}`, `{}`, `{"Item":{"id":{"S":"a"}}}`,
+	}}
+	clock := aws4.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	db := &dydb.DB{Transport: ft, Clock: clock}
+
+	start := time.Now()
+	if err := db.RetryQuery("ListTables", nil, 4).Decode(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.WaitForItem(context.Background(), "t", dydb.Item{"id": dydb.StringValue("a")}, dydb.ItemExists, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(clock.Sleeps()); got != "[100ms 200ms 400ms 1m0s 1m0s]" {
+		t.Errorf("sleeps %s", got)
+	}
+	if !clock.Now().Equal(time.Date(2024, 1, 1, 0, 2, 0, 700e6, time.UTC)) || time.Since(start) > time.Second {
+		t.Errorf("clock at %v after %v", clock.Now(), time.Since(start))
+	}
+}
+
+func TestBatchWrite(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"UnprocessedItems":{"T":[{"PutRequest":{"Item":{"id":{"S":"b"}}}}]}}`,
+		`{}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	reqs := []dydb.WriteRequest{
+		{PutRequest: &dydb.PutRequest{Item: dydb.Item{"id": dydb.StringValue("a")}}},
+		{PutRequest: &dydb.PutRequest{Item: dydb.Item{"id": dydb.StringValue("b")}}},
+	}
+	if err := db.BatchWrite(context.Background(), "T", reqs, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.bodies) != 2 || strings.Contains(ft.bodies[1], `"a"`) || !strings.Contains(ft.bodies[1], `"b"`) {
+		t.Errorf("requests %v", ft.bodies)
+	}
+
+	ft.responses = []interface{}{`{"UnprocessedItems":{"T":[{"PutRequest":{"Item":{"id":{"S":"b"}}}}]}}`}
+	err := db.BatchWrite(context.Background(), "T", reqs, 1)
+	if e, ok := err.(*dydb.UnprocessedError); !ok || len(e.Requests) != 1 {
+		t.Errorf("got %v", err)
+	}
+
+	// A throttled batch takes retries requests, not retries squared.
+	throttled := &dydb.ResponseError{StatusCode: 400, Type: "com.amazonaws.dynamodb.v20120810#ThrottlingException"}
+	clock := aws4.NewFakeClock(time.Now())
+	db.Clock = clock
+	ft.bodies, ft.responses = nil, []interface{}{throttled, throttled, throttled}
+	if err := db.BatchWrite(context.Background(), "T", reqs, 3); err != throttled || len(ft.bodies) != 3 {
+		t.Errorf("throttled: %v after %d requests", err, len(ft.bodies))
+	}
+	if got := fmt.Sprint(clock.Sleeps()); got != "[100ms 200ms]" {
+		t.Errorf("sleeps %s", got)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{"Items":[{"id":{"S":"a"},"n":{"N":"1"}}],"LastEvaluatedKey":{"id":{"S":"a"}}}`,
+		`{"Items":[{"id":{"S":"b"},"n":{"N":"2"}}]}`,
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	var buf bytes.Buffer
+	n, err := db.ExportTable(context.Background(), &buf, "T", dydb.CSV, nil)
+	if err != nil || n != 2 {
+		t.Fatalf("exported %d items: %v", n, err)
+	}
+	if buf.String() != "id,n\na,1\nb,2\n" {
+		t.Errorf("exported %q", buf.String())
+	}
+
+	ft.responses = []interface{}{`{}`}
+	opts := &dydb.ImportOptions{Types: map[string]string{"n": "N"}}
+	if n, err = db.ImportTable(context.Background(), &buf, "T", dydb.CSV, opts); err != nil || n != 2 {
+		t.Fatalf("imported %d items: %v", n, err)
+	}
+	if body := ft.bodies[len(ft.bodies)-1]; !strings.Contains(body, `"n":{"N":"2"}`) {
+		t.Errorf("request %s", body)
+	}
+}
+
+func TestExportImportFormats(t *testing.T) {
+	item := dydb.Item{
+		"id": dydb.StringValue("a"),
+		"n":  {N: strPtr("1.5")},
+		"b":  dydb.BinaryValue([]byte{1, 2}),
+		"ok": dydb.BoolValue(true),
+		"bs": dydb.BinarySetValue([]byte{3}),
+	}
+	scan, _ := json.Marshal(map[string]interface{}{"Items": []dydb.Item{item}})
+
+	// CSV writes nested values as JSON, which comes back as a string.
+	flat := dydb.Item{}
+	for name, av := range item {
+		flat[name] = av
+	}
+	flat["bs"] = dydb.StringValue(`["Aw=="]`)
+
+	tests := []struct {
+		format dydb.Format
+		types  map[string]string
+		want   dydb.Item
+	}{
+		{dydb.DynamoJSONLines, nil, item},
+		{dydb.JSONLines, map[string]string{"b": "B", "bs": "BS"}, item},
+		{dydb.CSV, map[string]string{"n": "N", "b": "B", "ok": "BOOL"}, flat},
+	}
+	for _, tt := range tests {
+		ft := &fakeTransport{t: t, responses: []interface{}{string(scan)}}
+		db := &dydb.DB{Transport: ft}
+
+		var buf bytes.Buffer
+		if n, err := db.ExportTable(context.Background(), &buf, "T", tt.format, nil); err != nil || n != 1 {
+			t.Fatalf("format %d: exported %d items: %v", tt.format, n, err)
+		}
+		ft.responses = []interface{}{`{}`}
+		opts := &dydb.ImportOptions{Types: tt.types}
+		if n, err := db.ImportTable(context.Background(), &buf, "T", tt.format, opts); err != nil || n != 1 {
+			t.Fatalf("format %d: imported %d items: %v", tt.format, n, err)
+		}
+
+		var req struct {
+			RequestItems map[string][]dydb.WriteRequest
+		}
+		json.Unmarshal([]byte(ft.bodies[len(ft.bodies)-1]), &req)
+		got, _ := json.Marshal(req.RequestItems["T"][0].PutRequest.Item)
+		want, _ := json.Marshal(tt.want)
+		if string(got) != string(want) {
+			t.Errorf("format %d: imported %s, want %s", tt.format, got, want)
+		}
+	}
+}
+
+func TestExportImportEmpty(t *testing.T) {
+	for _, columns := range [][]string{nil, {"id", "n"}} {
+		db := &dydb.DB{Transport: &fakeTransport{t: t, responses: []interface{}{`{"Items":[]}`}}}
+
+		var buf bytes.Buffer
+		opts := &dydb.ExportOptions{Columns: columns}
+		if n, err := db.ExportTable(context.Background(), &buf, "T", dydb.CSV, opts); err != nil || n != 0 {
+			t.Fatalf("exported %d items: %v", n, err)
+		}
+		want := ""
+		if columns != nil {
+			want = strings.Join(columns, ",") + "\n"
+		}
+		if buf.String() != want {
+			t.Errorf("exported %q, want %q", buf.String(), want)
+		}
+		if n, err := db.ImportTable(context.Background(), &buf, "T", dydb.CSV, nil); err != nil || n != 0 {
+			t.Errorf("columns %v: imported %d items: %v", columns, n, err)
+		}
+	}
+}
+
+func TestImportTableFailure(t *testing.T) {
+	var in bytes.Buffer
+	for i := 0; i < dydb.MaxBatchWriteItems+2; i++ {
+		fmt.Fprintf(&in, "{\"id\":{\"S\":\"%d\"}}\n", i)
+	}
+	ft := &fakeTransport{t: t, responses: []interface{}{
+		`{}`,
+		&dydb.ResponseError{StatusCode: 400, Type: "x#ValidationException"},
+	}}
+	db := &dydb.DB{Transport: ft}
+
+	n, err := db.ImportTable(context.Background(), &in, "T", dydb.DynamoJSONLines, nil)
+	if !dydb.IsException(err, "ValidationException") || n != dydb.MaxBatchWriteItems {
+		t.Errorf("imported %d items: %v", n, err)
+	}
+}
+
+func TestImportTableCapacityUnits(t *testing.T) {
+	big := strings.Repeat("x", 2500)
+	in := fmt.Sprintf("{\"id\":{\"S\":\"1\"},\"v\":{\"S\":%q}}\n{\"id\":{\"S\":\"2\"},\"v\":{\"S\":%q}}\n", big, big)
+	db := &dydb.DB{Transport: &fakeTransport{t: t, responses: []interface{}{`{}`}}}
+
+	// Two items of 3 write units each take 600ms of a limiter of 10 units
+	// per second.
+	l := dydb.NewRateLimiter(10)
+	n, err := db.ImportTable(context.Background(), strings.NewReader(in), "T", dydb.DynamoJSONLines, &dydb.ImportOptions{Limiter: l})
+	if err != nil || n != 2 {
+		t.Fatalf("imported %d items: %v", n, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("limiter was not charged by capacity units: %v", err)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := dydb.NewRateLimiter(10)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 10); err != context.DeadlineExceeded {
+		t.Fatalf("got %v", err)
+	}
+
+	// The canceled reservation of a second is given back.
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("waited %v", d)
+	}
+}
@@ -0,0 +1,130 @@
+package dydb
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// An Endpoint is an endpoint of DynamoDB for the account and region of a DB,
+// as returned by DescribeEndpoints.
+type Endpoint struct {
+	// Address is the host name of the endpoint.
+	Address string
+
+	// CachePeriod is how long the endpoint may be used before asking for it
+	// again.
+	CachePeriod time.Duration
+}
+
+// DescribeEndpoints returns the endpoints DynamoDB wants the account to use.
+func (db *DB) DescribeEndpoints(ctx context.Context) ([]Endpoint, error) {
+	var resp describeEndpointsResponse
+	if err := db.QueryContext(ctx, "DescribeEndpoints", nil).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp.endpoints(), nil
+}
+
+type describeEndpointsResponse struct {
+	Endpoints []struct {
+		Address              string
+		CachePeriodInMinutes int64
+	}
+}
+
+func (r *describeEndpointsResponse) endpoints() []Endpoint {
+	endpoints := make([]Endpoint, len(r.Endpoints))
+	for i, e := range r.Endpoints {
+		endpoints[i] = Endpoint{Address: e.Address, CachePeriod: time.Duration(e.CachePeriodInMinutes) * time.Minute}
+	}
+	return endpoints
+}
+
+// discoveryTimeout bounds the DescribeEndpoints calls of endpoint.
+const discoveryTimeout = 10 * time.Second
+
+// discovery caches the endpoint found by DescribeEndpoints.
+type discovery struct {
+	mu      sync.Mutex
+	url     string
+	expires time.Time
+	done    chan struct{} // closed when the discovery in progress ends
+}
+
+// endpoint returns the URL to send the requests of t to instead of t.url,
+// discovering it with t if needed, bypassing the limits of db. Concurrent
+// callers share a single discovery, which has its own timeout and goes on
+// if they give up. Failed discoveries are retried no more than once a
+// minute, with t.url used meanwhile.
+func (db *DB) endpoint(ctx context.Context, t *httpTransport) string {
+	d := &db.discovery
+	d.mu.Lock()
+	if time.Now().Before(d.expires) {
+		u := d.url
+		d.mu.Unlock()
+		return u
+	}
+	if d.done == nil {
+		d.done = make(chan struct{})
+		go d.discover(t)
+	}
+	done := d.done
+	d.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return t.url
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.url
+}
+
+// discover calls DescribeEndpoints and caches the endpoint, or t.url for a
+// minute on failure.
+func (d *discovery) discover(t *httpTransport) {
+	u, period := t.url, time.Minute
+	if e, ok := describeEndpoint(t); ok {
+		if base, err := url.Parse(t.url); err == nil {
+			u = base.Scheme + "://" + e.Address + "/"
+			if e.CachePeriod > 0 {
+				period = e.CachePeriod
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.url, d.expires = u, time.Now().Add(period)
+	close(d.done)
+	d.done = nil
+	d.mu.Unlock()
+}
+
+// describeEndpoint returns the first endpoint returned by DescribeEndpoints
+// through t.
+func describeEndpoint(t *httpTransport) (Endpoint, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	body, err := t.RoundTrip(ctx, "DescribeEndpoints", []byte("{}"))
+	if err != nil {
+		return Endpoint{}, false
+	}
+	defer body.Close()
+	var resp describeEndpointsResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil || len(resp.Endpoints) == 0 {
+		return Endpoint{}, false
+	}
+	return resp.endpoints()[0], true
+}
+
+// forgetEndpoint discards the discovered endpoint, such as after DynamoDB
+// reported it invalid.
+func (db *DB) forgetEndpoint() {
+	db.discovery.mu.Lock()
+	db.discovery.expires = time.Time{}
+	db.discovery.mu.Unlock()
+}
@@ -1,6 +1,7 @@
 package dydb_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/bmizerany/aws4/dydb"
 	"log"
@@ -54,3 +55,18 @@ func Example_createAndListTables() {
 	// ["Posts"]
 	fmt.Printf("%q", resp.TableNames)
 }
+
+func Example_scanStream() {
+	var db dydb.DB
+
+	items, errc := db.ScanStream(context.Background(), "Posts", &dydb.ScanOptions{Buffer: 100})
+	n := 0
+	for range items {
+		n++
+	}
+	if err := <-errc; err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(n, "posts")
+}
@@ -0,0 +1,337 @@
+package dydb
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// A Format is a file format understood by ExportTable and ImportTable.
+type Format int
+
+const (
+	// DynamoJSONLines is one item per line in DynamoDB JSON, preserving all
+	// attribute types.
+	DynamoJSONLines Format = iota
+
+	// JSONLines is one item per line as a plain JSON document. Sets are
+	// written as arrays and binary values as base64 strings, so they come
+	// back as lists and strings when imported unless ImportOptions.Types
+	// says otherwise.
+	JSONLines
+
+	// CSV is a header row of attribute names followed by one row per item.
+	// Nested values are written as plain JSON.
+	CSV
+)
+
+// ExportOptions controls ExportTable.
+type ExportOptions struct {
+	// Scan is passed to ScanStream.
+	Scan *ScanOptions
+
+	// Columns are the attributes written in CSV format. If empty, the
+	// attributes of the first item are used, and an empty table is written
+	// without a header.
+	Columns []string
+}
+
+// ExportTable scans table and writes every item to w in the given format. It
+// returns the number of items written.
+func (db *DB) ExportTable(ctx context.Context, w io.Writer, table string, format Format, opts *ExportOptions) (int, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	cw := csv.NewWriter(bw)
+	columns := opts.Columns
+
+	items, errc := db.ScanStream(ctx, table, opts.Scan)
+	n := 0
+	for item := range items {
+		var err error
+		switch format {
+		case DynamoJSONLines:
+			err = enc.Encode(item)
+		case JSONLines:
+			var doc map[string]interface{}
+			if doc, err = ItemToMap(item); err == nil {
+				err = enc.Encode(doc)
+			}
+		case CSV:
+			if n == 0 {
+				if len(columns) == 0 {
+					for name := range item {
+						columns = append(columns, name)
+					}
+					sort.Strings(columns)
+				}
+				err = cw.Write(columns)
+			}
+			if err == nil {
+				err = cw.Write(csvRecord(item, columns))
+			}
+		default:
+			err = fmt.Errorf("dydb: unknown format %d", format)
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := <-errc; err != nil {
+		return n, err
+	}
+
+	// An empty table still gets a header, when known, so that the output
+	// can be imported.
+	if format == CSV && n == 0 && len(columns) > 0 {
+		if err := cw.Write(columns); err != nil {
+			return n, err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// ImportOptions controls ImportTable.
+type ImportOptions struct {
+	// WritesPerSecond limits the rate at which items are written. If 0,
+	// items are written as fast as the table accepts them.
+	WritesPerSecond float64
+
+	// Limiter, if not nil, paces writes in place of WritesPerSecond, by
+	// write capacity units: one per KB of each item. Use the Limiter of a
+	// Governor to follow the capacity of the table.
+	Limiter *RateLimiter
+
+	// Retries is the number of attempts made for each batch while throttled
+	// or partially processed. If 0, DefaultStreamRetries is used.
+	Retries uint
+
+	// Types maps attribute names to DynamoDB types. In CSV format a column
+	// may be S, N, B or BOOL; columns not listed are strings and empty cells
+	// are not imported. In JSONLines format, B and BS attributes are decoded
+	// from the base64 strings written on export.
+	Types map[string]string
+}
+
+// ImportTable reads items in the given format from r and writes them to
+// table with BatchWriteItem. It returns the number of items written, also
+// on failure.
+func (db *DB) ImportTable(ctx context.Context, r io.Reader, table string, format Format, opts *ImportOptions) (int, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultStreamRetries
+	}
+	limit, units := opts.Limiter, true
+	if limit == nil {
+		limit, units = NewRateLimiter(opts.WritesPerSecond), false
+	}
+
+	next, err := itemReader(r, format, opts.Types)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	batch := make([]WriteRequest, 0, MaxBatchWriteItems)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		cost := len(batch)
+		if units {
+			cost = 0
+			for _, r := range batch {
+				cost += writeUnits(r.PutRequest.Item)
+			}
+		}
+		if err := limit.WaitN(ctx, cost); err != nil {
+			return err
+		}
+		written, err := db.batchWrite(ctx, table, batch, retries)
+		n += written
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		item, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		batch = append(batch, WriteRequest{PutRequest: &PutRequest{Item: item}})
+		if len(batch) == MaxBatchWriteItems {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	err = flush()
+	return n, err
+}
+
+// itemReader returns a function reading successive items from r, returning
+// io.EOF at the end of the input.
+func itemReader(r io.Reader, format Format, types map[string]string) (func() (Item, error), error) {
+	switch format {
+	case DynamoJSONLines:
+		dec := json.NewDecoder(r)
+		return func() (Item, error) {
+			var item Item
+			err := dec.Decode(&item)
+			return item, err
+		}, nil
+
+	case JSONLines:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		return func() (Item, error) {
+			var doc map[string]interface{}
+			if err := dec.Decode(&doc); err != nil {
+				return nil, err
+			}
+			item, err := MapToItem(doc)
+			if err != nil {
+				return nil, err
+			}
+			return item, decodeBinary(item, types)
+		}, nil
+
+	case CSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err == io.EOF {
+			// Empty tables exported without Columns have no header.
+			return func() (Item, error) { return nil, io.EOF }, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return func() (Item, error) {
+			rec, err := cr.Read()
+			if err != nil {
+				return nil, err
+			}
+			return csvItem(header, rec, types)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("dydb: unknown format %d", format)
+}
+
+func csvRecord(item Item, columns []string) []string {
+	rec := make([]string, len(columns))
+	for i, name := range columns {
+		av := item[name]
+		switch {
+		case av == nil || av.NULL != nil:
+		case av.S != nil:
+			rec[i] = *av.S
+		case av.N != nil:
+			rec[i] = *av.N
+		case av.BOOL != nil:
+			rec[i] = strconv.FormatBool(*av.BOOL)
+		case av.B != nil:
+			rec[i] = base64.StdEncoding.EncodeToString(av.B)
+		default:
+			x, _ := interfaceValue(av)
+			b, _ := json.Marshal(x)
+			rec[i] = string(b)
+		}
+	}
+	return rec
+}
+
+func csvItem(header, rec []string, types map[string]string) (Item, error) {
+	item := make(Item, len(header))
+	for i, name := range header {
+		if i >= len(rec) || rec[i] == "" {
+			continue
+		}
+		s := rec[i]
+		switch t := types[name]; t {
+		case "", "S":
+			item[name] = &AttributeValue{S: &s}
+		case "N":
+			item[name] = &AttributeValue{N: &s}
+		case "B":
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("dydb: column %s: %v", name, err)
+			}
+			item[name] = &AttributeValue{B: b}
+		case "BOOL":
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("dydb: column %s: %v", name, err)
+			}
+			item[name] = &AttributeValue{BOOL: &b}
+		default:
+			return nil, fmt.Errorf("dydb: column %s: unsupported type %q", name, t)
+		}
+	}
+	return item, nil
+}
+
+// decodeBinary replaces the base64 strings of the attributes that types marks
+// as B or BS with their binary values.
+func decodeBinary(item Item, types map[string]string) error {
+	for name, t := range types {
+		av := item[name]
+		if av == nil || av.NULL != nil {
+			continue
+		}
+
+		switch t {
+		case "B":
+			if av.S == nil {
+				return fmt.Errorf("dydb: attribute %s: expected base64 string", name)
+			}
+			b, err := base64.StdEncoding.DecodeString(*av.S)
+			if err != nil {
+				return fmt.Errorf("dydb: attribute %s: %v", name, err)
+			}
+			item[name] = BinaryValue(b)
+
+		case "BS":
+			if av.L == nil {
+				return fmt.Errorf("dydb: attribute %s: expected array of base64 strings", name)
+			}
+			bs := make([][]byte, len(av.L))
+			for i, e := range av.L {
+				if e == nil || e.S == nil {
+					return fmt.Errorf("dydb: attribute %s: expected base64 string", name)
+				}
+				b, err := base64.StdEncoding.DecodeString(*e.S)
+				if err != nil {
+					return fmt.Errorf("dydb: attribute %s: %v", name, err)
+				}
+				bs[i] = b
+			}
+			item[name] = BinarySetValue(bs...)
+		}
+	}
+	return nil
+}
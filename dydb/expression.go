@@ -0,0 +1,110 @@
+package dydb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// exprBuilder allocates the placeholders expressions use for attribute names
+// and values.
+type exprBuilder struct {
+	names  map[string]string // placeholder to attribute name
+	values Item              // placeholder to value
+}
+
+// name returns n, or a placeholder for it if n needs one. Placeholders
+// depend only on the name they stand for ("#status" for status), so the
+// names of several builders can be merged.
+func (b *exprBuilder) name(n string) string {
+	if !needsAlias(n) {
+		return n
+	}
+	p := "#" + n
+	if !IsReserved(n) {
+		h := fnv.New32a()
+		h.Write([]byte(n))
+		p = fmt.Sprintf("#x%08x", h.Sum32())
+	}
+	if b.names == nil {
+		b.names = make(map[string]string)
+	}
+	// Step aside from placeholders the caller used for other names.
+	for old, ok := b.names[p]; ok && old != n; old, ok = b.names[p] {
+		p += "x"
+	}
+	b.names[p] = n
+	return p
+}
+
+// path returns the document path p ("a.b[2].c") with the attribute names
+// that need it replaced by placeholders. Components that already are
+// placeholders are kept.
+func (b *exprBuilder) path(p string) string {
+	parts := strings.Split(p, ".")
+	for i, part := range parts {
+		name, index := part, ""
+		if j := strings.IndexByte(part, '['); j > 0 {
+			name, index = part[:j], part[j:]
+		}
+		if !strings.HasPrefix(name, "#") {
+			name = b.name(name)
+		}
+		parts[i] = name + index
+	}
+	return strings.Join(parts, ".")
+}
+
+// addNames adds user-supplied placeholders.
+func (b *exprBuilder) addNames(names map[string]string) error {
+	if b.names == nil {
+		b.names = make(map[string]string)
+	}
+	return mergeNames(b.names, names)
+}
+
+// value returns a new placeholder for av, stepping aside from placeholders
+// already used.
+func (b *exprBuilder) value(av *AttributeValue) string {
+	if b.values == nil {
+		b.values = make(Item)
+	}
+	n := len(b.values)
+	p := ":v" + strconv.Itoa(n)
+	for b.values[p] != nil {
+		n++
+		p = ":v" + strconv.Itoa(n)
+	}
+	b.values[p] = av
+	return p
+}
+
+// MergeNames merges maps of expression attribute names, such as the ones of
+// the expressions of a request built separately. It fails if a placeholder
+// stands for different names.
+func MergeNames(maps ...map[string]string) (map[string]string, error) {
+	var merged map[string]string
+	for _, m := range maps {
+		if len(m) == 0 {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string]string, len(m))
+		}
+		if err := mergeNames(merged, m); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+func mergeNames(dst, src map[string]string) error {
+	for p, n := range src {
+		if old, ok := dst[p]; ok && old != n {
+			return fmt.Errorf("dydb: placeholder %s stands for both %s and %s", p, old, n)
+		}
+		dst[p] = n
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package dydb
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Defaults for Failover.
+const (
+	DefaultMaxFailures   = 3
+	DefaultProbeInterval = 30 * time.Second
+)
+
+// A Failover is a Transport that sends requests to the replicas of a Global
+// Table, preferring them in order. After MaxFailures consecutive failures of
+// a replica (network errors, timeouts, server errors and throttling) it is
+// marked down and requests, reads and writes alike, go to the next healthy
+// replica. A down replica is probed every ProbeInterval and used again as
+// soon as a probe succeeds. If every replica is down, they are all tried in
+// order.
+//
+// Use it as the Transport of a DB:
+//
+//	db := &dydb.DB{Transport: &dydb.Failover{Replicas: []*dydb.DB{
+//		{URL: "https://dynamodb.us-east-1.amazonaws.com/"},
+//		{URL: "https://dynamodb.us-west-2.amazonaws.com/"},
+//	}}}
+//
+// Writes accepted by a replica are replicated asynchronously, so reads that
+// fail over may not see the latest writes.
+type Failover struct {
+	// Replicas are the DBs of each region, in order of preference. Their
+	// Transport, Client and endpoint settings are used; their Cache isn't.
+	Replicas []*DB
+
+	// MaxFailures is the number of consecutive failures that mark a replica
+	// down. If zero, DefaultMaxFailures is used.
+	MaxFailures int
+
+	// Timeout, if not zero, limits each attempt so that a hanging replica
+	// fails over.
+	Timeout time.Duration
+
+	// ProbeInterval is how often down replicas are probed. If zero,
+	// DefaultProbeInterval is used.
+	ProbeInterval time.Duration
+
+	// Probe checks whether a down replica is healthy again. If nil, a
+	// DescribeLimits request is sent to it.
+	Probe func(ctx context.Context, db *DB) error
+
+	mu    sync.Mutex
+	state map[*DB]*replicaState
+}
+
+type replicaState struct {
+	failures  int
+	down      bool
+	nextProbe time.Time
+	probing   bool
+}
+
+// Healthy returns the replicas that are not marked down.
+func (f *Failover) Healthy() []*DB {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var a []*DB
+	for _, db := range f.Replicas {
+		if !f.replica(db).down {
+			a = append(a, db)
+		}
+	}
+	return a
+}
+
+func (f *Failover) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	var err error
+	for _, db := range f.order() {
+		var t Transport
+		if t, err = db.transport(); err != nil {
+			continue
+		}
+
+		actx, cancel := withTimeout(ctx, f.Timeout)
+		var rc io.ReadCloser
+		rc, err = t.RoundTrip(actx, action, body)
+		if err == nil {
+			rc = &cancelCloser{rc, cancel}
+		} else {
+			cancel()
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil || !failsOver(err) {
+			f.succeeded(db)
+			return rc, err
+		}
+		f.failed(db)
+	}
+	return nil, err
+}
+
+// order returns the healthy replicas followed by the down ones, starting
+// probes of the down replicas that are due.
+func (f *Failover) order() []*DB {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	var up, down []*DB
+	for _, db := range f.Replicas {
+		s := f.replica(db)
+		if !s.down {
+			up = append(up, db)
+			continue
+		}
+		down = append(down, db)
+		if !s.probing && !now.Before(s.nextProbe) {
+			s.probing = true
+			go f.probe(db)
+		}
+	}
+	return append(up, down...)
+}
+
+func (f *Failover) probe(db *DB) {
+	ctx, cancel := withTimeout(context.Background(), f.Timeout)
+	defer cancel()
+
+	var err error
+	if f.Probe != nil {
+		err = f.Probe(ctx, db)
+	} else {
+		err = probeLimits(ctx, db)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.replica(db)
+	s.probing = false
+	if err == nil {
+		s.down, s.failures = false, 0
+	} else {
+		s.nextProbe = time.Now().Add(f.probeInterval())
+	}
+}
+
+func probeLimits(ctx context.Context, db *DB) error {
+	t, err := db.transport()
+	if err != nil {
+		return err
+	}
+	rc, err := t.RoundTrip(ctx, "DescribeLimits", []byte("{}"))
+	if err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+func (f *Failover) succeeded(db *DB) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.replica(db)
+	s.down, s.failures = false, 0
+}
+
+func (f *Failover) failed(db *DB) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	max := f.MaxFailures
+	if max <= 0 {
+		max = DefaultMaxFailures
+	}
+	s := f.replica(db)
+	if s.failures++; s.failures >= max && !s.down {
+		s.down = true
+		s.nextProbe = time.Now().Add(f.probeInterval())
+	}
+}
+
+// replica returns the state of db. f.mu must be held.
+func (f *Failover) replica(db *DB) *replicaState {
+	if f.state == nil {
+		f.state = make(map[*DB]*replicaState)
+	}
+	s := f.state[db]
+	if s == nil {
+		s = new(replicaState)
+		f.state[db] = s
+	}
+	return s
+}
+
+func (f *Failover) probeInterval() time.Duration {
+	if f.ProbeInterval > 0 {
+		return f.ProbeInterval
+	}
+	return DefaultProbeInterval
+}
+
+// failsOver returns true if err suggests that the replica, rather than the
+// request, is at fault.
+func failsOver(err error) bool {
+	e, ok := err.(*ResponseError)
+	return !ok || e.StatusCode >= 500 || isThrottle(err)
+}
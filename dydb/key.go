@@ -0,0 +1,150 @@
+package dydb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// A KeyAttribute is a key attribute and its value, which DynamoDB requires
+// to be a string, number or binary.
+type KeyAttribute struct {
+	Name  string
+	Value *AttributeValue
+}
+
+// StringKey returns the string key attribute name = v.
+func StringKey(name, v string) KeyAttribute {
+	return KeyAttribute{name, StringValue(v)}
+}
+
+// NumberKey returns the number key attribute name = v.
+func NumberKey(name string, v int64) KeyAttribute {
+	return KeyAttribute{name, numberValue(strconv.FormatInt(v, 10))}
+}
+
+// BinaryKey returns the binary key attribute name = v.
+func BinaryKey(name string, v []byte) KeyAttribute {
+	return KeyAttribute{name, BinaryValue(v)}
+}
+
+// A Key is the primary key of an item. Sort is the zero KeyAttribute for
+// tables without a sort key.
+type Key struct {
+	Partition KeyAttribute
+	Sort      KeyAttribute
+}
+
+// Item returns k as an item holding only the key attributes, as GetItem,
+// DeleteItem and UpdateItem take it.
+func (k Key) Item() Item {
+	item := Item{k.Partition.Name: k.Partition.Value}
+	if k.Sort.Name != "" {
+		item[k.Sort.Name] = k.Sort.Value
+	}
+	return item
+}
+
+// A SortCondition is the condition of a query on the sort key, built by Eq,
+// LT, LE, GT, GE, Between or BeginsWith.
+type SortCondition struct {
+	op     string
+	name   string
+	values []*AttributeValue
+	err    error
+}
+
+func sortCondition(op string, a KeyAttribute) *SortCondition {
+	return &SortCondition{op: op, name: a.Name, values: []*AttributeValue{a.Value}}
+}
+
+// Eq matches sort keys equal to a.
+func Eq(a KeyAttribute) *SortCondition { return sortCondition("=", a) }
+
+// LT matches sort keys less than a.
+func LT(a KeyAttribute) *SortCondition { return sortCondition("<", a) }
+
+// LE matches sort keys less than or equal to a.
+func LE(a KeyAttribute) *SortCondition { return sortCondition("<=", a) }
+
+// GT matches sort keys greater than a.
+func GT(a KeyAttribute) *SortCondition { return sortCondition(">", a) }
+
+// GE matches sort keys greater than or equal to a.
+func GE(a KeyAttribute) *SortCondition { return sortCondition(">=", a) }
+
+// Between matches sort keys from lo to hi, inclusive, which must be values
+// of the same attribute.
+func Between(lo, hi KeyAttribute) *SortCondition {
+	c := &SortCondition{op: "BETWEEN", name: lo.Name, values: []*AttributeValue{lo.Value, hi.Value}}
+	if lo.Name != hi.Name {
+		c.err = fmt.Errorf("dydb: BETWEEN bounds of different attributes %s and %s", lo.Name, hi.Name)
+	}
+	return c
+}
+
+// BeginsWith matches string or binary sort keys starting with prefix.
+func BeginsWith(prefix KeyAttribute) *SortCondition {
+	c := sortCondition("begins_with", prefix)
+	if prefix.Value == nil || prefix.Value.N != nil {
+		c.err = errors.New("dydb: begins_with requires a string or binary key")
+	}
+	return c
+}
+
+// A KeyCondition selects the items of a query: the ones with the partition
+// key Partition and, if Sort is not nil, a sort key matching Sort.
+//
+//	cond := &dydb.KeyCondition{
+//		Partition: dydb.StringKey("pk", "user#42"),
+//		Sort:      dydb.BeginsWith(dydb.StringKey("sk", "order#")),
+//	}
+type KeyCondition struct {
+	Partition KeyAttribute
+	Sort      *SortCondition
+}
+
+// A KeyConditionExpression holds the expression members of the key
+// condition of a Query request. It can be embedded in a request struct.
+type KeyConditionExpression struct {
+	KeyConditionExpression    string
+	ExpressionAttributeNames  map[string]string `json:",omitempty"`
+	ExpressionAttributeValues Item              `json:",omitempty"`
+}
+
+// Expression returns the expression of c, with placeholders for all names
+// that need one and for all values.
+func (c *KeyCondition) Expression() (*KeyConditionExpression, error) {
+	return c.expression(&exprBuilder{})
+}
+
+func (c *KeyCondition) expression(b *exprBuilder) (*KeyConditionExpression, error) {
+	if c.Partition.Name == "" || c.Partition.Value == nil {
+		return nil, errors.New("dydb: key condition without a partition key")
+	}
+	expr := b.name(c.Partition.Name) + " = " + b.value(c.Partition.Value)
+
+	if s := c.Sort; s != nil {
+		if s.err != nil {
+			return nil, s.err
+		}
+		if s.name == "" || s.name == c.Partition.Name {
+			return nil, fmt.Errorf("dydb: invalid sort key %q", s.name)
+		}
+		name := b.name(s.name)
+		switch s.op {
+		case "BETWEEN":
+			expr += " AND " + name + " BETWEEN " + b.value(s.values[0]) + " AND " + b.value(s.values[1])
+		case "begins_with":
+			expr += " AND begins_with(" + name + ", " + b.value(s.values[0]) + ")"
+		default:
+			expr += " AND " + name + " " + s.op + " " + b.value(s.values[0])
+		}
+	}
+
+	return &KeyConditionExpression{
+		KeyConditionExpression:    expr,
+		ExpressionAttributeNames:  b.names,
+		ExpressionAttributeValues: b.values,
+	}, nil
+}
@@ -0,0 +1,166 @@
+package dydb
+
+import (
+	"context"
+	"time"
+)
+
+// Limits are the provisioned capacity limits of an account in a region.
+type Limits struct {
+	AccountMaxReadCapacityUnits  int64
+	AccountMaxWriteCapacityUnits int64
+	TableMaxReadCapacityUnits    int64
+	TableMaxWriteCapacityUnits   int64
+}
+
+// DescribeLimits returns the capacity limits of the account.
+func (db *DB) DescribeLimits(ctx context.Context) (*Limits, error) {
+	l := new(Limits)
+	if err := db.QueryContext(ctx, "DescribeLimits", nil).Decode(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Defaults for Governor.
+const (
+	DefaultGovernorShare    = 0.8
+	DefaultGovernorInterval = time.Minute
+)
+
+// A Governor keeps the rate of a RateLimiter in step with the capacity of a
+// table, for bulk operations such as ImportTable that should use most of it
+// without being throttled. Tables with auto scaling change their capacity
+// over time, so the Governor refreshes it periodically. For on-demand tables
+// it uses the per-table maximum from DescribeLimits.
+type Governor struct {
+	DB    *DB
+	Table string
+
+	// Write governs write capacity; otherwise read capacity is governed.
+	Write bool
+
+	// Share is the fraction of the capacity to use. If zero,
+	// DefaultGovernorShare is used.
+	Share float64
+
+	// Interval is how often Run refreshes the capacity. If zero,
+	// DefaultGovernorInterval is used.
+	Interval time.Duration
+
+	// Limiter is the RateLimiter kept up to date. If nil, Update creates
+	// one.
+	Limiter *RateLimiter
+}
+
+// Update reads the capacity of the table and sets the rate of Limiter to
+// Share of it, in capacity units per second, so that Limiter must be waited
+// for by capacity units rather than items, as ImportTable does. It returns
+// the new rate.
+func (g *Governor) Update(ctx context.Context) (float64, error) {
+	d, err := g.DB.DescribeTable(ctx, g.Table)
+	if err != nil {
+		return 0, err
+	}
+
+	units := d.Throughput.ReadCapacityUnits
+	if g.Write {
+		units = d.Throughput.WriteCapacityUnits
+	}
+	if d.PayPerRequest() || units == 0 {
+		l, err := g.DB.DescribeLimits(ctx)
+		if err != nil {
+			return 0, err
+		}
+		units = l.TableMaxReadCapacityUnits
+		if g.Write {
+			units = l.TableMaxWriteCapacityUnits
+		}
+	}
+
+	share := g.Share
+	if share <= 0 {
+		share = DefaultGovernorShare
+	}
+	rate := share * float64(units)
+	if g.Limiter == nil {
+		g.Limiter = NewRateLimiter(rate)
+	} else {
+		g.Limiter.SetRate(rate)
+	}
+	return rate, nil
+}
+
+// Run calls Update every Interval until ctx is done, and returns ctx.Err().
+// Failed updates leave the rate unchanged. Call Update once before starting
+// Run, so that Limiter is set.
+func (g *Governor) Run(ctx context.Context) error {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = DefaultGovernorInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			g.Update(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// writeUnits returns the write capacity units consumed by writing item: one
+// per KB, rounded up.
+func writeUnits(item Item) int {
+	size := 0
+	for name, av := range item {
+		size += len(name) + valueSize(av)
+	}
+	if size == 0 {
+		return 1
+	}
+	return (size + 1023) / 1024
+}
+
+// valueSize returns the approximate size DynamoDB counts for av.
+func valueSize(av *AttributeValue) int {
+	if av == nil {
+		return 0
+	}
+	size := 0
+	switch {
+	case av.S != nil:
+		size = len(*av.S)
+	case av.N != nil:
+		size = len(*av.N)/2 + 1
+	case av.B != nil:
+		size = len(av.B)
+	case av.NULL != nil, av.BOOL != nil:
+		size = 1
+	case av.SS != nil:
+		for _, s := range av.SS {
+			size += len(s)
+		}
+	case av.NS != nil:
+		for _, s := range av.NS {
+			size += len(s)/2 + 1
+		}
+	case av.BS != nil:
+		for _, b := range av.BS {
+			size += len(b)
+		}
+	case av.M != nil:
+		size = 3
+		for name, v := range av.M {
+			size += 1 + len(name) + valueSize(v)
+		}
+	case av.L != nil:
+		size = 3
+		for _, v := range av.L {
+			size += 1 + valueSize(v)
+		}
+	}
+	return size
+}
@@ -0,0 +1,337 @@
+package dydb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lock table defaults, matching the amazon-dynamodb-lock-client library.
+const (
+	DefaultLockPartitionKey = "key"
+	DefaultLeaseDuration    = 20 * time.Second
+	DefaultHeartbeatPeriod  = 5 * time.Second
+)
+
+// ErrLockLost is returned when a lock was taken over by another owner, or
+// expired, before it was released.
+var ErrLockLost = errors.New("dydb: lock lost")
+
+// A LockClient acquires distributed locks stored in a DynamoDB table, for
+// coordinating singleton workers. Items use the layout of the
+// amazon-dynamodb-lock-client library (attributes ownerName, leaseDuration,
+// recordVersionNumber, data and isReleased), so both can share a table.
+//
+// A lock is held for a lease that each heartbeat renews by writing a new
+// record version number. A competing client takes a lock over only after
+// seeing the same record version for a whole lease duration, so holders
+// must heartbeat well within it.
+type LockClient struct {
+	DB    *DB
+	Table string
+
+	// PartitionKey is the name of the table's partition key, which must be
+	// a string. If empty, DefaultLockPartitionKey is used.
+	PartitionKey string
+
+	// Owner identifies this client in the lock item. If empty, the host
+	// name and process id are used.
+	Owner string
+
+	// If 0, DefaultLeaseDuration is used.
+	LeaseDuration time.Duration
+
+	// HeartbeatPeriod is how often held locks are renewed in the
+	// background. If 0, DefaultHeartbeatPeriod is used; if negative, locks
+	// are only renewed by calling Heartbeat.
+	HeartbeatPeriod time.Duration
+}
+
+// A Lock is a lock held by a LockClient.
+type Lock struct {
+	c    *LockClient
+	key  string
+	data []byte
+
+	beat sync.Mutex // held by Heartbeat
+
+	mu        sync.Mutex
+	rvn       string
+	next      string // the record version a heartbeat in flight writes
+	releasing bool
+	released  bool
+	lost      chan struct{}
+	stop      chan struct{}
+}
+
+func (c *LockClient) partitionKey() string {
+	if c.PartitionKey == "" {
+		return DefaultLockPartitionKey
+	}
+	return c.PartitionKey
+}
+
+func (c *LockClient) owner() string {
+	if c.Owner == "" {
+		host, _ := os.Hostname()
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return c.Owner
+}
+
+func (c *LockClient) leaseDuration() time.Duration {
+	if c.LeaseDuration <= 0 {
+		return DefaultLeaseDuration
+	}
+	return c.LeaseDuration
+}
+
+// Acquire blocks until it holds the lock named key, storing data with it, or
+// until ctx is done.
+func (c *LockClient) Acquire(ctx context.Context, key string, data []byte) (*Lock, error) {
+	var seen string         // record version of the current holder
+	var seenAt time.Time    // when seen was first observed
+	var lease time.Duration // the current holder's lease
+
+	for {
+		rvn := NewRequestToken()
+		item := Item{
+			c.partitionKey():      StringValue(key),
+			"ownerName":           StringValue(c.owner()),
+			"leaseDuration":       StringValue(strconv.FormatInt(int64(c.leaseDuration()/time.Millisecond), 10)),
+			"recordVersionNumber": StringValue(rvn),
+			"isReleased":          BoolValue(false),
+		}
+		if data != nil {
+			item["data"] = BinaryValue(data)
+		}
+
+		cond := "attribute_not_exists(#k) OR #rel = :true"
+		values := Item{":true": BoolValue(true)}
+		if seen != "" && c.db().clock().Now().Sub(seenAt) >= lease {
+			cond += " OR #rvn = :rvn"
+			values[":rvn"] = StringValue(seen)
+		}
+
+		err := c.db().ExecContext(ctx, "PutItem", map[string]interface{}{
+			"TableName":                 c.Table,
+			"Item":                      item,
+			"ConditionExpression":       cond,
+			"ExpressionAttributeNames":  map[string]string{"#k": c.partitionKey(), "#rvn": "recordVersionNumber", "#rel": "isReleased"},
+			"ExpressionAttributeValues": values,
+		})
+		if err == nil {
+			return c.newLock(key, data, rvn), nil
+		}
+		if !IsException(err, "ConditionalCheckFailedException") {
+			return nil, err
+		}
+
+		var resp struct{ Item Item }
+		err = c.db().RetryQueryContext(ctx, "GetItem", map[string]interface{}{
+			"TableName":      c.Table,
+			"Key":            Item{c.partitionKey(): StringValue(key)},
+			"ConsistentRead": true,
+		}, DefaultStreamRetries).Decode(&resp)
+		if err != nil {
+			return nil, err
+		}
+
+		// Without a record version, as for items written by other tools,
+		// the lock can't be taken over; wait a lease before trying again.
+		wait := c.leaseDuration()
+		if cur := resp.Item["recordVersionNumber"]; cur != nil && cur.S != nil {
+			if *cur.S != seen {
+				seen, seenAt = *cur.S, c.db().clock().Now()
+				lease = c.itemLease(resp.Item)
+			}
+			wait = lease - c.db().clock().Now().Sub(seenAt)
+		}
+		if wait > time.Second {
+			wait = time.Second
+		}
+		if err := c.db().clock().Sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// itemLease returns the lease duration recorded in a lock item, which the
+// Java client stores as a string of milliseconds.
+func (c *LockClient) itemLease(item Item) time.Duration {
+	if av := item["leaseDuration"]; av != nil {
+		s := av.S
+		if s == nil {
+			s = av.N
+		}
+		if s != nil {
+			if ms, err := strconv.ParseInt(*s, 10, 64); err == nil {
+				return time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return c.leaseDuration()
+}
+
+func (c *LockClient) newLock(key string, data []byte, rvn string) *Lock {
+	l := &Lock{c: c, key: key, data: data, rvn: rvn, lost: make(chan struct{})}
+
+	period := c.HeartbeatPeriod
+	if period == 0 {
+		period = DefaultHeartbeatPeriod
+	}
+	if period > 0 {
+		l.stop = make(chan struct{})
+		go l.heartbeats(period, l.stop)
+	}
+	return l
+}
+
+func (l *Lock) heartbeats(period time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(period)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), period)
+			l.Heartbeat(ctx)
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Key returns the name of the lock.
+func (l *Lock) Key() string { return l.key }
+
+// Data returns the data stored with the lock when it was acquired.
+func (l *Lock) Data() []byte { return l.data }
+
+// RecordVersion returns the current record version number of the lock. It
+// changes with every heartbeat and can be passed to other systems as a
+// fencing token: writes guarded by a record version that no longer matches
+// the lock item come from a holder that lost the lock.
+func (l *Lock) RecordVersion() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rvn
+}
+
+// Lost returns a channel that is closed if the lock is lost.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Heartbeat renews the lease of the lock. It returns ErrLockLost if another
+// owner took the lock over or the lock was released. It does nothing while
+// the lock is being released.
+func (l *Lock) Heartbeat(ctx context.Context) error {
+	l.beat.Lock()
+	defer l.beat.Unlock()
+
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return ErrLockLost
+	}
+	if l.releasing {
+		l.mu.Unlock()
+		return nil
+	}
+	rvn, old := NewRequestToken(), l.rvn
+	l.next = rvn
+	l.mu.Unlock()
+
+	err := l.c.db().ExecContext(ctx, "UpdateItem", map[string]interface{}{
+		"TableName":                 l.c.Table,
+		"Key":                       Item{l.c.partitionKey(): StringValue(l.key)},
+		"UpdateExpression":          "SET #rvn = :new",
+		"ConditionExpression":       "#own = :own AND #rvn = :rvn",
+		"ExpressionAttributeNames":  map[string]string{"#own": "ownerName", "#rvn": "recordVersionNumber"},
+		"ExpressionAttributeValues": Item{":new": StringValue(rvn), ":own": StringValue(l.c.owner()), ":rvn": StringValue(old)},
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.next = ""
+	if IsException(err, "ConditionalCheckFailedException") {
+		// A Release in flight may have deleted the item: it decides.
+		if !l.releasing {
+			l.markLost()
+		}
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	l.rvn = rvn
+	return nil
+}
+
+// Release deletes the lock item, if the lock is still held, and stops its
+// heartbeats. It returns ErrLockLost if the lock was taken over. If the item
+// can't be deleted otherwise, the lock is still held and renewed.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return ErrLockLost
+	}
+	// The item has either record version while a heartbeat is in flight.
+	l.releasing = true
+	rvn, next := l.rvn, l.next
+	if next == "" {
+		next = rvn
+	}
+	l.mu.Unlock()
+
+	err := l.c.db().ExecContext(ctx, "DeleteItem", map[string]interface{}{
+		"TableName":                 l.c.Table,
+		"Key":                       Item{l.c.partitionKey(): StringValue(l.key)},
+		"ConditionExpression":       "#own = :own AND (#rvn = :rvn OR #rvn = :next)",
+		"ExpressionAttributeNames":  map[string]string{"#own": "ownerName", "#rvn": "recordVersionNumber"},
+		"ExpressionAttributeValues": Item{":own": StringValue(l.c.owner()), ":rvn": StringValue(rvn), ":next": StringValue(next)},
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releasing = false
+	if IsException(err, "ConditionalCheckFailedException") {
+		l.markLost()
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	l.released = true
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	return nil
+}
+
+// markLost must be called with l.mu held.
+func (l *Lock) markLost() {
+	if !l.released {
+		l.released = true
+		close(l.lost)
+	}
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+}
+
+func (c *LockClient) db() *DB {
+	if c.DB == nil {
+		return &DB{}
+	}
+	return c.DB
+}
@@ -0,0 +1,74 @@
+package dydb
+
+import (
+	"encoding"
+	"reflect"
+)
+
+// Marshaler is implemented by types that encode themselves as an attribute
+// value.
+type Marshaler interface {
+	MarshalDynamo() (*AttributeValue, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from an
+// attribute value. UnmarshalDynamo is not called for NULL values, which set
+// the Go value to its zero value.
+type Unmarshaler interface {
+	UnmarshalDynamo(av *AttributeValue) error
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// implementer returns v, or its address, as a value of type t if either
+// implements the interface t.
+func implementer(v reflect.Value, t reflect.Type) (interface{}, bool) {
+	if v.Type().Implements(t) {
+		return v.Interface(), true
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(t) {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// marshalCustom encodes v with its Marshaler or encoding.TextMarshaler
+// method, reporting false if it has neither.
+func marshalCustom(v reflect.Value) (*AttributeValue, bool, error) {
+	if m, ok := implementer(v, marshalerType); ok {
+		av, err := m.(Marshaler).MarshalDynamo()
+		if err == nil && av == nil {
+			av = NullValue()
+		}
+		return av, true, err
+	}
+	if m, ok := implementer(v, textMarshalerType); ok {
+		b, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, true, err
+		}
+		s := string(b)
+		return &AttributeValue{S: &s}, true, nil
+	}
+	return nil, false, nil
+}
+
+// unmarshalCustom decodes av with the Unmarshaler or
+// encoding.TextUnmarshaler method of v, reporting false if it has neither.
+func unmarshalCustom(av *AttributeValue, v reflect.Value) (bool, error) {
+	if u, ok := implementer(v, unmarshalerType); ok {
+		return true, u.(Unmarshaler).UnmarshalDynamo(av)
+	}
+	if u, ok := implementer(v, textUnmarshalerType); ok {
+		if av.S == nil {
+			return true, &UnmarshalTypeError{av.typeName(), v.Type()}
+		}
+		return true, u.(encoding.TextUnmarshaler).UnmarshalText([]byte(*av.S))
+	}
+	return false, nil
+}
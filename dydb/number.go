@@ -0,0 +1,76 @@
+package dydb
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// NumberPrecision is the precision, in bits, of the big.Float values returned
+// by BigFloat and decoded by Unmarshal. It holds the 38 significant digits
+// DynamoDB stores.
+const NumberPrecision = 128
+
+// Int64 returns the value of the N attribute av. It fails if av is not a
+// number, or is not an integer that fits in an int64.
+func (av *AttributeValue) Int64() (int64, error) {
+	s, err := av.number()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("dydb: number %s is not an int64", s)
+	}
+	return n, nil
+}
+
+// Float64 returns the value of the N attribute av. Values with more
+// significant digits than a float64 holds are rounded; use BigFloat to keep
+// them exact.
+func (av *AttributeValue) Float64() (float64, error) {
+	s, err := av.number()
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("dydb: number %s is not a float64", s)
+	}
+	return f, nil
+}
+
+// BigInt returns the value of the N attribute av. It fails if av is not an
+// integer.
+func (av *AttributeValue) BigInt() (*big.Int, error) {
+	s, err := av.number()
+	if err != nil {
+		return nil, err
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("dydb: number %s is not an integer", s)
+	}
+	return n, nil
+}
+
+// BigFloat returns the value of the N attribute av with NumberPrecision bits
+// of precision.
+func (av *AttributeValue) BigFloat() (*big.Float, error) {
+	s, err := av.number()
+	if err != nil {
+		return nil, err
+	}
+	f, _, err := big.ParseFloat(s, 10, NumberPrecision, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("dydb: invalid number %s", s)
+	}
+	return f, nil
+}
+
+func (av *AttributeValue) number() (string, error) {
+	if av == nil || av.N == nil {
+		return "", fmt.Errorf("dydb: attribute is not a number")
+	}
+	return *av.N, nil
+}
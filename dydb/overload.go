@@ -0,0 +1,120 @@
+package dydb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Defaults of OverloadedIndex.
+const (
+	DefaultOverloadedIndex = "GSI1"
+	DefaultOverloadedPK    = "GSI1PK"
+	DefaultOverloadedSK    = "GSI1SK"
+	DefaultTypeAttribute   = "Type"
+)
+
+// An OverloadedIndex is a global secondary index shared by several entity
+// types of a single-table design, keyed by generic attributes (GSI1PK and
+// GSI1SK) whose values each type fills in its own way, such as
+// "ORG#acme"/"USER#bob" for users and "ORG#acme"/"PROJECT#2024#x" for
+// projects. An attribute of every item names its type.
+type OverloadedIndex struct {
+	DB    *DB
+	Table string
+
+	// If empty, DefaultOverloadedIndex is used.
+	Index string
+
+	// If empty, DefaultOverloadedPK and DefaultOverloadedSK are used.
+	PartitionKey string
+	SortKey      string
+
+	// If empty, DefaultTypeAttribute is used.
+	TypeAttribute string
+}
+
+func (x *OverloadedIndex) names() (index, pk, sk, typ string) {
+	index, pk, sk, typ = x.Index, x.PartitionKey, x.SortKey, x.TypeAttribute
+	if index == "" {
+		index = DefaultOverloadedIndex
+	}
+	if pk == "" {
+		pk = DefaultOverloadedPK
+	}
+	if sk == "" {
+		sk = DefaultOverloadedSK
+	}
+	if typ == "" {
+		typ = DefaultTypeAttribute
+	}
+	return
+}
+
+// Attributes returns the index attributes of an item of type typ with the
+// index keys pk and sk, to be added to the item before writing it.
+func (x *OverloadedIndex) Attributes(typ, pk, sk string) Item {
+	_, pkName, skName, typName := x.names()
+	return Item{pkName: StringValue(pk), skName: StringValue(sk), typName: StringValue(typ)}
+}
+
+// Query returns all the items of the index with partition key pk, and a
+// sort key starting with sortPrefix unless it is empty, grouped by type.
+// opts, if not nil, adds a filter or projection, which must include the
+// type attribute; its IndexName and KeyCondition are ignored.
+func (x *OverloadedIndex) Query(ctx context.Context, pk, sortPrefix string, opts *QueryOptions) (Collection, error) {
+	index, pkName, skName, typName := x.names()
+
+	var o QueryOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.IndexName = index
+	o.KeyConditionExpression = ""
+	o.KeyCondition = &KeyCondition{Partition: StringKey(pkName, pk)}
+	if sortPrefix != "" {
+		o.KeyCondition.Sort = BeginsWith(StringKey(skName, sortPrefix))
+	}
+
+	c := make(Collection)
+	token := ""
+	for {
+		p, err := x.DB.QueryPage(ctx, x.Table, &o, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range p.Items {
+			var typ string
+			if av := item[typName]; av != nil && av.S != nil {
+				typ = *av.S
+			}
+			c[typ] = append(c[typ], item)
+		}
+		if token = p.Next; token == "" {
+			return c, nil
+		}
+	}
+}
+
+// A Collection holds the items of a query by type. Items without a type are
+// under "".
+type Collection map[string][]Item
+
+// Unmarshal decodes the items of type typ into v, a pointer to a slice of
+// structs or maps, replacing its contents.
+func (c Collection) Unmarshal(typ string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dydb: cannot unmarshal a collection into %T", v)
+	}
+	s := rv.Elem()
+	items := c[typ]
+	out := reflect.MakeSlice(s.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := Unmarshal(item, out.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	s.Set(out)
+	return nil
+}
@@ -0,0 +1,204 @@
+package dydb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DefaultPageTokenTTL is how long page tokens stay valid by default.
+const DefaultPageTokenTTL = 24 * time.Hour
+
+var (
+	// ErrInvalidPageToken is returned for malformed page tokens and tokens
+	// issued for a different query or scan.
+	ErrInvalidPageToken = errors.New("dydb: invalid page token")
+
+	// ErrPageTokenExpired is returned for page tokens past their expiry.
+	ErrPageTokenExpired = errors.New("dydb: page token expired")
+)
+
+// QueryOptions controls the Query requests issued by QueryPage. Segment,
+// TotalSegments and Buffer are not used by queries.
+type QueryOptions struct {
+	KeyConditionExpression string
+
+	// KeyCondition, if not nil, is used in place of
+	// KeyConditionExpression. Its placeholders are merged with the
+	// ExpressionAttributeNames and ExpressionAttributeValues of
+	// ScanOptions.
+	KeyCondition *KeyCondition
+
+	// Descending returns items in descending order of sort key.
+	Descending bool
+
+	ScanOptions
+}
+
+func (o *QueryOptions) request(table string) (map[string]interface{}, error) {
+	scan := o.ScanOptions
+	scan.Segment, scan.TotalSegments = 0, 0
+	cond := o.KeyConditionExpression
+	if o.KeyCondition != nil {
+		b := &exprBuilder{}
+		if err := b.addNames(scan.ExpressionAttributeNames); err != nil {
+			return nil, err
+		}
+		b.values = make(Item, len(scan.ExpressionAttributeValues))
+		for k, v := range scan.ExpressionAttributeValues {
+			b.values[k] = v
+		}
+		e, err := o.KeyCondition.expression(b)
+		if err != nil {
+			return nil, err
+		}
+		cond = e.KeyConditionExpression
+		scan.ExpressionAttributeNames = e.ExpressionAttributeNames
+		scan.ExpressionAttributeValues = e.ExpressionAttributeValues
+	}
+	req := scan.request(table)
+	req["KeyConditionExpression"] = cond
+	if o.Descending {
+		req["ScanIndexForward"] = false
+	}
+	return req, nil
+}
+
+// A Page is one page of the results of a query or scan. It can also be
+// decoded from the response of a Query or Scan action.
+type Page struct {
+	Items []Item
+
+	// Count is the number of items returned, after filtering. ScannedCount
+	// is the number of items evaluated before the FilterExpression was
+	// applied; a low Count/ScannedCount ratio means an inefficient filter.
+	Count        int
+	ScannedCount int
+
+	// LastEvaluatedKey is the key to resume after, or nil if this is the
+	// last page.
+	LastEvaluatedKey Item
+
+	// Next is the token of the next page, or "" if this is the last page.
+	Next string `json:"-"`
+}
+
+// A PageToken identifies where a query or scan resumes. Its string form is
+// opaque and URL-safe, so it can be handed to web clients as a cursor. It
+// holds the key of the last item read, which is not encrypted.
+type PageToken struct {
+	Table   string
+	Index   string
+	Key     Item
+	Expires time.Time
+
+	// sum identifies the query or scan the token was issued for.
+	sum []byte
+}
+
+type pageTokenJSON struct {
+	Table   string `json:"t"`
+	Index   string `json:"i,omitempty"`
+	Key     Item   `json:"k"`
+	Expires int64  `json:"e"`
+	Sum     []byte `json:"s"`
+}
+
+// String returns the encoded token.
+func (t *PageToken) String() string {
+	b, _ := json.Marshal(&pageTokenJSON{t.Table, t.Index, t.Key, t.Expires.Unix(), t.sum})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParsePageToken decodes a token returned as Page.Next. It does not check
+// whether the token has expired.
+func ParsePageToken(s string) (*PageToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var j pageTokenJSON
+	if json.Unmarshal(b, &j) != nil || j.Table == "" || len(j.Key) == 0 {
+		return nil, ErrInvalidPageToken
+	}
+	return &PageToken{Table: j.Table, Index: j.Index, Key: j.Key, Expires: time.Unix(j.Expires, 0), sum: j.Sum}, nil
+}
+
+// QueryPage returns one page of the results of a query of table. It starts
+// after token, a Page.Next of the same query, or at the beginning if token
+// is empty. Tokens of other queries are rejected with ErrInvalidPageToken,
+// and tokens older than the DB's PageTokenTTL with ErrPageTokenExpired. A
+// different Limit may be used for each page.
+func (db *DB) QueryPage(ctx context.Context, table string, opts *QueryOptions, token string) (*Page, error) {
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+	req, err := opts.request(table)
+	if err != nil {
+		return nil, err
+	}
+	return db.page(ctx, "Query", req, opts.Retries, token)
+}
+
+// ScanPage is like QueryPage, for a scan.
+func (db *DB) ScanPage(ctx context.Context, table string, opts *ScanOptions, token string) (*Page, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	return db.page(ctx, "Scan", opts.request(table), opts.Retries, token)
+}
+
+func (db *DB) page(ctx context.Context, action string, req map[string]interface{}, retries uint, token string) (*Page, error) {
+	if retries == 0 {
+		retries = DefaultStreamRetries
+	}
+	table, _ := req["TableName"].(string)
+	index, _ := req["IndexName"].(string)
+	sum := requestSum(action, req)
+
+	if token != "" {
+		t, err := ParsePageToken(token)
+		if err != nil {
+			return nil, err
+		}
+		if t.Table != table || t.Index != index || string(t.sum) != string(sum) {
+			return nil, ErrInvalidPageToken
+		}
+		if time.Now().After(t.Expires) {
+			return nil, ErrPageTokenExpired
+		}
+		req["ExclusiveStartKey"] = t.Key
+	}
+
+	p := new(Page)
+	if err := db.RetryQueryContext(ctx, action, req, retries).Decode(p); err != nil {
+		return nil, err
+	}
+
+	if len(p.LastEvaluatedKey) > 0 {
+		ttl := db.PageTokenTTL
+		if ttl <= 0 {
+			ttl = DefaultPageTokenTTL
+		}
+		t := &PageToken{Table: table, Index: index, Key: p.LastEvaluatedKey, Expires: time.Now().Add(ttl), sum: sum}
+		p.Next = t.String()
+	}
+	return p, nil
+}
+
+// requestSum returns a short hash of the parts of a Query or Scan request
+// that must not change between pages.
+func requestSum(action string, req map[string]interface{}) []byte {
+	fixed := make(map[string]interface{}, len(req))
+	for k, v := range req {
+		if k != "Limit" && k != "ExclusiveStartKey" {
+			fixed[k] = v
+		}
+	}
+	b, _ := json.Marshal(fixed)
+	h := sha256.Sum256(append([]byte(action+"\x00"), b...))
+	return h[:8]
+}
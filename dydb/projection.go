@@ -0,0 +1,107 @@
+package dydb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A ProjectionExpression holds the expression members that select the
+// attributes returned by GetItem, Query and Scan. It can be embedded in a
+// request struct.
+type ProjectionExpression struct {
+	ProjectionExpression     string
+	ExpressionAttributeNames map[string]string `json:",omitempty"`
+}
+
+// A Projection builds a ProjectionExpression. Like Update, it replaces
+// reserved words such as "name" and "status", and names with special
+// characters, by placeholders. The zero value projects nothing.
+type Projection struct {
+	b     exprBuilder
+	paths []string
+	seen  map[string]bool
+	err   error
+}
+
+// Add projects the attributes at paths ("a.b[2]").
+func (p *Projection) Add(paths ...string) *Projection {
+	for _, path := range paths {
+		p.add(p.b.path(path))
+	}
+	return p
+}
+
+// add projects path, already in expression form.
+func (p *Projection) add(path string) {
+	if p.seen == nil {
+		p.seen = make(map[string]bool)
+	}
+	if !p.seen[path] {
+		p.seen[path] = true
+		p.paths = append(p.paths, path)
+	}
+}
+
+// Names adds placeholders of the caller's, as Update.Names does.
+func (p *Projection) Names(names map[string]string) *Projection {
+	if err := p.b.addNames(names); err != nil {
+		p.fail(err)
+	}
+	return p
+}
+
+// Fields projects the attributes that the fields of v, a struct or a pointer
+// to one, are encoded to by Marshal. If fields are given, only the Go fields
+// with these names are projected; otherwise all of them are. Attribute names
+// are not paths: a tag such as "a.b" names a top-level attribute.
+func (p *Projection) Fields(v interface{}, fields ...string) *Projection {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		p.fail(fmt.Errorf("dydb: Projection.Fields of non-struct %v", t))
+		return p
+	}
+
+	byName := make(map[string]string)
+	for _, f := range structFields(t) {
+		if len(fields) == 0 {
+			p.add(p.b.name(f.name))
+		} else {
+			byName[t.FieldByIndex(f.index).Name] = f.name
+		}
+	}
+	for _, name := range fields {
+		attr, ok := byName[name]
+		if !ok {
+			p.fail(fmt.Errorf("dydb: %v has no encoded field %s", t, name))
+			return p
+		}
+		p.add(p.b.name(attr))
+	}
+	return p
+}
+
+// Expression returns the built expression, or the first error met while
+// building it.
+func (p *Projection) Expression() (*ProjectionExpression, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.paths) == 0 {
+		return nil, errors.New("dydb: empty projection")
+	}
+	return &ProjectionExpression{
+		ProjectionExpression:     strings.Join(p.paths, ", "),
+		ExpressionAttributeNames: p.b.names,
+	}, nil
+}
+
+func (p *Projection) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,78 @@
+package dydb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A RateLimiter paces operations to a steady rate. A nil *RateLimiter, or
+// one with a zero rate, never waits. It is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing perSecond operations per
+// second.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(perSecond)
+	return l
+}
+
+// SetRate changes the rate to perSecond operations per second. A rate of 0
+// or less removes the limit.
+func (l *RateLimiter) SetRate(perSecond float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if perSecond <= 0 {
+		l.interval = 0
+	} else {
+		l.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+}
+
+// Wait blocks until one operation may proceed or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n operations may proceed or ctx is done. If ctx is done
+// first, the n operations are given back.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	if l.interval == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	reserved := time.Duration(n) * l.interval
+	l.next = at.Add(reserved)
+	l.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.next = l.next.Add(-reserved)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+package dydb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// StringSetValue returns an SS attribute value holding ss.
+func StringSetValue(ss ...string) *AttributeValue {
+	if ss == nil {
+		ss = []string{}
+	}
+	return &AttributeValue{SS: ss}
+}
+
+// NumberSetValue returns an NS attribute value holding the numbers ns.
+func NumberSetValue(ns ...string) *AttributeValue {
+	if ns == nil {
+		ns = []string{}
+	}
+	return &AttributeValue{NS: ns}
+}
+
+// MarshalSet returns the DynamoDB set encoding of v: a slice or array of
+// strings, numbers or byte slices, or a map whose keys are strings or
+// numbers. Duplicate members are dropped, since DynamoDB rejects them. An
+// empty set is encoded as NULL, since DynamoDB does not store empty sets.
+func MarshalSet(v interface{}) (*AttributeValue, error) {
+	return marshalSet(reflect.ValueOf(v))
+}
+
+// isSetMap reports whether t is a map used as a set, like map[string]struct{}.
+func isSetMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+func marshalSet(v reflect.Value) (*AttributeValue, error) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return NullValue(), nil
+	}
+
+	var elems []reflect.Value
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, fmt.Errorf("dydb: cannot marshal %s as a set", v.Type())
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, v.Index(i))
+		}
+	case reflect.Map:
+		elems = v.MapKeys()
+	default:
+		return nil, fmt.Errorf("dydb: cannot marshal %s as a set", v.Type())
+	}
+	if len(elems) == 0 {
+		return NullValue(), nil
+	}
+
+	set := &AttributeValue{}
+	seen := make(map[string]bool, len(elems))
+	for _, e := range elems {
+		av, err := marshalValue(e, 0)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		switch {
+		case av.S != nil:
+			key = *av.S
+		case av.N != nil:
+			key = *av.N
+		default:
+			key = string(av.B)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		switch {
+		case av.S != nil && set.NS == nil && set.BS == nil:
+			set.SS = append(set.SS, *av.S)
+		case av.N != nil && set.SS == nil && set.BS == nil:
+			set.NS = append(set.NS, *av.N)
+		case av.B != nil && set.SS == nil && set.NS == nil:
+			set.BS = append(set.BS, av.B)
+		default:
+			return nil, fmt.Errorf("dydb: cannot marshal %s as a set", v.Type())
+		}
+	}
+
+	// Map iteration order is random; keep the encoding stable.
+	if v.Kind() == reflect.Map {
+		sort.Strings(set.SS)
+		sort.Strings(set.NS)
+	}
+	return set, nil
+}
+
+// unmarshalSetMap decodes the members of a set or list into the keys of the
+// set map v.
+func unmarshalSetMap(av *AttributeValue, v reflect.Value) error {
+	l, ok := av.elements()
+	if !ok {
+		return &UnmarshalTypeError{av.typeName(), v.Type()}
+	}
+
+	m := reflect.MakeMapWithSize(v.Type(), len(l))
+	kt, present := v.Type().Key(), reflect.New(v.Type().Elem()).Elem()
+	for _, e := range l {
+		k := reflect.New(kt).Elem()
+		if err := unmarshalValue(e, k); err != nil {
+			return err
+		}
+		m.SetMapIndex(k, present)
+	}
+	v.Set(m)
+	return nil
+}
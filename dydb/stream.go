@@ -0,0 +1,121 @@
+package dydb
+
+import (
+	"context"
+)
+
+// DefaultStreamRetries is the number of attempts ScanStream makes for each
+// page while DynamoDB throttles it.
+const DefaultStreamRetries = 8
+
+// ScanOptions controls the Scan requests issued by ScanStream. The zero value
+// scans the whole table with the service defaults.
+type ScanOptions struct {
+	IndexName                 string
+	FilterExpression          string
+	ProjectionExpression      string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues Item
+	ConsistentRead            bool
+
+	// Limit is the number of items evaluated per page. If 0, DynamoDB
+	// returns pages of up to 1MB.
+	Limit int
+
+	// Segment and TotalSegments select one segment of a parallel scan.
+	// TotalSegments is ignored if 0.
+	Segment       int
+	TotalSegments int
+
+	// Buffer is the capacity of the item channel. A slow consumer blocks the
+	// scan once the buffer is full.
+	Buffer int
+
+	// Retries is the number of attempts made for each page while throttled.
+	// If 0, DefaultStreamRetries is used.
+	Retries uint
+}
+
+func (o *ScanOptions) request(table string) map[string]interface{} {
+	req := map[string]interface{}{"TableName": table}
+	if o.IndexName != "" {
+		req["IndexName"] = o.IndexName
+	}
+	if o.FilterExpression != "" {
+		req["FilterExpression"] = o.FilterExpression
+	}
+	if o.ProjectionExpression != "" {
+		req["ProjectionExpression"] = o.ProjectionExpression
+	}
+	if len(o.ExpressionAttributeNames) > 0 {
+		req["ExpressionAttributeNames"] = o.ExpressionAttributeNames
+	}
+	if len(o.ExpressionAttributeValues) > 0 {
+		req["ExpressionAttributeValues"] = o.ExpressionAttributeValues
+	}
+	if o.ConsistentRead {
+		req["ConsistentRead"] = true
+	}
+	if o.Limit > 0 {
+		req["Limit"] = o.Limit
+	}
+	if o.TotalSegments > 0 {
+		req["Segment"] = o.Segment
+		req["TotalSegments"] = o.TotalSegments
+	}
+	return req
+}
+
+// ScanStream scans table in the background and sends every item on the
+// returned item channel, following LastEvaluatedKey until the scan is
+// complete. Throttled pages are retried with backoff. A nil opts is the same
+// as the zero ScanOptions.
+//
+// Both channels are closed when the scan ends. The error channel receives at
+// most one value: the error that stopped the scan, or ctx.Err() if ctx was
+// canceled. Callers should drain the item channel before reading the error.
+func (db *DB) ScanStream(ctx context.Context, table string, opts *ScanOptions) (<-chan Item, <-chan error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultStreamRetries
+	}
+
+	items := make(chan Item, opts.Buffer)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(items)
+
+		req := opts.request(table)
+		for {
+			var resp struct {
+				Items            []Item
+				LastEvaluatedKey Item
+			}
+			if err := db.RetryQueryContext(ctx, "Scan", req, retries).Decode(&resp); err != nil {
+				errc <- err
+				return
+			}
+
+			for _, item := range resp.Items {
+				select {
+				case items <- item:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+
+			if len(resp.LastEvaluatedKey) == 0 {
+				return
+			}
+			req["ExclusiveStartKey"] = resp.LastEvaluatedKey
+		}
+	}()
+
+	return items, errc
+}
@@ -0,0 +1,124 @@
+package dydb
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// StreamsTarget is the Target of a DB talking to DynamoDB Streams, whose
+// endpoint is streams.dynamodb.<region>.amazonaws.com.
+const StreamsTarget = "DynamoDBStreams"
+
+// NewStreamsDB returns a DB for the DynamoDB Streams endpoint of region.
+func NewStreamsDB(region string) *DB {
+	url := "https://streams.dynamodb." + region + ".amazonaws.com/"
+	if strings.HasPrefix(region, "cn-") {
+		url = "https://streams.dynamodb." + region + ".amazonaws.com.cn/"
+	}
+	return &DB{URL: url, Region: region, Target: StreamsTarget}
+}
+
+// Shard iterator types.
+const (
+	TrimHorizon         = "TRIM_HORIZON"
+	Latest              = "LATEST"
+	AtSequenceNumber    = "AT_SEQUENCE_NUMBER"
+	AfterSequenceNumber = "AFTER_SEQUENCE_NUMBER"
+)
+
+// A Shard is a shard of a stream, as returned by DescribeStream.
+type Shard struct {
+	ShardId             string
+	ParentShardId       string
+	SequenceNumberRange struct {
+		StartingSequenceNumber string
+		EndingSequenceNumber   string // empty while the shard is open
+	}
+}
+
+// A StreamRecord is a change to an item of a table.
+type StreamRecord struct {
+	EventID   string `json:"eventID"`
+	EventName string `json:"eventName"` // INSERT, MODIFY or REMOVE
+	Dynamodb  struct {
+		Keys                        Item
+		NewImage                    Item
+		OldImage                    Item
+		SequenceNumber              string
+		SizeBytes                   int64
+		StreamViewType              string
+		ApproximateCreationDateTime float64
+	} `json:"dynamodb"`
+
+	// UserIdentity is set for deletions made by TTL.
+	UserIdentity *struct {
+		PrincipalId string `json:"principalId"`
+		Type        string `json:"type"`
+	} `json:"userIdentity,omitempty"`
+}
+
+// Time returns the approximate time of the change.
+func (r *StreamRecord) Time() time.Time {
+	return time.Unix(int64(r.Dynamodb.ApproximateCreationDateTime), 0)
+}
+
+// DescribeShards returns all the shards of the stream arn, following all
+// pages of DescribeStream. db must be a DynamoDB Streams DB.
+func (db *DB) DescribeShards(ctx context.Context, arn string) ([]Shard, error) {
+	req := map[string]interface{}{"StreamArn": arn}
+	var shards []Shard
+	for {
+		var resp struct {
+			StreamDescription struct {
+				Shards               []Shard
+				LastEvaluatedShardId string
+			}
+		}
+		if err := db.RetryQueryContext(ctx, "DescribeStream", req, DefaultStreamRetries).Decode(&resp); err != nil {
+			return nil, err
+		}
+		shards = append(shards, resp.StreamDescription.Shards...)
+		if resp.StreamDescription.LastEvaluatedShardId == "" {
+			return shards, nil
+		}
+		req["ExclusiveStartShardId"] = resp.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// GetShardIterator returns an iterator for shard of the stream arn, of one of
+// the iterator types. seq is the sequence number of AtSequenceNumber and
+// AfterSequenceNumber iterators.
+func (db *DB) GetShardIterator(ctx context.Context, arn, shard, iteratorType, seq string) (string, error) {
+	req := map[string]interface{}{
+		"StreamArn":         arn,
+		"ShardId":           shard,
+		"ShardIteratorType": iteratorType,
+	}
+	if seq != "" {
+		req["SequenceNumber"] = seq
+	}
+	var resp struct{ ShardIterator string }
+	if err := db.RetryQueryContext(ctx, "GetShardIterator", req, DefaultStreamRetries).Decode(&resp); err != nil {
+		return "", err
+	}
+	return resp.ShardIterator, nil
+}
+
+// GetRecords returns up to limit records (all available if 0) from iterator,
+// and the iterator to read the next ones from, which is empty once a closed
+// shard has been read to its end.
+func (db *DB) GetRecords(ctx context.Context, iterator string, limit int) ([]StreamRecord, string, error) {
+	req := map[string]interface{}{"ShardIterator": iterator}
+	if limit > 0 {
+		req["Limit"] = limit
+	}
+	var resp struct {
+		Records           []StreamRecord
+		NextShardIterator string
+	}
+	if err := db.RetryQueryContext(ctx, "GetRecords", req, DefaultStreamRetries).Decode(&resp); err != nil {
+		return nil, "", err
+	}
+	return resp.Records, resp.NextShardIterator, nil
+}
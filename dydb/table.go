@@ -0,0 +1,354 @@
+package dydb
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an item does not exist.
+var ErrNotFound = errors.New("dydb: item not found")
+
+// ErrCounterRange is returned by Increment when the new value of the counter
+// does not fit in an int64. The increment has been applied; use
+// IncrementBig to read such counters.
+var ErrCounterRange = errors.New("dydb: counter out of int64 range")
+
+// A Table is a DynamoDB table accessed through a DB. Keys are items holding
+// only the key attributes.
+type Table struct {
+	DB   *DB
+	Name string
+
+	// ConsistentRead makes GetItem use strongly consistent reads.
+	ConsistentRead bool
+
+	// Retries is the number of attempts made for each request while
+	// throttled. If 0, a single attempt is made.
+	Retries uint
+
+	// HedgeDelay, if not zero, makes GetItem send a second request when the
+	// first hasn't completed within HedgeDelay, and use whichever response
+	// arrives first. This trades extra reads for lower tail latency.
+	HedgeDelay time.Duration
+
+	// HedgeDB is where hedged requests are sent, such as a replica of a
+	// Global Table. If nil, DB is used. Reads from another region aren't
+	// strongly consistent, even with ConsistentRead.
+	HedgeDB *DB
+}
+
+// Table returns the table called name.
+func (db *DB) Table(name string) *Table {
+	return &Table{DB: db, Name: name}
+}
+
+func (t *Table) query(ctx context.Context, action string, req map[string]interface{}) Decoder {
+	req["TableName"] = t.Name
+	return t.DB.RetryQueryContext(ctx, action, req, t.Retries)
+}
+
+// GetItem reads the item with key and unmarshals it into v. It returns
+// ErrNotFound if there is no such item.
+func (t *Table) GetItem(ctx context.Context, key Item, v interface{}) error {
+	req := map[string]interface{}{"TableName": t.Name, "Key": key}
+	if t.ConsistentRead {
+		req["ConsistentRead"] = true
+	}
+
+	var item Item
+	var err error
+	if t.HedgeDelay > 0 {
+		item, err = t.hedgedGet(ctx, req)
+	} else {
+		item, err = t.getItem(ctx, t.DB, req)
+	}
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrNotFound
+	}
+	return Unmarshal(item, v)
+}
+
+func (t *Table) getItem(ctx context.Context, db *DB, req map[string]interface{}) (Item, error) {
+	var resp struct{ Item Item }
+	err := db.RetryQueryContext(ctx, "GetItem", req, t.Retries).Decode(&resp)
+	return resp.Item, err
+}
+
+// hedgedGet sends GetItem to t.DB and, if it hasn't completed after
+// t.HedgeDelay, to t.HedgeDB too. It returns the first successful response,
+// or the last error if every request fails.
+func (t *Table) hedgedGet(ctx context.Context, req map[string]interface{}) (Item, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		item Item
+		err  error
+	}
+	results := make(chan result, 2)
+	get := func(db *DB) {
+		item, err := t.getItem(ctx, db, req)
+		results <- result{item, err}
+	}
+	go get(t.DB)
+
+	timer := time.NewTimer(t.HedgeDelay)
+	defer timer.Stop()
+
+	for pending := 1; ; {
+		select {
+		case r := <-results:
+			if pending--; r.err == nil || pending == 0 {
+				return r.item, r.err
+			}
+		case <-timer.C:
+			hedge := t.HedgeDB
+			if hedge == nil {
+				hedge = t.DB
+			}
+			pending++
+			go get(hedge)
+		}
+	}
+}
+
+// PutItem marshals v and writes it, replacing any item with the same key.
+func (t *Table) PutItem(ctx context.Context, v interface{}) error {
+	_, err := t.PutItemReturn(ctx, v, ReturnNone)
+	return err
+}
+
+// DeleteItem deletes the item with key, if it exists.
+func (t *Table) DeleteItem(ctx context.Context, key Item) error {
+	_, err := t.DeleteItemReturn(ctx, key, ReturnNone)
+	return err
+}
+
+// UpdateItem applies u to the item with key, creating the item if it does
+// not exist.
+func (t *Table) UpdateItem(ctx context.Context, key Item, u *Update) error {
+	_, err := t.UpdateItemReturn(ctx, key, u, ReturnNone)
+	return err
+}
+
+// ReturnValues of writes. Puts and deletes only support ReturnNone and
+// ReturnAllOld.
+const (
+	ReturnNone       = "NONE"
+	ReturnAllOld     = "ALL_OLD"
+	ReturnUpdatedOld = "UPDATED_OLD"
+	ReturnAllNew     = "ALL_NEW"
+	ReturnUpdatedNew = "UPDATED_NEW"
+)
+
+// A WriteResult is the outcome of a write.
+type WriteResult struct {
+	// Attributes are the attributes asked for with ReturnValues: the item
+	// replaced or deleted, or the attributes before or after an update. It
+	// is nil if a put or delete found no item.
+	Attributes Item
+
+	// ItemCollectionMetrics is the size of the item collection written to,
+	// if the DB has OnItemCollectionMetrics and the table has local
+	// secondary indexes, or nil.
+	ItemCollectionMetrics *ItemCollectionMetrics
+}
+
+// MaxItemCollectionSizeGB is the largest size of an item collection.
+const MaxItemCollectionSizeGB = 10
+
+// ItemCollectionMetrics estimate the size of an item collection: the items
+// with the same partition key, in a table with local secondary indexes,
+// which can't grow past MaxItemCollectionSizeGB.
+type ItemCollectionMetrics struct {
+	// ItemCollectionKey holds the partition key of the collection.
+	ItemCollectionKey Item
+
+	// SizeEstimateRangeGB holds the lower and upper bounds of the size of
+	// the collection, in GB.
+	SizeEstimateRangeGB []float64
+}
+
+// SizeGB returns the upper bound of the size estimate, in GB.
+func (m *ItemCollectionMetrics) SizeGB() float64 {
+	if len(m.SizeEstimateRangeGB) == 0 {
+		return 0
+	}
+	return m.SizeEstimateRangeGB[len(m.SizeEstimateRangeGB)-1]
+}
+
+// Unmarshal unmarshals the Attributes into v. It returns ErrNotFound if
+// there are none.
+func (r *WriteResult) Unmarshal(v interface{}) error {
+	if r.Attributes == nil {
+		return ErrNotFound
+	}
+	return Unmarshal(r.Attributes, v)
+}
+
+// PutItemReturn is like PutItem, and returns the item replaced if
+// returnValues is ReturnAllOld.
+func (t *Table) PutItemReturn(ctx context.Context, v interface{}, returnValues string) (*WriteResult, error) {
+	item, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return t.write(ctx, "PutItem", map[string]interface{}{"Item": item}, returnValues)
+}
+
+// DeleteItemReturn is like DeleteItem, and returns the item deleted if
+// returnValues is ReturnAllOld.
+func (t *Table) DeleteItemReturn(ctx context.Context, key Item, returnValues string) (*WriteResult, error) {
+	return t.write(ctx, "DeleteItem", map[string]interface{}{"Key": key}, returnValues)
+}
+
+// UpdateItemReturn is like UpdateItem, and returns the attributes selected by
+// returnValues, such as ReturnUpdatedNew for the new values of the
+// attributes updated.
+func (t *Table) UpdateItemReturn(ctx context.Context, key Item, u *Update, returnValues string) (*WriteResult, error) {
+	expr, err := u.Expression()
+	if err != nil {
+		return nil, err
+	}
+	req := map[string]interface{}{
+		"Key":              key,
+		"UpdateExpression": expr.UpdateExpression,
+	}
+	if len(expr.ExpressionAttributeNames) > 0 {
+		req["ExpressionAttributeNames"] = expr.ExpressionAttributeNames
+	}
+	if len(expr.ExpressionAttributeValues) > 0 {
+		req["ExpressionAttributeValues"] = expr.ExpressionAttributeValues
+	}
+	return t.write(ctx, "UpdateItem", req, returnValues)
+}
+
+func (t *Table) write(ctx context.Context, action string, req map[string]interface{}, returnValues string) (*WriteResult, error) {
+	if returnValues != "" && returnValues != ReturnNone {
+		req["ReturnValues"] = returnValues
+	}
+	if t.DB.OnItemCollectionMetrics != nil {
+		req["ReturnItemCollectionMetrics"] = "SIZE"
+	}
+	var resp WriteResult
+	if err := t.query(ctx, action, req).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if m := resp.ItemCollectionMetrics; m != nil {
+		t.DB.OnItemCollectionMetrics(t.Name, m)
+	}
+	return &resp, nil
+}
+
+// Increment atomically adds delta, which may be negative, to the number attr
+// of the item with key and returns the new value. A missing item or
+// attribute counts as 0, so the first Increment creates it. Increment fails
+// with a ValidationException if attr holds something other than a number,
+// and returns ErrCounterRange if the new value does not fit in an int64.
+func (t *Table) Increment(ctx context.Context, key Item, attr string, delta int64) (int64, error) {
+	n, err := t.IncrementBig(ctx, key, attr, big.NewInt(delta))
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsInt64() {
+		return 0, ErrCounterRange
+	}
+	return n.Int64(), nil
+}
+
+// IncrementBig is like Increment, for counters beyond the int64 range.
+// DynamoDB numbers hold up to 38 digits.
+func (t *Table) IncrementBig(ctx context.Context, key Item, attr string, delta *big.Int) (*big.Int, error) {
+	return t.increment(ctx, key, attr, delta, false)
+}
+
+// IncrementExisting is like Increment, but returns ErrNotFound instead of
+// creating a missing item.
+func (t *Table) IncrementExisting(ctx context.Context, key Item, attr string, delta int64) (int64, error) {
+	n, err := t.increment(ctx, key, attr, big.NewInt(delta), true)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsInt64() {
+		return 0, ErrCounterRange
+	}
+	return n.Int64(), nil
+}
+
+func (t *Table) increment(ctx context.Context, key Item, attr string, delta *big.Int, mustExist bool) (*big.Int, error) {
+	var u Update
+	u.Add(attr, delta)
+	cond := ""
+	if mustExist {
+		for name := range key {
+			cond = "attribute_exists(" + u.b.name(name) + ")"
+			break
+		}
+	}
+	expr, err := u.Expression()
+	if err != nil {
+		return nil, err
+	}
+
+	req := map[string]interface{}{
+		"Key":              key,
+		"UpdateExpression": expr.UpdateExpression,
+		"ReturnValues":     "UPDATED_NEW",
+	}
+	if len(expr.ExpressionAttributeNames) > 0 {
+		req["ExpressionAttributeNames"] = expr.ExpressionAttributeNames
+	}
+	if len(expr.ExpressionAttributeValues) > 0 {
+		req["ExpressionAttributeValues"] = expr.ExpressionAttributeValues
+	}
+	if cond != "" {
+		req["ConditionExpression"] = cond
+	}
+
+	var resp struct{ Attributes Item }
+	err = t.query(ctx, "UpdateItem", req).Decode(&resp)
+	if mustExist && IsException(err, "ConditionalCheckFailedException") {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pathValue(resp.Attributes, attr).BigInt()
+}
+
+// pathValue returns the value at the document path p ("a.b[2].c") of item,
+// or nil if there is none.
+func pathValue(item Item, p string) *AttributeValue {
+	av := &AttributeValue{M: item}
+	for _, part := range strings.Split(p, ".") {
+		name := part
+		if i := strings.IndexByte(part, '['); i > 0 {
+			name, part = part[:i], part[i:]
+		} else {
+			part = ""
+		}
+		if av == nil {
+			return nil
+		}
+		av = av.M[name]
+		for part != "" {
+			j := strings.IndexByte(part, ']')
+			if j < 0 || av == nil {
+				return nil
+			}
+			n, err := strconv.Atoi(part[1:j])
+			if err != nil || n < 0 || n >= len(av.L) {
+				return nil
+			}
+			av, part = av.L[n], part[j+1:]
+		}
+	}
+	return av
+}
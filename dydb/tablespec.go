@@ -0,0 +1,272 @@
+package dydb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Billing modes of tables.
+const (
+	BillingModeProvisioned   = "PROVISIONED"
+	BillingModePayPerRequest = "PAY_PER_REQUEST"
+)
+
+// Throughput is the provisioned capacity of a table or index.
+type Throughput struct {
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+}
+
+// A KeyDefinition names a key attribute and its type: "S", "N" or "B".
+type KeyDefinition struct {
+	Name string
+	Type string
+}
+
+// An IndexSpec describes a global secondary index of a TableSpec.
+type IndexSpec struct {
+	Name         string
+	PartitionKey KeyDefinition
+
+	// SortKey is zero for indexes without a sort key.
+	SortKey KeyDefinition
+
+	// ProjectionType is ALL, KEYS_ONLY or INCLUDE, with NonKeyAttributes.
+	// If empty, ALL is used.
+	ProjectionType   string
+	NonKeyAttributes []string
+
+	// Throughput is required with BillingModeProvisioned, and not allowed
+	// with BillingModePayPerRequest.
+	Throughput *Throughput
+}
+
+// A TableSpec describes a table for CreateTable.
+type TableSpec struct {
+	Name         string
+	PartitionKey KeyDefinition
+
+	// SortKey is zero for tables without a sort key.
+	SortKey KeyDefinition
+
+	// BillingMode is BillingModeProvisioned or BillingModePayPerRequest.
+	// If empty, BillingModePayPerRequest is used, unless Throughput is set.
+	BillingMode string
+
+	// Throughput is required with BillingModeProvisioned, and not allowed
+	// with BillingModePayPerRequest.
+	Throughput *Throughput
+
+	Indexes []IndexSpec
+
+	// TableClass, if not empty, is TableClassStandard or
+	// TableClassStandardInfrequentAccess.
+	TableClass string
+}
+
+// billingMode returns the billing mode of s, defaulted.
+func (s *TableSpec) billingMode() string {
+	switch {
+	case s.BillingMode != "":
+		return s.BillingMode
+	case s.Throughput != nil:
+		return BillingModeProvisioned
+	}
+	return BillingModePayPerRequest
+}
+
+// checkThroughput checks that t is set if and only if mode is provisioned.
+func checkThroughput(mode string, t *Throughput, what string) error {
+	switch mode {
+	case BillingModeProvisioned:
+		if t == nil || t.ReadCapacityUnits <= 0 || t.WriteCapacityUnits <= 0 {
+			return fmt.Errorf("dydb: provisioned %s without throughput", what)
+		}
+	case BillingModePayPerRequest:
+		if t != nil {
+			return fmt.Errorf("dydb: %s billed per request with provisioned throughput", what)
+		}
+	default:
+		return fmt.Errorf("dydb: invalid billing mode %q", mode)
+	}
+	return nil
+}
+
+// Validate checks that s has a name and a partition key, and that
+// provisioned throughput is set for the table and all its indexes if and
+// only if it is provisioned.
+func (s *TableSpec) Validate() error {
+	if s.Name == "" || s.PartitionKey.Name == "" {
+		return errors.New("dydb: table spec without a name or partition key")
+	}
+	mode := s.billingMode()
+	if err := checkThroughput(mode, s.Throughput, "table "+s.Name); err != nil {
+		return err
+	}
+	for _, ix := range s.Indexes {
+		if ix.Name == "" || ix.PartitionKey.Name == "" {
+			return errors.New("dydb: index spec without a name or partition key")
+		}
+		if err := checkThroughput(mode, ix.Throughput, "index "+ix.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// request returns the CreateTable request of s.
+func (s *TableSpec) request() map[string]interface{} {
+	var defs []KeyDefinition
+	define := func(k KeyDefinition) {
+		for _, d := range defs {
+			if d.Name == k.Name {
+				return
+			}
+		}
+		defs = append(defs, KeyDefinition{Name: k.Name, Type: k.Type})
+	}
+	schema := func(pk, sk KeyDefinition) []map[string]string {
+		define(pk)
+		ks := []map[string]string{{"AttributeName": pk.Name, "KeyType": "HASH"}}
+		if sk.Name != "" {
+			define(sk)
+			ks = append(ks, map[string]string{"AttributeName": sk.Name, "KeyType": "RANGE"})
+		}
+		return ks
+	}
+
+	req := map[string]interface{}{
+		"TableName":   s.Name,
+		"KeySchema":   schema(s.PartitionKey, s.SortKey),
+		"BillingMode": s.billingMode(),
+	}
+	if s.Throughput != nil {
+		req["ProvisionedThroughput"] = s.Throughput
+	}
+	if s.TableClass != "" {
+		req["TableClass"] = s.TableClass
+	}
+	var indexes []map[string]interface{}
+	for _, ix := range s.Indexes {
+		projection := map[string]interface{}{"ProjectionType": ix.ProjectionType}
+		if ix.ProjectionType == "" {
+			projection["ProjectionType"] = "ALL"
+		}
+		if len(ix.NonKeyAttributes) > 0 {
+			projection["NonKeyAttributes"] = ix.NonKeyAttributes
+		}
+		gsi := map[string]interface{}{
+			"IndexName":  ix.Name,
+			"KeySchema":  schema(ix.PartitionKey, ix.SortKey),
+			"Projection": projection,
+		}
+		if ix.Throughput != nil {
+			gsi["ProvisionedThroughput"] = ix.Throughput
+		}
+		indexes = append(indexes, gsi)
+	}
+	if len(indexes) > 0 {
+		req["GlobalSecondaryIndexes"] = indexes
+	}
+
+	attrs := make([]map[string]string, len(defs))
+	for i, d := range defs {
+		attrs[i] = map[string]string{"AttributeName": d.Name, "AttributeType": d.Type}
+	}
+	req["AttributeDefinitions"] = attrs
+	return req
+}
+
+// CreateTable creates the table described by s, after validating it. It
+// does not wait for the table to become active.
+func (db *DB) CreateTable(ctx context.Context, s *TableSpec) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	return db.ExecContext(ctx, "CreateTable", s.request())
+}
+
+// SetBillingMode switches table to mode, with throughput t if provisioned,
+// which must be nil otherwise. DynamoDB allows switching to
+// BillingModePayPerRequest once a day. The throughput of global secondary
+// indexes is left to be updated separately.
+func (db *DB) SetBillingMode(ctx context.Context, table, mode string, t *Throughput) error {
+	if err := checkThroughput(mode, t, "table "+table); err != nil {
+		return err
+	}
+	req := map[string]interface{}{"TableName": table, "BillingMode": mode}
+	if t != nil {
+		req["ProvisionedThroughput"] = t
+	}
+	return db.ExecContext(ctx, "UpdateTable", req)
+}
+
+// A TableDescription is the part of the DescribeTable response of a table
+// that describes its status, size and capacity.
+type TableDescription struct {
+	Name   string
+	ARN    string
+	Status string // CREATING, UPDATING, DELETING, ACTIVE, ...
+
+	// BillingMode is BillingModeProvisioned or BillingModePayPerRequest.
+	BillingMode string
+
+	// Throughput is the provisioned capacity, zero for tables billed per
+	// request.
+	Throughput Throughput
+
+	ItemCount int64
+	SizeBytes int64
+	Created   time.Time
+}
+
+// PayPerRequest returns true if the table is billed per request, rather
+// than for provisioned capacity, so that only the account and table limits
+// of DescribeLimits cap its throughput.
+func (d *TableDescription) PayPerRequest() bool {
+	return d.BillingMode == BillingModePayPerRequest
+}
+
+// DescribeTable returns the description of table.
+func (db *DB) DescribeTable(ctx context.Context, table string) (*TableDescription, error) {
+	var resp struct {
+		Table struct {
+			TableName          string
+			TableArn           string
+			TableStatus        string
+			BillingModeSummary struct {
+				BillingMode string
+			}
+			ProvisionedThroughput Throughput
+			ItemCount             int64
+			TableSizeBytes        int64
+			CreationDateTime      float64
+		}
+	}
+	if err := db.QueryContext(ctx, "DescribeTable", map[string]string{"TableName": table}).Decode(&resp); err != nil {
+		return nil, err
+	}
+	t := resp.Table
+	d := &TableDescription{
+		Name:        t.TableName,
+		ARN:         t.TableArn,
+		Status:      t.TableStatus,
+		BillingMode: t.BillingModeSummary.BillingMode,
+		Throughput:  t.ProvisionedThroughput,
+		ItemCount:   t.ItemCount,
+		SizeBytes:   t.TableSizeBytes,
+	}
+	// Tables created before billing modes have no summary.
+	if d.BillingMode == "" {
+		d.BillingMode = BillingModeProvisioned
+	}
+	if d.PayPerRequest() {
+		d.Throughput = Throughput{}
+	}
+	if t.CreationDateTime > 0 {
+		d.Created = time.Unix(0, int64(t.CreationDateTime*1e9)).UTC()
+	}
+	return d, nil
+}
@@ -0,0 +1,168 @@
+package dydb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// A Tenant names the tables of one tenant of a multi-tenant application
+// that gives each tenant its own set of tables, as Prefix + name + Suffix:
+//
+//	acme := &dydb.Tenant{DB: db, Prefix: "acme."}
+//	orders := acme.Table("orders") // acme.orders
+//
+// The requests made with a context from WithTenant may only name the tables
+// of the tenant. Prefix must end, or Suffix start, with a separator (".",
+// "-" or "_"), so that the tables of tenant "t1" aren't those of "t12".
+type Tenant struct {
+	DB     *DB
+	Prefix string
+	Suffix string
+}
+
+// TableName returns the full name of the table name of t.
+func (t *Tenant) TableName(name string) string {
+	return t.Prefix + name + t.Suffix
+}
+
+// Table returns the table name of t.
+func (t *Tenant) Table(name string) *Table {
+	return t.DB.Table(t.TableName(name))
+}
+
+// Owns returns true if table is a table of t. A Tenant without a separator
+// owns no tables.
+func (t *Tenant) Owns(table string) bool {
+	return t.separated() && len(table) > len(t.Prefix)+len(t.Suffix) &&
+		strings.HasPrefix(table, t.Prefix) && strings.HasSuffix(table, t.Suffix)
+}
+
+// separated returns true if the Prefix of t ends, or its Suffix starts,
+// with a separator.
+func (t *Tenant) separated() bool {
+	return (t.Prefix != "" && strings.IndexByte(".-_", t.Prefix[len(t.Prefix)-1]) >= 0) ||
+		(t.Suffix != "" && strings.IndexByte(".-_", t.Suffix[0]) >= 0)
+}
+
+// A TenantError is returned for requests naming a table of another tenant
+// than the one of their context. They are not sent.
+type TenantError struct {
+	Table string
+}
+
+func (e *TenantError) Error() string {
+	return "dydb: table " + e.Table + " is not of the tenant of the request"
+}
+
+// ErrNoTenant is returned for requests without a tenant by DBs with
+// RequireTenant set.
+var ErrNoTenant = errors.New("dydb: request without a tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx whose requests may only name the tables
+// of t. Requests naming other tables fail with a *TenantError. Requests
+// naming no table, such as ListTables or ListBackups, and PartiQL
+// statements, whose tables aren't checked, fail too.
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// checkTenant checks that the request body b of action only names the
+// tables of the tenant of ctx.
+func (db *DB) checkTenant(ctx context.Context, action string, b []byte) error {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	if t == nil {
+		if db.RequireTenant {
+			return ErrNoTenant
+		}
+		return nil
+	}
+	if !t.separated() {
+		return errors.New("dydb: tenant without a separator after its Prefix or before its Suffix")
+	}
+	switch action {
+	case "ExecuteStatement", "BatchExecuteStatement", "ExecuteTransaction":
+		return errors.New("dydb: " + action + " is not allowed with a tenant")
+	}
+
+	tables, err := requestTables(b)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		// Such as ListTables, which would list the tables of all tenants.
+		return errors.New("dydb: " + action + " names no table and is not allowed with a tenant")
+	}
+	for _, name := range tables {
+		if !t.Owns(name) {
+			return &TenantError{Table: name}
+		}
+	}
+	return nil
+}
+
+// requestTables returns the names of the tables in the request body b,
+// including those of table ARNs. The ARNs of other resources are returned
+// whole, to be owned by no tenant, except for StreamArn, which names the
+// Kinesis stream of EnableKinesisStreamingDestination.
+func requestTables(b []byte) ([]string, error) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	for _, k := range []string{"TableName", "SourceTableName", "TargetTableName", "GlobalTableName"} {
+		var name string
+		if json.Unmarshal(req[k], &name) == nil && name != "" {
+			tables = append(tables, arnTable(name))
+		}
+	}
+	for _, k := range []string{"TableArn", "SourceTableArn", "ResourceArn", "BackupArn", "ExportArn", "ImportArn", "StreamArn"} {
+		var arn string
+		if json.Unmarshal(req[k], &arn) != nil || arn == "" {
+			continue
+		}
+		if k == "StreamArn" && !strings.Contains(arn, ":table/") {
+			continue
+		}
+		tables = append(tables, arnTable(arn))
+	}
+
+	var items map[string]json.RawMessage
+	if json.Unmarshal(req["RequestItems"], &items) == nil {
+		for name := range items {
+			tables = append(tables, arnTable(name))
+		}
+	}
+
+	var transact []map[string]struct{ TableName string }
+	if json.Unmarshal(req["TransactItems"], &transact) == nil {
+		for _, item := range transact {
+			for _, op := range item {
+				tables = append(tables, arnTable(op.TableName))
+			}
+		}
+	}
+	return tables, nil
+}
+
+// arnTable returns the table name of a table, index, stream, backup, export
+// or import ARN, or s if it isn't one.
+func arnTable(s string) string {
+	if !strings.HasPrefix(s, "arn:") {
+		return s
+	}
+	i := strings.Index(s, ":table/")
+	if i < 0 {
+		return s
+	}
+	s = s[i+len(":table/"):]
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
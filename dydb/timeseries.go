@@ -0,0 +1,190 @@
+package dydb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Period is the span of time covered by each table of a TimeSeries.
+type Period int
+
+const (
+	Monthly Period = iota
+	Daily
+	Hourly
+)
+
+// start returns the beginning of the period holding t.
+func (p Period) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch p {
+	case Hourly:
+		return t.Truncate(time.Hour)
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// next returns the beginning of the period after the one starting at t.
+func (p Period) next(t time.Time) time.Time {
+	switch p {
+	case Hourly:
+		return t.Add(time.Hour)
+	case Daily:
+		return t.AddDate(0, 0, 1)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+func (p Period) layout() string {
+	switch p {
+	case Hourly:
+		return "2006_01_02_15"
+	case Daily:
+		return "2006_01_02"
+	}
+	return "2006_01"
+}
+
+// A TimeSeries spreads items over one table per period, such as
+// events_2024_06 for June 2024, so that old data is dropped by deleting
+// whole tables and the write capacity of past tables can be lowered.
+// Periods are in UTC.
+type TimeSeries struct {
+	DB *DB
+
+	// Prefix is the name of the tables before the period, such as "events_".
+	Prefix string
+
+	Period Period
+
+	// Layout formats the period in table names. If empty, a layout such as
+	// "2006_01" (Monthly), "2006_01_02" (Daily) or "2006_01_02_15" (Hourly)
+	// is used.
+	Layout string
+
+	// CreateTable is the CreateTable request of the tables, without
+	// TableName, used by CreateTables.
+	CreateTable map[string]interface{}
+
+	// Retries is the number of attempts made for each request while
+	// throttled. If 0, a single attempt is made.
+	Retries uint
+}
+
+// TableName returns the name of the table holding the items of time t.
+func (ts *TimeSeries) TableName(t time.Time) string {
+	layout := ts.Layout
+	if layout == "" {
+		layout = ts.Period.layout()
+	}
+	return ts.Prefix + ts.Period.start(t).Format(layout)
+}
+
+// Table returns the table holding the items of time t, for writing and
+// reading them.
+func (ts *TimeSeries) Table(t time.Time) *Table {
+	return &Table{DB: ts.DB, Name: ts.TableName(t), Retries: ts.Retries}
+}
+
+// TableNames returns the names of the tables holding the items from time
+// from up to time to, in chronological order.
+func (ts *TimeSeries) TableNames(from, to time.Time) []string {
+	var names []string
+	end := ts.Period.start(to)
+	for p := ts.Period.start(from); !p.After(end); p = ts.Period.next(p) {
+		names = append(names, ts.TableName(p))
+	}
+	return names
+}
+
+// CreateTables creates the table of the period holding now and the tables
+// of the ahead periods after it, skipping the ones that already exist. It
+// is meant to be called periodically, so that tables are ready before
+// their period starts. It does not wait for the tables to become active.
+func (ts *TimeSeries) CreateTables(ctx context.Context, now time.Time, ahead int) error {
+	p := ts.Period.start(now)
+	for i := 0; i <= ahead; i, p = i+1, ts.Period.next(p) {
+		req := make(map[string]interface{}, len(ts.CreateTable)+1)
+		for k, v := range ts.CreateTable {
+			req[k] = v
+		}
+		req["TableName"] = ts.TableName(p)
+		err := ts.DB.RetryQueryContext(ctx, "CreateTable", req, ts.Retries).Decode(&struct{}{})
+		if err != nil && !IsException(err, "ResourceInUseException") {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query runs the query opts on the tables holding the items from time from
+// up to time to, concurrently, and returns all the items found, table after
+// table: in chronological order if the sort key is a timestamp, or in
+// reverse with opts.Descending. opts should restrict the sort key to the
+// time range. Tables that don't exist, such as dropped ones, are skipped.
+func (ts *TimeSeries) Query(ctx context.Context, from, to time.Time, opts *QueryOptions) ([]Item, error) {
+	names := ts.TableNames(from, to)
+	if opts != nil && opts.Descending {
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]Item, len(names))
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			items, err := ts.queryTable(ctx, name, opts)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+			results[i] = items
+		}(i, name)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var items []Item
+	for _, r := range results {
+		items = append(items, r...)
+	}
+	return items, nil
+}
+
+// queryTable returns all the items of the query opts on table.
+func (ts *TimeSeries) queryTable(ctx context.Context, table string, opts *QueryOptions) ([]Item, error) {
+	var items []Item
+	token := ""
+	for {
+		p, err := ts.DB.QueryPage(ctx, table, opts, token)
+		if IsException(err, "ResourceNotFoundException") {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, p.Items...)
+		if token = p.Next; token == "" {
+			return items, nil
+		}
+	}
+}
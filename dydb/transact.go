@@ -0,0 +1,106 @@
+package dydb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/raff/aws4/internal/awsjson"
+	"time"
+)
+
+// RequestTokenTTL is how long DynamoDB remembers a ClientRequestToken. A
+// TransactWriteItems request repeated with the same token within this window
+// succeeds without being applied twice.
+const RequestTokenTTL = 10 * time.Minute
+
+// DefaultTransactRetries is the number of attempts TransactWrite makes.
+const DefaultTransactRetries = 8
+
+// A TransactWriteItem is one action of a TransactWriteItems request. Exactly
+// one of its fields should be set.
+type TransactWriteItem struct {
+	ConditionCheck *TransactOp `json:",omitempty"`
+	Put            *TransactOp `json:",omitempty"`
+	Update         *TransactOp `json:",omitempty"`
+	Delete         *TransactOp `json:",omitempty"`
+}
+
+// A TransactOp describes the table, item and expressions of a
+// TransactWriteItem.
+type TransactOp struct {
+	TableName                           string
+	Key                                 Item              `json:",omitempty"`
+	Item                                Item              `json:",omitempty"`
+	UpdateExpression                    string            `json:",omitempty"`
+	ConditionExpression                 string            `json:",omitempty"`
+	ExpressionAttributeNames            map[string]string `json:",omitempty"`
+	ExpressionAttributeValues           Item              `json:",omitempty"`
+	ReturnValuesOnConditionCheckFailure string            `json:",omitempty"`
+}
+
+// NewRequestToken returns a random token for the ClientRequestToken member
+// of TransactWriteItems.
+func NewRequestToken() string {
+	return awsjson.NewToken()
+}
+
+// TransactWrite applies items atomically with TransactWriteItems, using
+// token as the ClientRequestToken. If token is empty a new one is generated.
+//
+// Since the token makes the request idempotent, TransactWrite retries not
+// only throttled requests but also network failures, server errors and
+// transactions still in progress, where it is unknown whether the write was
+// applied. To survive a process restart, generate the token with
+// NewRequestToken, store it before calling TransactWrite, and call it again
+// with the same token and items after restarting; DynamoDB applies the
+// transaction at most once as long as the calls are within RequestTokenTTL.
+func (db *DB) TransactWrite(ctx context.Context, token string, items ...TransactWriteItem) error {
+	if token == "" {
+		token = NewRequestToken()
+	}
+	req := struct {
+		TransactItems      []TransactWriteItem
+		ClientRequestToken string
+	}{items, token}
+
+	var err error
+	for i := uint(0); i < DefaultTransactRetries; i++ {
+		if err := db.retry_sleep(ctx, i); err != nil {
+			return err
+		}
+		if err = db.QueryContext(ctx, "TransactWriteItems", req).Decode(&struct{}{}); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !retryableWithToken(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryableWithToken reports whether a TransactWriteItems request that
+// failed with err may be repeated with the same ClientRequestToken.
+func retryableWithToken(err error) bool {
+	e, ok := err.(*ResponseError)
+	if !ok {
+		return true // network error: the outcome is unknown
+	}
+	return e.StatusCode >= 500 || isThrottle(err) ||
+		IsException(err, "TransactionInProgressException")
+}
+
+// withRequestToken adds a ClientRequestToken to a JSON TransactWriteItems
+// request that has none, so that retries of the request are idempotent.
+func withRequestToken(body []byte) []byte {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return body
+	}
+	if _, ok := req["ClientRequestToken"]; ok {
+		return body
+	}
+	req["ClientRequestToken"], _ = json.Marshal(NewRequestToken())
+	if b, err := json.Marshal(req); err == nil {
+		return b
+	}
+	return body
+}
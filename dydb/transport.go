@@ -0,0 +1,162 @@
+package dydb
+
+import (
+	"bytes"
+	"context"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// A Transport sends the JSON-encoded request body of one DynamoDB action and
+// returns the JSON response body. Errors reported by the service must be
+// returned as a *ResponseError, so that throttled requests are retried.
+//
+// The default transport speaks the DynamoDB HTTP API. DynamoDB Accelerator
+// (DAX) clusters use their own binary protocol; a DAX client can be used in
+// place of DynamoDB by implementing Transport, keeping the rest of the DB API
+// unchanged.
+type Transport interface {
+	RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error)
+}
+
+// TransportFunc adapts a function to the Transport interface.
+type TransportFunc func(ctx context.Context, action string, body []byte) (io.ReadCloser, error)
+
+func (f TransportFunc) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	return f(ctx, action, body)
+}
+
+type headerKey struct{}
+
+// WithHeader returns a copy of ctx that adds the header key: value to the
+// DynamoDB requests made with it, such as X-Amz-Client-Context or a tracing
+// header. The headers are signed like the others; they cannot replace the
+// ones the protocol requires. Transports other than the default HTTP one
+// may ignore them.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	h := http.Header{}
+	for k, v := range requestHeader(ctx) {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Add(key, value)
+	return context.WithValue(ctx, headerKey{}, h)
+}
+
+// requestHeader returns the headers added to ctx by WithHeader.
+func requestHeader(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headerKey{}).(http.Header)
+	return h
+}
+
+// transport returns db.Transport, or the HTTP transport if it is nil.
+func (db *DB) transport() (Transport, error) {
+	if db.Transport != nil {
+		return db.Transport, nil
+	}
+	return db.httpTransport()
+}
+
+// httpTransport sends requests to the DynamoDB HTTP API.
+type httpTransport struct {
+	client  *aws4.Client
+	url     string
+	target  string
+	service string
+	region  string
+
+	// db, if not nil, discovers the endpoint to use in place of url.
+	db *DB
+}
+
+func (db *DB) httpTransport() (*httpTransport, error) {
+	url, target, svc, region, err := db.getDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	cl := db.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+
+	t := &httpTransport{client: cl, url: url, target: target, service: svc, region: region}
+	if db.EndpointDiscovery {
+		t.db = db
+	}
+	return t, nil
+}
+
+func (t *httpTransport) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	u := t.url
+	if t.db != nil && action != "DescribeEndpoints" {
+		u = t.db.endpoint(ctx, t)
+	}
+	r, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	for k, v := range requestHeader(ctx) {
+		r.Header[k] = v
+	}
+	r.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	r.Header.Set("X-Amz-Target", t.target+"."+action)
+
+	resp, err := t.client.DoService(t.service, t.region, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		defer resp.Body.Close()
+
+		e := aws4.ParseError(resp)
+		// Read the whole body in so that Keep-Alives may be released back to the pool.
+		io.Copy(ioutil.Discard, resp.Body)
+		if t.db != nil && e.Code == "InvalidEndpointException" {
+			t.db.forgetEndpoint()
+		}
+		return nil, &ResponseError{
+			StatusCode: code,
+			Type:       e.RawCode,
+			Message:    e.Message,
+			RequestID:  e.RequestID,
+			RetryAfter: e.RetryAfter,
+		}
+	}
+
+	return resp.Body, nil
+}
+
+// limitTransport bounds the number of requests in flight through next.
+type limitTransport struct {
+	sem     aws4.Semaphore
+	timeout time.Duration
+	next    Transport
+}
+
+func (t *limitTransport) RoundTrip(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+	if err := t.sem.Acquire(ctx, t.timeout); err != nil {
+		return nil, err
+	}
+	rc, err := t.next.RoundTrip(ctx, action, body)
+	if err != nil {
+		t.sem.Release()
+		return nil, err
+	}
+	return t.sem.ReleaseOnClose(rc), nil
+}
+
+// cancelCloser cancels the context of a request once its body is closed.
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,147 @@
+package dydb
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// An UpdateExpression holds the expression members of an UpdateItem request.
+// It can be embedded in a request struct.
+type UpdateExpression struct {
+	UpdateExpression          string
+	ExpressionAttributeNames  map[string]string `json:",omitempty"`
+	ExpressionAttributeValues Item              `json:",omitempty"`
+}
+
+// An Update builds an UpdateExpression. Paths use dots and brackets to reach
+// into documents ("a.b[2]"). Reserved words and names with special
+// characters are replaced by placeholders, so they need no special
+// handling. The zero value is an empty update.
+type Update struct {
+	b   exprBuilder
+	set []string
+	rem []string
+	add []string
+	del []string
+	err error
+}
+
+// Set assigns v, encoded with MarshalValue, to the attribute at path.
+func (u *Update) Set(path string, v interface{}) *Update {
+	av, err := MarshalValue(v)
+	if err != nil {
+		u.fail(err)
+		return u
+	}
+	u.set = append(u.set, u.b.path(path)+" = "+u.b.value(av))
+	return u
+}
+
+// Names adds placeholders of the caller's, such as "#d" for a name with a
+// dot, that paths may then use.
+func (u *Update) Names(names map[string]string) *Update {
+	if err := u.b.addNames(names); err != nil {
+		u.fail(err)
+	}
+	return u
+}
+
+// Remove deletes the attributes at paths.
+func (u *Update) Remove(paths ...string) *Update {
+	for _, p := range paths {
+		u.rem = append(u.rem, u.b.path(p))
+	}
+	return u
+}
+
+// Add adds v to the attribute at path. If v is a number, it is added to the
+// attribute's value (which starts at 0 if missing). If v is a slice, array
+// or set map, its elements are added to the set at path.
+func (u *Update) Add(path string, v interface{}) *Update {
+	av, err := updateOperand(v)
+	if err != nil {
+		u.fail(err)
+		return u
+	}
+	if av.N == nil && av.SS == nil && av.NS == nil && av.BS == nil {
+		u.fail(errors.New("dydb: ADD requires a number or a set"))
+		return u
+	}
+	u.add = append(u.add, u.b.path(path)+" "+u.b.value(av))
+	return u
+}
+
+// Delete removes the elements of v, a slice, array or set map, from the set
+// at path.
+func (u *Update) Delete(path string, v interface{}) *Update {
+	av, err := updateOperand(v)
+	if err != nil {
+		u.fail(err)
+		return u
+	}
+	if av.SS == nil && av.NS == nil && av.BS == nil {
+		u.fail(errors.New("dydb: DELETE requires a set"))
+		return u
+	}
+	u.del = append(u.del, u.b.path(path)+" "+u.b.value(av))
+	return u
+}
+
+// Expression returns the built expression, or the first error met while
+// building it.
+func (u *Update) Expression() (*UpdateExpression, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+
+	var clauses []string
+	for _, c := range []struct {
+		action string
+		list   []string
+	}{{"SET", u.set}, {"REMOVE", u.rem}, {"ADD", u.add}, {"DELETE", u.del}} {
+		if len(c.list) > 0 {
+			clauses = append(clauses, c.action+" "+strings.Join(c.list, ", "))
+		}
+	}
+	if len(clauses) == 0 {
+		return nil, errors.New("dydb: empty update")
+	}
+
+	return &UpdateExpression{
+		UpdateExpression:          strings.Join(clauses, " "),
+		ExpressionAttributeNames:  u.b.names,
+		ExpressionAttributeValues: u.b.values,
+	}, nil
+}
+
+func (u *Update) fail(err error) {
+	if u.err == nil {
+		u.err = err
+	}
+}
+
+// updateOperand encodes the operand of ADD and DELETE, where collections are
+// sets rather than lists.
+func updateOperand(v interface{}) (*AttributeValue, error) {
+	if av, ok := v.(*AttributeValue); ok {
+		return av, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	switch {
+	case !rv.IsValid():
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8,
+		rv.Kind() == reflect.Array && rv.Type().Elem().Kind() != reflect.Uint8,
+		isSetMap(rv.Type()):
+		av, err := marshalSet(rv)
+		if err == nil && av.NULL != nil {
+			err = errors.New("dydb: empty set")
+		}
+		return av, err
+	}
+	return MarshalValue(v)
+}
@@ -0,0 +1,45 @@
+package dydb
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPollInterval is used by WaitForItem when pollInterval is 0.
+const DefaultPollInterval = time.Second
+
+// ItemExists is a WaitForItem predicate that holds once the item exists.
+func ItemExists(item Item) bool { return item != nil }
+
+// ItemNotExists is a WaitForItem predicate that holds once the item is gone.
+func ItemNotExists(item Item) bool { return item == nil }
+
+// WaitForItem polls the item with key in table, using strongly consistent
+// GetItem requests every pollInterval, until predicate returns true for it.
+// predicate receives nil while the item does not exist. WaitForItem returns
+// the item that satisfied predicate, or ctx.Err() if ctx is done first.
+func (db *DB) WaitForItem(ctx context.Context, table string, key Item, predicate func(Item) bool, pollInterval time.Duration) (Item, error) {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	req := map[string]interface{}{
+		"TableName":      table,
+		"Key":            key,
+		"ConsistentRead": true,
+	}
+
+	for {
+		var resp struct{ Item Item }
+		if err := db.RetryQueryContext(ctx, "GetItem", req, DefaultStreamRetries).Decode(&resp); err != nil {
+			return nil, err
+		}
+		if predicate(resp.Item) {
+			return resp.Item, nil
+		}
+
+		if err := db.clock().Sleep(ctx, pollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
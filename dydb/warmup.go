@@ -0,0 +1,84 @@
+package dydb
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultWarmInterval is how often KeepWarm pings DynamoDB if its interval
+// is zero, well within the time idle connections are kept open.
+const DefaultWarmInterval = 30 * time.Second
+
+// WarmUp opens n connections to the DynamoDB endpoint, with as many
+// concurrent requests to its health check (an unauthenticated GET /), so
+// that the first requests of latency-critical services, such as Lambda
+// functions after a cold start, don't pay for DNS lookups and TLS
+// handshakes. It returns the first error of a request.
+//
+// The http.Transport of Client must keep at least n idle connections per
+// host (MaxIdleConnsPerHost, 2 by default), or the extra ones are closed.
+// WarmUp does nothing if Transport is set.
+func (db *DB) WarmUp(ctx context.Context, n int) error {
+	if db.Transport != nil || n <= 0 {
+		return nil
+	}
+	t, err := db.httpTransport()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = t.ping(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeepWarm calls WarmUp every interval until ctx is done, and returns
+// ctx.Err(), keeping n connections open while requests are rare. Failed
+// pings are ignored. If interval is zero, DefaultWarmInterval is used.
+func (db *DB) KeepWarm(ctx context.Context, n int, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultWarmInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			db.WarmUp(ctx, n)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ping sends a GET to the endpoint. Its status doesn't matter, only that
+// the connection is made.
+func (t *httpTransport) ping(ctx context.Context) error {
+	req, err := http.NewRequest("GET", t.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.DoService(t.service, t.region, req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
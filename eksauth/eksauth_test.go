@@ -0,0 +1,33 @@
+package eksauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/eksauth"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetToken(t *testing.T) {
+	g := &eksauth.Generator{Client: &aws4.Client{Keys: &aws4.Keys{AccessKey: "AKID", SecretKey: "secret"}}, Region: "eu-west-1"}
+	tok, err := g.GetToken(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tok.Token, eksauth.TokenPrefix) || time.Until(tok.Expiration) < 13*time.Minute {
+		t.Fatalf("token = %+v", tok)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(tok.Token, eksauth.TokenPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(string(b))
+	q := u.Query()
+	if u.Host != "sts.eu-west-1.amazonaws.com" || q.Get("Action") != "GetCallerIdentity" || q.Get("X-Amz-Expires") != "60" ||
+		q.Get("X-Amz-SignedHeaders") != "host;x-k8s-aws-id" || !strings.HasSuffix(q.Get("X-Amz-Credential"), "/eu-west-1/sts/aws4_request") {
+		t.Errorf("presigned URL = %s", u)
+	}
+}
@@ -0,0 +1,171 @@
+package aws4
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// An Endpoint describes the AWS service behind a host name.
+type Endpoint struct {
+	// Service is the signing name of the service (i.e. dynamodb, ses).
+	Service string
+
+	// Region is the signing region. Global endpoints have the region of
+	// their partition's signing region, such as us-east-1.
+	Region string
+
+	// FIPS and DualStack report FIPS 140-2 and IPv6 endpoints.
+	FIPS      bool
+	DualStack bool
+
+	// Bucket is the bucket of an S3 virtual-hosted-style host.
+	Bucket string
+}
+
+// partitions maps the domain suffixes of AWS partitions to the region used to
+// sign requests to their global endpoints.
+var partitions = []struct {
+	suffix    string
+	global    string
+	dualStack bool
+}{
+	{".amazonaws.com.cn", "cn-north-1", false},
+	{".amazonaws.com", "us-east-1", false},
+	{".api.amazonwebservices.com.cn", "cn-north-1", true},
+	{".api.aws", "us-east-1", true},
+}
+
+// signingNames maps host labels to the service names used for signing,
+// where they differ.
+var signingNames = map[string]string{
+	"email":                "ses",
+	"streams.dynamodb":     "dynamodb",
+	"runtime.sagemaker":    "sagemaker",
+	"runtime.lex":          "lex",
+	"data.iot":             "iotdata",
+	"data-ats.iot":         "iotdata",
+	"s3-control":           "s3",
+	"s3-external-1":        "s3",
+	"s3-website":           "s3",
+	"metering.marketplace": "aws-marketplace",
+}
+
+var regionRE = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+
+var (
+	endpointMu        sync.RWMutex
+	endpointOverrides = map[string]Endpoint{}
+)
+
+// RegisterEndpoint makes EndpointInfo return e for host (without a port),
+// overriding its rules.
+// Use it for custom domains, VPC endpoints and AWS-compatible services.
+func RegisterEndpoint(host string, e Endpoint) {
+	endpointMu.Lock()
+	defer endpointMu.Unlock()
+	endpointOverrides[strings.ToLower(host)] = e
+}
+
+// EndpointInfo returns the service and region of the AWS endpoint named by
+// rawurl, which may be a URL or a bare host name. It knows the host name
+// patterns of the standard and China partitions, including regional and
+// global endpoints, FIPS and dual-stack endpoints, and S3 path-style and
+// virtual-hosted-style hosts.
+func EndpointInfo(rawurl string) (*Endpoint, error) {
+	host := rawurl
+	if strings.Contains(rawurl, "://") {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		host = u.Host
+	}
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	endpointMu.RLock()
+	e, ok := endpointOverrides[host]
+	endpointMu.RUnlock()
+	if ok {
+		return &e, nil
+	}
+
+	for _, p := range partitions {
+		if strings.HasSuffix(host, p.suffix) {
+			return parseEndpoint(host, strings.TrimSuffix(host, p.suffix), p.global, p.dualStack)
+		}
+	}
+	return nil, fmt.Errorf("Invalid AWS Endpoint: %s", host)
+}
+
+func parseEndpoint(host, rest, global string, dualStack bool) (*Endpoint, error) {
+	e := &Endpoint{DualStack: dualStack}
+
+	var labels []string
+	for _, l := range strings.Split(rest, ".") {
+		if l == "dualstack" {
+			e.DualStack = true
+		} else {
+			labels = append(labels, l)
+		}
+	}
+
+	// Find the region, which follows the service except for a few services
+	// that put it first (us-west-2.elasticmapreduce).
+	ri := -1
+	for i, l := range labels {
+		if regionRE.MatchString(l) {
+			ri = i
+			break
+		}
+		// Legacy S3 hosts: s3-us-west-2, s3-fips-us-gov-west-1.
+		if r := strings.TrimPrefix(strings.TrimPrefix(l, "s3-"), "fips-"); r != l && regionRE.MatchString(r) {
+			e.FIPS = strings.HasPrefix(l, "s3-fips-")
+			labels[i] = "s3"
+			labels = append(labels[:i+1], append([]string{r}, labels[i+1:]...)...)
+			ri = i + 1
+			break
+		}
+	}
+
+	var svc []string
+	switch {
+	case ri == 0 && len(labels) > 1:
+		e.Region, svc = labels[0], labels[1:]
+	case ri > 0:
+		e.Region, svc = labels[ri], labels[:ri]
+	case ri < 0 && len(labels) > 0:
+		e.Region, svc = global, labels
+	default:
+		return nil, fmt.Errorf("Invalid AWS Endpoint: %s", host)
+	}
+
+	// The service is the last label, possibly qualified by the labels
+	// before it; anything further left is a bucket or resource id.
+	name := svc[len(svc)-1]
+	prefix := svc[:len(svc)-1]
+	if len(prefix) > 0 {
+		if _, ok := signingNames[prefix[len(prefix)-1]+"."+name]; ok {
+			name = prefix[len(prefix)-1] + "." + name
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if strings.HasSuffix(name, "-fips") {
+		e.FIPS = true
+		name = strings.TrimSuffix(name, "-fips")
+	}
+	if n, ok := signingNames[name]; ok {
+		name = n
+	}
+	e.Service = name
+
+	if name == "s3" && len(prefix) > 0 {
+		e.Bucket = strings.Join(prefix, ".")
+	}
+	return e, nil
+}
@@ -0,0 +1,192 @@
+package aws4
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error faults.
+const (
+	FaultClient = "Client"
+	FaultServer = "Server"
+)
+
+// An Error is the error response of an AWS service, parsed by ParseError
+// from any of the AWS protocols.
+type Error struct {
+	StatusCode int
+
+	// Code is the error code, such as ThrottlingException or NoSuchKey,
+	// without any namespace. Responses without a body, such as the ones to
+	// HEAD requests, get a code derived from their status, such as
+	// NotFound.
+	Code    string
+	Message string
+
+	// RawCode is the error code as sent, with its namespace if any, such as
+	// "com.amazonaws.dynamodb.v20120810#ThrottlingException".
+	RawCode string
+
+	// Resource is the bucket or object of REST-XML errors, if reported.
+	Resource string
+
+	// Fault is FaultClient if the request was at fault, or FaultServer.
+	Fault string
+
+	RequestID string
+
+	// RetryAfter is the delay the service asked for before a retry, with a
+	// Retry-After header or a retryAfterSeconds member, or 0.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("aws4: %d - %s - %q", e.StatusCode, e.Code, e.Message)
+}
+
+// IsError returns true if err is an *Error with code name.
+func IsError(err error, name string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == name
+}
+
+// ParseError parses the error response resp, reading its body. It handles
+// the JSON 1.0/1.1 protocols (a __type member), REST-JSON (an
+// X-Amzn-ErrorType header) and the XML error documents of the query,
+// REST-XML and EC2 protocols.
+func ParseError(resp *http.Response) *Error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return ParseErrorBody(resp.StatusCode, resp.Header, b)
+}
+
+// ParseErrorBody is ParseError for a response already read.
+func ParseErrorBody(status int, header http.Header, body []byte) *Error {
+	e := &Error{StatusCode: status}
+
+	switch trimmed := strings.TrimSpace(string(body)); {
+	case strings.HasPrefix(trimmed, "{"):
+		var j struct {
+			Type     string `json:"__type"`
+			Code     string `json:"code"`
+			Message  string `json:"message"`
+			Message_ string `json:"Message"`
+			ErrorMsg string `json:"errorMessage"`
+
+			RetryAfterSeconds json.Number `json:"retryAfterSeconds"`
+		}
+		json.Unmarshal(body, &j)
+		if s, err := j.RetryAfterSeconds.Float64(); err == nil && s > 0 {
+			e.RetryAfter = time.Duration(s * float64(time.Second))
+		}
+		e.Code = j.Type
+		if e.Code == "" {
+			e.Code = j.Code
+		}
+		e.Message = firstOf(j.Message, j.Message_, j.ErrorMsg)
+
+	case strings.HasPrefix(trimmed, "<"):
+		// <Error> (REST-XML), <ErrorResponse><Error> (query) or
+		// <Response><Errors><Error> (EC2).
+		type xmlError struct {
+			Type     string
+			Code     string
+			Message  string
+			Resource string
+		}
+		var x struct {
+			xmlError
+			Error     xmlError
+			Errors    []xmlError `xml:"Errors>Error"`
+			RequestId string
+			RequestID string
+		}
+		xml.Unmarshal(body, &x)
+		switch {
+		case x.Error.Code != "":
+			x.xmlError = x.Error
+		case len(x.Errors) > 0:
+			x.xmlError = x.Errors[0]
+		}
+		e.Code, e.Message, e.Resource = x.Code, x.Message, x.Resource
+		e.RequestID = firstOf(x.RequestId, x.RequestID)
+		switch x.Type {
+		case "Sender":
+			e.Fault = FaultClient
+		case "Receiver":
+			e.Fault = FaultServer
+		}
+	}
+
+	if h := header.Get("X-Amzn-Errortype"); h != "" {
+		e.Code = h
+	}
+	e.RawCode = e.Code
+	// Strip namespaces ("aws.dynamodb#Type", "com.amazon.coral.service#Type")
+	// and REST-JSON suffixes ("Type:http://internal.amazon.com/...").
+	if i := strings.IndexByte(e.Code, ':'); i >= 0 {
+		e.Code = e.Code[:i]
+	}
+	if i := strings.LastIndexByte(e.Code, '#'); i >= 0 {
+		e.Code = e.Code[i+1:]
+	}
+	if e.Code == "" {
+		e.Code = strings.Replace(http.StatusText(status), " ", "", -1)
+	}
+	if e.Message == "" {
+		e.Message = header.Get("X-Amzn-Errormessage")
+	}
+	if e.RequestID == "" {
+		e.RequestID = firstOf(header.Get("X-Amzn-Requestid"), header.Get("X-Amz-Request-Id"))
+	}
+	if d := RetryAfter(header); d > 0 {
+		e.RetryAfter = d
+	}
+	if e.Fault == "" {
+		e.Fault = FaultClient
+		if status >= 500 {
+			e.Fault = FaultServer
+		}
+	}
+	return e
+}
+
+// MaxRetryAfter is the longest delay that retrying clients wait for when a
+// service asks for a longer one, with Retry-After or otherwise.
+const MaxRetryAfter = 20 * time.Second
+
+// RetryAfter returns the delay requested by the Retry-After header h, in
+// seconds or as an HTTP date, or 0 if there is none.
+func RetryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.ParseFloat(v, 64); err == nil {
+		if s <= 0 {
+			return 0
+		}
+		return time.Duration(s * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func firstOf(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
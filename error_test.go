@@ -0,0 +1,59 @@
+package aws4
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseError(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		header http.Header
+		body   string
+		want   Error
+	}{
+		{400, nil, `{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"bad key"}`,
+			Error{StatusCode: 400, Code: "ValidationException", Message: "bad key", RawCode: "com.amazonaws.dynamodb.v20120810#ValidationException", Fault: FaultClient}},
+		{400, http.Header{"X-Amzn-Errortype": {"NotFoundException:http://internal.amazon.com/coral/com.amazon.ses/"}, "X-Amzn-Requestid": {"r-1"}}, `{"message":"no such address"}`,
+			Error{StatusCode: 400, Code: "NotFoundException", Message: "no such address", RawCode: "NotFoundException:http://internal.amazon.com/coral/com.amazon.ses/", Fault: FaultClient, RequestID: "r-1"}},
+		{503, nil, `<ErrorResponse><Error><Type>Receiver</Type><Code>ServiceUnavailable</Code><Message>busy</Message></Error><RequestId>r-2</RequestId></ErrorResponse>`,
+			Error{StatusCode: 503, Code: "ServiceUnavailable", Message: "busy", RawCode: "ServiceUnavailable", Fault: FaultServer, RequestID: "r-2"}},
+		{404, nil, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><Resource>/bucket/key</Resource><RequestId>r-3</RequestId></Error>`,
+			Error{StatusCode: 404, Code: "NoSuchKey", Message: "The specified key does not exist.", RawCode: "NoSuchKey", Resource: "/bucket/key", Fault: FaultClient, RequestID: "r-3"}},
+		{400, nil, `<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code><Message>gone</Message></Error></Errors><RequestID>r-4</RequestID></Response>`,
+			Error{StatusCode: 400, Code: "InvalidInstanceID.NotFound", Message: "gone", RawCode: "InvalidInstanceID.NotFound", Fault: FaultClient, RequestID: "r-4"}},
+		{404, http.Header{"X-Amz-Request-Id": {"r-5"}}, ``,
+			Error{StatusCode: 404, Code: "NotFound", Fault: FaultClient, RequestID: "r-5"}},
+		{429, http.Header{"Retry-After": {"2"}}, `{"Type":"User","message":"Rate exceeded","retryAfterSeconds":"1"}`,
+			Error{StatusCode: 429, Code: "TooManyRequests", Message: "Rate exceeded", Fault: FaultClient, RetryAfter: 2 * time.Second}},
+		{429, nil, `{"__type":"TooManyRequestsException","message":"Rate exceeded","retryAfterSeconds":"1"}`,
+			Error{StatusCode: 429, Code: "TooManyRequestsException", Message: "Rate exceeded", RawCode: "TooManyRequestsException", Fault: FaultClient, RetryAfter: time.Second}},
+	} {
+		h := tt.header
+		if h == nil {
+			h = http.Header{}
+		}
+		if got := ParseErrorBody(tt.status, h, []byte(tt.body)); *got != tt.want {
+			t.Errorf("ParseErrorBody(%s) = %+v", tt.body, got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"0.5":                           500 * time.Millisecond,
+		"-1":                            0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+	} {
+		if got := RetryAfter(http.Header{"Retry-After": {v}}); got != want {
+			t.Errorf("RetryAfter(%q) = %v", v, got)
+		}
+	}
+	d := RetryAfter(http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}})
+	if d < 58*time.Second || d > time.Minute {
+		t.Errorf("RetryAfter(date) = %v", d)
+	}
+}
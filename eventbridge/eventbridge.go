@@ -0,0 +1,224 @@
+// Package eventbridge publishes events to Amazon EventBridge with PutEvents,
+// signing requests with github.com/raff/aws4.
+package eventbridge
+
+import (
+	"context"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// Limits of PutEvents.
+const (
+	MaxBatchEntries = 10
+	MaxBatchBytes   = 262144
+)
+
+// A Client publishes events to EventBridge.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the EventBridge endpoint of Region is used.
+	URL string
+
+	// EventBusName is the event bus of entries that don't name one. If
+	// empty, the default event bus is used.
+	EventBusName string
+}
+
+// An Error is an error reported by EventBridge.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name.
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+// An Entry is an event.
+type Entry struct {
+	Source     string
+	DetailType string
+
+	// Detail is the event as a JSON object.
+	Detail string
+
+	Resources    []string `json:",omitempty"`
+	EventBusName string   `json:",omitempty"`
+	TraceHeader  string   `json:",omitempty"`
+
+	// If zero, the time the event is received is used.
+	Time time.Time
+}
+
+// Size returns the size of e, as counted against MaxBatchBytes.
+func (e *Entry) Size() int {
+	n := len(e.Source) + len(e.DetailType) + len(e.Detail)
+	if !e.Time.IsZero() {
+		n += 14
+	}
+	for _, r := range e.Resources {
+		n += len(r)
+	}
+	return n
+}
+
+// A FailedEntry is an entry that EventBridge didn't accept.
+type FailedEntry struct {
+	Entry        Entry
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// A PutEventsError is returned by PutEvents when some entries still failed
+// after all retries.
+type PutEventsError struct {
+	Failed []FailedEntry
+}
+
+func (e *PutEventsError) Error() string {
+	f := e.Failed[0]
+	return fmt.Sprintf("eventbridge: %d entries failed, first with %s - %q", len(e.Failed), f.ErrorCode, f.ErrorMessage)
+}
+
+// PutEvents publishes entries in batches within the limits of the service,
+// and returns their event IDs, in order; the ID of a failed entry is empty.
+// Throttled requests, and entries that failed with a throttling or internal
+// error, are retried with backoff, making up to retries attempts each.
+func (c *Client) PutEvents(ctx context.Context, entries []Entry, retries uint) ([]string, error) {
+	ids := make([]string, len(entries))
+	var failed []FailedEntry
+
+	for start := 0; start < len(entries); {
+		n := batchLen(entries[start:])
+		f, err := c.putBatch(ctx, entries[start:start+n], ids[start:start+n], retries)
+		if err != nil {
+			return ids, err
+		}
+		failed = append(failed, f...)
+		start += n
+	}
+	if len(failed) > 0 {
+		return ids, &PutEventsError{failed}
+	}
+	return ids, nil
+}
+
+// batchLen returns the number of entries that fit in a batch.
+func batchLen(entries []Entry) int {
+	size := 0
+	for i := range entries {
+		size += entries[i].Size()
+		if i == MaxBatchEntries || size > MaxBatchBytes {
+			if i == 0 {
+				return 1
+			}
+			return i
+		}
+	}
+	return len(entries)
+}
+
+type requestEntry struct {
+	Entry
+	Time *float64 `json:",omitempty"`
+}
+
+type resultEntry struct {
+	EventId      string
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// putBatch sends batch, storing the event IDs in ids, and returns the
+// entries that failed.
+func (c *Client) putBatch(ctx context.Context, batch []Entry, ids []string, retries uint) ([]FailedEntry, error) {
+	if retries == 0 {
+		retries = 1
+	}
+
+	// pending holds the indexes of the entries still to send.
+	pending := make([]int, len(batch))
+	for i := range pending {
+		pending[i] = i
+	}
+	var failed, retried []FailedEntry
+
+	var lastErr error // of the last attempt, if retried
+	for attempt := uint(0); len(pending) > 0; attempt++ {
+		if attempt == retries {
+			return append(failed, retried...), nil
+		}
+		if err := awsjson.Sleep(ctx, attempt, lastErr); err != nil {
+			return nil, err
+		}
+
+		req := struct{ Entries []requestEntry }{}
+		for _, i := range pending {
+			e := requestEntry{Entry: batch[i]}
+			if e.EventBusName == "" {
+				e.EventBusName = c.EventBusName
+			}
+			if !e.Entry.Time.IsZero() {
+				t := float64(e.Entry.Time.Unix())
+				e.Time = &t
+			}
+			req.Entries = append(req.Entries, e)
+		}
+
+		var resp struct {
+			FailedEntryCount int
+			Entries          []resultEntry
+		}
+		err := c.do(ctx, "PutEvents", &req, &resp)
+		lastErr = err
+		if awsjson.Retryable(ctx, err) && attempt+1 < retries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Entries) != len(pending) {
+			return nil, fmt.Errorf("eventbridge: %d results for %d entries", len(resp.Entries), len(pending))
+		}
+
+		sent := pending
+		pending, retried = nil, nil
+		for j, r := range resp.Entries {
+			i := sent[j]
+			switch r.ErrorCode {
+			case "":
+				ids[i] = r.EventId
+			case "InternalFailure", "ThrottlingException":
+				pending = append(pending, i)
+				retried = append(retried, FailedEntry{batch[i], r.ErrorCode, r.ErrorMessage})
+			default:
+				failed = append(failed, FailedEntry{batch[i], r.ErrorCode, r.ErrorMessage})
+			}
+		}
+	}
+	return failed, nil
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "events",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "AWSEvents",
+		Version: "1.1",
+	}
+	return jc.Do(ctx, action, in, out)
+}
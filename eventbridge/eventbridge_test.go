@@ -0,0 +1,102 @@
+package eventbridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/eventbridge"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBus fails the first attempt of every entry whose detail is "flaky", and
+// always rejects entries whose detail is "bad".
+type fakeBus struct {
+	mu      sync.Mutex
+	batches []int
+	seen    map[string]bool
+}
+
+func (f *fakeBus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Amz-Target") != "AWSEvents.PutEvents" {
+		w.WriteHeader(400)
+		return
+	}
+	var req struct {
+		Entries []struct {
+			Source       string
+			Detail       string
+			EventBusName string
+		}
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	f.batches = append(f.batches, len(req.Entries))
+
+	var results []string
+	for _, e := range req.Entries {
+		switch {
+		case e.Detail == `"bad"`:
+			results = append(results, `{"ErrorCode":"MalformedDetail","ErrorMessage":"bad"}`)
+		case e.Detail == `"flaky"` && !f.seen[e.Source]:
+			f.seen[e.Source] = true
+			results = append(results, `{"ErrorCode":"InternalFailure"}`)
+		default:
+			results = append(results, fmt.Sprintf(`{"EventId":"%s@%s"}`, e.Source, e.EventBusName))
+		}
+	}
+	fmt.Fprintf(w, `{"Entries":[%s]}`, strings.Join(results, ","))
+}
+
+func TestPutEvents(t *testing.T) {
+	f := &fakeBus{seen: map[string]bool{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &eventbridge.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, EventBusName: "bus"}
+
+	var entries []eventbridge.Entry
+	for i := 0; i < 12; i++ {
+		detail := `{}`
+		switch i {
+		case 3:
+			detail = `"flaky"`
+		case 5:
+			detail = `"bad"`
+		}
+		entries = append(entries, eventbridge.Entry{Source: fmt.Sprint("s", i), DetailType: "t", Detail: detail})
+	}
+
+	ids, err := c.PutEvents(context.Background(), entries, 3)
+	perr, ok := err.(*eventbridge.PutEventsError)
+	if !ok || len(perr.Failed) != 1 || perr.Failed[0].ErrorCode != "MalformedDetail" {
+		t.Fatalf("expected one failed entry, got %v", err)
+	}
+	if ids[3] != "s3@bus" || ids[5] != "" || ids[11] != "s11@bus" {
+		t.Errorf("ids %q", ids)
+	}
+	if fmt.Sprint(f.batches) != "[10 1 2]" {
+		t.Errorf("batches %v", f.batches)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	f := &fakeBus{seen: map[string]bool{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &eventbridge.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	big := `"` + strings.Repeat("x", 100000) + `"`
+	entries := []eventbridge.Entry{{Source: "a", Detail: big}, {Source: "b", Detail: big}, {Source: "c", Detail: big}}
+	if _, err := c.PutEvents(context.Background(), entries, 1); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(f.batches) != "[2 1]" {
+		t.Errorf("batches %v", f.batches)
+	}
+}
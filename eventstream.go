@@ -0,0 +1,403 @@
+package aws4
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event stream limits.
+const (
+	MaxEventMessageSize = 16 << 20 // 16 MiB
+	MaxEventHeadersSize = 128 << 10
+)
+
+// Event header value types.
+const (
+	eventTrue = iota
+	eventFalse
+	eventByte
+	eventShort
+	eventInt
+	eventLong
+	eventBytes
+	eventString
+	eventTimestamp
+	eventUUID
+)
+
+// An EventUUID is the value of a UUID event header.
+type EventUUID [16]byte
+
+// An EventHeader is a header of an EventMessage. Value is one of bool, int8,
+// int16, int32, int64, []byte, string, time.Time (in milliseconds) or
+// EventUUID.
+type EventHeader struct {
+	Name  string
+	Value interface{}
+}
+
+// EventHeaders are the headers of an EventMessage, in order.
+type EventHeaders []EventHeader
+
+// Get returns the value of the header name, or nil.
+func (hs EventHeaders) Get(name string) interface{} {
+	for _, h := range hs {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return nil
+}
+
+// String returns the value of the string header name, or "".
+func (hs EventHeaders) String(name string) string {
+	s, _ := hs.Get(name).(string)
+	return s
+}
+
+// An EventMessage is a message of an AWS event stream
+// (application/vnd.amazon.eventstream), the framing of streaming APIs such
+// as Kinesis SubscribeToShard, S3 SelectObjectContent and Transcribe.
+type EventMessage struct {
+	Headers EventHeaders
+	Payload []byte
+}
+
+// An EventError is a message of type "error" or "exception" received on an
+// event stream.
+type EventError struct {
+	Code    string
+	Message string
+}
+
+func (e *EventError) Error() string {
+	return "aws4: event stream " + e.Code + ": " + e.Message
+}
+
+// Err returns an *EventError if m is an error or exception message, or nil.
+func (m *EventMessage) Err() error {
+	switch m.Headers.String(":message-type") {
+	case "error":
+		return &EventError{m.Headers.String(":error-code"), m.Headers.String(":error-message")}
+	case "exception":
+		return &EventError{m.Headers.String(":exception-type"), string(m.Payload)}
+	}
+	return nil
+}
+
+// MarshalBinary encodes m in the event stream framing: a prelude holding the
+// total and headers lengths, the headers, the payload, and CRC32 checksums of
+// the prelude and of the whole message.
+func (m *EventMessage) MarshalBinary() ([]byte, error) {
+	var hb bytes.Buffer
+	if err := writeEventHeaders(&hb, m.Headers); err != nil {
+		return nil, err
+	}
+	if hb.Len() > MaxEventHeadersSize {
+		return nil, errors.New("aws4: event headers too large")
+	}
+	total := 12 + hb.Len() + len(m.Payload) + 4
+	if total > MaxEventMessageSize {
+		return nil, errors.New("aws4: event message too large")
+	}
+
+	b := make([]byte, 12, total)
+	binary.BigEndian.PutUint32(b[0:], uint32(total))
+	binary.BigEndian.PutUint32(b[4:], uint32(hb.Len()))
+	binary.BigEndian.PutUint32(b[8:], crc32.ChecksumIEEE(b[:8]))
+	b = append(b, hb.Bytes()...)
+	b = append(b, m.Payload...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(b))
+	return append(b, crc[:]...), nil
+}
+
+func writeEventHeaders(w *bytes.Buffer, hs EventHeaders) error {
+	for _, h := range hs {
+		if len(h.Name) == 0 || len(h.Name) > 255 {
+			return fmt.Errorf("aws4: invalid event header name %q", h.Name)
+		}
+		w.WriteByte(byte(len(h.Name)))
+		w.WriteString(h.Name)
+
+		switch v := h.Value.(type) {
+		case bool:
+			if v {
+				w.WriteByte(eventTrue)
+			} else {
+				w.WriteByte(eventFalse)
+			}
+		case int8:
+			w.WriteByte(eventByte)
+			w.WriteByte(byte(v))
+		case int16:
+			w.WriteByte(eventShort)
+			binary.Write(w, binary.BigEndian, v)
+		case int32:
+			w.WriteByte(eventInt)
+			binary.Write(w, binary.BigEndian, v)
+		case int64:
+			w.WriteByte(eventLong)
+			binary.Write(w, binary.BigEndian, v)
+		case []byte:
+			if len(v) > 0xffff {
+				return fmt.Errorf("aws4: event header %s too long", h.Name)
+			}
+			w.WriteByte(eventBytes)
+			binary.Write(w, binary.BigEndian, uint16(len(v)))
+			w.Write(v)
+		case string:
+			if len(v) > 0xffff {
+				return fmt.Errorf("aws4: event header %s too long", h.Name)
+			}
+			w.WriteByte(eventString)
+			binary.Write(w, binary.BigEndian, uint16(len(v)))
+			w.WriteString(v)
+		case time.Time:
+			w.WriteByte(eventTimestamp)
+			binary.Write(w, binary.BigEndian, v.UnixNano()/int64(time.Millisecond))
+		case EventUUID:
+			w.WriteByte(eventUUID)
+			w.Write(v[:])
+		default:
+			return fmt.Errorf("aws4: event header %s has unsupported type %T", h.Name, h.Value)
+		}
+	}
+	return nil
+}
+
+// UnmarshalBinary decodes a single message from b, verifying its checksums.
+func (m *EventMessage) UnmarshalBinary(b []byte) error {
+	if len(b) < 16 {
+		return errors.New("aws4: event message too short")
+	}
+	total := binary.BigEndian.Uint32(b[0:])
+	hlen := binary.BigEndian.Uint32(b[4:])
+	switch {
+	case binary.BigEndian.Uint32(b[8:]) != crc32.ChecksumIEEE(b[:8]):
+		return errors.New("aws4: event prelude checksum mismatch")
+	case int(total) != len(b) || hlen > total-16:
+		return errors.New("aws4: invalid event message length")
+	case binary.BigEndian.Uint32(b[total-4:]) != crc32.ChecksumIEEE(b[:total-4]):
+		return errors.New("aws4: event message checksum mismatch")
+	}
+
+	hs, err := readEventHeaders(b[12 : 12+hlen])
+	if err != nil {
+		return err
+	}
+	m.Headers = hs
+	m.Payload = b[12+hlen : total-4]
+	return nil
+}
+
+func readEventHeaders(b []byte) (EventHeaders, error) {
+	short := errors.New("aws4: truncated event header")
+	var hs EventHeaders
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+1 {
+			return nil, short
+		}
+		name := string(b[1 : 1+n])
+		typ := b[1+n]
+		b = b[2+n:]
+
+		var v interface{}
+		var size int
+		switch typ {
+		case eventTrue, eventFalse:
+			v = typ == eventTrue
+		case eventByte:
+			size = 1
+		case eventShort:
+			size = 2
+		case eventInt:
+			size = 4
+		case eventLong, eventTimestamp:
+			size = 8
+		case eventUUID:
+			size = 16
+		case eventBytes, eventString:
+			if len(b) < 2 {
+				return nil, short
+			}
+			size = 2 + int(binary.BigEndian.Uint16(b))
+		default:
+			return nil, fmt.Errorf("aws4: event header %s has unknown type %d", name, typ)
+		}
+		if len(b) < size {
+			return nil, short
+		}
+
+		switch typ {
+		case eventByte:
+			v = int8(b[0])
+		case eventShort:
+			v = int16(binary.BigEndian.Uint16(b))
+		case eventInt:
+			v = int32(binary.BigEndian.Uint32(b))
+		case eventLong:
+			v = int64(binary.BigEndian.Uint64(b))
+		case eventTimestamp:
+			ms := int64(binary.BigEndian.Uint64(b))
+			v = time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()
+		case eventUUID:
+			var u EventUUID
+			copy(u[:], b)
+			v = u
+		case eventBytes:
+			v = append([]byte(nil), b[2:size]...)
+		case eventString:
+			v = string(b[2:size])
+		}
+		hs = append(hs, EventHeader{name, v})
+		b = b[size:]
+	}
+	return hs, nil
+}
+
+// An EventReader reads the messages of an event stream, such as the body of
+// a streaming response.
+type EventReader struct {
+	r io.Reader
+}
+
+// NewEventReader returns an EventReader reading from r.
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{r: r}
+}
+
+// ReadMessage reads the next message. It returns io.EOF at the end of the
+// stream, and io.ErrUnexpectedEOF if it ends within a message. Error and
+// exception messages are returned as messages; see EventMessage.Err.
+func (r *EventReader) ReadMessage() (*EventMessage, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r.r, prelude[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(prelude[8:]) != crc32.ChecksumIEEE(prelude[:8]) {
+		return nil, errors.New("aws4: event prelude checksum mismatch")
+	}
+	total := binary.BigEndian.Uint32(prelude[0:])
+	if total < 16 || total > MaxEventMessageSize {
+		return nil, errors.New("aws4: invalid event message length")
+	}
+
+	b := make([]byte, total)
+	copy(b, prelude[:])
+	if _, err := io.ReadFull(r.r, b[12:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	m := new(EventMessage)
+	if err := m.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// An EventWriter writes the messages of an event stream, such as the body of
+// a streaming request. A signed EventWriter wraps each message in a message
+// signed with the chunk signing of SigV4, chained from the signature of the
+// request, as services receiving signed event streams require.
+type EventWriter struct {
+	w io.Writer
+
+	keys *Keys
+	s    *Service
+	prev []byte           // the previous signature
+	now  func() time.Time // for tests
+}
+
+// NewEventWriter returns an EventWriter writing unsigned messages to w.
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{w: w}
+}
+
+// NewSignedEventWriter returns an EventWriter writing messages to w signed
+// with keys for s. seed is the hex signature of the request carrying the
+// stream, as returned by RequestSignature.
+func NewSignedEventWriter(w io.Writer, keys *Keys, s *Service, seed string) (*EventWriter, error) {
+	prev, err := hex.DecodeString(seed)
+	if err != nil || len(prev) == 0 {
+		return nil, fmt.Errorf("aws4: invalid seed signature %q", seed)
+	}
+	return &EventWriter{w: w, keys: keys, s: s, prev: prev, now: time.Now}, nil
+}
+
+// WriteMessage writes m.
+func (w *EventWriter) WriteMessage(m *EventMessage) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if w.keys != nil {
+		if b, err = w.sign(b); err != nil {
+			return err
+		}
+	}
+	_, err = w.w.Write(b)
+	return err
+}
+
+// Close ends a signed stream with the signed empty message services expect.
+// It does nothing for an unsigned stream, and doesn't close the underlying
+// writer.
+func (w *EventWriter) Close() error {
+	if w.keys == nil {
+		return nil
+	}
+	b, err := w.sign(nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(b)
+	return err
+}
+
+// sign returns the message wrapping payload, with a :date header and the
+// :chunk-signature of
+//
+//	AWS4-HMAC-SHA256-PAYLOAD
+//	<date>
+//	<scope>
+//	<previous signature>
+//	<hash of the encoded :date header>
+//	<hash of payload>
+func (w *EventWriter) sign(payload []byte) ([]byte, error) {
+	t := w.now().UTC().Truncate(time.Millisecond)
+	date := EventHeaders{{":date", t}}
+	var hb bytes.Buffer
+	writeEventHeaders(&hb, date)
+
+	h := hmac.New(sha256.New, w.keys.sign(w.s, t))
+	fmt.Fprintf(h, "AWS4-HMAC-SHA256-PAYLOAD\n%s\n%s\n%x\n%x\n%x",
+		t.Format(iSO8601BasicFormat), w.s.creds(t), w.prev, sha256.Sum256(hb.Bytes()), sha256.Sum256(payload))
+	w.prev = h.Sum(nil)
+
+	m := &EventMessage{Headers: append(date, EventHeader{":chunk-signature", w.prev}), Payload: payload}
+	return m.MarshalBinary()
+}
+
+// RequestSignature returns the hex signature of a signed request, the seed of
+// the signatures of an event stream sent in its body.
+func RequestSignature(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if i := strings.Index(auth, "Signature="); i >= 0 {
+		return auth[i+len("Signature="):]
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package aws4
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	m := &EventMessage{
+		Headers: EventHeaders{
+			{":message-type", "event"},
+			{"t", true}, {"f", false}, {"b", int8(-1)}, {"s", int16(2)}, {"i", int32(3)}, {"l", int64(4)},
+			{"bytes", []byte{1, 2}}, {"ts", ts}, {"id", EventUUID{15: 1}},
+		},
+		Payload: []byte(`{"a":1}`),
+	}
+
+	var buf bytes.Buffer
+	w := NewEventWriter(&buf)
+	for i := 0; i < 2; i++ {
+		if err := w.WriteMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := buf.Bytes()
+
+	r := NewEventReader(bytes.NewReader(b))
+	for i := 0; i < 2; i++ {
+		got, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("message %d = %+v", i, got)
+		}
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Errorf("end of stream: %v", err)
+	}
+	if _, err := NewEventReader(bytes.NewReader(b[:len(b)-1])).ReadMessage(); err != nil {
+		t.Errorf("first message of truncated stream: %v", err)
+	}
+
+	b[len(b)-5] ^= 1
+	r = NewEventReader(bytes.NewReader(b))
+	r.ReadMessage()
+	if _, err := r.ReadMessage(); err == nil {
+		t.Error("corrupt message read")
+	}
+
+	e := &EventMessage{Headers: EventHeaders{{":message-type", "exception"}, {":exception-type", "Throttled"}}, Payload: []byte("slow down")}
+	if err := e.Err(); err == nil || err.Error() != "aws4: event stream Throttled: slow down" {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestSignedEventWriter(t *testing.T) {
+	keys := &Keys{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	s := &Service{Name: "transcribe", Region: "us-east-1"}
+	r, _ := http.NewRequest("POST", "https://transcribestreaming.us-east-1.amazonaws.com/stream-transcription", nil)
+	if err := s.Sign(keys, r); err != nil {
+		t.Fatal(err)
+	}
+	seed := RequestSignature(r)
+
+	var buf bytes.Buffer
+	w, err := NewSignedEventWriter(&buf, keys, s, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	inner := &EventMessage{Headers: EventHeaders{{":event-type", "AudioEvent"}}, Payload: []byte("audio")}
+	if err := w.WriteMessage(inner); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := seed
+	rd := NewEventReader(&buf)
+	for i, want := range [][]byte{mustMarshal(t, inner), nil} {
+		m, err := rd.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(m.Payload, want) || !m.Headers.Get(":date").(time.Time).Equal(now) {
+			t.Errorf("message %d: %+v", i, m)
+		}
+
+		date := mustMarshal(t, &EventMessage{Headers: EventHeaders{{":date", now}}})
+		h := hmac.New(sha256.New, keys.sign(s, now))
+		fmt.Fprintf(h, "AWS4-HMAC-SHA256-PAYLOAD\n20200102T030405Z\n20200102/us-east-1/transcribe/aws4_request\n%s\n%x\n%x",
+			prev, sha256.Sum256(date[12:len(date)-4]), sha256.Sum256(want))
+		sig := fmt.Sprintf("%x", m.Headers.Get(":chunk-signature"))
+		if sig != fmt.Sprintf("%x", h.Sum(nil)) {
+			t.Errorf("message %d: signature %s", i, sig)
+		}
+		prev = sig
+	}
+}
+
+func mustMarshal(t *testing.T, m *EventMessage) []byte {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
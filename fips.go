@@ -0,0 +1,83 @@
+package aws4
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FIPSHost returns the FIPS 140 endpoint of host, an AWS endpoint known to
+// EndpointInfo, such as dynamodb-fips.us-east-1.amazonaws.com for
+// dynamodb.us-east-1.amazonaws.com. FIPS hosts are returned as they are. Not
+// every service has FIPS endpoints in every region.
+func FIPSHost(host string) (string, error) {
+	e, err := EndpointInfo(host)
+	if err != nil {
+		return "", err
+	}
+	if e.FIPS {
+		return host, nil
+	}
+
+	port := ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host, port = host[:i], host[i:]
+	}
+	labels := strings.Split(host, ".")
+	for i, l := range labels {
+		// Legacy S3 hosts: s3-us-west-2.
+		if r := strings.TrimPrefix(l, "s3-"); r != l && regionRE.MatchString(r) {
+			labels[i] = "s3-fips." + r
+			return strings.Join(labels, ".") + port, nil
+		}
+		if !regionRE.MatchString(l) {
+			continue
+		}
+		// The service precedes the region, and "dualstack" if any.
+		j := i - 1
+		if j > 0 && labels[j] == "dualstack" {
+			j--
+		}
+		if j < 0 {
+			break
+		}
+		labels[j] += "-fips"
+		return strings.Join(labels, ".") + port, nil
+	}
+
+	// Global endpoints, such as iam.amazonaws.com.
+	for _, p := range partitions {
+		if rest := strings.TrimSuffix(host, p.suffix); rest != host && !strings.Contains(rest, ".") {
+			return rest + "-fips" + p.suffix + port, nil
+		}
+	}
+	return "", fmt.Errorf("aws4: no FIPS endpoint for %s", host)
+}
+
+// fipsRequest sends req to the FIPS endpoint of its host, if it is a known
+// AWS endpoint.
+func fipsRequest(req *http.Request) error {
+	host := req.URL.Host
+	name := host
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		name = name[:i]
+	}
+	endpointMu.RLock()
+	_, ok := endpointOverrides[strings.ToLower(name)]
+	endpointMu.RUnlock()
+	if ok {
+		return nil
+	}
+	if _, err := EndpointInfo(host); err != nil {
+		return nil
+	}
+	fh, err := FIPSHost(host)
+	if err != nil {
+		return err
+	}
+	if req.Host == "" || req.Host == req.URL.Host {
+		req.Host = fh
+	}
+	req.URL.Host = fh
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build boringcrypto
+// +build boringcrypto
+
+package aws4
+
+import (
+	"crypto/boring"
+
+	// Restrict TLS to FIPS-approved settings.
+	_ "crypto/tls/fipsonly"
+)
+
+// BoringCrypto returns true if the program is built with GOEXPERIMENT=
+// boringcrypto, in which case SigV4 hashing and HMACs (crypto/sha256 and
+// crypto/hmac) and TLS go through the FIPS 140 validated BoringCrypto
+// module, and TLS only negotiates FIPS-approved settings.
+func BoringCrypto() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,197 @@
+// Package firehose sends records to Amazon Data Firehose delivery streams,
+// signing requests with github.com/raff/aws4.
+package firehose
+
+import (
+	"context"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+)
+
+const DefaultRegion = "us-east-1"
+
+// Limits of PutRecordBatch.
+const (
+	MaxBatchRecords = 500
+	MaxBatchBytes   = 4194304
+	MaxRecordBytes  = 1024000
+)
+
+// A Client sends records to a delivery stream.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the Firehose endpoint of Region is used.
+	URL string
+
+	// DeliveryStreamName is the stream records are sent to.
+	DeliveryStreamName string
+}
+
+// An Error is an error reported by Firehose.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name.
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+type record struct {
+	Data []byte
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "firehose",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "Firehose_20150804",
+		Version: "1.1",
+	}
+	return jc.Do(ctx, action, in, out)
+}
+
+// PutRecord sends a single record, and returns its record ID.
+func (c *Client) PutRecord(ctx context.Context, data []byte) (string, error) {
+	req := struct {
+		DeliveryStreamName string
+		Record             record
+	}{c.DeliveryStreamName, record{data}}
+	var resp struct{ RecordId string }
+	if err := c.do(ctx, "PutRecord", &req, &resp); err != nil {
+		return "", err
+	}
+	return resp.RecordId, nil
+}
+
+// A FailedRecord is a record that Firehose didn't accept.
+type FailedRecord struct {
+	Data         []byte
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// A PutRecordBatchError is returned by PutRecordBatch when some records
+// still failed after all retries.
+type PutRecordBatchError struct {
+	Failed []FailedRecord
+}
+
+func (e *PutRecordBatchError) Error() string {
+	f := e.Failed[0]
+	return fmt.Sprintf("firehose: %d records failed, first with %s - %q", len(e.Failed), f.ErrorCode, f.ErrorMessage)
+}
+
+// PutRecordBatch sends records in batches within the limits of the service,
+// and returns their record IDs, in order; the ID of a failed record is
+// empty. Throttled requests and failed records are retried with backoff,
+// making up to retries attempts each.
+func (c *Client) PutRecordBatch(ctx context.Context, records [][]byte, retries uint) ([]string, error) {
+	ids := make([]string, len(records))
+	var failed []FailedRecord
+
+	for start := 0; start < len(records); {
+		n := batchLen(records[start:])
+		f, err := c.putBatch(ctx, records[start:start+n], ids[start:start+n], retries)
+		if err != nil {
+			return ids, err
+		}
+		failed = append(failed, f...)
+		start += n
+	}
+	if len(failed) > 0 {
+		return ids, &PutRecordBatchError{failed}
+	}
+	return ids, nil
+}
+
+// batchLen returns the number of records that fit in a batch.
+func batchLen(records [][]byte) int {
+	size := 0
+	for i, r := range records {
+		size += len(r)
+		if i == MaxBatchRecords || size > MaxBatchBytes {
+			if i == 0 {
+				return 1
+			}
+			return i
+		}
+	}
+	return len(records)
+}
+
+// putBatch sends batch, storing the record IDs in ids, and returns the
+// records that failed.
+func (c *Client) putBatch(ctx context.Context, batch [][]byte, ids []string, retries uint) ([]FailedRecord, error) {
+	if retries == 0 {
+		retries = 1
+	}
+
+	// pending holds the indexes of the records still to send.
+	pending := make([]int, len(batch))
+	for i := range pending {
+		pending[i] = i
+	}
+	var failed []FailedRecord
+
+	var lastErr error // of the last attempt, if retried
+	for attempt := uint(0); len(pending) > 0; attempt++ {
+		if attempt == retries {
+			return failed, nil
+		}
+		if err := awsjson.Sleep(ctx, attempt, lastErr); err != nil {
+			return nil, err
+		}
+
+		req := struct {
+			DeliveryStreamName string
+			Records            []record
+		}{DeliveryStreamName: c.DeliveryStreamName}
+		for _, i := range pending {
+			req.Records = append(req.Records, record{batch[i]})
+		}
+
+		var resp struct {
+			FailedPutCount   int
+			RequestResponses []struct {
+				RecordId     string
+				ErrorCode    string
+				ErrorMessage string
+			}
+		}
+		err := c.do(ctx, "PutRecordBatch", &req, &resp)
+		lastErr = err
+		if awsjson.Retryable(ctx, err) && attempt+1 < retries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.RequestResponses) != len(pending) {
+			return nil, fmt.Errorf("firehose: %d results for %d records", len(resp.RequestResponses), len(pending))
+		}
+
+		sent := pending
+		pending, failed = nil, nil
+		for j, r := range resp.RequestResponses {
+			i := sent[j]
+			if r.ErrorCode == "" {
+				ids[i] = r.RecordId
+				continue
+			}
+			pending = append(pending, i)
+			failed = append(failed, FailedRecord{batch[i], r.ErrorCode, r.ErrorMessage})
+		}
+	}
+	return nil, nil
+}
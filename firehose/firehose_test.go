@@ -0,0 +1,64 @@
+package firehose_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/firehose"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPutRecordBatch(t *testing.T) {
+	var batches []int
+	failed := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "Firehose_20150804.PutRecordBatch" {
+			t.Errorf("target %s", r.Header.Get("X-Amz-Target"))
+		}
+		var req struct {
+			DeliveryStreamName string
+			Records            []struct{ Data []byte }
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		batches = append(batches, len(req.Records))
+
+		var results []string
+		for _, rec := range req.Records {
+			// Every record ending in 7 fails once.
+			if d := string(rec.Data); strings.HasSuffix(d, "7") && !failed[d] {
+				failed[d] = true
+				results = append(results, `{"ErrorCode":"ServiceUnavailableException","ErrorMessage":"slow down"}`)
+				continue
+			}
+			results = append(results, fmt.Sprintf(`{"RecordId":"%s/%s"}`, req.DeliveryStreamName, rec.Data))
+		}
+		fmt.Fprintf(w, `{"FailedPutCount":0,"RequestResponses":[%s]}`, strings.Join(results, ","))
+	}))
+	defer srv.Close()
+	c := &firehose.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, DeliveryStreamName: "s"}
+
+	var records [][]byte
+	for i := 0; i < 510; i++ {
+		records = append(records, []byte(fmt.Sprint(i)))
+	}
+	ids, err := c.PutRecordBatch(context.Background(), records, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[7] != "s/7" || ids[509] != "s/509" {
+		t.Errorf("ids %q %q", ids[7], ids[509])
+	}
+	if fmt.Sprint(batches) != "[500 50 10 1]" {
+		t.Errorf("batches %v", batches)
+	}
+
+	failed = map[string]bool{}
+	_, err = c.PutRecordBatch(context.Background(), [][]byte{[]byte("17")}, 1)
+	if perr, ok := err.(*firehose.PutRecordBatchError); !ok || perr.Failed[0].ErrorCode != "ServiceUnavailableException" {
+		t.Errorf("expected a PutRecordBatchError, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package awsjson implements the JSON protocol shared by many AWS services,
+// where every action is a POST of a JSON document to the service endpoint
+// with the action named by the X-Amz-Target header.
+package awsjson
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A Client calls the actions of one service.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// Service is the signing name of the service, and the endpoint prefix
+	// unless URL is set.
+	Service string
+
+	// Region is the region of the service.
+	Region string
+
+	// If empty, https://<Service>.<Region>.amazonaws.com/ is used.
+	URL string
+
+	// Target is the X-Amz-Target prefix of actions, such as
+	// "Logs_20140328".
+	Target string
+
+	// Version is the protocol version, "1.0" or "1.1".
+	Version string
+}
+
+// An Error is an error reported by a service.
+type Error struct {
+	Service    string
+	StatusCode int
+	Type       string
+	Message    string
+	RequestID  string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %d - %s - %q", e.Service, e.StatusCode, e.Type, e.Message)
+}
+
+// IsError returns true if err is an *Error of type name.
+func IsError(err error, name string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Type == name
+}
+
+// Retryable returns true if err is a throttling or server error, which may
+// succeed if the request is sent again, or a failure to connect. Other
+// connection errors aren't retried, since the requests of the packages using
+// awsjson aren't idempotent and may have been applied, unless ctx says
+// otherwise with aws4.WithIdempotency.
+func Retryable(ctx context.Context, err error) bool {
+	if ce, ok := err.(*aws4.ConnError); ok {
+		idempotent, _ := aws4.Idempotency(ctx)
+		return ce.Retryable(idempotent)
+	}
+	e, ok := err.(*Error)
+	return ok && (e.StatusCode >= 500 || strings.Contains(e.Type, "Throttl"))
+}
+
+// Sleep waits before attempt retry (counting from 0) of a request whose
+// last attempt failed with err, for the delay the service asked for with
+// Retry-After, up to aws4.MaxRetryAfter, or else backing off exponentially
+// from 100ms.
+func Sleep(ctx context.Context, retry uint, err error) error {
+	if retry == 0 {
+		return nil
+	}
+
+	d := (2 << (retry - 1)) * 50 * time.Millisecond
+	if e, ok := err.(*Error); ok && e.RetryAfter > 0 {
+		d = e.RetryAfter
+		if d > aws4.MaxRetryAfter {
+			d = aws4.MaxRetryAfter
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// URL returns the endpoint of service in region.
+func URL(service, region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return "https://" + service + "." + region + ".amazonaws.com.cn/"
+	}
+	return "https://" + service + "." + region + ".amazonaws.com/"
+}
+
+// Do calls action with in encoded as JSON, and decodes the response into out
+// unless it is nil.
+func (c *Client) Do(ctx context.Context, action string, in, out interface{}) error {
+	if in == nil {
+		in = struct{}{}
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	u := c.URL
+	if u == "" {
+		u = URL(c.Service, c.Region)
+	}
+	r, err := http.NewRequest("POST", u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-amz-json-"+c.Version)
+	r.Header.Set("X-Amz-Target", c.Target+"."+action)
+
+	cl := c.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+	resp, err := cl.DoService(c.Service, c.Region, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Read the whole body in so that Keep-Alives may be released back to the pool.
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != 200 {
+		e := aws4.ParseError(resp)
+		return &Error{c.Service, resp.StatusCode, e.Code, e.Message, e.RequestID, e.RetryAfter}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// NewToken returns a random version 4 UUID, as used for the client tokens
+// that make requests idempotent.
+func NewToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,127 @@
+package aws4
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KeysFromMap returns the Keys in env, a map of environment variables, as
+// KeysFromEnvironment does for the process environment.
+func KeysFromMap(env map[string]string) *Keys {
+	k := &Keys{
+		AccessKey:    env["AWS_ACCESS_KEY"],
+		SecretKey:    env["AWS_SECRET_KEY"],
+		SessionToken: env["AWS_SESSION_TOKEN"],
+	}
+	if k.AccessKey == "" {
+		k.AccessKey = env["AWS_ACCESS_KEY_ID"]
+		k.SecretKey = env["AWS_SECRET_ACCESS_KEY"]
+	}
+	return k
+}
+
+// KeysFromJSON reads Keys from a JSON object in the format of STS and the
+// container credential endpoints ("AccessKeyId", "SecretAccessKey",
+// "SessionToken" or "Token"), or of the Vault AWS secrets engine
+// ("access_key", "secret_key", "security_token"). The keys are validated.
+func KeysFromJSON(r io.Reader) (*Keys, error) {
+	var v struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Token           string
+		AccessKey       string `json:"access_key"`
+		SecretKey       string `json:"secret_key"`
+		SecurityToken   string `json:"security_token"`
+	}
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	k := &Keys{
+		AccessKey:    first(v.AccessKeyId, v.AccessKey),
+		SecretKey:    first(v.SecretAccessKey, v.SecretKey),
+		SessionToken: first(v.SessionToken, v.Token, v.SecurityToken),
+	}
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// KeysFromINI reads the Keys of section (such as "default") from a shared
+// credentials or config file in INI format, as written by the AWS CLI. In a
+// config file the section may also be named "profile <section>". The keys
+// are validated.
+func KeysFromINI(r io.Reader, section string) (*Keys, error) {
+	var k Keys
+	found, in := false, false
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			in = name == section || name == "profile "+section
+			found = found || in
+			continue
+		case !in:
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		switch strings.ToLower(strings.TrimSpace(line[:i])) {
+		case "aws_access_key_id":
+			k.AccessKey = value
+		case "aws_secret_access_key":
+			k.SecretKey = value
+		case "aws_session_token", "aws_security_token":
+			k.SessionToken = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("aws4: no section %q", section)
+	}
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// Validate checks that k looks like a set of AWS credentials: an access key
+// of 16 to 128 upper case letters and digits, a 40 character secret key and,
+// for temporary credentials (access keys starting with ASIA), a session
+// token.
+func (k *Keys) Validate() error {
+	switch {
+	case len(k.AccessKey) < 16 || len(k.AccessKey) > 128:
+		return fmt.Errorf("aws4: invalid keys: access key has %d characters", len(k.AccessKey))
+	case strings.IndexFunc(k.AccessKey, func(r rune) bool { return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') }) >= 0:
+		return errors.New("aws4: invalid keys: access key has invalid characters")
+	case len(k.SecretKey) != 40:
+		return fmt.Errorf("aws4: invalid keys: secret key has %d characters", len(k.SecretKey))
+	case strings.HasPrefix(k.AccessKey, "ASIA") && k.SessionToken == "":
+		return errors.New("aws4: invalid keys: temporary access key without a session token")
+	}
+	return nil
+}
+
+func first(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
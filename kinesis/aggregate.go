@@ -0,0 +1,265 @@
+package kinesis
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+)
+
+// magic starts the records aggregated in the format of the Kinesis Producer
+// Library (KPL): the magic, an AggregatedRecord protocol buffer, and its
+// MD5.
+//
+//	message AggregatedRecord {
+//		repeated string partition_key_table     = 1;
+//		repeated string explicit_hash_key_table = 2;
+//		repeated Record records                 = 3;
+//	}
+//	message Record {
+//		required uint64 partition_key_index     = 1;
+//		optional uint64 explicit_hash_key_index = 2;
+//		required bytes  data                    = 3;
+//		repeated Tag    tags                    = 4;
+//	}
+var magic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// aggregateOverhead is the size of the magic and the MD5.
+const aggregateOverhead = 4 + md5.Size
+
+// A UserRecord is a record written by a producer, which may be aggregated
+// with others in a Kinesis record.
+type UserRecord struct {
+	PartitionKey    string
+	ExplicitHashKey string
+	Data            []byte
+}
+
+func varintLen(v uint64) int {
+	n := 1
+	for ; v >= 0x80; v >>= 7 {
+		n++
+	}
+	return n
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for ; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+// appendBytes appends field as a length-delimited field.
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field<<3|2))
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendUint appends field as a varint field.
+func appendUint(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field<<3))
+	return appendVarint(b, v)
+}
+
+// An aggregator builds an aggregated record, tracking its size.
+type aggregator struct {
+	keys, hashKeys         map[string]int
+	keyTable, hashKeyTable []string
+	records                []UserRecord
+	size                   int
+}
+
+// add adds r to a, unless the aggregated record would exceed max bytes,
+// counting its partition key.
+func (a *aggregator) add(r UserRecord, max int) bool {
+	if a.keys == nil {
+		a.keys, a.hashKeys = make(map[string]int), make(map[string]int)
+		a.size = aggregateOverhead
+	}
+	size := 0
+	ki, found := a.keys[r.PartitionKey]
+	if !found {
+		ki = len(a.keyTable)
+		size += 1 + varintLen(uint64(len(r.PartitionKey))) + len(r.PartitionKey)
+	}
+	rec := 1 + varintLen(uint64(ki)) + 1 + varintLen(uint64(len(r.Data))) + len(r.Data)
+	hi, hashFound := a.hashKeys[r.ExplicitHashKey]
+	if r.ExplicitHashKey != "" {
+		if !hashFound {
+			hi = len(a.hashKeyTable)
+			size += 1 + varintLen(uint64(len(r.ExplicitHashKey))) + len(r.ExplicitHashKey)
+		}
+		rec += 1 + varintLen(uint64(hi))
+	}
+	size += 1 + varintLen(uint64(rec)) + rec
+
+	first := r.PartitionKey
+	if len(a.records) > 0 {
+		first = a.records[0].PartitionKey
+	}
+	if len(a.records) > 0 && a.size+size+len(first) > max {
+		return false
+	}
+
+	if !found {
+		a.keys[r.PartitionKey] = ki
+		a.keyTable = append(a.keyTable, r.PartitionKey)
+	}
+	if r.ExplicitHashKey != "" && !hashFound {
+		a.hashKeys[r.ExplicitHashKey] = hi
+		a.hashKeyTable = append(a.hashKeyTable, r.ExplicitHashKey)
+	}
+	a.records = append(a.records, r)
+	a.size += size
+	return true
+}
+
+// bytes returns the aggregated record.
+func (a *aggregator) bytes() []byte {
+	pb := make([]byte, 0, a.size)
+	pb = append(pb, magic...)
+	for _, k := range a.keyTable {
+		pb = appendBytes(pb, 1, []byte(k))
+	}
+	for _, k := range a.hashKeyTable {
+		pb = appendBytes(pb, 2, []byte(k))
+	}
+	var rec []byte
+	for _, r := range a.records {
+		rec = appendUint(rec[:0], 1, uint64(a.keys[r.PartitionKey]))
+		if r.ExplicitHashKey != "" {
+			rec = appendUint(rec, 2, uint64(a.hashKeys[r.ExplicitHashKey]))
+		}
+		rec = appendBytes(rec, 3, r.Data)
+		pb = appendBytes(pb, 3, rec)
+	}
+	sum := md5.Sum(pb[len(magic):])
+	return append(pb, sum[:]...)
+}
+
+// Aggregate returns records aggregated in the KPL format, to put with the
+// partition key of the first one.
+func Aggregate(records []UserRecord) []byte {
+	var a aggregator
+	for _, r := range records {
+		a.add(r, int(^uint(0)>>1))
+	}
+	return a.bytes()
+}
+
+// IsAggregated returns true if data is an aggregated record.
+func IsAggregated(data []byte) bool {
+	if len(data) < aggregateOverhead || !bytes.HasPrefix(data, magic) {
+		return false
+	}
+	pb := data[len(magic) : len(data)-md5.Size]
+	sum := md5.Sum(pb)
+	return bytes.Equal(sum[:], data[len(data)-md5.Size:])
+}
+
+var errAggregate = errors.New("kinesis: invalid aggregated record")
+
+// field is a field of a protocol buffer.
+type field struct {
+	num   int
+	value uint64 // of varints
+	bytes []byte // of length-delimited fields
+}
+
+// fields decodes the varint and length-delimited fields of pb.
+func fields(pb []byte) ([]field, error) {
+	var fs []field
+	varint := func() (uint64, error) {
+		var v uint64
+		for shift := uint(0); shift < 64; shift += 7 {
+			if len(pb) == 0 {
+				break
+			}
+			c := pb[0]
+			pb = pb[1:]
+			v |= uint64(c&0x7F) << shift
+			if c < 0x80 {
+				return v, nil
+			}
+		}
+		return 0, errAggregate
+	}
+	for len(pb) > 0 {
+		key, err := varint()
+		if err != nil {
+			return nil, err
+		}
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			if f.value, err = varint(); err != nil {
+				return nil, err
+			}
+		case 2:
+			n, err := varint()
+			if err != nil || n > uint64(len(pb)) {
+				return nil, errAggregate
+			}
+			f.bytes, pb = pb[:n], pb[n:]
+		default:
+			return nil, errAggregate
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// Deaggregate returns the user records of a Kinesis record with
+// partitionKey and data, which is the record itself unless it is
+// aggregated.
+func Deaggregate(partitionKey string, data []byte) ([]UserRecord, error) {
+	if !IsAggregated(data) {
+		return []UserRecord{{PartitionKey: partitionKey, Data: data}}, nil
+	}
+	fs, err := fields(data[len(magic) : len(data)-md5.Size])
+	if err != nil {
+		return nil, err
+	}
+	// The tables may follow the records.
+	var keys, hashKeys []string
+	var records []UserRecord
+	var indexes [][2]int
+	for _, f := range fs {
+		switch f.num {
+		case 1:
+			keys = append(keys, string(f.bytes))
+		case 2:
+			hashKeys = append(hashKeys, string(f.bytes))
+		case 3:
+			rfs, err := fields(f.bytes)
+			if err != nil {
+				return nil, err
+			}
+			ix := [2]int{-1, -1}
+			var r UserRecord
+			for _, rf := range rfs {
+				switch rf.num {
+				case 1:
+					ix[0] = int(rf.value)
+				case 2:
+					ix[1] = int(rf.value)
+				case 3:
+					r.Data = rf.bytes
+				}
+			}
+			records = append(records, r)
+			indexes = append(indexes, ix)
+		}
+	}
+	for i, ix := range indexes {
+		if ix[0] < 0 || ix[0] >= len(keys) || ix[1] >= len(hashKeys) {
+			return nil, errAggregate
+		}
+		records[i].PartitionKey = keys[ix[0]]
+		if ix[1] >= 0 {
+			records[i].ExplicitHashKey = hashKeys[ix[1]]
+		}
+	}
+	return records, nil
+}
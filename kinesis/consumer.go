@@ -0,0 +1,324 @@
+package kinesis
+
+import (
+	"context"
+	"github.com/raff/aws4/dydb"
+	"sync"
+	"time"
+)
+
+// Defaults of Consumer.
+const (
+	DefaultPollInterval      = time.Second
+	DefaultShardSyncInterval = time.Minute
+)
+
+// shardEnd is the checkpoint of a shard read to its end.
+const shardEnd = "SHARD_END"
+
+// A ConsumedRecord is a user record read by a Consumer. The user records
+// of an aggregated record share its SequenceNumber.
+type ConsumedRecord struct {
+	UserRecord
+	SequenceNumber string
+
+	// SubSequenceNumber is the index of the user record in its aggregated
+	// record, or 0.
+	SubSequenceNumber int
+
+	Arrival time.Time
+}
+
+// A Consumer delivers the records of a stream to Handler, deaggregating the
+// records of producers such as Producer:
+//
+//   - shards are discovered every ShardSyncInterval, and when a shard is
+//     read to its end; a shard split or merged from others is only read
+//     once its parents have been read to their end, so that the records of
+//     a partition key are delivered in order across resharding;
+//   - after Handler returns nil for the records of a GetRecords call, the
+//     sequence number of the last one is checkpointed; if Handler fails the
+//     records are delivered again, so delivery is at least once.
+//
+// A Consumer reads every shard of the stream; run one per Application.
+type Consumer struct {
+	Stream *Client
+
+	// Handler is called with the records of each GetRecords call of a
+	// shard, one call at a time per shard.
+	Handler func(ctx context.Context, shard string, records []ConsumedRecord) error
+
+	// Checkpoints, if not nil, is the table holding the checkpoints, with a
+	// string partition key named CheckpointKey, which should use
+	// ConsistentRead. If nil, checkpoints are kept in memory.
+	Checkpoints *dydb.Table
+
+	// If empty, dydb.DefaultLockPartitionKey is used, so that a lock table
+	// can hold the checkpoints.
+	CheckpointKey string
+
+	// Application names the consumer in the checkpoints, for the consumers
+	// of several applications to share a table.
+	Application string
+
+	// StartingPosition is the iterator type of shards without a checkpoint,
+	// TrimHorizon or Latest. If empty, TrimHorizon is used. The children of
+	// a shard split or merged while its records are kept are always read
+	// from TrimHorizon, so that no record written after the resharding is
+	// skipped.
+	StartingPosition string
+
+	// If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// If zero, DefaultShardSyncInterval is used.
+	ShardSyncInterval time.Duration
+
+	// OnError, if not nil, is called with the errors of Handler and of the
+	// requests, with an empty shard for the listing of shards.
+	OnError func(shard string, err error)
+
+	mu          sync.Mutex
+	running     map[string]bool
+	checkpoints map[string]string // without Checkpoints
+	resync      chan struct{}
+}
+
+func (c *Consumer) onError(shard string, err error) {
+	if c.OnError != nil {
+		c.OnError(shard, err)
+	}
+}
+
+// Run consumes the stream until ctx is done, then waits for the handlers
+// running and returns ctx.Err().
+func (c *Consumer) Run(ctx context.Context) error {
+	c.mu.Lock()
+	c.running = make(map[string]bool)
+	if c.checkpoints == nil {
+		c.checkpoints = make(map[string]string)
+	}
+	c.resync = make(chan struct{}, 1)
+	c.mu.Unlock()
+
+	interval := c.ShardSyncInterval
+	if interval <= 0 {
+		interval = DefaultShardSyncInterval
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		// Failures are retried at the next sync.
+		if err := c.syncShards(ctx, &wg); err != nil && ctx.Err() == nil {
+			c.onError("", err)
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-t.C:
+		case <-c.resync:
+			t.Stop()
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// syncShards starts reading the shards whose parents have been read.
+func (c *Consumer) syncShards(ctx context.Context, wg *sync.WaitGroup) error {
+	shards, err := c.Stream.ListShards(ctx)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(shards))
+	for _, s := range shards {
+		present[s.ShardId] = true
+	}
+	// ended returns true if shard was read to its end, or has expired.
+	ended := func(shard string) bool {
+		if shard == "" || !present[shard] {
+			return true
+		}
+		cp, err := c.checkpoint(ctx, shard)
+		return err == nil && cp == shardEnd
+	}
+
+	for _, s := range shards {
+		c.mu.Lock()
+		running := c.running[s.ShardId]
+		c.mu.Unlock()
+		if running || ended(s.ShardId) || !ended(s.ParentShardId) || !ended(s.AdjacentParentShardId) {
+			continue
+		}
+
+		start := c.StartingPosition
+		if start == "" || present[s.ParentShardId] || present[s.AdjacentParentShardId] {
+			start = TrimHorizon
+		}
+		c.mu.Lock()
+		c.running[s.ShardId] = true
+		c.mu.Unlock()
+		wg.Add(1)
+		go func(shard, start string) {
+			defer wg.Done()
+			c.readShard(ctx, shard, start)
+			c.mu.Lock()
+			delete(c.running, shard)
+			c.mu.Unlock()
+		}(s.ShardId, start)
+	}
+	return nil
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// readShard delivers the records of shard, from start if it has no
+// checkpoint, until it ends or ctx is done.
+func (c *Consumer) readShard(ctx context.Context, shard, start string) {
+	poll := c.PollInterval
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+
+	iter := ""
+	for ctx.Err() == nil {
+		if iter == "" {
+			var err error
+			if iter, err = c.iterator(ctx, shard, start); err != nil {
+				c.onError(shard, err)
+				sleep(ctx, poll)
+				continue
+			}
+		}
+
+		records, next, err := c.Stream.GetRecords(ctx, iter, 0)
+		if IsException(err, "ExpiredIteratorException") {
+			iter = ""
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				c.onError(shard, err)
+			}
+			sleep(ctx, poll)
+			continue
+		}
+
+		if len(records) > 0 {
+			consumed, err := deaggregate(records)
+			if err == nil {
+				err = c.Handler(ctx, shard, consumed)
+			}
+			if err == nil {
+				err = c.setCheckpoint(ctx, shard, records[len(records)-1].SequenceNumber)
+			}
+			if err != nil {
+				// Deliver the same records again.
+				c.onError(shard, err)
+				iter = ""
+				sleep(ctx, poll)
+				continue
+			}
+		}
+		if next == "" {
+			if err := c.setCheckpoint(ctx, shard, shardEnd); err != nil {
+				c.onError(shard, err)
+			}
+			// Start reading the children of shard.
+			select {
+			case c.resync <- struct{}{}:
+			default:
+			}
+			return
+		}
+		iter = next
+		if len(records) == 0 {
+			sleep(ctx, poll)
+		}
+	}
+}
+
+// deaggregate returns the user records of records.
+func deaggregate(records []Record) ([]ConsumedRecord, error) {
+	var consumed []ConsumedRecord
+	for i := range records {
+		r := &records[i]
+		urs, err := Deaggregate(r.PartitionKey, r.Data)
+		if err != nil {
+			return nil, err
+		}
+		for j, ur := range urs {
+			consumed = append(consumed, ConsumedRecord{
+				UserRecord:        ur,
+				SequenceNumber:    r.SequenceNumber,
+				SubSequenceNumber: j,
+				Arrival:           r.Time(),
+			})
+		}
+	}
+	return consumed, nil
+}
+
+// iterator returns an iterator resuming shard from its checkpoint, or else
+// from the iterator type start.
+func (c *Consumer) iterator(ctx context.Context, shard, start string) (string, error) {
+	cp, err := c.checkpoint(ctx, shard)
+	if err != nil {
+		return "", err
+	}
+	if cp != "" {
+		return c.Stream.GetShardIterator(ctx, shard, AfterSequenceNumber, cp)
+	}
+	return c.Stream.GetShardIterator(ctx, shard, start, "")
+}
+
+func (c *Consumer) checkpointKey() string {
+	if c.CheckpointKey == "" {
+		return dydb.DefaultLockPartitionKey
+	}
+	return c.CheckpointKey
+}
+
+func (c *Consumer) checkpointID(shard string) string {
+	return "checkpoint/" + c.Application + "/" + c.Stream.StreamName + "/" + shard
+}
+
+// checkpoint returns the checkpoint of shard, or "" if it has none.
+func (c *Consumer) checkpoint(ctx context.Context, shard string) (string, error) {
+	if c.Checkpoints == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.checkpoints[shard], nil
+	}
+	var item struct {
+		SequenceNumber string `dynamo:"sequenceNumber"`
+	}
+	err := c.Checkpoints.GetItem(ctx, dydb.Item{c.checkpointKey(): dydb.StringValue(c.checkpointID(shard))}, &item)
+	if err == dydb.ErrNotFound {
+		return "", nil
+	}
+	return item.SequenceNumber, err
+}
+
+func (c *Consumer) setCheckpoint(ctx context.Context, shard, seq string) error {
+	if c.Checkpoints == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.checkpoints[shard] = seq
+		return nil
+	}
+	return c.Checkpoints.PutItem(ctx, map[string]string{
+		c.checkpointKey(): c.checkpointID(shard),
+		"sequenceNumber":  seq,
+	})
+}
@@ -0,0 +1,215 @@
+// Package kinesis writes and reads the records of Amazon Kinesis data
+// streams, signing requests with github.com/raff/aws4.
+package kinesis
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"math"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// Limits of Kinesis.
+const (
+	MaxBatchRecords = 500
+	MaxBatchBytes   = 5 << 20
+	MaxRecordBytes  = 1 << 20
+
+	// Write throughput of a shard.
+	ShardBytesPerSecond   = 1 << 20
+	ShardRecordsPerSecond = 1000
+)
+
+// A Client sends requests to a stream.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the Kinesis endpoint of Region is used.
+	URL string
+
+	// StreamName is the name of the stream.
+	StreamName string
+}
+
+// An Error is an error reported by Kinesis.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name.
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "kinesis",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "Kinesis_20131202",
+		Version: "1.1",
+	}
+	return jc.Do(ctx, action, in, out)
+}
+
+// An Entry is a record to put.
+type Entry struct {
+	Data         []byte
+	PartitionKey string
+
+	// ExplicitHashKey, if not empty, is the hash key, a decimal 128-bit
+	// integer, that selects the shard instead of the MD5 of PartitionKey.
+	ExplicitHashKey string `json:",omitempty"`
+}
+
+// A Result is the result of putting an entry.
+type Result struct {
+	SequenceNumber string
+	ShardId        string
+
+	// ErrorCode is empty if the entry was put, and
+	// ProvisionedThroughputExceededException or InternalFailure otherwise.
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// PutRecords puts entries, within MaxBatchRecords and MaxBatchBytes, in a
+// single call, and returns their results, in order.
+func (c *Client) PutRecords(ctx context.Context, entries []Entry) ([]Result, error) {
+	req := struct {
+		StreamName string
+		Records    []Entry
+	}{c.StreamName, entries}
+	var resp struct {
+		FailedRecordCount int
+		Records           []Result
+	}
+	if err := c.do(ctx, "PutRecords", &req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Records, nil
+}
+
+// HashKeyRange is the range of the hash keys of a shard, decimal 128-bit
+// integers.
+type HashKeyRange struct {
+	StartingHashKey string
+	EndingHashKey   string
+}
+
+// SequenceNumberRange is the range of the sequence numbers of a shard.
+// EndingSequenceNumber is empty for open shards.
+type SequenceNumberRange struct {
+	StartingSequenceNumber string
+	EndingSequenceNumber   string `json:",omitempty"`
+}
+
+// A Shard describes a shard of a stream.
+type Shard struct {
+	ShardId string
+
+	// ParentShardId and AdjacentParentShardId are the shards this one was
+	// split or merged from, if any.
+	ParentShardId         string
+	AdjacentParentShardId string
+
+	HashKeyRange        HashKeyRange
+	SequenceNumberRange SequenceNumberRange
+}
+
+// Open returns true if records can still be put to s.
+func (s *Shard) Open() bool {
+	return s.SequenceNumberRange.EndingSequenceNumber == ""
+}
+
+// ListShards returns all the shards of the stream, open and closed ones
+// still within the retention period.
+func (c *Client) ListShards(ctx context.Context) ([]Shard, error) {
+	var shards []Shard
+	req := map[string]string{"StreamName": c.StreamName}
+	for {
+		var resp struct {
+			Shards    []Shard
+			NextToken string
+		}
+		if err := c.do(ctx, "ListShards", req, &resp); err != nil {
+			return nil, err
+		}
+		shards = append(shards, resp.Shards...)
+		if resp.NextToken == "" {
+			return shards, nil
+		}
+		// The stream name is not allowed with a token.
+		req = map[string]string{"NextToken": resp.NextToken}
+	}
+}
+
+// Shard iterator types.
+const (
+	TrimHorizon         = "TRIM_HORIZON"
+	Latest              = "LATEST"
+	AtSequenceNumber    = "AT_SEQUENCE_NUMBER"
+	AfterSequenceNumber = "AFTER_SEQUENCE_NUMBER"
+)
+
+// A Record is a record read from a shard.
+type Record struct {
+	Data                        []byte
+	PartitionKey                string
+	SequenceNumber              string
+	ApproximateArrivalTimestamp float64
+	EncryptionType              string `json:",omitempty"`
+}
+
+// Time returns the approximate time r arrived in the stream.
+func (r *Record) Time() time.Time {
+	sec, frac := math.Modf(r.ApproximateArrivalTimestamp)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// GetShardIterator returns an iterator for shard, of one of the iterator
+// types. seq is the sequence number of AtSequenceNumber and
+// AfterSequenceNumber iterators.
+func (c *Client) GetShardIterator(ctx context.Context, shard, iteratorType, seq string) (string, error) {
+	req := map[string]string{
+		"StreamName":        c.StreamName,
+		"ShardId":           shard,
+		"ShardIteratorType": iteratorType,
+	}
+	if seq != "" {
+		req["StartingSequenceNumber"] = seq
+	}
+	var resp struct{ ShardIterator string }
+	if err := c.do(ctx, "GetShardIterator", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ShardIterator, nil
+}
+
+// GetRecords returns up to limit records (up to 10000 if 0) from iterator,
+// and the iterator to read the next ones from, which is empty once a closed
+// shard has been read to its end.
+func (c *Client) GetRecords(ctx context.Context, iterator string, limit int) ([]Record, string, error) {
+	req := map[string]interface{}{"ShardIterator": iterator}
+	if limit > 0 {
+		req["Limit"] = limit
+	}
+	var resp struct {
+		Records           []Record
+		NextShardIterator string
+	}
+	if err := c.do(ctx, "GetRecords", req, &resp); err != nil {
+		return nil, "", err
+	}
+	return resp.Records, resp.NextShardIterator, nil
+}
@@ -0,0 +1,383 @@
+package kinesis_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/dydb"
+	"github.com/raff/aws4/kinesis"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	records := []kinesis.UserRecord{
+		{PartitionKey: "a", Data: []byte("one")},
+		{PartitionKey: "b", ExplicitHashKey: "42", Data: []byte("two")},
+		{PartitionKey: "a", Data: []byte(strings.Repeat("x", 300))},
+	}
+	data := kinesis.Aggregate(records)
+	if !kinesis.IsAggregated(data) {
+		t.Fatalf("not aggregated: %x", data)
+	}
+	got, err := kinesis.Deaggregate("a", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", records) {
+		t.Errorf("Deaggregate = %q", got)
+	}
+
+	data[10]++
+	if kinesis.IsAggregated(data) {
+		t.Error("corrupted record is aggregated")
+	}
+	if got, err := kinesis.Deaggregate("k", []byte("plain")); err != nil || len(got) != 1 || string(got[0].Data) != "plain" || got[0].PartitionKey != "k" {
+		t.Errorf("Deaggregate plain = %q, %v", got, err)
+	}
+}
+
+// fakeStream has two shards, splitting the hash keys in half, and throttles
+// the first record put. If fail is set, PutRecords fails with it.
+type fakeStream struct {
+	mu        sync.Mutex
+	puts      int
+	records   []kinesis.Entry
+	throttled bool
+	fail      string
+}
+
+func (f *fakeStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Header.Get("X-Amz-Target") {
+	case "Kinesis_20131202.ListShards":
+		fmt.Fprint(w, `{"Shards":[
+			{"ShardId":"shard-0","HashKeyRange":{"StartingHashKey":"0","EndingHashKey":"170141183460469231731687303715884105727"},"SequenceNumberRange":{"StartingSequenceNumber":"1"}},
+			{"ShardId":"shard-1","HashKeyRange":{"StartingHashKey":"170141183460469231731687303715884105728","EndingHashKey":"340282366920938463463374607431768211455"},"SequenceNumberRange":{"StartingSequenceNumber":"2"}},
+			{"ShardId":"shard-old","HashKeyRange":{"StartingHashKey":"0","EndingHashKey":"340282366920938463463374607431768211455"},"SequenceNumberRange":{"StartingSequenceNumber":"0","EndingSequenceNumber":"1"}}]}`)
+	case "Kinesis_20131202.PutRecords":
+		var req struct{ Records []kinesis.Entry }
+		json.NewDecoder(r.Body).Decode(&req)
+		f.puts++
+		if f.fail != "" {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, `{"__type":%q,"message":"failed"}`, f.fail)
+			return
+		}
+		var results []string
+		for i, e := range req.Records {
+			if i == 0 && !f.throttled {
+				f.throttled = true
+				results = append(results, `{"ErrorCode":"ProvisionedThroughputExceededException","ErrorMessage":"slow down"}`)
+				continue
+			}
+			f.records = append(f.records, e)
+			results = append(results, `{"SequenceNumber":"1","ShardId":"shard-0"}`)
+		}
+		fmt.Fprintf(w, `{"Records":[%s]}`, strings.Join(results, ","))
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+// shardOf returns the shard of fakeStream of partition key k.
+func shardOf(k string) int {
+	sum := md5.Sum([]byte(k))
+	return int(sum[0] >> 7)
+}
+
+func TestProducer(t *testing.T) {
+	f := &fakeStream{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	p := &kinesis.Producer{Stream: &kinesis.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, StreamName: "events"}}
+	for i := 0; i < 100; i++ {
+		if err := p.Put(fmt.Sprint("key-", i), []byte(fmt.Sprint("data-", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// One aggregated record per shard, one of them throttled first.
+	if f.puts != 2 || len(f.records) != 2 {
+		t.Fatalf("%d puts of %d records", f.puts, len(f.records))
+	}
+	seen := map[string]bool{}
+	for _, e := range f.records {
+		urs, err := kinesis.Deaggregate(e.PartitionKey, e.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ur := range urs {
+			if shardOf(ur.PartitionKey) != shardOf(e.PartitionKey) {
+				t.Errorf("%s aggregated in the record of %s", ur.PartitionKey, e.PartitionKey)
+			}
+			if string(ur.Data) != "data-"+strings.TrimPrefix(ur.PartitionKey, "key-") || seen[ur.PartitionKey] {
+				t.Errorf("record %s: %q", ur.PartitionKey, ur.Data)
+			}
+			seen[ur.PartitionKey] = true
+		}
+	}
+	if len(seen) != 100 {
+		t.Errorf("%d records", len(seen))
+	}
+}
+
+func TestProducerShardRate(t *testing.T) {
+	f := &fakeStream{throttled: true}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	p := &kinesis.Producer{
+		Stream:             &kinesis.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, StreamName: "events"},
+		DisableAggregation: true,
+	}
+	for i := 0; i < 3; i++ {
+		p.Put("same", make([]byte, 400<<10))
+	}
+	start := time.Now()
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The third record exceeds the throughput of the shard.
+	if f.puts != 2 || len(f.records) != 3 || time.Since(start) < 900*time.Millisecond {
+		t.Errorf("%d puts of %d records in %v", f.puts, len(f.records), time.Since(start))
+	}
+}
+
+func TestProducerRequestError(t *testing.T) {
+	f := &fakeStream{fail: "ResourceNotFoundException"}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	p := &kinesis.Producer{
+		Stream:             &kinesis.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, StreamName: "events"},
+		DisableAggregation: true,
+	}
+	for i := 0; i < 3; i++ {
+		p.Put(fmt.Sprint("key-", i), []byte("data"))
+	}
+	err := p.Flush(context.Background())
+	pe, ok := err.(*kinesis.PutError)
+	if !ok || len(pe.Failed) != 3 || !kinesis.IsException(pe.Err, "ResourceNotFoundException") || pe.Failed[0].ErrorCode != "ResourceNotFoundException" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestProducerCanceled(t *testing.T) {
+	f := &fakeStream{throttled: true}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	p := &kinesis.Producer{
+		Stream:             &kinesis.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, StreamName: "events"},
+		DisableAggregation: true,
+	}
+	for i := 0; i < 3; i++ {
+		p.Put("same", make([]byte, 400<<10))
+	}
+	// The third record waits for the throughput of the shard, and is kept.
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := p.Flush(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v", err)
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.records) != 3 {
+		t.Errorf("%d records", len(f.records))
+	}
+}
+
+// fakeShards serves the pages of records of its shards; shards other than
+// s0 are open, and s1 and s2 are children of s0.
+type fakeShards struct {
+	mu    sync.Mutex
+	pages map[string][][]kinesis.Record
+	ended map[string]bool
+	order []string // of the shards iterated
+}
+
+func (f *fakeShards) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	switch r.Header.Get("X-Amz-Target") {
+	case "Kinesis_20131202.ListShards":
+		fmt.Fprint(w, `{"Shards":[
+			{"ShardId":"s0","SequenceNumberRange":{"StartingSequenceNumber":"1","EndingSequenceNumber":"2"}},
+			{"ShardId":"s1","ParentShardId":"s0","SequenceNumberRange":{"StartingSequenceNumber":"3"}},
+			{"ShardId":"s2","ParentShardId":"s0","SequenceNumberRange":{"StartingSequenceNumber":"4"}}]}`)
+	case "Kinesis_20131202.GetShardIterator":
+		shard := req["ShardId"].(string)
+		if shard != "s0" && !f.ended["s0"] {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"__type":"TestException","message":"child before parent"}`)
+			return
+		}
+		f.order = append(f.order, shard)
+		page := 0
+		if req["ShardIteratorType"] == kinesis.Latest {
+			page = len(f.pages[shard])
+		}
+		if req["ShardIteratorType"] == kinesis.AfterSequenceNumber {
+			for i, p := range f.pages[shard] {
+				for _, rec := range p {
+					if rec.SequenceNumber == req["StartingSequenceNumber"] {
+						page = i + 1
+					}
+				}
+			}
+		}
+		fmt.Fprintf(w, `{"ShardIterator":"%s/%d"}`, shard, page)
+	case "Kinesis_20131202.GetRecords":
+		var shard string
+		var page int
+		fmt.Sscanf(strings.Replace(req["ShardIterator"].(string), "/", " ", 1), "%s %d", &shard, &page)
+		var records []kinesis.Record
+		if page < len(f.pages[shard]) {
+			records = f.pages[shard][page]
+			page++
+		}
+		next := fmt.Sprintf("%s/%d", shard, page)
+		if shard == "s0" && page == len(f.pages[shard]) && len(records) == 0 {
+			f.ended[shard] = true
+			next = ""
+		}
+		b, _ := json.Marshal(map[string]interface{}{"Records": records, "NextShardIterator": next})
+		w.Write(b)
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	f := &fakeShards{
+		pages: map[string][][]kinesis.Record{
+			"s0": {{
+				{Data: []byte("a"), PartitionKey: "k", SequenceNumber: "1"},
+				{Data: kinesis.Aggregate([]kinesis.UserRecord{{PartitionKey: "k", Data: []byte("b")}, {PartitionKey: "k", Data: []byte("c")}}), PartitionKey: "k", SequenceNumber: "2"},
+			}},
+			"s1": {{{Data: []byte("d"), PartitionKey: "k", SequenceNumber: "3"}}},
+		},
+		ended: map[string]bool{},
+	}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	var cpMu sync.Mutex
+	checkpoints := map[string]string{}
+	db := &dydb.DB{Transport: dydb.TransportFunc(func(ctx context.Context, action string, body []byte) (io.ReadCloser, error) {
+		cpMu.Lock()
+		defer cpMu.Unlock()
+		var req struct {
+			Key, Item map[string]map[string]string
+		}
+		json.Unmarshal(body, &req)
+		switch action {
+		case "GetItem":
+			id := req.Key["key"]["S"]
+			if seq, ok := checkpoints[id]; ok {
+				return ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"Item":{"key":{"S":%q},"sequenceNumber":{"S":%q}}}`, id, seq))), nil
+			}
+			return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+		case "PutItem":
+			checkpoints[req.Item["key"]["S"]] = req.Item["sequenceNumber"]["S"]
+		}
+		return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var got []string
+	failed := false
+	c := &kinesis.Consumer{
+		Stream: &kinesis.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, StreamName: "events"},
+		Handler: func(ctx context.Context, shard string, records []kinesis.ConsumedRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if shard == "s1" && !failed {
+				failed = true
+				return fmt.Errorf("failed")
+			}
+			for _, r := range records {
+				got = append(got, fmt.Sprintf("%s:%s:%s.%d", shard, r.Data, r.SequenceNumber, r.SubSequenceNumber))
+			}
+			if shard == "s1" {
+				cancel()
+			}
+			return nil
+		},
+		Checkpoints:  db.Table("checkpoints"),
+		Application:  "app",
+		PollInterval: 10 * time.Millisecond,
+	}
+	if err := c.Run(ctx); err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(got) != "[s0:a:1.0 s0:b:2.0 s0:c:2.1 s1:d:3.0]" {
+		t.Errorf("records %v", got)
+	}
+	if cp := checkpoints["checkpoint/app/events/s0"]; cp != "SHARD_END" {
+		t.Errorf("s0 checkpoint %q", cp)
+	}
+	if cp := checkpoints["checkpoint/app/events/s1"]; cp != "3" {
+		t.Errorf("s1 checkpoint %q", cp)
+	}
+	// s1 is iterated again after the failure of its handler.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n := strings.Count(fmt.Sprint(f.order), "s1"); n != 2 || f.order[0] != "s0" {
+		t.Errorf("iterated shards %v", f.order)
+	}
+}
+
+func TestConsumerLatest(t *testing.T) {
+	f := &fakeShards{
+		pages: map[string][][]kinesis.Record{
+			"s0": {{{Data: []byte("a"), PartitionKey: "k", SequenceNumber: "1"}}},
+			"s1": {{{Data: []byte("d"), PartitionKey: "k", SequenceNumber: "3"}}},
+		},
+		ended: map[string]bool{},
+	}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	// The records of s0 precede the consumer, but those of its children are
+	// written after the resharding and are all delivered.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []string
+	c := &kinesis.Consumer{
+		Stream: &kinesis.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, StreamName: "events"},
+		Handler: func(ctx context.Context, shard string, records []kinesis.ConsumedRecord) error {
+			for _, r := range records {
+				got = append(got, shard+":"+string(r.Data))
+			}
+			cancel()
+			return nil
+		},
+		StartingPosition: kinesis.Latest,
+		PollInterval:     10 * time.Millisecond,
+	}
+	c.Run(ctx)
+	if fmt.Sprint(got) != "[s1:d]" {
+		t.Errorf("records %v", got)
+	}
+}
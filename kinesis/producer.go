@@ -0,0 +1,438 @@
+package kinesis
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/raff/aws4/internal/awsjson"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of Producer.
+const (
+	DefaultFlushInterval        = 100 * time.Millisecond
+	DefaultPutAttempts          = 3
+	DefaultShardRefreshInterval = time.Minute
+)
+
+// A FailedRecord is a user record that Kinesis didn't accept.
+type FailedRecord struct {
+	UserRecord
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// A PutError is returned by Flush when some records still failed after all
+// attempts, or were not sent as a PutRecords request failed.
+type PutError struct {
+	Failed []FailedRecord
+
+	// Err, if not nil, is the error of the request that ended the flush.
+	// The records not sent are in Failed, with the ErrorCode of Err.
+	Err error
+}
+
+func (e *PutError) Error() string {
+	f := e.Failed[0]
+	if e.Err != nil {
+		return fmt.Sprintf("kinesis: %d records failed: %v", len(e.Failed), e.Err)
+	}
+	return fmt.Sprintf("kinesis: %d records failed, first with %s - %q", len(e.Failed), f.ErrorCode, f.ErrorMessage)
+}
+
+// A Producer puts user records to a stream in batches, aggregating the
+// records of each shard in the format of the Kinesis Producer Library, as
+// Deaggregate reads them. It keeps the records put to each shard within
+// ShardBytesPerSecond and ShardRecordsPerSecond, and retries records that
+// are throttled or fail. It is safe for concurrent use:
+//
+//	p := &kinesis.Producer{Stream: &kinesis.Client{StreamName: "events"}}
+//	go p.Run(ctx)
+//	p.Put("user-1", data)
+type Producer struct {
+	Stream *Client
+
+	// If zero, DefaultFlushInterval is used.
+	FlushInterval time.Duration
+
+	// DisableAggregation puts every user record as a Kinesis record, for
+	// consumers that don't deaggregate.
+	DisableAggregation bool
+
+	// Attempts is how many times each record is put at most. If zero,
+	// DefaultPutAttempts is used.
+	Attempts uint
+
+	// If zero, DefaultShardRefreshInterval is used.
+	ShardRefreshInterval time.Duration
+
+	// OnError, if not nil, is called with the errors of the flushes of Run.
+	OnError func(error)
+
+	mu      sync.Mutex
+	pending []UserRecord
+
+	flushMu sync.Mutex // held by Flush
+	shards  []openShard
+	synced  time.Time
+	rates   map[string]*shardRate
+}
+
+// An openShard is the hash key range of an open shard.
+type openShard struct {
+	id         string
+	start, end *big.Int
+}
+
+// A shardRate counts what was put to a shard in the second from window.
+type shardRate struct {
+	window  time.Time
+	bytes   int
+	records int
+}
+
+// A putEntry is an entry for a shard and the user records in it.
+type putEntry struct {
+	Entry
+	shard    string
+	records  []UserRecord
+	attempts uint
+}
+
+func (e *putEntry) size() int {
+	return len(e.Data) + len(e.PartitionKey)
+}
+
+// Put adds a record with partitionKey and data, to be put at the next flush.
+func (p *Producer) Put(partitionKey string, data []byte) error {
+	return p.PutRecord(UserRecord{PartitionKey: partitionKey, Data: data})
+}
+
+// PutRecord adds r, to be put at the next flush.
+func (p *Producer) PutRecord(r UserRecord) error {
+	if r.PartitionKey == "" {
+		return errors.New("kinesis: record without a partition key")
+	}
+	if len(r.PartitionKey)+len(r.Data) > MaxRecordBytes {
+		return fmt.Errorf("kinesis: record of %d bytes", len(r.PartitionKey)+len(r.Data))
+	}
+	p.mu.Lock()
+	p.pending = append(p.pending, r)
+	p.mu.Unlock()
+	return nil
+}
+
+// Run flushes the records every FlushInterval until ctx is done, then
+// flushes the remaining ones and returns ctx.Err().
+func (p *Producer) Run(ctx context.Context) error {
+	interval := p.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := p.Flush(ctx); err != nil && p.OnError != nil {
+				p.OnError(err)
+			}
+		case <-ctx.Done():
+			if err := p.Flush(context.Background()); err != nil && p.OnError != nil {
+				p.OnError(err)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// Flush puts the records added so far, waiting for the throughput of their
+// shards. It returns a *PutError if some failed after all attempts, or
+// weren't sent as a request failed. If the shards of the stream can't be
+// listed, or ctx is done, the records not sent are kept for the next flush.
+func (p *Producer) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	records := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+
+	entries, err := p.entries(ctx, records)
+	if err != nil {
+		p.requeue(records)
+		return err
+	}
+	return p.send(ctx, entries)
+}
+
+// requeue puts records back before the pending records.
+func (p *Producer) requeue(records []UserRecord) {
+	p.mu.Lock()
+	p.pending = append(records, p.pending...)
+	p.mu.Unlock()
+}
+
+// syncShards lists the open shards, if not done recently.
+func (p *Producer) syncShards(ctx context.Context) error {
+	refresh := p.ShardRefreshInterval
+	if refresh <= 0 {
+		refresh = DefaultShardRefreshInterval
+	}
+	if p.shards != nil && time.Since(p.synced) < refresh {
+		return nil
+	}
+
+	shards, err := p.Stream.ListShards(ctx)
+	if err != nil {
+		return err
+	}
+	var open []openShard
+	for _, s := range shards {
+		if !s.Open() {
+			continue
+		}
+		start, ok1 := new(big.Int).SetString(s.HashKeyRange.StartingHashKey, 10)
+		end, ok2 := new(big.Int).SetString(s.HashKeyRange.EndingHashKey, 10)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("kinesis: invalid hash key range of shard %s", s.ShardId)
+		}
+		open = append(open, openShard{s.ShardId, start, end})
+	}
+	if len(open) == 0 {
+		return fmt.Errorf("kinesis: no open shard in stream %s", p.Stream.StreamName)
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].start.Cmp(open[j].start) < 0 })
+	p.shards, p.synced = open, time.Now()
+	return nil
+}
+
+// shard returns the ID of the open shard of r.
+func (p *Producer) shard(r *UserRecord) string {
+	hash, ok := new(big.Int).SetString(r.ExplicitHashKey, 10)
+	if !ok {
+		sum := md5.Sum([]byte(r.PartitionKey))
+		hash = new(big.Int).SetBytes(sum[:])
+	}
+	i := sort.Search(len(p.shards), func(i int) bool { return p.shards[i].start.Cmp(hash) > 0 })
+	if i > 0 {
+		i--
+	}
+	return p.shards[i].id
+}
+
+// entries returns the entries of records, aggregated by shard.
+func (p *Producer) entries(ctx context.Context, records []UserRecord) ([]*putEntry, error) {
+	if err := p.syncShards(ctx); err != nil {
+		return nil, err
+	}
+
+	var entries []*putEntry
+	single := func(shard string, r UserRecord) {
+		entries = append(entries, &putEntry{
+			Entry:   Entry{Data: r.Data, PartitionKey: r.PartitionKey, ExplicitHashKey: r.ExplicitHashKey},
+			shard:   shard,
+			records: []UserRecord{r},
+		})
+	}
+	if p.DisableAggregation {
+		for _, r := range records {
+			single(p.shard(&r), r)
+		}
+		return entries, nil
+	}
+
+	aggregates := make(map[string]*aggregator)
+	var order []string
+	flush := func(shard string) {
+		a := aggregates[shard]
+		// Single records are put as they are.
+		if len(a.records) == 1 {
+			single(shard, a.records[0])
+			return
+		}
+		first := a.records[0]
+		entries = append(entries, &putEntry{
+			Entry:   Entry{Data: a.bytes(), PartitionKey: first.PartitionKey, ExplicitHashKey: first.ExplicitHashKey},
+			shard:   shard,
+			records: a.records,
+		})
+	}
+	for _, r := range records {
+		shard := p.shard(&r)
+		a := aggregates[shard]
+		if a == nil {
+			a = &aggregator{}
+			aggregates[shard] = a
+			order = append(order, shard)
+		}
+		if !a.add(r, MaxRecordBytes) {
+			flush(shard)
+			a = &aggregator{}
+			aggregates[shard] = a
+			if !a.add(r, MaxRecordBytes) {
+				return nil, fmt.Errorf("kinesis: record of %d bytes", len(r.PartitionKey)+len(r.Data))
+			}
+		}
+	}
+	for _, shard := range order {
+		flush(shard)
+	}
+	return entries, nil
+}
+
+// allow returns true, and counts e, if e is within the throughput of its
+// shard at now.
+func (p *Producer) allow(e *putEntry, now time.Time) bool {
+	if p.rates == nil {
+		p.rates = make(map[string]*shardRate)
+	}
+	r := p.rates[e.shard]
+	if r == nil || now.Sub(r.window) >= time.Second {
+		r = &shardRate{window: now}
+		p.rates[e.shard] = r
+	}
+	if r.bytes+e.size() > ShardBytesPerSecond || r.records+1 > ShardRecordsPerSecond {
+		return false
+	}
+	r.bytes += e.size()
+	r.records++
+	return true
+}
+
+// wait returns how long until the throughput of a shard of entries renews.
+func (p *Producer) wait(entries []*putEntry, now time.Time) time.Duration {
+	d := time.Second
+	for _, e := range entries {
+		if r := p.rates[e.shard]; r != nil {
+			if w := r.window.Add(time.Second).Sub(now); w < d {
+				d = w
+			}
+		}
+	}
+	return d
+}
+
+// send puts entries in batches within the throughput of their shards.
+func (p *Producer) send(ctx context.Context, entries []*putEntry) error {
+	attempts := p.Attempts
+	if attempts == 0 {
+		attempts = DefaultPutAttempts
+	}
+
+	var failed []FailedRecord
+	// abort ends the flush with err, keeping the records of unsent for the
+	// next flush if ctx is done, or else failing them.
+	abort := func(err error, unsent []*putEntry) error {
+		if ctx.Err() != nil {
+			err = ctx.Err() // rather than the error of a request cut short
+		}
+		code := "RequestFailed"
+		if e, ok := err.(*Error); ok {
+			code = e.Type
+		}
+		var records []UserRecord
+		for _, e := range unsent {
+			for _, ur := range e.records {
+				if ctx.Err() != nil {
+					records = append(records, ur)
+				} else {
+					failed = append(failed, FailedRecord{UserRecord: ur, ErrorCode: code, ErrorMessage: err.Error()})
+				}
+			}
+		}
+		p.requeue(records)
+		if len(failed) == 0 {
+			return err
+		}
+		return &PutError{Failed: failed, Err: err}
+	}
+
+	pending := entries
+	// retry counts the calls that failed in a row.
+	for retry := uint(0); len(pending) > 0; {
+		now := time.Now()
+		var batch, rest []*putEntry
+		size := 0
+		for _, e := range pending {
+			if len(batch) == MaxBatchRecords || size+e.size() > MaxBatchBytes || !p.allow(e, now) {
+				rest = append(rest, e)
+				continue
+			}
+			batch = append(batch, e)
+			size += e.size()
+		}
+		if len(batch) == 0 {
+			t := time.NewTimer(p.wait(rest, now))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return abort(ctx.Err(), rest)
+			}
+			continue
+		}
+
+		req := make([]Entry, len(batch))
+		for i, e := range batch {
+			req[i] = e.Entry
+		}
+		results, err := p.Stream.PutRecords(ctx, req)
+		if err == nil && len(results) != len(batch) {
+			err = fmt.Errorf("kinesis: %d results for %d records", len(results), len(batch))
+		}
+		if err != nil {
+			retry++
+			pending = append(batch, rest...)
+			if !awsjson.Retryable(ctx, err) || retry >= attempts {
+				return abort(err, pending)
+			}
+			if err := awsjson.Sleep(ctx, retry, err); err != nil {
+				return abort(err, pending)
+			}
+			continue
+		}
+		retry = 0
+
+		var again []*putEntry
+		for i, r := range results {
+			e := batch[i]
+			if r.ErrorCode == "" {
+				continue
+			}
+			e.attempts++
+			switch {
+			case e.attempts >= attempts:
+			case r.ErrorCode == "ProvisionedThroughputExceededException":
+				// Wait for the next second of the shard.
+				p.rates[e.shard].bytes = ShardBytesPerSecond
+				again = append(again, e)
+				continue
+			case r.ErrorCode == "InternalFailure":
+				again = append(again, e)
+				continue
+			}
+			for _, ur := range e.records {
+				failed = append(failed, FailedRecord{UserRecord: ur, ErrorCode: r.ErrorCode, ErrorMessage: r.ErrorMessage})
+			}
+		}
+		pending = append(again, rest...)
+		if len(again) > 0 {
+			if err := awsjson.Sleep(ctx, again[0].attempts, nil); err != nil {
+				return abort(err, pending)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &PutError{Failed: failed}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package aws4
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// LambdaDialTimeout limits connecting and TLS handshakes for Clients made by
+// NewLambdaClient. Functions are billed while they wait, and a retry on a
+// new connection is cheaper than a stalled one.
+const LambdaDialTimeout = 2 * time.Second
+
+// InLambda returns true if the process runs in AWS Lambda.
+func InLambda() bool {
+	return os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != ""
+}
+
+// NewLambdaClient returns a Client for AWS Lambda functions. It signs with
+// the keys of the function's execution role, which Lambda sets in the
+// environment, so nothing is looked up at startup, and it connects with
+// LambdaDialTimeout. Its User-Agent names the function.
+//
+// Connections outlive invocations while the execution environment is
+// reused, so the Client should be made once, outside the handler, rather
+// than in every invocation; LambdaClient does that.
+func NewLambdaClient() *Client {
+	d := &net.Dialer{Timeout: LambdaDialTimeout, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           d.DialContext,
+		TLSHandshakeTimeout:   LambdaDialTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+	ua := &UserAgent{AppID: os.Getenv("AWS_SDK_UA_APP_ID")}
+	if ua.AppID == "" {
+		ua.AppID = os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	}
+	return &Client{
+		Keys:      KeysFromEnvironment(),
+		Client:    &http.Client{Transport: t},
+		UserAgent: ua,
+	}
+}
+
+var (
+	lambdaOnce   sync.Once
+	lambdaClient *Client
+)
+
+// LambdaClient returns a Client made by NewLambdaClient the first time it is
+// called, and shared by all invocations and goroutines after that.
+func LambdaClient() *Client {
+	lambdaOnce.Do(func() {
+		lambdaClient = NewLambdaClient()
+	})
+	return lambdaClient
+}
@@ -0,0 +1,229 @@
+// Package preflight checks at startup that the credentials of an
+// application are valid and allowed to do what it needs, so that it fails
+// fast with a clear message rather than with opaque errors on first use:
+//
+//	err := (&preflight.Checker{}).Check(ctx, preflight.Permission{
+//		Action:   "dynamodb:PutItem",
+//		Resource: "arn:aws:dynamodb:us-east-1:123456789012:table/Orders",
+//	})
+//	// preflight: arn:aws:iam::123456789012:role/app is missing dynamodb:PutItem on arn:aws:dynamodb:us-east-1:123456789012:table/Orders
+//
+// Checking permissions with IAM SimulatePrincipalPolicy needs the
+// iam:SimulatePrincipalPolicy permission itself, and only considers
+// identity-based policies, not resource policies or SCPs.
+package preflight
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	STSVersion = "2011-06-15"
+	IAMVersion = "2010-05-08"
+)
+
+// A Checker checks the identity and permissions of a Client.
+type Checker struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// Region is the region of the STS endpoint. If empty, the global
+	// endpoint is used.
+	Region string
+
+	// If empty, the STS endpoint of Region is used.
+	STSURL string
+
+	// If empty, the global IAM endpoint is used.
+	IAMURL string
+}
+
+// An Identity is the result of GetCallerIdentity.
+type Identity struct {
+	Account string
+	Arn     string
+	UserId  string
+}
+
+// A Permission is an action on a resource, such as "s3:GetObject" on
+// "arn:aws:s3:::bucket/key". If Resource is empty, "*" is used.
+type Permission struct {
+	Action   string
+	Resource string
+}
+
+func (p Permission) resource() string {
+	if p.Resource == "" {
+		return "*"
+	}
+	return p.Resource
+}
+
+// An Error is an error reported by STS or IAM.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("preflight: %d - %s - %q", e.StatusCode, e.Code, e.Message)
+}
+
+// A MissingPermissionsError lists the permissions a principal lacks.
+type MissingPermissionsError struct {
+	Principal string
+	Missing   []Permission
+}
+
+func (e *MissingPermissionsError) Error() string {
+	a := make([]string, len(e.Missing))
+	for i, p := range e.Missing {
+		a[i] = p.Action + " on " + p.resource()
+	}
+	return "preflight: " + e.Principal + " is missing " + strings.Join(a, ", ")
+}
+
+// GetCallerIdentity returns the identity of the credentials of c.Client,
+// failing if they are invalid or expired.
+func (c *Checker) GetCallerIdentity(ctx context.Context) (*Identity, error) {
+	u := c.STSURL
+	if u == "" {
+		u = "https://sts.amazonaws.com/"
+		if c.Region != "" {
+			u = "https://sts." + c.Region + ".amazonaws.com/"
+		}
+	}
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var resp struct {
+		Result Identity `xml:"GetCallerIdentityResult"`
+	}
+	v := url.Values{"Action": {"GetCallerIdentity"}, "Version": {STSVersion}}
+	if err := c.do(ctx, "sts", region, u, v, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Result, nil
+}
+
+// Check checks that the credentials of c.Client are valid and, with IAM
+// SimulatePrincipalPolicy, that they are allowed perms. It returns a
+// *MissingPermissionsError listing the permissions denied.
+func (c *Checker) Check(ctx context.Context, perms ...Permission) error {
+	id, err := c.GetCallerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if len(perms) == 0 {
+		return nil
+	}
+	principal := PrincipalArn(id.Arn)
+
+	u := c.IAMURL
+	if u == "" {
+		u = "https://iam.amazonaws.com/"
+	}
+
+	// Simulate the actions of each resource separately, since a
+	// simulation covers every action on every resource given.
+	var resources []string
+	actions := make(map[string][]string)
+	for _, p := range perms {
+		r := p.resource()
+		if actions[r] == nil {
+			resources = append(resources, r)
+		}
+		actions[r] = append(actions[r], p.Action)
+	}
+
+	missing := &MissingPermissionsError{Principal: principal}
+	for _, r := range resources {
+		v := url.Values{
+			"Action":                {"SimulatePrincipalPolicy"},
+			"Version":               {IAMVersion},
+			"PolicySourceArn":       {principal},
+			"ResourceArns.member.1": {r},
+		}
+		for i, a := range actions[r] {
+			v.Set("ActionNames.member."+strconv.Itoa(i+1), a)
+		}
+		for {
+			var resp struct {
+				Results []struct {
+					EvalActionName   string
+					EvalResourceName string
+					EvalDecision     string
+				} `xml:"SimulatePrincipalPolicyResult>EvaluationResults>member"`
+				IsTruncated bool   `xml:"SimulatePrincipalPolicyResult>IsTruncated"`
+				Marker      string `xml:"SimulatePrincipalPolicyResult>Marker"`
+			}
+			if err := c.do(ctx, "iam", "us-east-1", u, v, &resp); err != nil {
+				return err
+			}
+			for _, res := range resp.Results {
+				if res.EvalDecision != "allowed" {
+					missing.Missing = append(missing.Missing, Permission{res.EvalActionName, res.EvalResourceName})
+				}
+			}
+			if !resp.IsTruncated {
+				break
+			}
+			v.Set("Marker", resp.Marker)
+		}
+	}
+	if len(missing.Missing) > 0 {
+		return missing
+	}
+	return nil
+}
+
+// PrincipalArn returns the ARN of the IAM principal of an identity ARN: the
+// role of an assumed-role session, or arn itself. Roles with a path can't be
+// told from their session ARN, and need their full ARN simulated instead.
+func PrincipalArn(arn string) string {
+	// arn:aws:sts::123456789012:assumed-role/name/session
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return arn
+	}
+	role := strings.SplitN(strings.TrimPrefix(parts[5], "assumed-role/"), "/", 2)[0]
+	return "arn:" + parts[1] + ":iam::" + parts[4] + ":role/" + role
+}
+
+func (c *Checker) do(ctx context.Context, service, region, u string, v url.Values, out interface{}) error {
+	r, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	cl := c.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+	resp, err := cl.DoService(service, region, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != 200 {
+		e := aws4.ParseError(resp)
+		return &Error{resp.StatusCode, e.Code, e.Message}
+	}
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
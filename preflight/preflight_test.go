@@ -0,0 +1,64 @@
+package preflight_test
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/preflight"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var simulations []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		v, _ := url.ParseQuery(string(b))
+		switch v.Get("Action") {
+		case "GetCallerIdentity":
+			w.Write([]byte(`<GetCallerIdentityResponse><GetCallerIdentityResult>
+				<Arn>arn:aws:sts::123456789012:assumed-role/app/i-1</Arn><UserId>AROA:i-1</UserId><Account>123456789012</Account>
+				</GetCallerIdentityResult></GetCallerIdentityResponse>`))
+		case "SimulatePrincipalPolicy":
+			simulations = append(simulations, v)
+			decision := "allowed"
+			if v.Get("ResourceArns.member.1") == "arn:aws:dynamodb:us-east-1:123456789012:table/Orders" {
+				decision = "implicitDeny"
+			}
+			w.Write([]byte(`<SimulatePrincipalPolicyResponse><SimulatePrincipalPolicyResult><EvaluationResults>
+				<member><EvalActionName>` + v.Get("ActionNames.member.1") + `</EvalActionName><EvalResourceName>` + v.Get("ResourceArns.member.1") + `</EvalResourceName><EvalDecision>` + decision + `</EvalDecision></member>
+				</EvaluationResults><IsTruncated>false</IsTruncated></SimulatePrincipalPolicyResult></SimulatePrincipalPolicyResponse>`))
+		}
+	}))
+	defer srv.Close()
+	c := &preflight.Checker{Client: &aws4.Client{Keys: &aws4.Keys{}}, STSURL: srv.URL, IAMURL: srv.URL}
+
+	err := c.Check(context.Background(),
+		preflight.Permission{Action: "dynamodb:PutItem", Resource: "arn:aws:dynamodb:us-east-1:123456789012:table/Orders"},
+		preflight.Permission{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/*"})
+	want := "preflight: arn:aws:iam::123456789012:role/app is missing dynamodb:PutItem on arn:aws:dynamodb:us-east-1:123456789012:table/Orders"
+	if err == nil || err.Error() != want {
+		t.Errorf("Check = %v", err)
+	}
+	if len(simulations) != 2 || simulations[0].Get("PolicySourceArn") != "arn:aws:iam::123456789012:role/app" {
+		t.Errorf("simulations %v", simulations)
+	}
+
+	if err := c.Check(context.Background()); err != nil {
+		t.Errorf("identity check: %v", err)
+	}
+}
+
+func TestPrincipalArn(t *testing.T) {
+	for arn, want := range map[string]string{
+		"arn:aws:sts::123456789012:assumed-role/app/i-1": "arn:aws:iam::123456789012:role/app",
+		"arn:aws:iam::123456789012:user/bob":             "arn:aws:iam::123456789012:user/bob",
+		"arn:aws-cn:sts::123456789012:assumed-role/r/s":  "arn:aws-cn:iam::123456789012:role/r",
+	} {
+		if got := preflight.PrincipalArn(arn); got != want {
+			t.Errorf("PrincipalArn(%s) = %s", arn, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package aws4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPresignExpiry is the longest validity of a presigned request.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// Presign signs r in its query string rather than in its headers, so that it
+// can be handed to someone without credentials, such as a browser
+// downloading from S3, or used as a token, as RDS and EKS authentication do.
+// The signature is valid for expires, at most MaxPresignExpiry.
+//
+// The signing time is taken from the X-Amz-Date query parameter, if set, or
+// else is the current time. Host and the other headers r has when presigned
+// are signed, and must be sent unchanged. The payload is signed as
+// UNSIGNED-PAYLOAD if s.UnsignedPayload, or else as for Sign.
+func (s *Service) Presign(keys *Keys, r *http.Request, expires time.Duration) error {
+	if expires < time.Second || expires > MaxPresignExpiry {
+		return fmt.Errorf("aws4: invalid presign expiry %v", expires)
+	}
+	q := r.URL.Query()
+	t := time.Now().UTC()
+	if xdate := q.Get("X-Amz-Date"); xdate != "" {
+		var err error
+		if t, err = time.Parse(iSO8601BasicFormat, xdate); err != nil {
+			return err
+		}
+	}
+	q.Del("X-Amz-Signature")
+
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	if !s.KeepDefaultPort {
+		r.Host = stripDefaultPort(r.URL.Scheme, r.Host)
+	}
+	r.Header.Set("host", r.Host)
+	hs := s.headersToSign(r)
+
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.Credential(keys, t))
+	q.Set("X-Amz-Date", t.Format(iSO8601BasicFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	q.Set("X-Amz-SignedHeaders", strings.Join(hs, ";"))
+	if keys.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", keys.SessionToken)
+	}
+	r.URL.RawQuery = strings.Replace(q.Encode(), "+", "%20", -1)
+
+	h := hmac.New(sha256.New, keys.sign(s, t))
+	crh, err := s.writeStringToSign(h, t, r, hs)
+	if err != nil {
+		return err
+	}
+	r.URL.RawQuery += fmt.Sprintf("&X-Amz-Signature=%x", h.Sum(nil))
+	if s.OnSign != nil {
+		s.OnSign(s.signEvent(keys, t, r, hs, crh, true))
+	}
+	return nil
+}
+
+// PresignService presigns r for the service name in region, applying the
+// Profile of the service. The payload is unsigned for services whose
+// Profile allows it, such as S3, since the body of presigned requests is
+// chosen by whoever sends them.
+func PresignService(name, region string, keys *Keys, r *http.Request, expires time.Duration) error {
+	p := ProfileFor(name)
+	sv := p.Service(name, region)
+	sv.UnsignedPayload = p.AllowUnsignedPayload
+	return sv.Presign(keys, r, expires)
+}
@@ -0,0 +1,91 @@
+package aws4
+
+import (
+	"sync"
+)
+
+// A Profile holds the signing quirks of a service. The zero Profile signs
+// as SigV4 prescribes for most services.
+type Profile struct {
+	// DisableURIPathEscaping signs the path as it is sent.
+	DisableURIPathEscaping bool
+
+	// ContentSha256Header sends the payload hash as X-Amz-Content-Sha256.
+	ContentSha256Header bool
+
+	// AllowUnsignedPayload lets Clients with UnsignedPayload set skip
+	// hashing the body of HTTPS requests.
+	AllowUnsignedPayload bool
+
+	// AllowStreamingTrailer lets Clients with StreamingTrailer set send the
+	// body of HTTPS requests with its hash as a trailer.
+	AllowStreamingTrailer bool
+
+	// KeepDefaultPort keeps a default port in the host.
+	KeepDefaultPort bool
+
+	// DisableDecompression makes Clients return responses as they are
+	// sent, for services whose Content-Encoding describes stored content
+	// rather than the transfer, like S3 objects uploaded gzipped.
+	DisableDecompression bool
+
+	// UnsignedHeaders lists headers that are never signed.
+	UnsignedHeaders []string
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{
+		"s3": {
+			DisableURIPathEscaping: true,
+			ContentSha256Header:    true,
+			AllowUnsignedPayload:   true,
+			AllowStreamingTrailer:  true,
+			DisableDecompression:   true,
+		},
+		"s3-object-lambda": {
+			DisableURIPathEscaping: true,
+			ContentSha256Header:    true,
+			AllowUnsignedPayload:   true,
+			DisableDecompression:   true,
+		},
+		"s3-outposts": {
+			DisableURIPathEscaping: true,
+			ContentSha256Header:    true,
+			AllowUnsignedPayload:   true,
+			DisableDecompression:   true,
+		},
+		"glacier": {
+			ContentSha256Header:  true,
+			DisableDecompression: true,
+		},
+	}
+)
+
+// RegisterProfile sets the Profile of service, such as a custom or
+// S3-compatible service, replacing any existing one.
+func RegisterProfile(service string, p Profile) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[service] = p
+}
+
+// ProfileFor returns the Profile of service, or the zero Profile if none is
+// registered.
+func ProfileFor(service string) Profile {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	return profiles[service]
+}
+
+// Service returns a Service for name and region that signs with p.
+func (p Profile) Service(name, region string) *Service {
+	return &Service{
+		Name:                   name,
+		Region:                 region,
+		UnsignedHeaders:        p.UnsignedHeaders,
+		DisableURIPathEscaping: p.DisableURIPathEscaping,
+		ContentSha256Header:    p.ContentSha256Header,
+		KeepDefaultPort:        p.KeepDefaultPort,
+	}
+}
@@ -0,0 +1,120 @@
+package aws4
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Provider supplies Keys, such as temporary credentials fetched from a
+// credentials service. Retrieve returns the keys and the time they expire,
+// or the zero time if they don't.
+type Provider interface {
+	Retrieve(ctx context.Context) (*Keys, time.Time, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ctx context.Context) (*Keys, time.Time, error)
+
+func (f ProviderFunc) Retrieve(ctx context.Context) (*Keys, time.Time, error) {
+	return f(ctx)
+}
+
+// StaticProvider returns a Provider of keys, which never expire.
+func StaticProvider(keys *Keys) Provider {
+	return ProviderFunc(func(context.Context) (*Keys, time.Time, error) {
+		return keys, time.Time{}, nil
+	})
+}
+
+// EnvProvider is a Provider of the keys of KeysFromEnvironment. It fails if
+// they are not set.
+var EnvProvider Provider = ProviderFunc(func(context.Context) (*Keys, time.Time, error) {
+	k := KeysFromEnvironment()
+	if k.AccessKey == "" || k.SecretKey == "" {
+		return nil, time.Time{}, errors.New("aws4: no keys in the environment")
+	}
+	return k, time.Time{}, nil
+})
+
+// A ChainError is returned by a Chain when all its providers failed.
+type ChainError []error
+
+func (e ChainError) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return "aws4: no provider of keys: " + strings.Join(s, "; ")
+}
+
+// A Chain is a Provider that returns the keys of the first of its providers
+// that succeeds.
+type Chain []Provider
+
+func (c Chain) Retrieve(ctx context.Context) (*Keys, time.Time, error) {
+	var errs ChainError
+	for _, p := range c {
+		k, exp, err := p.Retrieve(ctx)
+		if err == nil {
+			return k, exp, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, time.Time{}, errs
+}
+
+// DefaultExpiryWindow is how long before they expire Credentials refresh
+// keys by default.
+const DefaultExpiryWindow = 5 * time.Minute
+
+// Credentials caches the keys of a Provider, retrieving new ones when they
+// are about to expire. Set it as Client.Credentials to sign requests with
+// it. It is safe for concurrent use.
+type Credentials struct {
+	Provider Provider
+
+	// ExpiryWindow is how long before they expire keys are refreshed. If
+	// zero, DefaultExpiryWindow is used.
+	ExpiryWindow time.Duration
+
+	mu      sync.Mutex
+	keys    *Keys
+	expires time.Time
+}
+
+// NewCredentials returns Credentials for p.
+func NewCredentials(p Provider) *Credentials {
+	return &Credentials{Provider: p}
+}
+
+// Keys returns the current keys, retrieving them if needed.
+func (c *Credentials) Keys(ctx context.Context) (*Keys, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	window := c.ExpiryWindow
+	if window <= 0 {
+		window = DefaultExpiryWindow
+	}
+	if c.keys != nil && (c.expires.IsZero() || time.Now().Add(window).Before(c.expires)) {
+		return c.keys, nil
+	}
+
+	k, exp, err := c.Provider.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.keys, c.expires = k, exp
+	return k, nil
+}
+
+// Expire forces the keys to be retrieved again, such as after a request
+// failed because they were revoked.
+func (c *Credentials) Expire() {
+	c.mu.Lock()
+	c.keys = nil
+	c.mu.Unlock()
+}
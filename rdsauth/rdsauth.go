@@ -0,0 +1,35 @@
+// Package rdsauth builds the tokens that authenticate to Amazon RDS and
+// Aurora databases with IAM, signed with github.com/raff/aws4.
+package rdsauth
+
+import (
+	"fmt"
+	"github.com/raff/aws4"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TokenExpiry is how long tokens are valid. A token is only checked when a
+// connection is opened, so connections outlive it.
+const TokenExpiry = 15 * time.Minute
+
+// BuildAuthToken returns the token authenticating user to the database at
+// endpoint, its "host:port", in region, for use as the password of MySQL or
+// PostgreSQL drivers. The connection must use TLS.
+func BuildAuthToken(endpoint, region, user string, keys *aws4.Keys) (string, error) {
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return "", fmt.Errorf("rdsauth: endpoint %q must be host:port", endpoint)
+	}
+	q := url.Values{"Action": {"connect"}, "DBUser": {user}}
+	r, err := http.NewRequest("GET", "https://"+endpoint+"/?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if err := aws4.PresignService("rds-db", region, keys, r, TokenExpiry); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(r.URL.String(), "https://"), nil
+}
@@ -0,0 +1,34 @@
+package rdsauth_test
+
+import (
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/rdsauth"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBuildAuthToken(t *testing.T) {
+	keys := &aws4.Keys{AccessKey: "AKID", SecretKey: "secret", SessionToken: "tok"}
+	token, err := rdsauth.BuildAuthToken("db.abc.us-west-2.rds.amazonaws.com:5432", "us-west-2", "app user", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "db.abc.us-west-2.rds.amazonaws.com:5432/?") {
+		t.Fatalf("token = %s", token)
+	}
+	u, err := url.Parse("https://" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("Action") != "connect" || q.Get("DBUser") != "app user" || q.Get("X-Amz-Expires") != "900" ||
+		q.Get("X-Amz-Security-Token") != "tok" || !strings.HasSuffix(q.Get("X-Amz-Credential"), "/us-west-2/rds-db/aws4_request") ||
+		len(q.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("token = %s", token)
+	}
+
+	if _, err := rdsauth.BuildAuthToken("db.example.com", "us-west-2", "app", keys); err == nil {
+		t.Error("endpoint without port accepted")
+	}
+}
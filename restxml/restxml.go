@@ -0,0 +1,164 @@
+// Package restxml implements the REST-XML protocol of AWS services such as
+// Route 53, CloudFront and the S3 control API, where actions are HTTP
+// methods on resource paths exchanging XML documents.
+//
+//	c := &restxml.Client{Service: "route53", Region: "us-east-1", URL: "https://route53.amazonaws.com"}
+//	path, _ := restxml.Path("/2013-04-01/hostedzone/{Id}", map[string]string{"Id": id})
+//	var resp GetHostedZoneResponse
+//	err := c.Do(ctx, "GET", path, nil, nil, &resp)
+package restxml
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A Client calls the actions of one service.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// Service is the signing name of the service, and the endpoint prefix
+	// unless URL is set.
+	Service string
+
+	// Region is the region of the service; global services such as Route 53
+	// and CloudFront are signed for us-east-1.
+	Region string
+
+	// If empty, https://<Service>.<Region>.amazonaws.com is used.
+	URL string
+}
+
+// An Error is an error reported by a service, from either the ErrorResponse
+// envelope of most services or the bare Error document of S3.
+type Error struct {
+	Service    string
+	StatusCode int
+
+	// Type is Sender if the request was at fault, or Receiver.
+	Type      string
+	Code      string
+	Message   string
+	RequestId string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %d - %s - %q", e.Service, e.StatusCode, e.Code, e.Message)
+}
+
+// IsError returns true if err is an *Error with code name.
+func IsError(err error, name string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == name
+}
+
+// Path expands the parameters of template, written {Name}, with the values
+// of params, escaped as path segments. Greedy parameters, written {Name+},
+// keep their slashes, as for S3 keys.
+func Path(template string, params map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(template, '{')
+		if i < 0 {
+			b.WriteString(template)
+			return b.String(), nil
+		}
+		j := strings.IndexByte(template[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("restxml: unterminated parameter in %q", template)
+		}
+		b.WriteString(template[:i])
+		name := template[i+1 : i+j]
+		template = template[i+j+1:]
+
+		greedy := strings.HasSuffix(name, "+")
+		name = strings.TrimSuffix(name, "+")
+		v, ok := params[name]
+		if !ok || v == "" {
+			return "", fmt.Errorf("restxml: missing path parameter %s", name)
+		}
+		if greedy {
+			segs := strings.Split(v, "/")
+			for k, s := range segs {
+				segs[k] = url.PathEscape(s)
+			}
+			b.WriteString(strings.Join(segs, "/"))
+		} else {
+			b.WriteString(url.PathEscape(v))
+		}
+	}
+}
+
+// Do sends a method request for path with query, with in encoded as XML
+// unless it is nil, and decodes the response into out unless it is nil.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := xml.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(append([]byte(xml.Header), b...))
+	}
+
+	u := c.URL
+	if u == "" {
+		u = "https://" + c.Service + "." + c.Region + ".amazonaws.com"
+		if strings.HasPrefix(c.Region, "cn-") {
+			u += ".cn"
+		}
+	}
+	u = strings.TrimSuffix(u, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	r, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	if in != nil {
+		r.Header.Set("Content-Type", "application/xml")
+	}
+
+	cl := c.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+	resp, err := cl.DoService(c.Service, c.Region, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return ParseError(c.Service, resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
+
+// ParseError returns the *Error of resp, reading its body.
+func ParseError(service string, resp *http.Response) error {
+	e := aws4.ParseError(resp)
+	typ := ""
+	switch e.Fault {
+	case aws4.FaultClient:
+		typ = "Sender"
+	case aws4.FaultServer:
+		typ = "Receiver"
+	}
+	return &Error{service, resp.StatusCode, typ, e.Code, e.Message, e.RequestID}
+}
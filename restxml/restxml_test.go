@@ -0,0 +1,66 @@
+package restxml_test
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/restxml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	for _, tt := range []struct {
+		template string
+		params   map[string]string
+		want     string
+	}{
+		{"/2013-04-01/hostedzone/{Id}/rrset", map[string]string{"Id": "Z1"}, "/2013-04-01/hostedzone/Z1/rrset"},
+		{"/{Bucket}/{Key+}", map[string]string{"Bucket": "b", "Key": "a b/c"}, "/b/a%20b/c"},
+		{"/x/{Id}", map[string]string{"Id": "a/b"}, "/x/a%2Fb"},
+		{"/x/{Id}", nil, ""},
+	} {
+		got, err := restxml.Path(tt.template, tt.params)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("Path(%q) = %q, %v", tt.template, got, err)
+		}
+	}
+}
+
+type changeBatch struct {
+	XMLName xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+	Comment string   `xml:"ChangeBatch>Comment"`
+}
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req changeBatch
+		xml.NewDecoder(r.Body).Decode(&req)
+		switch req.Comment {
+		case "ok":
+			w.Write([]byte(`<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+		default:
+			w.WriteHeader(400)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>InvalidChangeBatch</Code><Message>bad</Message></Error><RequestId>r-1</RequestId></ErrorResponse>`))
+		}
+	}))
+	defer srv.Close()
+	c := &restxml.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, Service: "route53", Region: "us-east-1", URL: srv.URL}
+
+	var resp struct {
+		Id     string `xml:"ChangeInfo>Id"`
+		Status string `xml:"ChangeInfo>Status"`
+	}
+	if err := c.Do(context.Background(), "POST", "/2013-04-01/hostedzone/Z1/rrset", nil, &changeBatch{Comment: "ok"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Id != "/change/C1" || resp.Status != "PENDING" {
+		t.Errorf("response %+v", resp)
+	}
+
+	err := c.Do(context.Background(), "POST", "/2013-04-01/hostedzone/Z1/rrset", nil, &changeBatch{}, nil)
+	if e, ok := err.(*restxml.Error); !ok || e.Code != "InvalidChangeBatch" || e.Type != "Sender" || e.RequestId != "r-1" {
+		t.Errorf("err = %#v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// MaxCopySize is the size of the largest object that S3 copies in a single
+// request. Larger objects are copied in parts.
+const MaxCopySize = 5 << 30
+
+// DefaultCopyPartSize is the size of the parts of multipart copies by
+// default.
+const DefaultCopyPartSize = 512 << 20
+
+// DefaultCopyConcurrency is how many parts are copied at once by default.
+const DefaultCopyConcurrency = 4
+
+// maxParts is the maximum number of parts of a multipart upload.
+const maxParts = 10000
+
+// CopyOptions are the options of CopyObject.
+type CopyOptions struct {
+	// Put, if not nil, replaces the content type, metadata and tags of the
+	// source, and sets the storage class and encryption of the copy. If nil,
+	// the content type and metadata of the source are kept, and so are its
+	// tags unless it is copied in parts.
+	Put *PutOptions
+
+	// SourceVersionID, if not empty, copies a version of the source other
+	// than the current one.
+	SourceVersionID string
+
+	// SourceSSECustomerKey is the key of sources encrypted with SSE-C.
+	SourceSSECustomerKey []byte
+
+	// MultipartSize is the size above which objects are copied in parts. If
+	// zero, MaxCopySize is used.
+	MultipartSize int64
+
+	// PartSize is the size of the parts. If zero, DefaultCopyPartSize is
+	// used, or larger to fit objects in 10000 parts.
+	PartSize int64
+
+	// Concurrency is how many parts are copied at once. If zero,
+	// DefaultCopyConcurrency is used.
+	Concurrency int
+
+	// OnProgress, if not nil, is called with the bytes copied so far and
+	// the size of the source, after each part.
+	OnProgress func(copied, total int64)
+}
+
+// copySource returns the x-amz-copy-source of key in bucket.
+func copySource(bucket, key, version string) string {
+	s := "/" + bucket + "/" + escapeKey(key)
+	if version != "" {
+		s += "?versionId=" + url.QueryEscape(version)
+	}
+	return s
+}
+
+// CopyObject copies srcKey in srcBucket to key in bucket, with opts, which
+// may be nil, and returns the ETag of the copy. Objects larger than
+// MultipartSize are copied with a multipart upload, which is aborted if a
+// part fails. The copy fails with PreconditionFailed if the source changes
+// meanwhile.
+func (c *Client) CopyObject(ctx context.Context, bucket, key, srcBucket, srcKey string, opts *CopyOptions) (string, error) {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	src, err := c.HeadObject(ctx, srcBucket, srcKey, &GetOptions{
+		SSECustomerKey: opts.SourceSSECustomerKey,
+		VersionID:      opts.SourceVersionID,
+	})
+	if err != nil {
+		return "", err
+	}
+	src.Close()
+
+	source := http.Header{}
+	source.Set("x-amz-copy-source", copySource(srcBucket, srcKey, opts.SourceVersionID))
+	source.Set("x-amz-copy-source-if-match", src.ETag)
+	if opts.SourceSSECustomerKey != nil {
+		setSSECustomerKey(source, "x-amz-copy-source-", opts.SourceSSECustomerKey)
+	}
+
+	limit := opts.MultipartSize
+	if limit <= 0 {
+		limit = MaxCopySize
+	}
+	if src.Size <= limit {
+		header := http.Header{}
+		if opts.Put != nil {
+			header = opts.Put.Header()
+			header.Set("x-amz-metadata-directive", "REPLACE")
+			if len(opts.Put.Tags) > 0 {
+				header.Set("x-amz-tagging-directive", "REPLACE")
+			}
+		}
+		for k, v := range source {
+			header[k] = v
+		}
+		resp, err := c.do(ctx, "PUT", bucket, key, nil, header, nil)
+		etag, err := resultETag(resp, err, "CopyObject")
+		if err == nil && opts.OnProgress != nil {
+			opts.OnProgress(src.Size, src.Size)
+		}
+		return etag, err
+	}
+
+	put := opts.Put
+	if put == nil {
+		put = sourceOptions(src)
+	}
+	uploadID, err := c.CreateMultipartUpload(ctx, bucket, key, put.Header())
+	if err != nil {
+		return "", err
+	}
+	if put.SSECustomerKey != nil {
+		setSSECustomerKey(source, "", put.SSECustomerKey)
+	}
+	parts, err := c.copyParts(ctx, bucket, key, uploadID, source, src.Size, opts)
+	if err == nil {
+		var etag string
+		if etag, err = c.CompleteMultipartUpload(ctx, bucket, key, uploadID, parts); err == nil {
+			return etag, nil
+		}
+	}
+	// Abort even if ctx is done, not to leave billed parts behind.
+	c.AbortMultipartUpload(context.Background(), bucket, key, uploadID)
+	return "", err
+}
+
+// sourceOptions returns the PutOptions that keep the content type and
+// metadata of src.
+func sourceOptions(src *ObjectReader) *PutOptions {
+	return &PutOptions{
+		ContentType:        src.ContentType,
+		CacheControl:       src.Header.Get("Cache-Control"),
+		ContentDisposition: src.Header.Get("Content-Disposition"),
+		ContentEncoding:    src.Header.Get("Content-Encoding"),
+		Metadata:           src.Metadata,
+	}
+}
+
+// copyParts copies the size bytes of the source in header to the parts of
+// the upload uploadID.
+func (c *Client) copyParts(ctx context.Context, bucket, key, uploadID string, header http.Header, size int64, opts *CopyOptions) ([]Part, error) {
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		partSize = DefaultCopyPartSize
+	}
+	if least := (size + maxParts - 1) / maxParts; partSize < least {
+		partSize = least
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		parts  = make([]Part, (size+partSize-1)/partSize)
+		sem    = make(chan struct{}, concurrency)
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		copied int64
+		failed error
+	)
+	for i := range parts {
+		sem <- struct{}{}
+		mu.Lock()
+		err := failed
+		mu.Unlock()
+		if err != nil {
+			break
+		}
+
+		start := int64(i) * partSize
+		end := start + partSize
+		if end > size {
+			end = size
+		}
+		h := http.Header{}
+		for k, v := range header {
+			h[k] = v
+		}
+		h.Set("x-amz-copy-source-range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+		wg.Add(1)
+		go func(n int, h http.Header, length int64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			resp, err := c.do(ctx, "PUT", bucket, key, partQuery(uploadID, n), h, nil)
+			etag, err := resultETag(resp, err, "UploadPartCopy")
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if failed == nil {
+					failed = err
+					cancel()
+				}
+				return
+			}
+			parts[n-1] = Part{PartNumber: n, ETag: etag}
+			copied += length
+			if opts.OnProgress != nil {
+				opts.OnProgress(copied, size)
+			}
+		}(i+1, h, end-start)
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, failed
+	}
+	return parts, nil
+}
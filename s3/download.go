@@ -0,0 +1,235 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDownloadPartSize is the size of the parts of downloads by default.
+const DefaultDownloadPartSize = 8 << 20
+
+// DefaultDownloadConcurrency is how many parts are downloaded at once by
+// default.
+const DefaultDownloadConcurrency = 4
+
+// DefaultDownloadRetries is how many times a part is retried by default.
+const DefaultDownloadRetries = 3
+
+// ErrChecksumMismatch is returned by Download when the content does not
+// match the checksum of the object.
+var ErrChecksumMismatch = errors.New("s3: checksum mismatch")
+
+// DownloadOptions are the options of Download.
+type DownloadOptions struct {
+	// VersionID, if not empty, downloads a version of the object other than
+	// the current one.
+	VersionID string
+
+	// SSECustomerKey is the key of objects encrypted with SSE-C.
+	SSECustomerKey []byte
+
+	// PartSize is the size of the ranges requested. If zero,
+	// DefaultDownloadPartSize is used.
+	PartSize int64
+
+	// Concurrency is how many parts are downloaded, and buffered, at once.
+	// If zero, DefaultDownloadConcurrency is used.
+	Concurrency int
+
+	// Retries is how many times a part that fails with a network or server
+	// error is requested again. If zero, DefaultDownloadRetries is used; if
+	// negative, parts are not retried.
+	Retries int
+
+	// OnProgress, if not nil, is called with the bytes downloaded so far
+	// and the size of the object, after each part.
+	OnProgress func(downloaded, total int64)
+}
+
+// checksum returns the hash of the content of src and the value it must
+// have, hex for MD5 and base64 otherwise, or a nil hash if src has no
+// checksum of the whole object. The ETag is the MD5 of objects uploaded in
+// one part without SSE-KMS or SSE-C.
+func checksum(src *ObjectReader) (string, hash.Hash, string) {
+	sums := []struct {
+		name string
+		new  func() hash.Hash
+	}{
+		{"sha256", sha256.New},
+		{"sha1", sha1.New},
+		{"crc32c", func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }},
+		{"crc32", func() hash.Hash { return crc32.NewIEEE() }},
+	}
+	for _, s := range sums {
+		// Checksums of checksums of parts end with -<parts>.
+		if v := src.Header.Get("x-amz-checksum-" + s.name); v != "" && !strings.Contains(v, "-") {
+			return s.name, s.new(), v
+		}
+	}
+	etag := strings.Trim(src.ETag, `"`)
+	if len(etag) == 2*md5.Size && src.Header.Get("x-amz-server-side-encryption") != SSEKMS &&
+		src.Header.Get("x-amz-server-side-encryption-customer-algorithm") == "" {
+		return "md5", md5.New(), etag
+	}
+	return "", nil, ""
+}
+
+// Download writes key in bucket to w, requesting ranges of the object
+// concurrently, with opts, which may be nil, and returns its size. Parts
+// that fail are retried, and the content is checked against the checksum
+// of the object, if any, failing with ErrChecksumMismatch. The download
+// fails with PreconditionFailed if the object changes meanwhile.
+func (c *Client) Download(ctx context.Context, w io.WriterAt, bucket, key string, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	get := GetOptions{SSECustomerKey: opts.SSECustomerKey, VersionID: opts.VersionID}
+	src, err := c.HeadObject(ctx, bucket, key, &GetOptions{
+		SSECustomerKey: opts.SSECustomerKey,
+		VersionID:      opts.VersionID,
+		Checksum:       true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	src.Close()
+	get.IfMatch = src.ETag
+	size := src.Size
+
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		partSize = DefaultDownloadPartSize
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultDownloadRetries
+	}
+	name, sum, want := checksum(src)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Parts hold their slot of sem until they are hashed, in order, so that
+	// at most concurrency parts are buffered.
+	var (
+		parts      = make([][]byte, (size+partSize-1)/partSize)
+		next       = 0
+		sem        = make(chan struct{}, concurrency)
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		downloaded int64
+		failed     error
+	)
+	for i := range parts {
+		sem <- struct{}{}
+		mu.Lock()
+		err := failed
+		mu.Unlock()
+		if err != nil {
+			break
+		}
+
+		start := int64(i) * partSize
+		end := start + partSize
+		if end > size {
+			end = size
+		}
+		wg.Add(1)
+		go func(i int, start, end int64) {
+			defer wg.Done()
+			b, err := c.downloadPart(ctx, w, bucket, key, get, start, end-1, retries)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if failed == nil {
+					failed = err
+					cancel()
+				}
+				<-sem
+				return
+			}
+			downloaded += int64(len(b))
+			if opts.OnProgress != nil {
+				opts.OnProgress(downloaded, size)
+			}
+			for parts[i] = b; next < len(parts) && parts[next] != nil; next++ {
+				if sum != nil {
+					sum.Write(parts[next])
+				}
+				parts[next] = nil
+				<-sem
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+	if failed != nil {
+		return 0, failed
+	}
+
+	if sum != nil {
+		got := base64.StdEncoding.EncodeToString(sum.Sum(nil))
+		if name == "md5" {
+			got = hex.EncodeToString(sum.Sum(nil))
+		}
+		if got != want {
+			return 0, ErrChecksumMismatch
+		}
+	}
+	return size, nil
+}
+
+// downloadPart writes the bytes from start to end, inclusive, of key in
+// bucket to w, and returns them, retrying up to retries times.
+func (c *Client) downloadPart(ctx context.Context, w io.WriterAt, bucket, key string, get GetOptions, start, end int64, retries int) ([]byte, error) {
+	get.Range = ByteRange(start, end)
+	for attempt := 1; ; attempt++ {
+		b, err := c.getRange(ctx, bucket, key, &get, start, end)
+		if err == nil {
+			_, err = w.WriteAt(b, start)
+			return b, err
+		}
+		if e, ok := err.(*Error); attempt > retries || ctx.Err() != nil || ok && e.StatusCode < 500 {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		}
+	}
+}
+
+func (c *Client) getRange(ctx context.Context, bucket, key string, get *GetOptions, start, end int64) ([]byte, error) {
+	r, err := c.GetObject(ctx, bucket, key, get)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if !r.Partial() || r.Start != start || r.End != end {
+		return nil, fmt.Errorf("s3: got bytes %d-%d for range %d-%d", r.Start, r.End, start, end)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err == nil && int64(len(b)) != end-start+1 {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
@@ -0,0 +1,198 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Object describes an object in a listing.
+type Object struct {
+	Key          string
+	LastModified time.Time
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+// ListOptions select the objects listed by ListObjectsV2.
+type ListOptions struct {
+	// Prefix, if not empty, lists only the keys starting with it.
+	Prefix string
+
+	// Delimiter, if not empty, groups the keys containing it after Prefix
+	// into the CommonPrefixes of pages, up to its first occurrence, such as
+	// "/" to list a directory.
+	Delimiter string
+
+	// MaxKeys limits the size of pages. If zero, S3 returns up to 1000.
+	MaxKeys int
+
+	// StartAfter, if not empty, lists the keys after it.
+	StartAfter string
+}
+
+// A ListPage is a page of a listing.
+type ListPage struct {
+	Objects        []Object
+	CommonPrefixes []string
+
+	// NextToken is the token of the next page, or empty on the last page.
+	NextToken string
+}
+
+// ListObjectsV2 returns the page of the listing of bucket by opts (which may
+// be nil) continuing at token, or the first page if token is empty.
+func (c *Client) ListObjectsV2(ctx context.Context, bucket string, opts *ListOptions, token string) (*ListPage, error) {
+	q := url.Values{"list-type": {"2"}}
+	if opts != nil {
+		if opts.Prefix != "" {
+			q.Set("prefix", opts.Prefix)
+		}
+		if opts.Delimiter != "" {
+			q.Set("delimiter", opts.Delimiter)
+		}
+		if opts.MaxKeys > 0 {
+			q.Set("max-keys", strconv.Itoa(opts.MaxKeys))
+		}
+		if opts.StartAfter != "" {
+			q.Set("start-after", opts.StartAfter)
+		}
+	}
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+
+	resp, err := c.do(ctx, "GET", bucket, "", q, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		IsTruncated           bool
+		Contents              []Object
+		CommonPrefixes        []struct{ Prefix string }
+		NextContinuationToken string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	page := &ListPage{Objects: res.Contents}
+	for _, p := range res.CommonPrefixes {
+		page.CommonPrefixes = append(page.CommonPrefixes, p.Prefix)
+	}
+	if res.IsTruncated {
+		page.NextToken = res.NextContinuationToken
+	}
+	return page, nil
+}
+
+// An ObjectLister iterates over the pages of a listing:
+//
+//	l := c.NewObjectLister(ctx, "bucket", &s3.ListOptions{Prefix: "logs/"})
+//	for l.Next() {
+//		for _, o := range l.Page().Objects {
+//			...
+//		}
+//	}
+//	if err := l.Err(); err != nil {
+type ObjectLister struct {
+	c      *Client
+	ctx    context.Context
+	bucket string
+	opts   *ListOptions
+
+	page *ListPage
+	err  error
+	done bool
+}
+
+// NewObjectLister returns an ObjectLister of the listing of bucket by opts,
+// which may be nil.
+func (c *Client) NewObjectLister(ctx context.Context, bucket string, opts *ListOptions) *ObjectLister {
+	return &ObjectLister{c: c, ctx: ctx, bucket: bucket, opts: opts}
+}
+
+// Next gets the next page, and returns false after the last page or an
+// error.
+func (l *ObjectLister) Next() bool {
+	if l.done {
+		return false
+	}
+	token := ""
+	if l.page != nil {
+		token = l.page.NextToken
+	}
+	l.page, l.err = l.c.ListObjectsV2(l.ctx, l.bucket, l.opts, token)
+	if l.err != nil {
+		l.done = true
+		return false
+	}
+	l.done = l.page.NextToken == ""
+	return true
+}
+
+// Page returns the page got by Next.
+func (l *ObjectLister) Page() *ListPage {
+	return l.page
+}
+
+// Err returns the error that stopped Next, if any.
+func (l *ObjectLister) Err() error {
+	return l.err
+}
+
+// A Dir is a directory of a Tree: the objects whose key is Prefix followed
+// by a name without "/", and the directories under it.
+type Dir struct {
+	// Prefix is the full prefix of the directory, ending with "/" except
+	// at the root.
+	Prefix string
+
+	// Name is the last element of Prefix, without "/".
+	Name string
+
+	Objects []Object
+	Dirs    []*Dir
+
+	// Truncated is true if Dirs were not listed, beyond the depth of Tree.
+	Truncated bool
+}
+
+// Tree lists bucket as a tree of directories separated by "/", from prefix
+// (empty for the whole bucket, or ending with "/") down to depth levels
+// below it. With depth 0 only the directory prefix is listed, and its
+// directories have Truncated set, as file browsers list one level at a
+// time. With a negative depth the whole tree is listed.
+func (c *Client) Tree(ctx context.Context, bucket, prefix string, depth int) (*Dir, error) {
+	d := &Dir{Prefix: prefix, Name: path.Base(strings.TrimSuffix(prefix, "/"))}
+	if prefix == "" {
+		d.Name = ""
+	}
+
+	l := c.NewObjectLister(ctx, bucket, &ListOptions{Prefix: prefix, Delimiter: "/"})
+	for l.Next() {
+		p := l.Page()
+		d.Objects = append(d.Objects, p.Objects...)
+		for _, sub := range p.CommonPrefixes {
+			if depth == 0 {
+				d.Dirs = append(d.Dirs, &Dir{Prefix: sub, Name: path.Base(sub), Truncated: true})
+				continue
+			}
+			sd, err := c.Tree(ctx, bucket, sub, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			d.Dirs = append(d.Dirs, sd)
+		}
+	}
+	if err := l.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
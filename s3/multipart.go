@@ -0,0 +1,162 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultPresignExpiry is how long presigned URLs are valid by default.
+const DefaultPresignExpiry = 15 * time.Minute
+
+// A Part is an uploaded part of a multipart upload.
+type Part struct {
+	PartNumber int
+	ETag       string
+}
+
+// Presign returns a URL for the request method on key in bucket, with
+// query, that anyone can send without credentials until it expires, at
+// most aws4.MaxPresignExpiry later. If expires is zero,
+// DefaultPresignExpiry is used. The payload of presigned requests is
+// unsigned.
+func (c *Client) Presign(ctx context.Context, method, bucket, key string, query url.Values, expires time.Duration) (string, error) {
+	if expires == 0 {
+		expires = DefaultPresignExpiry
+	}
+	keys, err := c.client().CurrentKeys(ctx)
+	if err != nil {
+		return "", err
+	}
+	r, err := http.NewRequest(method, c.objectURL(bucket, key, query), nil)
+	if err != nil {
+		return "", err
+	}
+	if err := aws4.PresignService("s3", c.region(), keys, r, expires); err != nil {
+		return "", err
+	}
+	return r.URL.String(), nil
+}
+
+// CreateMultipartUpload starts a multipart upload of key in bucket, with
+// header, such as Content-Type or x-amz-meta-* (see PutOptions.Header), and
+// returns its upload ID.
+func (c *Client) CreateMultipartUpload(ctx context.Context, bucket, key string, header http.Header) (string, error) {
+	resp, err := c.do(ctx, "POST", bucket, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res struct{ UploadId string }
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", err
+	}
+	return res.UploadId, nil
+}
+
+func partQuery(uploadID string, part int) url.Values {
+	return url.Values{"uploadId": {uploadID}, "partNumber": {strconv.Itoa(part)}}
+}
+
+// UploadPart uploads part number part (from 1 to 10000) of the upload
+// uploadID, and returns its ETag. body should be of known length, such as
+// a *bytes.Reader, and be at least 5 MiB unless it is the last part.
+func (c *Client) UploadPart(ctx context.Context, bucket, key, uploadID string, part int, body io.Reader) (string, error) {
+	resp, err := c.do(ctx, "PUT", bucket, key, partQuery(uploadID, part), nil, body)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// PresignUploadPart returns a URL to PUT part number part of the upload
+// uploadID to, such as from a browser. The ETag header of the response is
+// needed to complete the upload, so buckets accessed from browsers must
+// expose it with CORS.
+func (c *Client) PresignUploadPart(ctx context.Context, bucket, key, uploadID string, part int, expires time.Duration) (string, error) {
+	return c.Presign(ctx, "PUT", bucket, key, partQuery(uploadID, part), expires)
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []Part   `xml:"Part"`
+}
+
+// CompleteMultipartUpload assembles parts, in order, into the object of the
+// upload uploadID, and returns its ETag.
+func (c *Client) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []Part) (string, error) {
+	b, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{"Content-Type": {"application/xml"}}
+	resp, err := c.do(ctx, "POST", bucket, key, url.Values{"uploadId": {uploadID}}, header, bytes.NewReader(b))
+	return resultETag(resp, err, "CompleteMultipartUpload")
+}
+
+// resultETag returns the ETag in the result of action, the response to a
+// request that completes or copies an object.
+func resultETag(resp *http.Response, err error, action string) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// S3 may report a failure after sending the status, as the body of a
+	// 200 response.
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		XMLName   xml.Name
+		ETag      string
+		Code      string
+		Message   string
+		RequestId string
+		Resource  string
+	}
+	if err := xml.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	if res.XMLName.Local == "Error" {
+		return "", &Error{
+			StatusCode: resp.StatusCode,
+			Code:       res.Code,
+			Message:    res.Message,
+			RequestId:  res.RequestId,
+			Resource:   res.Resource,
+		}
+	}
+	if res.ETag == "" {
+		return "", errors.New("s3: " + action + " without an ETag")
+	}
+	return res.ETag, nil
+}
+
+// PresignCompleteMultipartUpload returns a URL to POST the
+// CompleteMultipartUpload document of the upload uploadID to, for clients
+// that upload all the parts themselves.
+func (c *Client) PresignCompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, expires time.Duration) (string, error) {
+	return c.Presign(ctx, "POST", bucket, key, url.Values{"uploadId": {uploadID}}, expires)
+}
+
+// AbortMultipartUpload discards the upload uploadID and its parts, which
+// are otherwise stored, and billed, until it is completed.
+func (c *Client) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	resp, err := c.do(ctx, "DELETE", bucket, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,281 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotModified is returned by GetObject when the object matches the
+// IfNoneMatch or IfModifiedSince conditions, as a cached copy is current.
+var ErrNotModified = errors.New("s3: not modified")
+
+// ByteRange returns the Range of the bytes from start to end, inclusive. A
+// negative end reads to the end of the object, and a negative start reads
+// the last -start bytes.
+func ByteRange(start, end int64) string {
+	switch {
+	case start < 0:
+		return fmt.Sprintf("bytes=%d", start)
+	case end < 0:
+		return fmt.Sprintf("bytes=%d-", start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+// GetOptions are the options of GetObject.
+type GetOptions struct {
+	// Range, if not empty, reads part of the object, such as to resume a
+	// download. See ByteRange.
+	Range string
+
+	// IfMatch and IfUnmodifiedSince fail the request with PreconditionFailed
+	// unless the object matches them. IfNoneMatch and IfModifiedSince make
+	// it fail with ErrNotModified if the object matches them.
+	IfMatch           string
+	IfNoneMatch       string
+	IfModifiedSince   time.Time
+	IfUnmodifiedSince time.Time
+
+	// SSECustomerKey is the 256-bit key of objects encrypted with a key of
+	// the customer (SSE-C).
+	SSECustomerKey []byte
+
+	// VersionID, if not empty, reads a version of the object other than the
+	// current one.
+	VersionID string
+
+	// Checksum requests the checksums of the object stored by S3, in the
+	// x-amz-checksum-* headers of the ObjectReader.
+	Checksum bool
+}
+
+// setSSECustomerKey sets the SSE-C headers of key in h, with the given
+// prefix for the copy source of CopyObject.
+func setSSECustomerKey(h http.Header, prefix string, key []byte) {
+	sum := md5.Sum(key)
+	h.Set(prefix+"x-amz-server-side-encryption-customer-algorithm", "AES256")
+	h.Set(prefix+"x-amz-server-side-encryption-customer-key", base64.StdEncoding.EncodeToString(key))
+	h.Set(prefix+"x-amz-server-side-encryption-customer-key-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// An ObjectReader reads the content of an object. The caller must close it.
+type ObjectReader struct {
+	io.ReadCloser
+
+	// StatusCode is 200, or 206 for part of the object.
+	StatusCode int
+
+	// ContentLength is the length of the content read.
+	ContentLength int64
+
+	// Start and End are the positions of the first and last bytes read
+	// within the object, and Size is the size of the object.
+	Start, End, Size int64
+
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	VersionID    string
+
+	// Metadata holds the user metadata of the object, its x-amz-meta-*
+	// headers, by lower-case name without the prefix.
+	Metadata map[string]string
+
+	Header http.Header
+}
+
+// Partial returns true if r reads part of the object.
+func (r *ObjectReader) Partial() bool {
+	return r.StatusCode == http.StatusPartialContent
+}
+
+// header returns the headers and query of o.
+func (o *GetOptions) header() (http.Header, url.Values) {
+	header := http.Header{}
+	var query url.Values
+	if o == nil {
+		return header, query
+	}
+	if o.Range != "" {
+		header.Set("Range", o.Range)
+	}
+	if o.IfMatch != "" {
+		header.Set("If-Match", o.IfMatch)
+	}
+	if o.IfNoneMatch != "" {
+		header.Set("If-None-Match", o.IfNoneMatch)
+	}
+	if !o.IfModifiedSince.IsZero() {
+		header.Set("If-Modified-Since", o.IfModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if !o.IfUnmodifiedSince.IsZero() {
+		header.Set("If-Unmodified-Since", o.IfUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if o.SSECustomerKey != nil {
+		setSSECustomerKey(header, "", o.SSECustomerKey)
+	}
+	if o.VersionID != "" {
+		query = url.Values{"versionId": {o.VersionID}}
+	}
+	if o.Checksum {
+		header.Set("x-amz-checksum-mode", "ENABLED")
+	}
+	return header, query
+}
+
+// GetObject reads key in bucket. opts may be nil. It fails with
+// ErrNotModified if the object matches IfNoneMatch or IfModifiedSince, and
+// with an *Error InvalidRange if Range is beyond the end of the object.
+func (c *Client) GetObject(ctx context.Context, bucket, key string, opts *GetOptions) (*ObjectReader, error) {
+	return c.getObject(ctx, "GET", bucket, key, opts)
+}
+
+// HeadObject returns the size, ETag and metadata of key in bucket, in an
+// ObjectReader with an empty body, as GetObject.
+func (c *Client) HeadObject(ctx context.Context, bucket, key string, opts *GetOptions) (*ObjectReader, error) {
+	return c.getObject(ctx, "HEAD", bucket, key, opts)
+}
+
+func (c *Client) getObject(ctx context.Context, method, bucket, key string, opts *GetOptions) (*ObjectReader, error) {
+	header, query := opts.header()
+	resp, err := c.do(ctx, method, bucket, key, query, header, nil)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ObjectReader{
+		ReadCloser:    resp.Body,
+		StatusCode:    resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ETag:          resp.Header.Get("ETag"),
+		VersionID:     resp.Header.Get("X-Amz-Version-Id"),
+		Metadata:      metadata(resp.Header),
+		Header:        resp.Header,
+	}
+	r.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	r.End, r.Size = resp.ContentLength-1, resp.ContentLength
+	if cr := resp.Header.Get("Content-Range"); r.Partial() && cr != "" {
+		// bytes start-end/size
+		var start, end, size int64
+		if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err == nil {
+			r.Start, r.End, r.Size = start, end, size
+		} else if i := strings.LastIndexByte(cr, '/'); i >= 0 {
+			r.Size, _ = strconv.ParseInt(cr[i+1:], 10, 64)
+		}
+	}
+	return r, nil
+}
+
+// Server-side encryption of PutOptions: with keys managed by S3 (SSE-S3) or
+// by KMS (SSE-KMS).
+const (
+	SSES3  = "AES256"
+	SSEKMS = "aws:kms"
+)
+
+// PutOptions are the options of PutObject, CopyObject and
+// CreateMultipartUpload.
+type PutOptions struct {
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+
+	// StorageClass, if not empty, is the storage class of the object, such
+	// as STANDARD_IA, INTELLIGENT_TIERING or GLACIER_IR.
+	StorageClass string
+
+	// ServerSideEncryption, if not empty, is SSES3 or SSEKMS, with the key
+	// KMSKeyID, or the AWS managed key if empty. BucketKey uses an S3 Bucket
+	// Key to reduce the calls to KMS.
+	ServerSideEncryption string
+	KMSKeyID             string
+	BucketKey            bool
+
+	// SSECustomerKey, if not nil, encrypts the object with this 256-bit key
+	// of the customer (SSE-C), which must then be passed to read it.
+	SSECustomerKey []byte
+
+	// Metadata is the user metadata of the object, sent as x-amz-meta-*
+	// headers.
+	Metadata map[string]string
+
+	// Tags are the tags of the object.
+	Tags map[string]string
+}
+
+// Header returns the headers of o.
+func (o *PutOptions) Header() http.Header {
+	h := http.Header{}
+	set := func(k, v string) {
+		if v != "" {
+			h.Set(k, v)
+		}
+	}
+	set("Content-Type", o.ContentType)
+	set("Cache-Control", o.CacheControl)
+	set("Content-Disposition", o.ContentDisposition)
+	set("Content-Encoding", o.ContentEncoding)
+	set("x-amz-storage-class", o.StorageClass)
+	set("x-amz-server-side-encryption", o.ServerSideEncryption)
+	set("x-amz-server-side-encryption-aws-kms-key-id", o.KMSKeyID)
+	if o.BucketKey {
+		h.Set("x-amz-server-side-encryption-bucket-key-enabled", "true")
+	}
+	if o.SSECustomerKey != nil {
+		setSSECustomerKey(h, "", o.SSECustomerKey)
+	}
+	for k, v := range o.Metadata {
+		h.Set("x-amz-meta-"+k, v)
+	}
+	if len(o.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range o.Tags {
+			tags.Set(k, v)
+		}
+		h.Set("x-amz-tagging", tags.Encode())
+	}
+	return h
+}
+
+// PutObject writes body to key in bucket, with opts, which may be nil, and
+// returns the ETag of the object.
+func (c *Client) PutObject(ctx context.Context, bucket, key string, body io.Reader, opts *PutOptions) (string, error) {
+	var header http.Header
+	if opts != nil {
+		header = opts.Header()
+	}
+	resp, err := c.do(ctx, "PUT", bucket, key, nil, header, body)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// metadata returns the x-amz-meta-* headers of h.
+func metadata(h http.Header) map[string]string {
+	var m map[string]string
+	for k, v := range h {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-meta-") && len(v) > 0 {
+			if m == nil {
+				m = make(map[string]string)
+			}
+			m[strings.TrimPrefix(lk, "x-amz-meta-")] = v[0]
+		}
+	}
+	return m
+}
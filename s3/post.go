@@ -0,0 +1,142 @@
+package s3
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/raff/aws4"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPostExpiry is how long POST policies are valid by default.
+const DefaultPostExpiry = time.Hour
+
+// A PostPolicy describes the uploads a browser may make by POSTing a form
+// directly to S3, without credentials of its own.
+type PostPolicy struct {
+	Bucket string
+
+	// Key is the key of the uploaded object. If it ends with "${filename}",
+	// S3 replaces that with the name of the uploaded file. If Key is empty,
+	// the form must have a key field starting with KeyPrefix.
+	Key       string
+	KeyPrefix string
+
+	// Expires is when the policy expires. If zero, it expires
+	// DefaultPostExpiry after it is signed.
+	Expires time.Time
+
+	// MinSize and MaxSize, if MaxSize is not zero, limit the size of the
+	// uploaded file.
+	MinSize, MaxSize int64
+
+	// ContentType is the Content-Type of the object. If it ends with "*",
+	// the form may set any type starting with the rest, such as "image/*".
+	ContentType string
+
+	// ACL is the canned ACL of the object, such as "public-read".
+	ACL string
+
+	// SuccessActionStatus is the status of the response to a successful
+	// upload, "200", "201" or "204" (the default).
+	SuccessActionStatus string
+
+	// Fields are other fields of the form, such as "x-amz-meta-owner" or
+	// "x-amz-server-side-encryption", which the form must send unchanged.
+	Fields map[string]string
+
+	// Conditions are other conditions of the policy, in its JSON form, such
+	// as []string{"starts-with", "$x-amz-meta-tag", ""}.
+	Conditions []interface{}
+}
+
+// A PostForm is a signed upload form. Fields must be sent as form fields
+// before the file, which is sent last as the field "file".
+type PostForm struct {
+	URL    string
+	Fields map[string]string
+}
+
+// PresignPost signs p with the keys of the client. The form it returns is
+// valid until p expires, or until the keys expire if they are temporary.
+func (c *Client) PresignPost(ctx context.Context, p *PostPolicy) (*PostForm, error) {
+	if p.Bucket == "" {
+		return nil, errors.New("s3: POST policy without a bucket")
+	}
+	keys, err := c.client().CurrentKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expires := p.Expires
+	if expires.IsZero() {
+		expires = now.Add(DefaultPostExpiry)
+	}
+	sv := &aws4.Service{Name: "s3", Region: c.region()}
+
+	fields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": sv.Credential(keys, now),
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if keys.SessionToken != "" {
+		fields["x-amz-security-token"] = keys.SessionToken
+	}
+	if p.ACL != "" {
+		fields["acl"] = p.ACL
+	}
+	if p.SuccessActionStatus != "" {
+		fields["success_action_status"] = p.SuccessActionStatus
+	}
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+
+	conds := []interface{}{map[string]string{"bucket": p.Bucket}}
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		conds = append(conds, map[string]string{k: fields[k]})
+	}
+	switch {
+	case strings.HasSuffix(p.Key, "${filename}"):
+		conds = append(conds, []string{"starts-with", "$key", strings.TrimSuffix(p.Key, "${filename}")})
+		fields["key"] = p.Key
+	case p.Key != "":
+		conds = append(conds, map[string]string{"key": p.Key})
+		fields["key"] = p.Key
+	default:
+		conds = append(conds, []string{"starts-with", "$key", p.KeyPrefix})
+	}
+	switch {
+	case strings.HasSuffix(p.ContentType, "*"):
+		conds = append(conds, []string{"starts-with", "$Content-Type", strings.TrimSuffix(p.ContentType, "*")})
+	case p.ContentType != "":
+		conds = append(conds, map[string]string{"Content-Type": p.ContentType})
+		fields["Content-Type"] = p.ContentType
+	}
+	if p.MaxSize > 0 {
+		conds = append(conds, []interface{}{"content-length-range", p.MinSize, p.MaxSize})
+	}
+	conds = append(conds, p.Conditions...)
+
+	doc, err := json.Marshal(map[string]interface{}{
+		"expiration": expires.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	policy := base64.StdEncoding.EncodeToString(doc)
+	fields["policy"] = policy
+	fields["x-amz-signature"] = sv.SignString(keys, now, policy)
+
+	return &PostForm{URL: c.objectURL(p.Bucket, "", nil), Fields: fields}, nil
+}
@@ -0,0 +1,122 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Retrieval tiers of RestoreObject, from the fastest and most expensive.
+const (
+	TierExpedited = "Expedited"
+	TierStandard  = "Standard"
+	TierBulk      = "Bulk"
+)
+
+type restoreRequest struct {
+	XMLName xml.Name `xml:"RestoreRequest"`
+	Days    int      `xml:"Days,omitempty"`
+	Tier    string   `xml:"GlacierJobParameters>Tier,omitempty"`
+}
+
+// RestoreObject starts restoring a copy of key in bucket, archived in the
+// GLACIER or DEEP_ARCHIVE storage classes, or the archive tiers of
+// INTELLIGENT_TIERING, that can be read for days (which must be zero for
+// INTELLIGENT_TIERING). tier, if not empty, is TierExpedited, TierStandard
+// or TierBulk. It returns true if a restored copy is already available,
+// whose expiry is then extended, and false if the restore started or was
+// already in progress. See RestoreStatus to wait for it.
+func (c *Client) RestoreObject(ctx context.Context, bucket, key string, days int, tier string) (bool, error) {
+	b, err := xml.Marshal(restoreRequest{Days: days, Tier: tier})
+	if err != nil {
+		return false, err
+	}
+	header := http.Header{"Content-Type": {"application/xml"}}
+	resp, err := c.do(ctx, "POST", bucket, key, url.Values{"restore": {""}}, header, bytes.NewReader(b))
+	if IsException(err, "RestoreAlreadyInProgress") {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// A RestoreStatus describes whether an object is archived, and the restore
+// of its copy.
+type RestoreStatus struct {
+	StorageClass string
+
+	// Archived is true if the object must be restored to be read.
+	Archived bool
+
+	// Ongoing is true while the restore is in progress.
+	Ongoing bool
+
+	// Expiry is when the restored copy is deleted, or zero if there is none.
+	Expiry time.Time
+}
+
+// Restored returns true if a restored copy of the object can be read.
+func (s *RestoreStatus) Restored() bool {
+	return !s.Ongoing && !s.Expiry.IsZero()
+}
+
+// Readable returns true if the object can be read, because it is not
+// archived or is restored.
+func (s *RestoreStatus) Readable() bool {
+	return !s.Archived || s.Restored()
+}
+
+// RestoreStatus returns the restore status of the object, from the headers
+// of HeadObject.
+func (r *ObjectReader) RestoreStatus() *RestoreStatus {
+	s := &RestoreStatus{StorageClass: r.Header.Get("x-amz-storage-class")}
+	switch s.StorageClass {
+	case "GLACIER", "DEEP_ARCHIVE":
+		s.Archived = true
+	}
+	// Objects in the archive tiers of INTELLIGENT_TIERING.
+	if r.Header.Get("x-amz-archive-status") != "" {
+		s.Archived = true
+	}
+
+	// ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+	restore := r.Header.Get("x-amz-restore")
+	s.Ongoing = strings.Contains(restore, `ongoing-request="true"`)
+	if i := strings.Index(restore, `expiry-date="`); i >= 0 {
+		date := restore[i+len(`expiry-date="`):]
+		if j := strings.IndexByte(date, '"'); j >= 0 {
+			s.Expiry, _ = http.ParseTime(date[:j])
+		}
+	}
+	return s
+}
+
+// SetStorageClass transitions key in bucket to the storage class class,
+// such as STANDARD_IA or GLACIER, by copying it onto itself, keeping its
+// content type, metadata and SSE-S3 or SSE-KMS encryption, and its tags up
+// to MaxCopySize. Archived objects must be restored first. Objects
+// encrypted with SSE-C are not supported.
+func (c *Client) SetStorageClass(ctx context.Context, bucket, key, class string) error {
+	src, err := c.HeadObject(ctx, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	src.Close()
+
+	put := sourceOptions(src)
+	put.StorageClass = class
+	put.ServerSideEncryption = src.Header.Get("x-amz-server-side-encryption")
+	if put.ServerSideEncryption == SSEKMS {
+		put.KMSKeyID = src.Header.Get("x-amz-server-side-encryption-aws-kms-key-id")
+		put.BucketKey = src.Header.Get("x-amz-server-side-encryption-bucket-key-enabled") == "true"
+	}
+	_, err = c.CopyObject(ctx, bucket, key, bucket, key, &CopyOptions{Put: put})
+	return err
+}
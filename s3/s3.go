@@ -0,0 +1,138 @@
+// Package s3 is a client for Amazon S3, signing requests with
+// github.com/raff/aws4.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultRegion = "us-east-1"
+
+// A Client sends requests to S3.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// URL, if not empty, is the endpoint of an S3-compatible service or
+	// emulator, which is addressed path-style (URL/bucket/key).
+	URL string
+
+	// PathStyle addresses buckets as s3.<region>.amazonaws.com/bucket
+	// rather than bucket.s3.<region>.amazonaws.com. It is implied for
+	// bucket names containing dots, which don't match the certificate of
+	// virtual-hosted endpoints.
+	PathStyle bool
+}
+
+// An Error is an error reported by S3, such as NoSuchKey, NoSuchBucket or
+// AccessDenied. Responses without a body, such as the ones to HEAD
+// requests, only have a StatusCode.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestId  string
+	Resource   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3: %d - %s - %q", e.StatusCode, e.Code, e.Message)
+}
+
+// IsException returns true if err is an *Error with code name.
+func IsException(err error, name string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == name
+}
+
+func (c *Client) region() string {
+	if c.Region == "" {
+		return DefaultRegion
+	}
+	return c.Region
+}
+
+func (c *Client) client() *aws4.Client {
+	if c.Client == nil {
+		return aws4.DefaultClient
+	}
+	return c.Client
+}
+
+// objectURL returns the URL of key in bucket, with query.
+func (c *Client) objectURL(bucket, key string, query url.Values) string {
+	var u string
+	switch {
+	case c.URL != "":
+		u = strings.TrimSuffix(c.URL, "/") + "/" + bucket
+	case c.PathStyle || strings.Contains(bucket, "."):
+		u = "https://s3." + c.region() + ".amazonaws.com/" + bucket
+	default:
+		u = "https://" + bucket + ".s3." + c.region() + ".amazonaws.com"
+	}
+	u += "/" + escapeKey(key)
+	if len(query) > 0 {
+		// Subresources like "select" are sent without "=".
+		u += "?" + strings.Replace(query.Encode(), "=&", "&", -1)
+		u = strings.TrimSuffix(u, "=")
+	}
+	return u
+}
+
+// escapeKey percent-encodes key as S3 signs it, keeping slashes.
+func escapeKey(key string) string {
+	const hex = "0123456789ABCDEF"
+	var b []byte
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b = append(b, c)
+		default:
+			b = append(b, '%', hex[c>>4], hex[c&15])
+		}
+	}
+	return string(b)
+}
+
+// do sends a request for key in bucket and returns the response, or an
+// *Error for responses with a status other than 2xx.
+func (c *Client) do(ctx context.Context, method, bucket, key string, query url.Values, header http.Header, body io.Reader) (*http.Response, error) {
+	r, err := http.NewRequest(method, c.objectURL(bucket, key, query), body)
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	resp, err := c.client().DoService("s3", c.region(), r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		defer io.Copy(ioutil.Discard, resp.Body)
+		e := aws4.ParseError(resp)
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Code:       e.Code,
+			Message:    e.Message,
+			RequestId:  e.RequestID,
+			Resource:   e.Resource,
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,614 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/s3"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func event(typ string, payload string) *aws4.EventMessage {
+	return &aws4.EventMessage{
+		Headers: aws4.EventHeaders{{Name: ":message-type", Value: "event"}, {Name: ":event-type", Value: typ}},
+		Payload: []byte(payload),
+	}
+}
+
+func TestSelectObjectContent(t *testing.T) {
+	end := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.EscapedPath() != "/bucket/dir/a%20b.csv" || r.URL.RawQuery != "select&select-type=2" {
+			t.Errorf("%s %s", r.URL.EscapedPath(), r.URL.RawQuery)
+		}
+		if !bytes.Contains(body, []byte("<Expression>SELECT * FROM S3Object</Expression>")) ||
+			!bytes.Contains(body, []byte("<InputSerialization><CSV><FileHeaderInfo>USE</FileHeaderInfo></CSV></InputSerialization>")) {
+			t.Errorf("body %s", body)
+		}
+		ew := aws4.NewEventWriter(w)
+		ew.WriteMessage(event("Records", "a,1\nb,"))
+		ew.WriteMessage(event("Progress", "<Progress><BytesScanned>10</BytesScanned></Progress>"))
+		ew.WriteMessage(event("Records", "2\n"))
+		ew.WriteMessage(event("Stats", "<Stats><BytesScanned>20</BytesScanned><BytesProcessed>20</BytesProcessed><BytesReturned>8</BytesReturned></Stats>"))
+		if end {
+			ew.WriteMessage(event("End", ""))
+		}
+	}))
+	defer srv.Close()
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	var scanned int64
+	in := &s3.SelectInput{
+		Expression: "SELECT * FROM S3Object",
+		Input:      s3.InputSerialization{CSV: &s3.CSVInput{FileHeaderInfo: "USE"}},
+		Output:     s3.OutputSerialization{CSV: &s3.CSVOutput{}},
+		Progress:   func(s *s3.SelectStats) { scanned = s.BytesScanned },
+	}
+	r, err := c.SelectObjectContent(context.Background(), "bucket", "dir/a b.csv", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []string
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, string(rec))
+	}
+	r.Close()
+	if strings.Join(recs, "|") != "a,1|b,2" || scanned != 10 || r.Stats() == nil || r.Stats().BytesReturned != 8 {
+		t.Errorf("records %q, scanned %d, stats %+v", recs, scanned, r.Stats())
+	}
+
+	end = false
+	r, err = c.SelectObjectContent(context.Background(), "bucket", "dir/a b.csv", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if b, err := ioutil.ReadAll(r); err == nil || string(b) != "a,1\nb,2\n" {
+		t.Errorf("truncated stream: %q, %v", b, err)
+	}
+}
+
+func TestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><RequestId>r-1</RequestId></Error>`))
+	}))
+	defer srv.Close()
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	_, err := c.SelectObjectContent(context.Background(), "bucket", "key", &s3.SelectInput{})
+	if !s3.IsException(err, "NoSuchKey") || err.(*s3.Error).RequestId != "r-1" {
+		t.Errorf("err = %#v", err)
+	}
+}
+
+func TestPresignPost(t *testing.T) {
+	keys := &aws4.Keys{AccessKey: "AKID", SecretKey: "secret", SessionToken: "tok"}
+	c := &s3.Client{Client: &aws4.Client{Keys: keys}, Region: "eu-west-1"}
+	f, err := c.PresignPost(context.Background(), &s3.PostPolicy{
+		Bucket:      "uploads",
+		Key:         "user/42/${filename}",
+		MaxSize:     1 << 20,
+		ContentType: "image/*",
+		Fields:      map[string]string{"x-amz-meta-owner": "42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.URL != "https://uploads.s3.eu-west-1.amazonaws.com/" {
+		t.Errorf("URL = %s", f.URL)
+	}
+	if f.Fields["key"] != "user/42/${filename}" || f.Fields["x-amz-security-token"] != "tok" || f.Fields["x-amz-meta-owner"] != "42" {
+		t.Errorf("fields = %v", f.Fields)
+	}
+
+	doc, _ := base64.StdEncoding.DecodeString(f.Fields["policy"])
+	var policy struct {
+		Expiration string
+		Conditions []interface{}
+	}
+	if err := json.Unmarshal(doc, &policy); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`["starts-with","$key","user/42/"]`, `["starts-with","$Content-Type","image/"]`, `["content-length-range",0,1048576]`, `{"x-amz-meta-owner":"42"}`, `{"bucket":"uploads"}`} {
+		if !strings.Contains(string(doc), want) {
+			t.Errorf("policy %s lacks %s", doc, want)
+		}
+	}
+
+	date, _ := time.Parse("20060102T150405Z", f.Fields["x-amz-date"])
+	sv := &aws4.Service{Name: "s3", Region: "eu-west-1"}
+	if f.Fields["x-amz-credential"] != sv.Credential(keys, date) || f.Fields["x-amz-signature"] != sv.SignString(keys, date, f.Fields["policy"]) {
+		t.Errorf("bad signature fields %v", f.Fields)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	var parts []string
+	completed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/big.bin" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		switch {
+		case r.Method == "POST" && r.URL.RawQuery == "uploads":
+			if r.Header.Get("Content-Type") != "video/mp4" {
+				t.Errorf("Content-Type %q", r.Header.Get("Content-Type"))
+			}
+			io.WriteString(w, `<InitiateMultipartUploadResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Bucket>bucket</Bucket><Key>big.bin</Key><UploadId>up-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == "PUT" && q.Get("uploadId") == "up-1":
+			b, _ := ioutil.ReadAll(r.Body)
+			parts = append(parts, q.Get("partNumber")+":"+string(b))
+			w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+		case r.Method == "POST" && q.Get("uploadId") == "up-1":
+			b, _ := ioutil.ReadAll(r.Body)
+			if string(b) != `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>&#34;etag-1&#34;</ETag></Part></CompleteMultipartUpload>` {
+				t.Errorf("complete %s", b)
+			}
+			if completed++; completed > 1 {
+				io.WriteString(w, `<Error><Code>InternalError</Code><Message>try again</Message><RequestId>r-2</RequestId></Error>`)
+				return
+			}
+			io.WriteString(w, `<CompleteMultipartUploadResult><ETag>"etag-all"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == "DELETE" && q.Get("uploadId") == "up-1":
+			w.WriteHeader(204)
+		default:
+			t.Errorf("%s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{AccessKey: "AKID", SecretKey: "secret"}}, URL: srv.URL}
+	ctx := context.Background()
+
+	id, err := c.CreateMultipartUpload(ctx, "bucket", "big.bin", http.Header{"Content-Type": {"video/mp4"}})
+	if err != nil || id != "up-1" {
+		t.Fatalf("CreateMultipartUpload = %q, %v", id, err)
+	}
+	etag, err := c.UploadPart(ctx, "bucket", "big.bin", id, 1, strings.NewReader("part one"))
+	if err != nil || etag != `"etag-1"` || len(parts) != 1 || parts[0] != "1:part one" {
+		t.Fatalf("UploadPart = %q, %v, %v", etag, err, parts)
+	}
+	done := []s3.Part{{PartNumber: 1, ETag: etag}}
+	if etag, err := c.CompleteMultipartUpload(ctx, "bucket", "big.bin", id, done); err != nil || etag != `"etag-all"` {
+		t.Errorf("CompleteMultipartUpload = %q, %v", etag, err)
+	}
+	if _, err := c.CompleteMultipartUpload(ctx, "bucket", "big.bin", id, done); !s3.IsException(err, "InternalError") {
+		t.Errorf("failure in 200 response: err = %v", err)
+	}
+	if err := c.AbortMultipartUpload(ctx, "bucket", "big.bin", id); err != nil {
+		t.Error(err)
+	}
+
+	// Presigned parts are sent without credentials.
+	u, err := c.PresignUploadPart(ctx, "bucket", "big.bin", id, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"partNumber=2", "uploadId=up-1", "X-Amz-Expires=3600", "X-Amz-Signature="} {
+		if !strings.Contains(u, want) {
+			t.Errorf("presigned URL %s lacks %s", u, want)
+		}
+	}
+	r, _ := http.NewRequest("PUT", u, strings.NewReader("part two"))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("ETag") != `"etag-2"` || parts[1] != "2:part two" {
+		t.Errorf("presigned part: %v, %v", resp.Header, parts)
+	}
+	if u, err := c.PresignCompleteMultipartUpload(ctx, "bucket", "big.bin", id, 0); err != nil || !strings.Contains(u, "X-Amz-Expires=900") {
+		t.Errorf("PresignCompleteMultipartUpload = %s, %v", u, err)
+	}
+}
+
+// listServer serves ListObjectsV2 for keys, in pages of max-keys keys and
+// common prefixes.
+func listServer(t *testing.T, keys []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("list-type") != "2" {
+			t.Errorf("query %s", r.URL.RawQuery)
+		}
+		prefix, delim := q.Get("prefix"), q.Get("delimiter")
+		var entries []string // keys, or prefixes ending with delim
+		for _, k := range keys {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			if i := strings.Index(k[len(prefix):], delim); delim != "" && i >= 0 {
+				k = k[:len(prefix)+i+1]
+				if len(entries) > 0 && entries[len(entries)-1] == k {
+					continue
+				}
+			}
+			entries = append(entries, k)
+		}
+		start, _ := strconv.Atoi(q.Get("continuation-token"))
+		max, _ := strconv.Atoi(q.Get("max-keys"))
+		if max == 0 {
+			max = 1000
+		}
+		end := start + max
+		if end > len(entries) {
+			end = len(entries)
+		}
+		fmt.Fprint(w, `<ListBucketResult>`)
+		for _, e := range entries[start:end] {
+			if delim != "" && strings.HasSuffix(e, delim) {
+				fmt.Fprintf(w, `<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>`, e)
+			} else {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2009-10-12T17:50:30.000Z</LastModified></Contents>`, e, len(e))
+			}
+		}
+		if end < len(entries) {
+			fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>`, end)
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	}))
+}
+
+func TestListObjects(t *testing.T) {
+	srv := listServer(t, []string{"a.txt", "docs/b.txt", "docs/c.txt", "docs/old/d.txt", "img/e.png", "z.txt"})
+	defer srv.Close()
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	ctx := context.Background()
+
+	var keys []string
+	pages := 0
+	l := c.NewObjectLister(ctx, "bucket", &s3.ListOptions{MaxKeys: 4})
+	for l.Next() {
+		pages++
+		for _, o := range l.Page().Objects {
+			keys = append(keys, o.Key)
+		}
+	}
+	if err := l.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 || len(keys) != 6 || keys[5] != "z.txt" {
+		t.Errorf("%d pages: %v", pages, keys)
+	}
+
+	p, err := c.ListObjectsV2(ctx, "bucket", &s3.ListOptions{Prefix: "docs/", Delimiter: "/"}, "")
+	if err != nil || len(p.Objects) != 2 || p.Objects[0].Size != 10 || p.Objects[0].LastModified.Year() != 2009 ||
+		len(p.CommonPrefixes) != 1 || p.CommonPrefixes[0] != "docs/old/" || p.NextToken != "" {
+		t.Errorf("ListObjectsV2 = %+v, %v", p, err)
+	}
+
+	root, err := c.Tree(ctx, "bucket", "", 0)
+	if err != nil || len(root.Objects) != 2 || len(root.Dirs) != 2 || root.Dirs[0].Name != "docs" || !root.Dirs[0].Truncated {
+		t.Fatalf("Tree depth 0 = %+v, %v", root, err)
+	}
+	root, err = c.Tree(ctx, "bucket", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := root.Dirs[0]
+	if docs.Prefix != "docs/" || len(docs.Objects) != 2 || len(docs.Dirs) != 1 || docs.Truncated {
+		t.Fatalf("docs = %+v", docs)
+	}
+	if old := docs.Dirs[0]; old.Name != "old" || len(old.Objects) != 1 || old.Objects[0].Key != "docs/old/d.txt" {
+		t.Errorf("docs/old = %+v", old)
+	}
+}
+
+func TestGetObject(t *testing.T) {
+	const content = "0123456789"
+	key := bytes.Repeat([]byte{7}, 32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-amz-server-side-encryption-customer-key") != base64.StdEncoding.EncodeToString(key) ||
+			r.Header.Get("x-amz-server-side-encryption-customer-key-MD5") == "" {
+			t.Errorf("SSE-C headers %v", r.Header)
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 28 Oct 2009 22:32:00 GMT")
+		w.Header().Set("x-amz-meta-owner", "me")
+		if rg := r.Header.Get("Range"); rg != "" {
+			if rg != "bytes=4-" {
+				t.Errorf("Range %q", rg)
+			}
+			w.Header().Set("Content-Range", "bytes 4-9/10")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, content[4:])
+			return
+		}
+		io.WriteString(w, content)
+	}))
+	defer srv.Close()
+
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	ctx := context.Background()
+
+	r, err := c.GetObject(ctx, "bucket", "obj", &s3.GetOptions{SSECustomerKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != content || r.Partial() || r.Size != 10 || r.ETag != `"v1"` || r.Metadata["owner"] != "me" || r.LastModified.Year() != 2009 {
+		t.Errorf("GetObject = %+v, %q", r, b)
+	}
+
+	r, err = c.GetObject(ctx, "bucket", "obj", &s3.GetOptions{Range: s3.ByteRange(4, -1), SSECustomerKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "456789" || !r.Partial() || r.Start != 4 || r.End != 9 || r.Size != 10 {
+		t.Errorf("GetObject range = %+v, %q", r, b)
+	}
+
+	if _, err := c.GetObject(ctx, "bucket", "obj", &s3.GetOptions{IfNoneMatch: `"v1"`, SSECustomerKey: key}); err != s3.ErrNotModified {
+		t.Errorf("GetObject If-None-Match = %v", err)
+	}
+}
+
+func TestPutObject(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		want := map[string]string{
+			"Content-Type":                                    "text/plain",
+			"Cache-Control":                                   "max-age=60",
+			"X-Amz-Storage-Class":                             "STANDARD_IA",
+			"X-Amz-Server-Side-Encryption":                    "aws:kms",
+			"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id":     "key-1",
+			"X-Amz-Server-Side-Encryption-Bucket-Key-Enabled": "true",
+			"X-Amz-Meta-Owner":                                "me",
+			"X-Amz-Tagging":                                   "env=prod&team=a+b",
+		}
+		for k, v := range want {
+			if r.Header.Get(k) != v {
+				t.Errorf("%s = %q, want %q", k, r.Header.Get(k), v)
+			}
+		}
+		if r.Method != "PUT" || r.URL.Path != "/bucket/notes.txt" || string(b) != "hello" {
+			t.Errorf("%s %s %q", r.Method, r.URL.Path, b)
+		}
+		w.Header().Set("ETag", `"e1"`)
+	}))
+	defer srv.Close()
+
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	etag, err := c.PutObject(context.Background(), "bucket", "notes.txt", strings.NewReader("hello"), &s3.PutOptions{
+		ContentType:          "text/plain",
+		CacheControl:         "max-age=60",
+		StorageClass:         "STANDARD_IA",
+		ServerSideEncryption: s3.SSEKMS,
+		KMSKeyID:             "key-1",
+		BucketKey:            true,
+		Metadata:             map[string]string{"owner": "me"},
+		Tags:                 map[string]string{"team": "a b", "env": "prod"},
+	})
+	if err != nil || etag != `"e1"` {
+		t.Errorf("PutObject = %q, %v", etag, err)
+	}
+}
+
+func TestCopyObject(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	var copies, aborts int
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		switch {
+		case r.Method == "HEAD":
+			if r.URL.Path != "/src/a b.bin" {
+				t.Errorf("HEAD %s", r.URL.Path)
+			}
+			w.Header().Set("Content-Length", "25")
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Header().Set("ETag", `"src"`)
+			w.Header().Set("x-amz-meta-owner", "me")
+		case r.Method == "POST" && r.URL.RawQuery == "uploads":
+			if r.Header.Get("Content-Type") != "video/mp4" || r.Header.Get("x-amz-meta-owner") != "me" {
+				t.Errorf("CreateMultipartUpload headers %v", r.Header)
+			}
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>up-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == "POST":
+			io.WriteString(w, `<CompleteMultipartUploadResult><ETag>"mp"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == "DELETE":
+			aborts++
+		case r.Header.Get("x-amz-copy-source") != "/src/a%20b.bin" || r.Header.Get("x-amz-copy-source-if-match") != `"src"`:
+			t.Errorf("%s %s copy source %v", r.Method, r.URL, r.Header)
+		case q.Get("uploadId") == "":
+			copies++
+			if r.Header.Get("x-amz-metadata-directive") != "REPLACE" || r.Header.Get("Content-Type") != "text/plain" {
+				t.Errorf("CopyObject headers %v", r.Header)
+			}
+			io.WriteString(w, `<CopyObjectResult><ETag>"copy"</ETag></CopyObjectResult>`)
+		default:
+			rg := r.Header.Get("x-amz-copy-source-range")
+			ranges = append(ranges, q.Get("partNumber")+":"+rg)
+			if fail && rg == "bytes=20-24" {
+				io.WriteString(w, `<Error><Code>InternalError</Code><Message>failed</Message></Error>`)
+				return
+			}
+			io.WriteString(w, `<CopyPartResult><ETag>"p`+q.Get("partNumber")+`"</ETag></CopyPartResult>`)
+		}
+	}))
+	defer srv.Close()
+
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	ctx := context.Background()
+
+	etag, err := c.CopyObject(ctx, "dst", "copy", "src", "a b.bin", &s3.CopyOptions{Put: &s3.PutOptions{ContentType: "text/plain"}})
+	if err != nil || etag != `"copy"` || copies != 1 {
+		t.Fatalf("CopyObject = %q, %v", etag, err)
+	}
+
+	var progress []int64
+	opts := &s3.CopyOptions{
+		MultipartSize: 10,
+		PartSize:      10,
+		Concurrency:   1,
+		OnProgress:    func(copied, total int64) { progress = append(progress, copied, total) },
+	}
+	etag, err = c.CopyObject(ctx, "dst", "copy", "src", "a b.bin", opts)
+	if err != nil || etag != `"mp"` {
+		t.Fatalf("multipart CopyObject = %q, %v", etag, err)
+	}
+	if fmt.Sprint(ranges) != "[1:bytes=0-9 2:bytes=10-19 3:bytes=20-24]" {
+		t.Errorf("ranges %v", ranges)
+	}
+	if fmt.Sprint(progress) != "[10 25 20 25 25 25]" {
+		t.Errorf("progress %v", progress)
+	}
+
+	fail = true
+	if _, err := c.CopyObject(ctx, "dst", "copy", "src", "a b.bin", opts); !s3.IsException(err, "InternalError") || aborts != 1 {
+		t.Errorf("failed CopyObject = %v, %d aborts", err, aborts)
+	}
+}
+
+type writerAt struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+func (w *writerAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n := int(off) + len(p); n > len(w.b) {
+		w.b = append(w.b, make([]byte, n-len(w.b))...)
+	}
+	return copy(w.b[off:], p), nil
+}
+
+func TestDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 10) + "abc"
+	sum := sha256.Sum256([]byte(content))
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	var mu sync.Mutex
+	failures := map[string]int{"bytes=20-29": 1}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failures[r.Header.Get("Range")] > 0
+		failures[r.Header.Get("Range")]--
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Method == "HEAD" && r.Header.Get("x-amz-checksum-mode") == "ENABLED" {
+			w.Header().Set("x-amz-checksum-sha256", checksum)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	ctx := context.Background()
+
+	var w writerAt
+	var progress int64
+	n, err := c.Download(ctx, &w, "bucket", "big", &s3.DownloadOptions{
+		PartSize:   10,
+		OnProgress: func(downloaded, total int64) { progress = downloaded },
+	})
+	if err != nil || n != 103 || string(w.b) != content || progress != 103 {
+		t.Fatalf("Download = %d, %v: %q", n, err, w.b)
+	}
+
+	checksum = base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if _, err := c.Download(ctx, &writerAt{}, "bucket", "big", &s3.DownloadOptions{PartSize: 10}); err != s3.ErrChecksumMismatch {
+		t.Errorf("Download with a bad checksum = %v", err)
+	}
+
+	failures["bytes=0-9"] = 5
+	if _, err := c.Download(ctx, &writerAt{}, "bucket", "big", &s3.DownloadOptions{PartSize: 10, Retries: 1}); err == nil {
+		t.Error("Download succeeded with a failing part")
+	}
+}
+
+func TestRestoreObject(t *testing.T) {
+	restore := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			b, _ := ioutil.ReadAll(r.Body)
+			if r.URL.RawQuery != "restore" || string(b) != `<RestoreRequest><Days>7</Days><GlacierJobParameters><Tier>Bulk</Tier></GlacierJobParameters></RestoreRequest>` {
+				t.Errorf("restore %s %s", r.URL, b)
+			}
+			if restore == "" {
+				restore = `ongoing-request="true"`
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `<Error><Code>RestoreAlreadyInProgress</Code></Error>`)
+		case "HEAD":
+			w.Header().Set("x-amz-storage-class", "DEEP_ARCHIVE")
+			w.Header().Set("x-amz-server-side-encryption", "aws:kms")
+			w.Header().Set("x-amz-server-side-encryption-aws-kms-key-id", "key-1")
+			w.Header().Set("x-amz-meta-owner", "me")
+			w.Header().Set("ETag", `"v1"`)
+			if restore != "" {
+				w.Header().Set("x-amz-restore", restore)
+			}
+		case "PUT":
+			if r.Header.Get("x-amz-copy-source") != "/bucket/old" || r.Header.Get("x-amz-storage-class") != "STANDARD_IA" ||
+				r.Header.Get("x-amz-server-side-encryption-aws-kms-key-id") != "key-1" || r.Header.Get("x-amz-meta-owner") != "me" {
+				t.Errorf("copy headers %v", r.Header)
+			}
+			io.WriteString(w, `<CopyObjectResult><ETag>"v2"</ETag></CopyObjectResult>`)
+		}
+	}))
+	defer srv.Close()
+
+	c := &s3.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if restored, err := c.RestoreObject(ctx, "bucket", "old", 7, s3.TierBulk); err != nil || restored {
+			t.Fatalf("RestoreObject = %v, %v", restored, err)
+		}
+	}
+	r, err := c.HeadObject(ctx, "bucket", "old", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := r.RestoreStatus(); !s.Archived || !s.Ongoing || s.Readable() {
+		t.Errorf("ongoing RestoreStatus = %+v", s)
+	}
+
+	restore = `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`
+	r, _ = c.HeadObject(ctx, "bucket", "old", nil)
+	if s := r.RestoreStatus(); !s.Restored() || !s.Readable() || s.Expiry.Day() != 21 {
+		t.Errorf("RestoreStatus = %+v", s)
+	}
+
+	if err := c.SetStorageClass(ctx, "bucket", "old", "STANDARD_IA"); err != nil {
+		t.Error(err)
+	}
+}
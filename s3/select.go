@@ -0,0 +1,242 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/raff/aws4"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// A SelectInput is a SelectObjectContent request.
+type SelectInput struct {
+	// Expression is an SQL expression, such as
+	// "SELECT s.name FROM S3Object s WHERE s.age > 30".
+	Expression string
+
+	Input  InputSerialization
+	Output OutputSerialization
+
+	// ScanRange, if End is not zero, limits the query to the records
+	// starting within bytes Start to End of uncompressed CSV or JSON Lines
+	// objects.
+	ScanRange struct{ Start, End int64 }
+
+	// Progress, if not nil, is called with the progress of the query as S3
+	// reports it.
+	Progress func(*SelectStats)
+}
+
+// InputSerialization describes the format of the object queried. Exactly one
+// of CSV, JSON and Parquet must be set.
+type InputSerialization struct {
+	CSV     *CSVInput     `xml:",omitempty"`
+	JSON    *JSONInput    `xml:",omitempty"`
+	Parquet *ParquetInput `xml:",omitempty"`
+
+	// CompressionType is NONE, GZIP or BZIP2. If empty, NONE is used.
+	CompressionType string `xml:",omitempty"`
+}
+
+// A CSVInput describes CSV objects.
+type CSVInput struct {
+	// FileHeaderInfo is USE (to refer to columns by name), IGNORE or NONE.
+	FileHeaderInfo             string `xml:",omitempty"`
+	Comments                   string `xml:",omitempty"`
+	QuoteEscapeCharacter       string `xml:",omitempty"`
+	RecordDelimiter            string `xml:",omitempty"`
+	FieldDelimiter             string `xml:",omitempty"`
+	QuoteCharacter             string `xml:",omitempty"`
+	AllowQuotedRecordDelimiter bool   `xml:",omitempty"`
+}
+
+// A JSONInput describes JSON objects.
+type JSONInput struct {
+	// Type is DOCUMENT or LINES.
+	Type string
+}
+
+// A ParquetInput describes Parquet objects.
+type ParquetInput struct{}
+
+// OutputSerialization describes the format of the records returned. Exactly
+// one of CSV and JSON must be set.
+type OutputSerialization struct {
+	CSV  *CSVOutput  `xml:",omitempty"`
+	JSON *JSONOutput `xml:",omitempty"`
+}
+
+// A CSVOutput describes CSV records.
+type CSVOutput struct {
+	// QuoteFields is ALWAYS or ASNEEDED.
+	QuoteFields          string `xml:",omitempty"`
+	QuoteEscapeCharacter string `xml:",omitempty"`
+	RecordDelimiter      string `xml:",omitempty"`
+	FieldDelimiter       string `xml:",omitempty"`
+	QuoteCharacter       string `xml:",omitempty"`
+}
+
+// A JSONOutput describes JSON records.
+type JSONOutput struct {
+	RecordDelimiter string `xml:",omitempty"`
+}
+
+// SelectStats are the statistics of a query.
+type SelectStats struct {
+	BytesScanned   int64
+	BytesProcessed int64
+	BytesReturned  int64
+}
+
+// SelectObjectContent runs the query of in on the object key of bucket and
+// returns a reader of the records it returns, which the caller must close.
+func (c *Client) SelectObjectContent(ctx context.Context, bucket, key string, in *SelectInput) (*SelectReader, error) {
+	req := struct {
+		XMLName             xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ SelectObjectContentRequest"`
+		Expression          string
+		ExpressionType      string
+		RequestProgress     *struct{ Enabled bool } `xml:",omitempty"`
+		InputSerialization  InputSerialization
+		OutputSerialization OutputSerialization
+		ScanRange           *struct{ Start, End int64 } `xml:",omitempty"`
+	}{
+		Expression:          in.Expression,
+		ExpressionType:      "SQL",
+		InputSerialization:  in.Input,
+		OutputSerialization: in.Output,
+	}
+	if in.Progress != nil {
+		req.RequestProgress = &struct{ Enabled bool }{true}
+	}
+	if in.ScanRange.End > 0 {
+		req.ScanRange = &in.ScanRange
+	}
+	body, err := xml.Marshal(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	delim := "\n"
+	switch {
+	case in.Output.CSV != nil && in.Output.CSV.RecordDelimiter != "":
+		delim = in.Output.CSV.RecordDelimiter
+	case in.Output.JSON != nil && in.Output.JSON.RecordDelimiter != "":
+		delim = in.Output.JSON.RecordDelimiter
+	}
+
+	query := url.Values{"select": {""}, "select-type": {"2"}}
+	resp, err := c.do(ctx, "POST", bucket, key, query, http.Header{"Content-Type": {"application/xml"}}, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sr := &SelectReader{body: resp.Body, events: aws4.NewEventReader(resp.Body), progress: in.Progress, delim: []byte(delim)}
+	sr.r = bufio.NewReader(recordsReader{sr})
+	return sr, nil
+}
+
+// A SelectReader reads the records returned by a query. Its Read method
+// returns the records as S3 sends them; ReadRecord returns them one by one.
+//
+// A query that fails after returning records, or a stream that ends early,
+// makes Read and ReadRecord return an error rather than io.EOF, so that
+// partial results can be told from complete ones.
+type SelectReader struct {
+	body     io.ReadCloser
+	events   *aws4.EventReader
+	progress func(*SelectStats)
+	delim    []byte
+
+	r       *bufio.Reader
+	pending []byte
+	stats   *SelectStats
+	err     error
+}
+
+// Read implements io.Reader.
+func (r *SelectReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// ReadRecord returns the next record, without its delimiter.
+func (r *SelectReader) ReadRecord() ([]byte, error) {
+	last := r.delim[len(r.delim)-1]
+	var rec []byte
+	for {
+		line, err := r.r.ReadSlice(last)
+		rec = append(rec, line...)
+		switch {
+		case err == bufio.ErrBufferFull:
+		case err == io.EOF && len(rec) > 0:
+			return rec, nil
+		case err != nil:
+			return nil, err
+		case bytes.HasSuffix(rec, r.delim):
+			return rec[:len(rec)-len(r.delim)], nil
+		}
+	}
+}
+
+// Stats returns the statistics of the query once all its records were read,
+// or nil.
+func (r *SelectReader) Stats() *SelectStats {
+	return r.stats
+}
+
+// Close closes the response.
+func (r *SelectReader) Close() error {
+	return r.body.Close()
+}
+
+// recordsReader reads the payloads of the Records events of a query.
+type recordsReader struct {
+	*SelectReader
+}
+
+func (rr recordsReader) Read(p []byte) (int, error) {
+	r := rr.SelectReader
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next reads the next event of the stream.
+func (r *SelectReader) next() error {
+	m, err := r.events.ReadMessage()
+	if err == io.EOF {
+		return errors.New("s3: select stream ended without an End event")
+	}
+	if err != nil {
+		return err
+	}
+	if m.Headers.String(":message-type") == "error" {
+		return &Error{Code: m.Headers.String(":error-code"), Message: m.Headers.String(":error-message")}
+	}
+
+	switch m.Headers.String(":event-type") {
+	case "Records":
+		r.pending = m.Payload
+	case "Stats":
+		r.stats = new(SelectStats)
+		if err := xml.Unmarshal(m.Payload, r.stats); err != nil {
+			return err
+		}
+	case "Progress":
+		var s SelectStats
+		if r.progress != nil && xml.Unmarshal(m.Payload, &s) == nil {
+			r.progress(&s)
+		}
+	case "End":
+		return io.EOF
+	}
+	return nil
+}
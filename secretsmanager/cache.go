@@ -0,0 +1,140 @@
+package secretsmanager
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a Cache serves a secret before checking it
+// again by default.
+const DefaultCacheTTL = time.Hour
+
+// A Cache keeps secrets in memory for services that read them on every
+// request, such as database passwords.
+//
+// Secrets are cached by ID and version stage. When an entry expires the
+// Cache asks DescribeSecret which version the stage points to, and only
+// fetches the value again if the version changed, as it does after a
+// rotation. If the check fails the old value keeps being served until the
+// next TTL, so that a Secrets Manager outage doesn't take the service down
+// with it; only a secret that was never read returns the error.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	// Client reads the secrets.
+	Client *Client
+
+	// TTL is how often a secret is checked. If zero, DefaultCacheTTL is
+	// used.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	id    string
+	stage string
+}
+
+type cacheEntry struct {
+	mu      sync.Mutex // held while refreshing
+	value   *SecretValue
+	expires time.Time
+}
+
+// Get returns the version of the secret id in stage, or Current if stage is
+// empty.
+func (c *Cache) Get(ctx context.Context, id, stage string) (*SecretValue, error) {
+	if stage == "" {
+		stage = Current
+	}
+	k := cacheKey{id, stage}
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]*cacheEntry)
+	}
+	e := c.entries[k]
+	if e == nil {
+		e = new(cacheEntry)
+		c.entries[k] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.value != nil && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+	v, err := c.refresh(ctx, k, e.value)
+	if err != nil && e.value == nil {
+		return nil, err
+	}
+	if err == nil {
+		e.value = v
+	}
+	e.expires = time.Now().Add(c.ttl())
+	return e.value, nil
+}
+
+// String returns the SecretString of the Current version of id.
+func (c *Cache) String(ctx context.Context, id string) (string, error) {
+	v, err := c.Get(ctx, id, "")
+	if err != nil {
+		return "", err
+	}
+	return v.SecretString, nil
+}
+
+// Put calls PutSecretValue, and drops the secret from the cache.
+func (c *Cache) Put(ctx context.Context, in *PutSecretInput) (string, error) {
+	v, err := c.Client.PutSecretValue(ctx, in)
+	c.Invalidate(in.SecretId)
+	return v, err
+}
+
+// Invalidate drops all the cached versions of the secrets ids, so that they
+// are read again on the next Get.
+func (c *Cache) Invalidate(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		for _, id := range ids {
+			if k.id == id {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
+
+func (c *Cache) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return DefaultCacheTTL
+	}
+	return c.TTL
+}
+
+// refresh returns the current value of k, reusing old if its version is
+// still the one of the stage.
+func (c *Cache) refresh(ctx context.Context, k cacheKey, old *SecretValue) (*SecretValue, error) {
+	if old == nil {
+		return c.Client.GetSecretValue(ctx, k.id, k.stage)
+	}
+	stages, err := c.Client.VersionStages(ctx, k.id)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := stages[k.stage]
+	if ok && version == old.VersionId {
+		return old, nil
+	}
+	if !ok {
+		// The stage was removed, as AWSPENDING is at the end of a rotation.
+		return c.Client.GetSecretValue(ctx, k.id, k.stage)
+	}
+	return c.Client.GetSecretVersion(ctx, k.id, version)
+}
@@ -0,0 +1,154 @@
+// Package secretsmanager reads and writes AWS Secrets Manager secrets,
+// signing requests with github.com/raff/aws4.
+package secretsmanager
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// Version stages maintained by Secrets Manager and rotation.
+const (
+	Current  = "AWSCURRENT"
+	Pending  = "AWSPENDING"
+	Previous = "AWSPREVIOUS"
+)
+
+// A Client sends requests to Secrets Manager.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the Secrets Manager endpoint of Region is used.
+	URL string
+}
+
+// An Error is an error reported by Secrets Manager.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name, such as
+// "ResourceNotFoundException".
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+// A SecretValue is a version of a secret. Exactly one of SecretString and
+// SecretBinary is set.
+type SecretValue struct {
+	ARN           string
+	Name          string
+	VersionId     string
+	VersionStages []string
+	SecretString  string
+	SecretBinary  []byte
+	CreatedDate   time.Time
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "secretsmanager",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "secretsmanager",
+		Version: "1.1",
+	}
+	return jc.Do(ctx, action, in, out)
+}
+
+// GetSecretValue returns the version of the secret id in stage. If stage is
+// empty, Current is used.
+func (c *Client) GetSecretValue(ctx context.Context, id, stage string) (*SecretValue, error) {
+	req := struct {
+		SecretId     string
+		VersionStage string `json:",omitempty"`
+	}{id, stage}
+	var resp struct {
+		SecretValue
+		CreatedDate float64
+	}
+	if err := c.do(ctx, "GetSecretValue", &req, &resp); err != nil {
+		return nil, err
+	}
+	v := resp.SecretValue
+	v.CreatedDate = time.Unix(0, int64(resp.CreatedDate*1e9)).UTC()
+	return &v, nil
+}
+
+// GetSecretVersion returns the version versionId of the secret id.
+func (c *Client) GetSecretVersion(ctx context.Context, id, versionId string) (*SecretValue, error) {
+	req := struct {
+		SecretId  string
+		VersionId string
+	}{id, versionId}
+	var resp struct {
+		SecretValue
+		CreatedDate float64
+	}
+	if err := c.do(ctx, "GetSecretValue", &req, &resp); err != nil {
+		return nil, err
+	}
+	v := resp.SecretValue
+	v.CreatedDate = time.Unix(0, int64(resp.CreatedDate*1e9)).UTC()
+	return &v, nil
+}
+
+// PutSecretInput is the input of PutSecretValue.
+type PutSecretInput struct {
+	SecretId string
+
+	// Exactly one of SecretString and SecretBinary must be set.
+	SecretString string `json:",omitempty"`
+	SecretBinary []byte `json:",omitempty"`
+
+	// ClientRequestToken makes the request idempotent, and becomes the
+	// version ID. If empty, a new token is generated.
+	ClientRequestToken string
+
+	// If empty, the new version is made Current.
+	VersionStages []string `json:",omitempty"`
+}
+
+// PutSecretValue stores a new version of a secret, and returns its version
+// ID.
+func (c *Client) PutSecretValue(ctx context.Context, in *PutSecretInput) (string, error) {
+	req := *in
+	if req.ClientRequestToken == "" {
+		req.ClientRequestToken = awsjson.NewToken()
+	}
+	var resp struct{ VersionId string }
+	if err := c.do(ctx, "PutSecretValue", &req, &resp); err != nil {
+		return "", err
+	}
+	return resp.VersionId, nil
+}
+
+// VersionStages returns the version IDs of the secret id by stage, as
+// reported by DescribeSecret. It is a cheaper way than GetSecretValue to
+// find out if a secret changed.
+func (c *Client) VersionStages(ctx context.Context, id string) (map[string]string, error) {
+	var resp struct {
+		VersionIdsToStages map[string][]string
+	}
+	if err := c.do(ctx, "DescribeSecret", map[string]string{"SecretId": id}, &resp); err != nil {
+		return nil, err
+	}
+	stages := make(map[string]string)
+	for v, ss := range resp.VersionIdsToStages {
+		for _, s := range ss {
+			stages[s] = v
+		}
+	}
+	return stages, nil
+}
@@ -0,0 +1,92 @@
+package secretsmanager_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/secretsmanager"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSecrets holds one secret, whose current version can be rotated.
+type fakeSecrets struct {
+	mu      sync.Mutex
+	version int
+	calls   map[string]int
+	fail    bool
+}
+
+func (f *fakeSecrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	action := r.Header.Get("X-Amz-Target")
+	f.calls[action]++
+	if f.fail {
+		w.WriteHeader(500)
+		w.Write([]byte(`{"__type":"InternalServiceError"}`))
+		return
+	}
+	var req struct{ VersionId, SecretString, ClientRequestToken string }
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch action {
+	case "secretsmanager.GetSecretValue":
+		v := f.version
+		if req.VersionId != "" {
+			fmt.Sscanf(req.VersionId, "v%d", &v)
+		}
+		fmt.Fprintf(w, `{"Name":"db","VersionId":"v%d","SecretString":"pw%d","VersionStages":["AWSCURRENT"],"CreatedDate":1.5E9}`, v, v)
+	case "secretsmanager.DescribeSecret":
+		fmt.Fprintf(w, `{"VersionIdsToStages":{"v%d":["AWSCURRENT"]}}`, f.version)
+	case "secretsmanager.PutSecretValue":
+		if req.ClientRequestToken == "" {
+			w.WriteHeader(400)
+			return
+		}
+		f.version++
+		fmt.Fprintf(w, `{"VersionId":"v%d"}`, f.version)
+	}
+}
+
+func TestCache(t *testing.T) {
+	f := &fakeSecrets{version: 1, calls: map[string]int{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	client := &secretsmanager.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+	cache := &secretsmanager.Cache{Client: client, TTL: time.Millisecond}
+	ctx := context.Background()
+
+	if s, err := cache.String(ctx, "db"); s != "pw1" || err != nil {
+		t.Fatalf("String = %q, %v", s, err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if s, _ := cache.String(ctx, "db"); s != "pw1" || f.calls["secretsmanager.GetSecretValue"] != 1 {
+		t.Errorf("unchanged secret fetched again: %q, %v", s, f.calls)
+	}
+
+	// Rotate behind the cache's back.
+	if _, err := client.PutSecretValue(ctx, &secretsmanager.PutSecretInput{SecretId: "db", SecretString: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if s, _ := cache.String(ctx, "db"); s != "pw2" {
+		t.Errorf("after rotation got %q", s)
+	}
+
+	f.mu.Lock()
+	f.fail = true
+	f.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	if s, err := cache.String(ctx, "db"); s != "pw2" || err != nil {
+		t.Errorf("during an outage got %q, %v", s, err)
+	}
+	if _, err := cache.String(ctx, "other"); err == nil {
+		t.Error("expected an error for an uncached secret")
+	}
+}
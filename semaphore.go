@@ -0,0 +1,77 @@
+package aws4
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout is returned when a request waited longer than its queue
+// timeout for a Semaphore slot.
+var ErrQueueTimeout = errors.New("aws4: timed out waiting for a request slot")
+
+// A Semaphore bounds the number of requests in flight.
+type Semaphore chan struct{}
+
+// NewSemaphore returns a Semaphore with n slots.
+func NewSemaphore(n int) Semaphore {
+	return make(Semaphore, n)
+}
+
+// Acquire waits for a free slot until ctx is done or, if timeout is not
+// zero, until timeout has passed. A nil Semaphore never waits.
+func (s Semaphore) Acquire(ctx context.Context, timeout time.Duration) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	default:
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-expired:
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (s Semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// ReleaseOnClose returns rc, changed to release a slot of s when it is first
+// closed, so that a request holds its slot until its response is read.
+func (s Semaphore) ReleaseOnClose(rc io.ReadCloser) io.ReadCloser {
+	if s == nil {
+		return rc
+	}
+	return &releaseCloser{ReadCloser: rc, release: s.Release}
+}
+
+type releaseCloser struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,224 @@
+// Package ses sends email with the Amazon SES v2 API, signing requests with
+// github.com/raff/aws4.
+package ses
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// A Client sends requests to SES.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the SES endpoint of Region is used.
+	URL string
+
+	// ConfigurationSet, if not empty, is the configuration set of the
+	// messages sent.
+	ConfigurationSet string
+}
+
+// An Error is an error reported by SES, such as MessageRejected,
+// MailFromDomainNotVerifiedException, SendingPausedException or
+// AccountSuspendedException.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ses: %d - %s - %q", e.StatusCode, e.Code, e.Message)
+}
+
+// IsException returns true if err is an *Error with code name.
+func IsException(err error, name string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == name
+}
+
+// IsSuppressed returns true if SES rejected a message because a recipient
+// is on the account-level suppression list.
+func IsSuppressed(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "MessageRejected" && strings.Contains(strings.ToLower(e.Message), "suppression list")
+}
+
+// A Message is a simple email message, which SES assembles into MIME.
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo []string
+	Subject string
+
+	// At least one of Text and HTML must be set.
+	Text string
+	HTML string
+}
+
+type content struct {
+	Data    string
+	Charset string `json:",omitempty"`
+}
+
+type destination struct {
+	ToAddresses  []string `json:",omitempty"`
+	CcAddresses  []string `json:",omitempty"`
+	BccAddresses []string `json:",omitempty"`
+}
+
+// SendEmail sends m and returns its message ID.
+func (c *Client) SendEmail(ctx context.Context, m *Message) (string, error) {
+	type body struct {
+		Text *content `json:",omitempty"`
+		Html *content `json:",omitempty"`
+	}
+	simple := struct {
+		Subject content
+		Body    body
+	}{Subject: content{m.Subject, "UTF-8"}}
+	if m.Text != "" {
+		simple.Body.Text = &content{m.Text, "UTF-8"}
+	}
+	if m.HTML != "" {
+		simple.Body.Html = &content{m.HTML, "UTF-8"}
+	}
+
+	req := map[string]interface{}{
+		"FromEmailAddress": m.From,
+		"Destination":      destination{m.To, m.Cc, m.Bcc},
+		"Content":          map[string]interface{}{"Simple": simple},
+	}
+	if len(m.ReplyTo) > 0 {
+		req["ReplyToAddresses"] = m.ReplyTo
+	}
+	return c.send(ctx, req)
+}
+
+// SendRawEmail sends a complete MIME message, such as one with attachments,
+// and returns its message ID. The recipients are taken from the message
+// headers unless to is not empty.
+func (c *Client) SendRawEmail(ctx context.Context, raw []byte, to ...string) (string, error) {
+	req := map[string]interface{}{
+		"Content": map[string]interface{}{"Raw": map[string][]byte{"Data": raw}},
+	}
+	if len(to) > 0 {
+		req["Destination"] = destination{ToAddresses: to}
+	}
+	return c.send(ctx, req)
+}
+
+func (c *Client) send(ctx context.Context, req map[string]interface{}) (string, error) {
+	if c.ConfigurationSet != "" {
+		req["ConfigurationSetName"] = c.ConfigurationSet
+	}
+	var resp struct{ MessageId string }
+	if err := c.do(ctx, "POST", "/v2/email/outbound-emails", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.MessageId, nil
+}
+
+// A SuppressedDestination is an address on the account-level suppression
+// list.
+type SuppressedDestination struct {
+	EmailAddress   string
+	Reason         string // BOUNCE or COMPLAINT
+	LastUpdateTime time.Time
+}
+
+// GetSuppressedDestination returns the suppression list entry of address,
+// or nil if it isn't suppressed.
+func (c *Client) GetSuppressedDestination(ctx context.Context, address string) (*SuppressedDestination, error) {
+	var resp struct {
+		SuppressedDestination struct {
+			EmailAddress   string
+			Reason         string
+			LastUpdateTime float64
+		}
+	}
+	err := c.do(ctx, "GET", "/v2/email/suppression/addresses/"+url.PathEscape(address), nil, &resp)
+	if IsException(err, "NotFoundException") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := resp.SuppressedDestination
+	return &SuppressedDestination{
+		EmailAddress:   d.EmailAddress,
+		Reason:         d.Reason,
+		LastUpdateTime: time.Unix(int64(d.LastUpdateTime), 0).UTC(),
+	}, nil
+}
+
+// DeleteSuppressedDestination removes address from the suppression list.
+func (c *Client) DeleteSuppressedDestination(ctx context.Context, address string) error {
+	return c.do(ctx, "DELETE", "/v2/email/suppression/addresses/"+url.PathEscape(address), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	u := c.URL
+	if u == "" {
+		u = "https://email." + region + ".amazonaws.com"
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(method, strings.TrimSuffix(u, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	if in != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	cl := c.Client
+	if cl == nil {
+		cl = aws4.DefaultClient
+	}
+	resp, err := cl.DoService("ses", region, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		e := aws4.ParseError(resp)
+		return &Error{resp.StatusCode, e.Code, e.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
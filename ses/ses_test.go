@@ -0,0 +1,74 @@
+package ses_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/ses"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendEmail(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"MessageId":"m-1"}`))
+	}))
+	defer srv.Close()
+	c := &ses.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, ConfigurationSet: "cs"}
+
+	id, err := c.SendEmail(context.Background(), &ses.Message{
+		From:    "a@example.com",
+		To:      []string{"b@example.com"},
+		Subject: "hi",
+		Text:    "hello",
+	})
+	if err != nil || id != "m-1" {
+		t.Fatalf("SendEmail = %q, %v", id, err)
+	}
+	simple := got["Content"].(map[string]interface{})["Simple"].(map[string]interface{})
+	body := simple["Body"].(map[string]interface{})
+	if body["Html"] != nil || body["Text"].(map[string]interface{})["Data"] != "hello" || got["ConfigurationSetName"] != "cs" {
+		t.Errorf("request %v", got)
+	}
+
+	if _, err := c.SendRawEmail(context.Background(), []byte("Subject: hi\r\n\r\nhello")); err != nil {
+		t.Fatal(err)
+	}
+	raw := got["Content"].(map[string]interface{})["Raw"].(map[string]interface{})["Data"].(string)
+	if b, _ := base64.StdEncoding.DecodeString(raw); string(b) != "Subject: hi\r\n\r\nhello" {
+		t.Errorf("raw data %q", raw)
+	}
+}
+
+func TestSuppressed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.Header().Set("X-Amzn-ErrorType", "MessageRejected:http://internal.amazon.com/coral/com.amazonaws.sesv2/")
+			w.WriteHeader(400)
+			w.Write([]byte(`{"message":"Email address is on the suppression list for your account."}`))
+		case "GET":
+			w.Header().Set("X-Amzn-ErrorType", "NotFoundException")
+			w.WriteHeader(404)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	defer srv.Close()
+	c := &ses.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	_, err := c.SendEmail(context.Background(), &ses.Message{From: "a@example.com", To: []string{"b@example.com"}, Text: "x"})
+	if !ses.IsSuppressed(err) {
+		t.Fatalf("expected a suppression error, got %v", err)
+	}
+	d, err := c.GetSuppressedDestination(context.Background(), "b@example.com")
+	if d != nil || err != nil {
+		t.Errorf("GetSuppressedDestination = %v, %v", d, err)
+	}
+}
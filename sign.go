@@ -6,15 +6,17 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	//"path/filepath"
 	filepath "path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,16 +29,52 @@ var lf = []byte{'\n'}
 type Keys struct {
 	AccessKey string
 	SecretKey string
+
+	// SessionToken is the token of temporary credentials, such as the ones
+	// of an IAM role. If not empty, it is sent as X-Amz-Security-Token.
+	SessionToken string
 }
 
+// sign returns the signing key of k for s on the day of t. Signing keys are
+// cached, since deriving one takes four HMACs.
 func (k *Keys) sign(s *Service, t time.Time) []byte {
-	h := ghmac([]byte("AWS4"+k.SecretKey), []byte(t.Format(iSO8601BasicFormatShort)))
+	y, m, d := t.Date()
+	ck := signingKeyID{k.SecretKey, s.Region, s.Name, y*10000 + int(m)*100 + d}
+	signingKeys.Lock()
+	h, ok := signingKeys.m[ck]
+	signingKeys.Unlock()
+	if ok {
+		return h
+	}
+
+	h = ghmac([]byte("AWS4"+k.SecretKey), []byte(t.Format(iSO8601BasicFormatShort)))
 	h = ghmac(h, []byte(s.Region))
 	h = ghmac(h, []byte(s.Name))
 	h = ghmac(h, []byte("aws4_request"))
+
+	signingKeys.Lock()
+	// Keys of past days, or of many rotated secrets, are dropped all at
+	// once rather than tracked individually.
+	if signingKeys.m == nil || len(signingKeys.m) >= maxSigningKeys {
+		signingKeys.m = make(map[signingKeyID][]byte)
+	}
+	signingKeys.m[ck] = h
+	signingKeys.Unlock()
 	return h
 }
 
+const maxSigningKeys = 256
+
+type signingKeyID struct {
+	secret, region, service string
+	day                     int
+}
+
+var signingKeys struct {
+	sync.Mutex
+	m map[signingKeyID][]byte
+}
+
 // Service represents an AWS-compatible service.
 type Service struct {
 	// Name is the name of the service being used (i.e. iam, etc)
@@ -44,167 +82,581 @@ type Service struct {
 
 	// Region is the region you want to communicate with the service through. (i.e. us-east-1)
 	Region string
+
+	// SignedHeaders, if not empty, lists the only headers that are signed
+	// besides Host, Date, Content-Type and X-Amz-*, which are always
+	// signed. Other headers are sent unsigned and may be changed in transit.
+	SignedHeaders []string
+
+	// UnsignedHeaders lists headers that are never signed, such as headers
+	// added or rewritten by proxies after signing. It cannot exclude the
+	// headers that are always signed. Authorization is never signed.
+	UnsignedHeaders []string
+
+	// VerbatimHeaders lists headers whose values are signed as they are,
+	// for services that sign them without collapsing spaces. The values of
+	// other headers are trimmed and their sequential spaces reduced to one,
+	// as SigV4 prescribes.
+	VerbatimHeaders []string
+
+	// DisableURIPathEscaping signs the request path exactly as it is sent,
+	// as S3 requires, so that object keys containing "//" or "./" sign
+	// correctly. Other services sign the path normalized and encoded twice.
+	DisableURIPathEscaping bool
+
+	// UnsignedPayload signs requests without hashing their body, which is
+	// then never read. X-Amz-Content-Sha256 is set to UNSIGNED-PAYLOAD, as
+	// services that allow it (such as S3) require.
+	UnsignedPayload bool
+
+	// StreamingTrailer sends the body in aws-chunked encoding, hashed as it
+	// is sent, with its SHA-256 as an x-amz-checksum-sha256 trailer rather
+	// than signed, so that it is read once and still verified. The
+	// ContentLength of the request must be known. It takes precedence over
+	// UnsignedPayload, and only S3 supports it.
+	StreamingTrailer bool
+
+	// ContentSha256Header sends the payload hash as X-Amz-Content-Sha256,
+	// which S3 and Glacier require.
+	ContentSha256Header bool
+
+	// KeepDefaultPort signs and sends the host with a default port (":443"
+	// for HTTPS, ":80" for HTTP) as it is. Otherwise the port is removed.
+	KeepDefaultPort bool
+
+	// OnSign, if not nil, is called with every request signed or presigned,
+	// such as to keep an AuditLog.
+	OnSign func(*SignEvent)
+}
+
+// ProxyHeaders are hop-by-hop headers and headers commonly added by proxies,
+// suitable for Service.UnsignedHeaders.
+var ProxyHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Via",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+	"X-Forwarded-Proto",
+	"Forwarded",
 }
 
-// SignService signs a request with the specified name and region
+// SignService signs a request with the specified name and region, applying
+// the Profile registered for the service.
 func SignService(name, region string, keys *Keys, r *http.Request) error {
-	sv := &Service{Name: name, Region: region}
-	return sv.Sign(keys, r)
+	return ProfileFor(name).Service(name, region).Sign(keys, r)
+}
+
+// SignRequest signs r for service in region with keys, for sending it with
+// any http.Client. It sets X-Amz-Date to the current time unless r has it or
+// a Date header, adds X-Amz-Security-Token for temporary credentials, and
+// sets X-Amz-Content-Sha256 to the hash of the body (reading and replacing
+// it) unless r has it, as S3 requires.
+func SignRequest(r *http.Request, keys *Keys, service, region string) error {
+	if r.Header.Get("X-Amz-Date") == "" && r.Header.Get("Date") == "" {
+		r.Header.Set("X-Amz-Date", time.Now().UTC().Format(iSO8601BasicFormat))
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") == "" {
+		ph, err := payloadHash(r)
+		if err != nil {
+			return err
+		}
+		r.Header.Set("X-Amz-Content-Sha256", ph)
+	}
+	return SignService(service, region, keys, r)
 }
 
-// Sign signs a request with a Service derived from r.Host
+// Sign signs a request with a Service derived from r.Host by EndpointInfo.
 func Sign(keys *Keys, r *http.Request) error {
-	parts := strings.Split(r.Host, ".")
-	if len(parts) < 4 {
-		return fmt.Errorf("Invalid AWS Endpoint: %s", r.Host)
+	e, err := EndpointInfo(r.Host)
+	if err != nil {
+		return err
 	}
 
-	return SignService(parts[0], parts[1], keys, r)
+	return SignService(e.Service, e.Region, keys, r)
 }
 
 // Sign signs an HTTP request with the given AWS keys for use on service s.
+//
+// The signing time is taken from the X-Amz-Date header, if set, or else from
+// the Date header, which is rewritten in the format AWS expects. Without
+// either the current time is used.
 func (s *Service) Sign(keys *Keys, r *http.Request) error {
-	date := r.Header.Get("Date")
 	t := time.Now().UTC()
-	if date != "" {
+	if xdate := r.Header.Get("X-Amz-Date"); xdate != "" {
 		var err error
-		t, err = time.Parse(http.TimeFormat, date)
+		t, err = time.Parse(iSO8601BasicFormat, xdate)
+		if err != nil {
+			return err
+		}
+	} else {
+		if date := r.Header.Get("Date"); date != "" {
+			var err error
+			t, err = time.Parse(http.TimeFormat, date)
+			if err != nil {
+				return err
+			}
+		}
+		r.Header.Set("Date", t.Format(iSO8601BasicFormat))
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	if !s.KeepDefaultPort {
+		r.Host = stripDefaultPort(r.URL.Scheme, r.Host)
+	}
+	r.Header.Set("host", r.Host)
+	if keys.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", keys.SessionToken)
+	}
+	if s.StreamingTrailer && !hasEmptyBody(r) {
+		if err := streamBody(r); err != nil {
+			return err
+		}
+	} else if s.UnsignedPayload {
+		r.Header.Set("X-Amz-Content-Sha256", UnsignedPayload)
+	} else if s.ContentSha256Header && r.Header.Get("X-Amz-Content-Sha256") == "" {
+		ph, err := payloadHash(r)
 		if err != nil {
 			return err
 		}
+		r.Header.Set("X-Amz-Content-Sha256", ph)
 	}
-	r.Header.Set("Date", t.Format(iSO8601BasicFormat))
+	hs := s.headersToSign(r)
 
 	k := keys.sign(s, t)
 	h := hmac.New(sha256.New, k)
-	s.writeStringToSign(h, t, r)
+	crh, err := s.writeStringToSign(h, t, r, hs)
+	if err != nil {
+		return err
+	}
+
+	var sum [sha256.Size]byte
+	var sig [2 * sha256.Size]byte
+	hex.Encode(sig[:], h.Sum(sum[:0]))
 
-	auth := bytes.NewBufferString("AWS4-HMAC-SHA256 ")
-	auth.Write([]byte("Credential=" + keys.AccessKey + "/" + s.creds(t)))
-	auth.Write([]byte{',', ' '})
-	auth.Write([]byte("SignedHeaders="))
-	s.writeHeaderList(auth, r)
-	auth.Write([]byte{',', ' '})
-	auth.Write([]byte("Signature=" + fmt.Sprintf("%x", h.Sum(nil))))
+	var auth strings.Builder
+	auth.Grow(200)
+	auth.WriteString("AWS4-HMAC-SHA256 Credential=")
+	auth.WriteString(keys.AccessKey)
+	auth.WriteByte('/')
+	s.writeCreds(&auth, t)
+	auth.WriteString(", SignedHeaders=")
+	s.writeHeaderList(&auth, hs)
+	auth.WriteString(", Signature=")
+	auth.Write(sig[:])
 
-	r.Header.Set("Authorization", auth.String())
+	r.Header["Authorization"] = []string{auth.String()}
+	if s.OnSign != nil {
+		s.OnSign(s.signEvent(keys, t, r, hs, crh, false))
+	}
 
 	return nil
 }
 
+func stripDefaultPort(scheme, host string) string {
+	switch {
+	case scheme == "https" && strings.HasSuffix(host, ":443"):
+		return strings.TrimSuffix(host, ":443")
+	case scheme == "http" && strings.HasSuffix(host, ":80"):
+		return strings.TrimSuffix(host, ":80")
+	}
+	return host
+}
+
+// writeQuery writes the canonical query string: every parameter, including
+// duplicates and ones without a value, URI-encoded as "key=value" and sorted
+// by key, then by value.
 func (s *Service) writeQuery(w io.Writer, r *http.Request) {
-	var a []string
+	if r.URL.RawQuery == "" {
+		return
+	}
+	type param struct{ k, v string }
+	var a []param
 	for k, vs := range r.URL.Query() {
-		k = url.QueryEscape(k)
+		k = uriEncode(k, true)
 		for _, v := range vs {
-			if v == "" {
-				a = append(a, k)
-			} else {
-				v = url.QueryEscape(v)
-				a = append(a, k+"="+v)
-			}
+			a = append(a, param{k, uriEncode(v, true)})
 		}
 	}
-	sort.Strings(a)
-	for i, s := range a {
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].k != a[j].k {
+			return a[i].k < a[j].k
+		}
+		return a[i].v < a[j].v
+	})
+	for i, p := range a {
 		if i > 0 {
 			w.Write([]byte{'&'})
 		}
-		w.Write([]byte(s))
+		io.WriteString(w, p.k+"="+p.v)
 	}
 }
 
-func (s *Service) writeHeader(w io.Writer, r *http.Request) {
-	i, a := 0, make([]string, len(r.Header))
-	for k, v := range r.Header {
-		sort.Strings(v)
-		a[i] = strings.ToLower(k) + ":" + strings.Join(v, ",")
-		i++
+// headersToSign returns the sorted, lower-case names of the headers of r
+// that are signed.
+func (s *Service) headersToSign(r *http.Request) []string {
+	a := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		k = lower(k)
+		if s.signsHeader(k) && !contains(a, k) {
+			a = append(a, k)
+		}
 	}
 	sort.Strings(a)
-	for i, s := range a {
+	return a
+}
+
+// lower is strings.ToLower for header names, without allocating for the
+// common ones.
+func lower(k string) string {
+	switch k {
+	case "Host", "host":
+		return "host"
+	case "Content-Type":
+		return "content-type"
+	case "Date":
+		return "date"
+	case "X-Amz-Date":
+		return "x-amz-date"
+	case "X-Amz-Target":
+		return "x-amz-target"
+	case "X-Amz-Content-Sha256":
+		return "x-amz-content-sha256"
+	case "X-Amz-Security-Token":
+		return "x-amz-security-token"
+	case "Authorization":
+		return "authorization"
+	case "Accept-Encoding":
+		return "accept-encoding"
+	case "User-Agent":
+		return "user-agent"
+	}
+	return strings.ToLower(k)
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) signsHeader(h string) bool {
+	switch {
+	case h == "authorization":
+		return false
+	case h == "host", h == "date", h == "content-type", strings.HasPrefix(h, "x-amz-"):
+		return true
+	}
+	for _, u := range s.UnsignedHeaders {
+		if strings.EqualFold(u, h) {
+			return false
+		}
+	}
+	if len(s.SignedHeaders) == 0 {
+		return true
+	}
+	for _, sh := range s.SignedHeaders {
+		if strings.EqualFold(sh, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeHeader writes the canonical headers hs: each value trimmed, with
+// sequential spaces reduced to one unless the header is in VerbatimHeaders,
+// and the values of a header joined with commas in the order they were
+// added.
+func (s *Service) writeHeader(w io.Writer, r *http.Request, hs []string) {
+	// Headers are usually only known by their canonical name, which is
+	// looked up directly. Otherwise the values of all the names of a
+	// header are joined, in the order of the names.
+	canonical := true
+	for k := range r.Header {
+		if http.CanonicalHeaderKey(k) != k {
+			canonical = false
+			break
+		}
+	}
+	var keys []string
+	if !canonical {
+		keys = make([]string, 0, len(r.Header))
+		for k := range r.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	for i, k := range hs {
 		if i > 0 {
 			w.Write(lf)
 		}
-		io.WriteString(w, s)
+		io.WriteString(w, k)
+		w.Write([]byte{':'})
+		verbatim := s.isVerbatim(k)
+		n := 0
+		write := func(vs []string) {
+			for _, v := range vs {
+				if n > 0 {
+					w.Write([]byte{','})
+				}
+				n++
+				if verbatim {
+					io.WriteString(w, v)
+				} else {
+					writeTrimmed(w, v)
+				}
+			}
+		}
+		if canonical {
+			write(r.Header[http.CanonicalHeaderKey(k)])
+			continue
+		}
+		for _, hk := range keys {
+			if strings.EqualFold(hk, k) {
+				write(r.Header[hk])
+			}
+		}
 	}
 }
 
-func (s *Service) writeHeaderList(w io.Writer, r *http.Request) {
-	i, a := 0, make([]string, len(r.Header))
-	for k, _ := range r.Header {
-		a[i] = strings.ToLower(k)
-		i++
+// writeTrimmed writes v trimmed, with sequential spaces reduced to one.
+func writeTrimmed(w io.Writer, v string) {
+	clean := len(v) == 0 || v[0] != ' ' && v[len(v)-1] != ' '
+	for i := 0; clean && i < len(v); i++ {
+		switch v[i] {
+		case '\t', '\n', '\r', '\v', '\f':
+			clean = false
+		case ' ':
+			clean = v[i+1] != ' '
+		}
 	}
-	sort.Strings(a)
-	for i, s := range a {
+	if !clean {
+		v = strings.Join(strings.Fields(v), " ")
+	}
+	io.WriteString(w, v)
+}
+
+func (s *Service) isVerbatim(h string) bool {
+	for _, v := range s.VerbatimHeaders {
+		if strings.EqualFold(v, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) writeHeaderList(w io.Writer, hs []string) {
+	for i, h := range hs {
 		if i > 0 {
-			w.Write([]byte{';'})
+			io.WriteString(w, ";")
 		}
-		w.Write([]byte(s))
+		io.WriteString(w, h)
+	}
+}
+
+// EmptyPayloadHash is the hex SHA-256 hash of an empty payload.
+const EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// UnsignedPayload is sent in place of the payload hash when
+// Service.UnsignedPayload is set.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// hasEmptyBody reports whether r is known to have no body, so that it needn't
+// be read to be hashed. GET, HEAD, DELETE and OPTIONS requests are assumed to
+// be empty unless their ContentLength says otherwise, so a non-nil body of
+// unknown length is never consumed.
+func hasEmptyBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return true
 	}
+	switch r.Method {
+	case "GET", "HEAD", "DELETE", "OPTIONS":
+		return r.ContentLength <= 0
+	}
+	return false
 }
 
-func (s *Service) writeBody(w io.Writer, r *http.Request) {
+// writeBody writes the payload hash: UNSIGNED-PAYLOAD if s.UnsignedPayload,
+// else the X-Amz-Content-Sha256 header if set, else the hash of the body.
+// Streamed bodies are always signed as such.
+func (s *Service) writeBody(w io.Writer, r *http.Request) error {
+	if r.Header.Get("X-Amz-Content-Sha256") == StreamingUnsignedPayloadTrailer {
+		io.WriteString(w, StreamingUnsignedPayloadTrailer)
+		return nil
+	}
+	if s.UnsignedPayload {
+		io.WriteString(w, UnsignedPayload)
+		return nil
+	}
+	if h := r.Header.Get("X-Amz-Content-Sha256"); h != "" {
+		io.WriteString(w, h)
+		return nil
+	}
+	ph, err := payloadHash(r)
+	if err != nil {
+		return err
+	}
+	io.WriteString(w, ph)
+	return nil
+}
+
+// payloadHash returns the hex SHA-256 of the body of r. The body is read
+// from GetBody, if r has it, so that r.Body is left to be sent; otherwise
+// r.Body is read and replaced.
+func payloadHash(r *http.Request) (string, error) {
+	if hasEmptyBody(r) {
+		return EmptyPayloadHash, nil
+	}
+
+	h := hashPool.Get().(hash.Hash)
+	defer hashPool.Put(h)
+	h.Reset()
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			_, err = io.Copy(h, body)
+			body.Close()
+			if err == nil {
+				return hexSum(h), nil
+			}
+			h.Reset()
+		}
+	}
+
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(b))
 
-	h := sha256.New()
 	h.Write(b)
-	fmt.Fprintf(w, "%x", h.Sum(nil))
+	return hexSum(h), nil
+}
+
+// hexSum returns the hex SHA-256 sum of h.
+func hexSum(h hash.Hash) string {
+	var sum [sha256.Size]byte
+	var hx [2 * sha256.Size]byte
+	hex.Encode(hx[:], h.Sum(sum[:0]))
+	return string(hx[:])
 }
 
+// writeURI writes the canonical URI: the path as sent if
+// s.DisableURIPathEscaping, else the path with dot segments and duplicate
+// slashes removed, encoded a second time.
 func (s *Service) writeURI(w io.Writer, r *http.Request) {
-	path := r.URL.RequestURI()
-	if r.URL.RawQuery != "" {
-		path = path[:len(path)-len(r.URL.RawQuery)-1]
+	path := r.URL.EscapedPath()
+	if path == "" || path == "/" {
+		io.WriteString(w, "/")
+		return
+	}
+	if s.DisableURIPathEscaping {
+		io.WriteString(w, path)
+		return
 	}
 	slash := strings.HasSuffix(path, "/")
 	path = filepath.Clean(path)
 	if path != "/" && slash {
 		path += "/"
 	}
-	w.Write([]byte(path))
+	io.WriteString(w, uriEncode(path, false))
 }
 
-func (s *Service) writeRequest(w io.Writer, r *http.Request) {
-	r.Header.Set("host", r.Host)
-
+func (s *Service) writeRequest(w io.Writer, r *http.Request, hs []string) error {
 	w.Write([]byte(r.Method))
 	w.Write(lf)
 	s.writeURI(w, r)
 	w.Write(lf)
 	s.writeQuery(w, r)
 	w.Write(lf)
-	s.writeHeader(w, r)
+	s.writeHeader(w, r, hs)
 	w.Write(lf)
 	w.Write(lf)
-	s.writeHeaderList(w, r)
+	s.writeHeaderList(w, hs)
 	w.Write(lf)
-	s.writeBody(w, r)
+	return s.writeBody(w, r)
 }
 
-func (s *Service) writeStringToSign(w io.Writer, t time.Time, r *http.Request) {
-	w.Write([]byte("AWS4-HMAC-SHA256"))
-	w.Write(lf)
-	w.Write([]byte(t.Format(iSO8601BasicFormat)))
+func (s *Service) writeStringToSign(w io.Writer, t time.Time, r *http.Request, hs []string) (crh [2 * sha256.Size]byte, err error) {
+	var buf [len(iSO8601BasicFormat)]byte
+	io.WriteString(w, "AWS4-HMAC-SHA256\n")
+	w.Write(t.AppendFormat(buf[:0], iSO8601BasicFormat))
 	w.Write(lf)
 
-	w.Write([]byte(s.creds(t)))
+	s.writeCreds(w, t)
 	w.Write(lf)
 
-	h := sha256.New()
-	s.writeRequest(h, r)
-	fmt.Fprintf(w, "%x", h.Sum(nil))
+	h := hashPool.Get().(hash.Hash)
+	defer hashPool.Put(h)
+	h.Reset()
+	if err := s.writeRequest(h, r, hs); err != nil {
+		return crh, err
+	}
+	var sum [sha256.Size]byte
+	hex.Encode(crh[:], h.Sum(sum[:0]))
+	w.Write(crh[:])
+	return crh, nil
+}
+
+// hashPool holds the SHA-256 states that hash canonical requests.
+var hashPool = sync.Pool{New: func() interface{} { return sha256.New() }}
+
+// writeCreds writes the credential scope of signatures made at t.
+func (s *Service) writeCreds(w io.Writer, t time.Time) {
+	var buf [len(iSO8601BasicFormatShort)]byte
+	w.Write(t.AppendFormat(buf[:0], iSO8601BasicFormatShort))
+	io.WriteString(w, "/")
+	io.WriteString(w, s.Region)
+	io.WriteString(w, "/")
+	io.WriteString(w, s.Name)
+	io.WriteString(w, "/aws4_request")
+}
+
+// Credential returns the credential of signatures made with keys for s at
+// time t, the access key followed by the scope, as sent in X-Amz-Credential.
+func (s *Service) Credential(keys *Keys, t time.Time) string {
+	return keys.AccessKey + "/" + s.creds(t.UTC())
+}
+
+// SignString returns the hex signature of stringToSign made with keys for s
+// at time t, for documents signed outside of a request, such as the
+// policies of S3 POST uploads.
+func (s *Service) SignString(keys *Keys, t time.Time, stringToSign string) string {
+	return fmt.Sprintf("%x", ghmac(keys.sign(s, t.UTC()), []byte(stringToSign)))
 }
 
 func (s *Service) creds(t time.Time) string {
 	return t.Format(iSO8601BasicFormatShort) + "/" + s.Region + "/" + s.Name + "/aws4_request"
 }
 
+// uriEncode percent-encodes every byte of s except the unreserved characters
+// of RFC 3986, as SigV4 requires. Slashes are kept if encodeSlash is false.
+func uriEncode(s string, encodeSlash bool) string {
+	const hex = "0123456789ABCDEF"
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b = append(b, c)
+		} else {
+			b = append(b, '%', hex[c>>4], hex[c&15])
+		}
+	}
+	return string(b)
+}
+
 func ghmac(key, data []byte) []byte {
 	h := hmac.New(sha256.New, key)
 	h.Write(data)
@@ -0,0 +1,284 @@
+// Package sns verifies the messages that Amazon SNS delivers to HTTP and
+// HTTPS subscriptions.
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of messages.
+const (
+	TypeNotification             = "Notification"
+	TypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	TypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// ErrSignature is returned by Verify for messages whose signature is not
+// valid.
+var ErrSignature = errors.New("sns: invalid message signature")
+
+// A Message is a message delivered by SNS, in the body of a POST.
+type Message struct {
+	Type      string
+	MessageId string
+	TopicArn  string
+	Subject   string `json:",omitempty"`
+	Message   string
+
+	// Timestamp is the time the message was sent, in RFC 3339 format, as
+	// signed. See Time.
+	Timestamp string
+
+	// Token and SubscribeURL are set in subscription and unsubscribe
+	// confirmations.
+	Token        string `json:",omitempty"`
+	SubscribeURL string `json:",omitempty"`
+
+	// UnsubscribeURL is set in notifications.
+	UnsubscribeURL string `json:",omitempty"`
+
+	MessageAttributes map[string]struct {
+		Type  string
+		Value string
+	} `json:",omitempty"`
+
+	// SignatureVersion is "1" for SHA1 or "2" for SHA256 signatures.
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+}
+
+// Time returns the time m was sent, or zero if Timestamp is not valid.
+func (m *Message) Time() time.Time {
+	t, _ := time.Parse(time.RFC3339, m.Timestamp)
+	return t
+}
+
+// stringToSign returns the string signed by SNS for m.
+func (m *Message) stringToSign() (string, error) {
+	var b strings.Builder
+	add := func(name, value string) {
+		b.WriteString(name)
+		b.WriteByte('\n')
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	switch m.Type {
+	case TypeNotification:
+		add("Message", m.Message)
+		add("MessageId", m.MessageId)
+		if m.Subject != "" {
+			add("Subject", m.Subject)
+		}
+		add("Timestamp", m.Timestamp)
+		add("TopicArn", m.TopicArn)
+		add("Type", m.Type)
+	case TypeSubscriptionConfirmation, TypeUnsubscribeConfirmation:
+		add("Message", m.Message)
+		add("MessageId", m.MessageId)
+		add("SubscribeURL", m.SubscribeURL)
+		add("Timestamp", m.Timestamp)
+		add("Token", m.Token)
+		add("TopicArn", m.TopicArn)
+		add("Type", m.Type)
+	default:
+		return "", fmt.Errorf("sns: unknown message type %q", m.Type)
+	}
+	return b.String(), nil
+}
+
+// certHost matches the hosts of the SNS endpoints, the only ones signing
+// certificates are fetched from.
+var certHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// maxCerts is the size of the certificate cache of a Verifier, reset when
+// reached.
+const maxCerts = 64
+
+// A Verifier verifies the signature of messages, with the signing
+// certificates of SNS, which it fetches over HTTPS from SNS endpoints only,
+// and caches. It is safe for concurrent use.
+type Verifier struct {
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// MaxAge, if not zero, rejects messages older than it, such as
+	// replayed ones. SNS retries deliveries for up to an hour by default.
+	MaxAge time.Duration
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// DefaultVerifier is the Verifier used by Verify and ParseRequest.
+var DefaultVerifier = &Verifier{}
+
+// Verify verifies m with DefaultVerifier.
+func Verify(ctx context.Context, m *Message) error {
+	return DefaultVerifier.Verify(ctx, m)
+}
+
+// ParseRequest parses and verifies the message in the body of r with
+// DefaultVerifier.
+func ParseRequest(r *http.Request) (*Message, error) {
+	return DefaultVerifier.ParseRequest(r)
+}
+
+// ParseRequest parses the message in the body of r, the POST of a
+// subscription, and verifies it.
+func (v *Verifier) ParseRequest(r *http.Request) (*Message, error) {
+	var m Message
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&m); err != nil {
+		return nil, err
+	}
+	if err := v.Verify(r.Context(), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Verify returns nil if the signature of m is valid, ErrSignature if it is
+// not, or another error if it can't be verified.
+func (v *Verifier) Verify(ctx context.Context, m *Message) error {
+	if v.MaxAge > 0 && time.Since(m.Time()) > v.MaxAge {
+		return fmt.Errorf("sns: message %s sent at %s is too old", m.MessageId, m.Timestamp)
+	}
+
+	var hash crypto.Hash
+	switch m.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("sns: unknown signature version %q", m.SignatureVersion)
+	}
+	s, err := m.stringToSign()
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return ErrSignature
+	}
+	cert, err := v.cert(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("sns: signing certificate without an RSA key")
+	}
+
+	var sum []byte
+	if hash == crypto.SHA1 {
+		h := sha1.Sum([]byte(s))
+		sum = h[:]
+	} else {
+		h := sha256.Sum256([]byte(s))
+		sum = h[:]
+	}
+	if rsa.VerifyPKCS1v15(key, hash, sum, sig) != nil {
+		return ErrSignature
+	}
+	return nil
+}
+
+// cert returns the certificate at rawurl, which must be an SNS endpoint.
+func (v *Verifier) cert(ctx context.Context, rawurl string) (*x509.Certificate, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "https" || !certHost.MatchString(u.Host) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, fmt.Errorf("sns: invalid signing certificate URL %q", rawurl)
+	}
+
+	v.mu.Lock()
+	cert := v.certs[rawurl]
+	v.mu.Unlock()
+	if cert != nil && time.Now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	r, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("sns: %d fetching signing certificate %s", resp.StatusCode, rawurl)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("sns: no certificate at %s", rawurl)
+	}
+	if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	if v.certs == nil || len(v.certs) >= maxCerts {
+		v.certs = make(map[string]*x509.Certificate)
+	}
+	v.certs[rawurl] = cert
+	v.mu.Unlock()
+	return cert, nil
+}
+
+// ConfirmSubscription confirms the subscription of a verified
+// SubscriptionConfirmation message, by visiting its SubscribeURL with
+// client, or http.DefaultClient if nil.
+func (m *Message) ConfirmSubscription(ctx context.Context, client *http.Client) error {
+	if m.Type != TypeSubscriptionConfirmation {
+		return fmt.Errorf("sns: %s message is not a subscription confirmation", m.Type)
+	}
+	u, err := url.Parse(m.SubscribeURL)
+	if err != nil || u.Scheme != "https" || !certHost.MatchString(u.Host) {
+		return fmt.Errorf("sns: invalid subscribe URL %q", m.SubscribeURL)
+	}
+	r, err := http.NewRequest("GET", m.SubscribeURL, nil)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("sns: %d confirming subscription to %s", resp.StatusCode, m.TopicArn)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package sns_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/raff/aws4/sns"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+const certURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+
+func signer(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, version, s string) string {
+	var sig []byte
+	var err error
+	if version == "1" {
+		sum := sha1.Sum([]byte(s))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	} else {
+		sum := sha256.Sum256([]byte(s))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	key, certPEM := signer(t)
+	fetches := 0
+	v := &sns.Verifier{Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := "ok"
+		switch r.URL.String() {
+		case certURL:
+			fetches++
+			body = string(certPEM)
+		case "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=tok":
+		default:
+			t.Errorf("unexpected GET %s", r.URL)
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	})}}
+	ctx := context.Background()
+
+	m := &sns.Message{
+		Type:             sns.TypeNotification,
+		MessageId:        "id-1",
+		TopicArn:         "arn:aws:sns:us-east-1:123456789012:topic",
+		Subject:          "hello",
+		Message:          "world",
+		Timestamp:        "2024-01-02T03:04:05.678Z",
+		SignatureVersion: "2",
+		SigningCertURL:   certURL,
+	}
+	m.Signature = sign(t, key, "2", "Message\nworld\nMessageId\nid-1\nSubject\nhello\nTimestamp\n2024-01-02T03:04:05.678Z\nTopicArn\narn:aws:sns:us-east-1:123456789012:topic\nType\nNotification\n")
+	if err := v.Verify(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &sns.Message{
+		Type:             sns.TypeSubscriptionConfirmation,
+		MessageId:        "id-2",
+		TopicArn:         "arn:aws:sns:us-east-1:123456789012:topic",
+		Message:          "confirm",
+		Token:            "tok",
+		SubscribeURL:     "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=tok",
+		Timestamp:        "2024-01-02T03:04:05.678Z",
+		SignatureVersion: "1",
+		SigningCertURL:   certURL,
+	}
+	c.Signature = sign(t, key, "1", "Message\nconfirm\nMessageId\nid-2\nSubscribeURL\n"+c.SubscribeURL+"\nTimestamp\n2024-01-02T03:04:05.678Z\nToken\ntok\nTopicArn\narn:aws:sns:us-east-1:123456789012:topic\nType\nSubscriptionConfirmation\n")
+	b, _ := json.Marshal(c)
+	parsed, err := v.ParseRequest(httptest.NewRequest("POST", "/sns", bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.ConfirmSubscription(ctx, v.Client); err != nil {
+		t.Error(err)
+	}
+	if fetches != 1 {
+		t.Errorf("%d certificate fetches", fetches)
+	}
+
+	m.Message = "tampered"
+	if err := v.Verify(ctx, m); err != sns.ErrSignature {
+		t.Errorf("Verify tampered = %v", err)
+	}
+	m.SigningCertURL = "https://evil.example.com/SimpleNotificationService-test.pem"
+	if err := v.Verify(ctx, m); err == nil || err == sns.ErrSignature {
+		t.Errorf("Verify with a foreign certificate = %v", err)
+	}
+
+	v.MaxAge = time.Hour
+	m.SigningCertURL = certURL
+	if err := v.Verify(ctx, m); err == nil || err == sns.ErrSignature {
+		t.Errorf("Verify old message = %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package sqs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults of Consumer.
+const (
+	DefaultWorkers           = 10
+	DefaultWaitTime          = 20 * time.Second
+	DefaultVisibilityTimeout = 30 * time.Second
+)
+
+// A Consumer delivers the messages of a queue to Handler, from a pool of
+// Workers:
+//
+//   - messages are received by long polling, as workers are free;
+//   - the visibility timeout of a message is extended while Handler runs,
+//     so that work longer than VisibilityTimeout isn't delivered twice;
+//   - after Handler returns nil, the message is deleted; if it fails, the
+//     message is received again after RetryDelay, until SQS moves it to
+//     the dead-letter queue of the queue, if any;
+//   - the messages of a FIFO message group are handled one at a time, in
+//     order, the ones waiting their turn being extended too; when Handler
+//     fails for one, the following ones are made visible again, to be
+//     received after it.
+type Consumer struct {
+	Queue *Client
+
+	// Handler is called with each message.
+	Handler func(ctx context.Context, m *Message) error
+
+	// If zero, DefaultWorkers is used.
+	Workers int
+
+	// WaitTime is the long polling time, up to 20 seconds. If zero,
+	// DefaultWaitTime is used.
+	WaitTime time.Duration
+
+	// VisibilityTimeout is how long messages are hidden at a time, extended
+	// while Handler runs. If zero, DefaultVisibilityTimeout is used.
+	VisibilityTimeout time.Duration
+
+	// RetryDelay, if not nil, returns how long a message that Handler failed
+	// for is hidden, by the times it was received. If nil, it is hidden for
+	// the rest of its visibility timeout.
+	RetryDelay func(receiveCount int) time.Duration
+
+	// MaxReceiveCount is how many times messages are received before SQS
+	// moves them to the dead-letter queue. If zero, it is read from the
+	// RedrivePolicy of the queue when Run starts.
+	MaxReceiveCount int
+
+	// OnDeadLetter, if not nil, is called when Handler fails for a message
+	// received MaxReceiveCount times, which SQS then moves to the
+	// dead-letter queue.
+	OnDeadLetter func(m *Message, err error)
+
+	// OnError, if not nil, is called with the errors of Handler, and of the
+	// requests to the queue, with a nil message for ReceiveMessage.
+	OnError func(m *Message, err error)
+}
+
+func (c *Consumer) onError(m *Message, err error) {
+	if c.OnError != nil {
+		c.OnError(m, err)
+	}
+}
+
+func (c *Consumer) visibilityTimeout() time.Duration {
+	if c.VisibilityTimeout <= 0 {
+		return DefaultVisibilityTimeout
+	}
+	return c.VisibilityTimeout
+}
+
+// Run consumes the queue until ctx is done, then waits for the running
+// handlers and returns ctx.Err().
+func (c *Consumer) Run(ctx context.Context) error {
+	maxReceive := c.MaxReceiveCount
+	if maxReceive == 0 {
+		n, err := c.Queue.MaxReceiveCount(ctx)
+		if err != nil {
+			return err
+		}
+		maxReceive = n
+	}
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	wait := c.WaitTime
+	if wait <= 0 {
+		wait = DefaultWaitTime
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for retry := uint(0); ; {
+		// Wait for a free worker, then take as many as are free.
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		free := 1
+		for free < MaxMessages && len(sem) < cap(sem) {
+			sem <- struct{}{}
+			free++
+		}
+
+		msgs, err := c.Queue.ReceiveMessage(ctx, &ReceiveOptions{
+			MaxMessages:       free,
+			WaitTime:          wait,
+			VisibilityTimeout: c.visibilityTimeout(),
+		})
+		for i := len(msgs); i < free; i++ {
+			<-sem
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.onError(nil, err)
+			retry++
+			if err := sleep(ctx, retry); err != nil {
+				return err
+			}
+			continue
+		}
+		retry = 0
+
+		for _, group := range groups(msgs) {
+			wg.Add(1)
+			go func(group []*Message) {
+				defer wg.Done()
+				// The messages waiting for their turn are extended too, not
+				// to be received again while the group is handled.
+				hb := c.heartbeat(ctx, group)
+				defer hb.stop()
+				for i, m := range group {
+					err := c.handle(ctx, m, maxReceive, hb)
+					<-sem
+					if err == nil {
+						continue
+					}
+					// The rest of the group is received again after m, in
+					// order. Release it even if ctx is done, not to hold
+					// the group until it times out.
+					hb.stop()
+					for _, m := range group[i+1:] {
+						if err := c.Queue.ChangeMessageVisibility(context.Background(), m.ReceiptHandle, 0); err != nil {
+							c.onError(m, err)
+						}
+						<-sem
+					}
+					return
+				}
+			}(group)
+		}
+	}
+}
+
+// groups splits msgs into the messages of each FIFO message group, in
+// order, and single messages without a group.
+func groups(msgs []Message) [][]*Message {
+	var gs [][]*Message
+	index := make(map[string]int)
+	for i := range msgs {
+		m := &msgs[i]
+		id := m.GroupID()
+		if j, ok := index[id]; ok {
+			gs[j] = append(gs[j], m)
+			continue
+		}
+		if id != "" {
+			index[id] = len(gs)
+		}
+		gs = append(gs, []*Message{m})
+	}
+	return gs
+}
+
+// sleep waits before receiving again after retry failures in a row,
+// backing off exponentially from 1s to 1 minute.
+func sleep(ctx context.Context, retry uint) error {
+	d := time.Minute
+	if retry < 7 {
+		d = time.Second << (retry - 1)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A heartbeat extends the visibility timeout of the messages of a group
+// that are not handled yet.
+type heartbeat struct {
+	mu      sync.Mutex // held while extending pending
+	pending []*Message
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// heartbeat starts extending the visibility timeout of msgs, until they are
+// handled or it is stopped.
+func (c *Consumer) heartbeat(ctx context.Context, msgs []*Message) *heartbeat {
+	h := &heartbeat{pending: msgs, done: make(chan struct{}), stopped: make(chan struct{})}
+	timeout := c.visibilityTimeout()
+	go func() {
+		defer close(h.stopped)
+		t := time.NewTicker(timeout / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				h.mu.Lock()
+				for _, m := range h.pending {
+					if err := c.Queue.ChangeMessageVisibility(ctx, m.ReceiptHandle, timeout); err != nil {
+						c.onError(m, err)
+					}
+				}
+				h.mu.Unlock()
+			case <-h.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return h
+}
+
+// handled stops extending the first pending message, once it is no longer
+// being extended.
+func (h *heartbeat) handled() {
+	h.mu.Lock()
+	h.pending = h.pending[1:]
+	h.mu.Unlock()
+}
+
+// stop stops extending the messages, and waits for h to end.
+func (h *heartbeat) stop() {
+	h.once.Do(func() { close(h.done) })
+	<-h.stopped
+}
+
+// handle calls Handler with m, the first pending message of hb, which
+// extends its visibility timeout meanwhile, and deletes it if Handler
+// succeeds. It returns the error of Handler.
+func (c *Consumer) handle(ctx context.Context, m *Message, maxReceive int, hb *heartbeat) error {
+	err := c.Handler(ctx, m)
+	hb.handled()
+
+	if err == nil {
+		// Delete even if ctx is done, not to handle m again.
+		if err := c.Queue.DeleteMessage(context.Background(), m.ReceiptHandle); err != nil {
+			c.onError(m, err)
+		}
+		return nil
+	}
+
+	c.onError(m, err)
+	if maxReceive > 0 && m.ReceiveCount() >= maxReceive && c.OnDeadLetter != nil {
+		c.OnDeadLetter(m, err)
+	}
+	if c.RetryDelay != nil && ctx.Err() == nil {
+		if err := c.Queue.ChangeMessageVisibility(ctx, m.ReceiptHandle, c.RetryDelay(m.ReceiveCount())); err != nil {
+			c.onError(m, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,248 @@
+// Package sqs sends and receives the messages of Amazon SQS queues, signing
+// requests with github.com/raff/aws4.
+package sqs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// MaxMessages is the maximum number of messages of a ReceiveMessage call.
+const MaxMessages = 10
+
+// A Client sends requests to a queue.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the SQS endpoint of Region is used.
+	URL string
+
+	// QueueURL is the URL of the queue.
+	QueueURL string
+}
+
+// An Error is an error reported by SQS.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name, such as
+// QueueDoesNotExist or ReceiptHandleIsInvalid.
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "sqs",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "AmazonSQS",
+		Version: "1.0",
+	}
+	return jc.Do(ctx, action, in, out)
+}
+
+// A MessageAttribute is a typed attribute of a message. DataType is
+// String, Number or Binary, optionally followed by "." and a custom type.
+type MessageAttribute struct {
+	DataType    string
+	StringValue string `json:",omitempty"`
+	BinaryValue []byte `json:",omitempty"`
+}
+
+// A Message is a message received from a queue.
+type Message struct {
+	MessageId     string
+	ReceiptHandle string
+	Body          string
+	MD5OfBody     string
+
+	// Attributes are the system attributes of the message, such as
+	// ApproximateReceiveCount or SentTimestamp.
+	Attributes map[string]string
+
+	MessageAttributes map[string]MessageAttribute
+}
+
+// ReceiveCount returns how many times m was received, including this one.
+func (m *Message) ReceiveCount() int {
+	n, _ := strconv.Atoi(m.Attributes["ApproximateReceiveCount"])
+	return n
+}
+
+// Sent returns when m was sent.
+func (m *Message) Sent() time.Time {
+	ms, _ := strconv.ParseInt(m.Attributes["SentTimestamp"], 10, 64)
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// GroupID returns the message group ID of m, received from a FIFO queue.
+func (m *Message) GroupID() string {
+	return m.Attributes["MessageGroupId"]
+}
+
+// SequenceNumber returns the sequence number of m in its FIFO queue.
+func (m *Message) SequenceNumber() string {
+	return m.Attributes["SequenceNumber"]
+}
+
+// SendOptions are the options of SendMessage.
+type SendOptions struct {
+	// Delay postpones the delivery of the message, up to 15 minutes. FIFO
+	// queues only support the delay of the queue.
+	Delay time.Duration
+
+	Attributes map[string]MessageAttribute
+
+	// GroupID is the message group of messages sent to FIFO queues, which
+	// are received in order within a group.
+	GroupID string
+
+	// DeduplicationID identifies a message sent to a FIFO queue, which is
+	// only delivered once if it is sent again within 5 minutes. If empty
+	// with GroupID set, the SHA-256 of the body is used, as with
+	// content-based deduplication.
+	DeduplicationID string
+}
+
+// SendMessage sends a message with body, and opts, which may be nil, and
+// returns its message ID.
+func (c *Client) SendMessage(ctx context.Context, body string, opts *SendOptions) (string, error) {
+	req := map[string]interface{}{"QueueUrl": c.QueueURL, "MessageBody": body}
+	if opts != nil {
+		if opts.Delay > 0 {
+			req["DelaySeconds"] = int(opts.Delay / time.Second)
+		}
+		if len(opts.Attributes) > 0 {
+			req["MessageAttributes"] = opts.Attributes
+		}
+		if opts.GroupID != "" {
+			req["MessageGroupId"] = opts.GroupID
+			req["MessageDeduplicationId"] = opts.DeduplicationID
+			if opts.DeduplicationID == "" {
+				sum := sha256.Sum256([]byte(body))
+				req["MessageDeduplicationId"] = hex.EncodeToString(sum[:])
+			}
+		}
+	}
+	var resp struct{ MessageId string }
+	if err := c.do(ctx, "SendMessage", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.MessageId, nil
+}
+
+// ReceiveOptions are the options of ReceiveMessage.
+type ReceiveOptions struct {
+	// MaxMessages is how many messages to receive at most, up to
+	// MaxMessages. If zero, 1 is used.
+	MaxMessages int
+
+	// WaitTime is how long to wait for messages (long polling), up to 20
+	// seconds. If zero, ReceiveMessage returns at once.
+	WaitTime time.Duration
+
+	// VisibilityTimeout is how long the messages are hidden from other
+	// receivers. If zero, the visibility timeout of the queue is used.
+	VisibilityTimeout time.Duration
+
+	// AttemptID, if not empty, identifies the attempt to receive from a FIFO
+	// queue, so that retrying it after a network error returns the same
+	// messages.
+	AttemptID string
+}
+
+// ReceiveMessage receives messages with opts, which may be nil, with all
+// their attributes. It returns no messages if none is available after
+// WaitTime.
+func (c *Client) ReceiveMessage(ctx context.Context, opts *ReceiveOptions) ([]Message, error) {
+	req := map[string]interface{}{
+		"QueueUrl":                    c.QueueURL,
+		"MessageSystemAttributeNames": []string{"All"},
+		"MessageAttributeNames":       []string{"All"},
+	}
+	if opts != nil {
+		if opts.MaxMessages > 0 {
+			req["MaxNumberOfMessages"] = opts.MaxMessages
+		}
+		if opts.WaitTime > 0 {
+			req["WaitTimeSeconds"] = int(opts.WaitTime / time.Second)
+		}
+		if opts.VisibilityTimeout > 0 {
+			req["VisibilityTimeout"] = int(opts.VisibilityTimeout / time.Second)
+		}
+		if opts.AttemptID != "" {
+			req["ReceiveRequestAttemptId"] = opts.AttemptID
+		}
+	}
+	var resp struct{ Messages []Message }
+	if err := c.do(ctx, "ReceiveMessage", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Messages, nil
+}
+
+// DeleteMessage deletes the message received with receiptHandle.
+func (c *Client) DeleteMessage(ctx context.Context, receiptHandle string) error {
+	req := map[string]string{"QueueUrl": c.QueueURL, "ReceiptHandle": receiptHandle}
+	return c.do(ctx, "DeleteMessage", req, nil)
+}
+
+// ChangeMessageVisibility hides the message received with receiptHandle for
+// timeout from now, up to 12 hours since it was received, or makes it
+// visible at once if timeout is zero.
+func (c *Client) ChangeMessageVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	req := map[string]interface{}{
+		"QueueUrl":          c.QueueURL,
+		"ReceiptHandle":     receiptHandle,
+		"VisibilityTimeout": int(timeout / time.Second),
+	}
+	return c.do(ctx, "ChangeMessageVisibility", req, nil)
+}
+
+// GetQueueAttributes returns the attributes of the queue with names, or all
+// of them if none is given.
+func (c *Client) GetQueueAttributes(ctx context.Context, names ...string) (map[string]string, error) {
+	if len(names) == 0 {
+		names = []string{"All"}
+	}
+	req := map[string]interface{}{"QueueUrl": c.QueueURL, "AttributeNames": names}
+	var resp struct{ Attributes map[string]string }
+	if err := c.do(ctx, "GetQueueAttributes", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Attributes, nil
+}
+
+// MaxReceiveCount returns how many times a message of the queue is received
+// before SQS moves it to its dead-letter queue, from its RedrivePolicy, or
+// 0 if the queue has none.
+func (c *Client) MaxReceiveCount(ctx context.Context) (int, error) {
+	attrs, err := c.GetQueueAttributes(ctx, "RedrivePolicy")
+	if err != nil || attrs["RedrivePolicy"] == "" {
+		return 0, err
+	}
+	// maxReceiveCount is a number or a string.
+	var policy struct{ MaxReceiveCount json.RawMessage }
+	if err := json.Unmarshal([]byte(attrs["RedrivePolicy"]), &policy); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.Trim(string(policy.MaxReceiveCount), `"`))
+}
@@ -0,0 +1,271 @@
+package sqs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/sqs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQueue delivers its messages once, and records the other actions.
+type fakeQueue struct {
+	mu         sync.Mutex
+	messages   []string
+	deleted    []string
+	visibility []string
+}
+
+func (f *fakeQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req["QueueUrl"] != "https://queue" {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, `{"__type":"QueueDoesNotExist","message":"%v"}`, req["QueueUrl"])
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.") {
+	case "GetQueueAttributes":
+		fmt.Fprint(w, `{"Attributes":{"RedrivePolicy":"{\"deadLetterTargetArn\":\"arn:aws:sqs:us-east-1:1:dlq\",\"maxReceiveCount\":\"3\"}"}}`)
+	case "ReceiveMessage":
+		n := int(req["MaxNumberOfMessages"].(float64))
+		if n > len(f.messages) {
+			n = len(f.messages)
+		}
+		var msgs []string
+		for _, m := range f.messages[:n] {
+			// FIFO messages are "group/body".
+			group, body := "", m
+			if i := strings.IndexByte(m, '/'); i >= 0 {
+				group, body = m[:i], m[i+1:]
+			}
+			count := "1"
+			if m == "fail" {
+				count = "3"
+			}
+			msgs = append(msgs, fmt.Sprintf(`{"MessageId":"id-%s","ReceiptHandle":"rh-%s","Body":%q,"Attributes":{"ApproximateReceiveCount":%q,"MessageGroupId":%q}}`, m, m, body, count, group))
+		}
+		f.messages = f.messages[n:]
+		if len(msgs) == 0 {
+			f.mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			f.mu.Lock()
+		}
+		fmt.Fprintf(w, `{"Messages":[%s]}`, strings.Join(msgs, ","))
+	case "DeleteMessage":
+		f.deleted = append(f.deleted, req["ReceiptHandle"].(string))
+		fmt.Fprint(w, `{}`)
+	case "ChangeMessageVisibility":
+		f.visibility = append(f.visibility, fmt.Sprintf("%s=%v", req["ReceiptHandle"], req["VisibilityTimeout"]))
+		fmt.Fprint(w, `{}`)
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	f := &fakeQueue{messages: []string{"ok", "slow", "fail"}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	q := &sqs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, QueueURL: "https://queue"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	handled := 0
+	var dead []string
+	c := &sqs.Consumer{
+		Queue: q,
+		Handler: func(ctx context.Context, m *sqs.Message) error {
+			defer func() {
+				mu.Lock()
+				if handled++; handled == 3 {
+					cancel()
+				}
+				mu.Unlock()
+			}()
+			switch m.Body {
+			case "slow":
+				time.Sleep(1200 * time.Millisecond)
+			case "fail":
+				return errors.New("failed")
+			}
+			return nil
+		},
+		Workers:           2,
+		VisibilityTimeout: 2 * time.Second,
+		RetryDelay:        func(n int) time.Duration { return time.Duration(n) * time.Second },
+		OnDeadLetter: func(m *sqs.Message, err error) {
+			mu.Lock()
+			dead = append(dead, m.MessageId)
+			mu.Unlock()
+		},
+	}
+	if err := c.Run(ctx); err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fmt.Sprint(f.deleted) != "[rh-ok rh-slow]" && fmt.Sprint(f.deleted) != "[rh-slow rh-ok]" {
+		t.Errorf("deleted %v", f.deleted)
+	}
+	if fmt.Sprint(dead) != "[id-fail]" {
+		t.Errorf("dead letters %v", dead)
+	}
+	// The slow message is extended once, the failed one delayed.
+	if len(f.visibility) != 2 || !contains(f.visibility, "rh-slow=2") || !contains(f.visibility, "rh-fail=3") {
+		t.Errorf("visibility changes %v", f.visibility)
+	}
+}
+
+func TestConsumerFIFO(t *testing.T) {
+	f := &fakeQueue{messages: []string{"g1/a", "g2/a", "g1/b", "g1/fail", "g1/c", "g2/b"}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	q := &sqs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, QueueURL: "https://queue"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	order := map[string][]string{}
+	handled := 0
+	c := &sqs.Consumer{
+		Queue: q,
+		Handler: func(ctx context.Context, m *sqs.Message) error {
+			// Let later messages overtake earlier ones if not in order.
+			if m.Body == "a" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			order[m.GroupID()] = append(order[m.GroupID()], m.Body)
+			if handled++; handled == 5 {
+				cancel()
+			}
+			if m.Body == "fail" {
+				return errors.New("failed")
+			}
+			return nil
+		},
+		Workers:         10,
+		MaxReceiveCount: 5,
+	}
+	if err := c.Run(ctx); err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(order) != "map[g1:[a b fail] g2:[a b]]" {
+		t.Errorf("order %v", order)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fmt.Sprint(f.visibility) != "[rh-g1/c=0]" {
+		t.Errorf("visibility changes %v", f.visibility)
+	}
+}
+
+func TestConsumerFIFOHeartbeat(t *testing.T) {
+	f := &fakeQueue{messages: []string{"g1/slow", "g1/b"}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	q := &sqs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, QueueURL: "https://queue"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &sqs.Consumer{
+		Queue: q,
+		Handler: func(ctx context.Context, m *sqs.Message) error {
+			switch m.Body {
+			case "slow":
+				time.Sleep(1200 * time.Millisecond)
+			case "b":
+				cancel()
+			}
+			return nil
+		},
+		VisibilityTimeout: 2 * time.Second,
+		MaxReceiveCount:   5,
+	}
+	if err := c.Run(ctx); err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// The queued message is extended with the one being handled.
+	if fmt.Sprint(f.visibility) != "[rh-g1/slow=2 rh-g1/b=2]" {
+		t.Errorf("visibility changes %v", f.visibility)
+	}
+	if fmt.Sprint(f.deleted) != "[rh-g1/slow rh-g1/b]" {
+		t.Errorf("deleted %v", f.deleted)
+	}
+}
+
+func TestSendMessageFIFO(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"MessageId":"m-1"}`)
+	}))
+	defer srv.Close()
+
+	q := &sqs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, QueueURL: "https://queue.fifo"}
+	ctx := context.Background()
+	if _, err := q.SendMessage(ctx, "hello", &sqs.SendOptions{GroupID: "g1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["MessageGroupId"] != "g1" || got["MessageDeduplicationId"] != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("request %v", got)
+	}
+	if _, err := q.SendMessage(ctx, "hello", &sqs.SendOptions{GroupID: "g1", DeduplicationID: "d-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["MessageDeduplicationId"] != "d-1" {
+		t.Errorf("request %v", got)
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSendMessage(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"MessageId":"m-1"}`)
+	}))
+	defer srv.Close()
+
+	q := &sqs.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL, QueueURL: "https://queue"}
+	id, err := q.SendMessage(context.Background(), "hello", &sqs.SendOptions{
+		Delay:      5 * time.Second,
+		Attributes: map[string]sqs.MessageAttribute{"kind": {DataType: "String", StringValue: "greeting"}},
+	})
+	if err != nil || id != "m-1" {
+		t.Fatalf("SendMessage = %q, %v", id, err)
+	}
+	b, _ := json.Marshal(got)
+	if string(b) != `{"DelaySeconds":5,"MessageAttributes":{"kind":{"DataType":"String","StringValue":"greeting"}},"MessageBody":"hello","QueueUrl":"https://queue"}` {
+		t.Errorf("request %s", b)
+	}
+}
@@ -0,0 +1,90 @@
+package ssm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a Cache keeps parameters by default.
+const DefaultCacheTTL = 5 * time.Minute
+
+// A Cache keeps decrypted parameters in memory, so that services reading
+// their configuration on every request don't call Parameter Store each
+// time. Parameters written through the Cache are dropped from it; others
+// are only seen once entries expire.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	// Client reads the parameters.
+	Client *Client
+
+	// TTL is how long parameters are kept. If zero, DefaultCacheTTL is used.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	param   *Parameter
+	expires time.Time
+}
+
+// Get returns the parameter name, from the cache if it hasn't expired.
+func (c *Cache) Get(ctx context.Context, name string) (*Parameter, error) {
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.param, nil
+	}
+
+	p, err := c.Client.GetParameter(ctx, name, true)
+	if err != nil {
+		return nil, err
+	}
+	c.put(name, p)
+	return p, nil
+}
+
+// Value returns the value of the parameter name.
+func (c *Cache) Value(ctx context.Context, name string) (string, error) {
+	p, err := c.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return p.Value, nil
+}
+
+// Put calls PutParameter, and drops the parameter from the cache.
+func (c *Cache) Put(ctx context.Context, in *PutParameterInput) (int64, error) {
+	v, err := c.Client.PutParameter(ctx, in)
+	c.Invalidate(in.Name)
+	return v, err
+}
+
+// Invalidate drops the parameters names from the cache.
+func (c *Cache) Invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, n := range names {
+		delete(c.entries, n)
+	}
+}
+
+func (c *Cache) put(name string, p *Parameter) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[name] = cacheEntry{p, time.Now().Add(ttl)}
+}
@@ -0,0 +1,201 @@
+// Package ssm reads and writes AWS Systems Manager Parameter Store
+// parameters, signing requests with github.com/raff/aws4.
+package ssm
+
+import (
+	"context"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/internal/awsjson"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// MaxGetParameters is the largest number of names GetParameters sends in
+// one request; more are split across several requests.
+const MaxGetParameters = 10
+
+// Parameter types.
+const (
+	String       = "String"
+	StringList   = "StringList"
+	SecureString = "SecureString"
+)
+
+// A Client sends requests to Parameter Store.
+type Client struct {
+	// If nil, aws4.DefaultClient is used.
+	Client *aws4.Client
+
+	// If empty, DefaultRegion is used.
+	Region string
+
+	// If empty, the SSM endpoint of Region is used.
+	URL string
+}
+
+// An Error is an error reported by SSM.
+type Error = awsjson.Error
+
+// IsException returns true if err is an *Error of type name, such as
+// "ParameterNotFound".
+func IsException(err error, name string) bool {
+	return awsjson.IsError(err, name)
+}
+
+// A Parameter is a parameter and its value.
+type Parameter struct {
+	Name             string
+	Type             string
+	Value            string
+	Version          int64
+	ARN              string
+	DataType         string
+	LastModifiedDate time.Time
+}
+
+type parameter struct {
+	Name             string
+	Type             string
+	Value            string
+	Version          int64
+	ARN              string
+	DataType         string
+	LastModifiedDate float64
+}
+
+func (p *parameter) parameter() *Parameter {
+	return &Parameter{
+		Name:             p.Name,
+		Type:             p.Type,
+		Value:            p.Value,
+		Version:          p.Version,
+		ARN:              p.ARN,
+		DataType:         p.DataType,
+		LastModifiedDate: time.Unix(0, int64(p.LastModifiedDate*1e9)).UTC(),
+	}
+}
+
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	region := c.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	jc := &awsjson.Client{
+		Client:  c.Client,
+		Service: "ssm",
+		Region:  region,
+		URL:     c.URL,
+		Target:  "AmazonSSM",
+		Version: "1.1",
+	}
+	return jc.Do(ctx, action, in, out)
+}
+
+// GetParameter returns the parameter name, decrypting SecureString values if
+// decrypt is true. name may select a version or label, as in "name:3".
+func (c *Client) GetParameter(ctx context.Context, name string, decrypt bool) (*Parameter, error) {
+	req := struct {
+		Name           string
+		WithDecryption bool
+	}{name, decrypt}
+	var resp struct{ Parameter parameter }
+	if err := c.do(ctx, "GetParameter", &req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Parameter.parameter(), nil
+}
+
+// GetParameters returns the parameters names, and the names that don't
+// exist.
+func (c *Client) GetParameters(ctx context.Context, names []string, decrypt bool) (params []*Parameter, invalid []string, err error) {
+	for len(names) > 0 {
+		n := len(names)
+		if n > MaxGetParameters {
+			n = MaxGetParameters
+		}
+		req := struct {
+			Names          []string
+			WithDecryption bool
+		}{names[:n], decrypt}
+		var resp struct {
+			Parameters        []parameter
+			InvalidParameters []string
+		}
+		if err := c.do(ctx, "GetParameters", &req, &resp); err != nil {
+			return nil, nil, err
+		}
+		for i := range resp.Parameters {
+			params = append(params, resp.Parameters[i].parameter())
+		}
+		invalid = append(invalid, resp.InvalidParameters...)
+		names = names[n:]
+	}
+	return params, invalid, nil
+}
+
+// GetParametersByPath returns the parameters under path, such as
+// "/myapp/prod/", following all pages of results. If recursive is false only
+// the parameters directly under path are returned.
+func (c *Client) GetParametersByPath(ctx context.Context, path string, recursive, decrypt bool) ([]*Parameter, error) {
+	req := struct {
+		Path           string
+		Recursive      bool
+		WithDecryption bool
+		NextToken      string `json:",omitempty"`
+	}{Path: path, Recursive: recursive, WithDecryption: decrypt}
+
+	var params []*Parameter
+	for {
+		var resp struct {
+			Parameters []parameter
+			NextToken  string
+		}
+		if err := c.do(ctx, "GetParametersByPath", &req, &resp); err != nil {
+			return nil, err
+		}
+		for i := range resp.Parameters {
+			params = append(params, resp.Parameters[i].parameter())
+		}
+		if resp.NextToken == "" {
+			return params, nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// PutParameterInput is the input of PutParameter.
+type PutParameterInput struct {
+	Name  string
+	Value string
+
+	// If empty, String is used.
+	Type string
+
+	Description string `json:",omitempty"`
+
+	// KeyId is the KMS key of a SecureString. If empty, the account's
+	// default key is used.
+	KeyId string `json:",omitempty"`
+
+	// Overwrite must be true to change an existing parameter.
+	Overwrite bool
+}
+
+// PutParameter creates or updates a parameter, and returns its new version.
+func (c *Client) PutParameter(ctx context.Context, in *PutParameterInput) (int64, error) {
+	req := *in
+	if req.Type == "" {
+		req.Type = String
+	}
+	var resp struct{ Version int64 }
+	if err := c.do(ctx, "PutParameter", &req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+// DeleteParameter deletes the parameter name.
+func (c *Client) DeleteParameter(ctx context.Context, name string) error {
+	return c.do(ctx, "DeleteParameter", map[string]string{"Name": name}, nil)
+}
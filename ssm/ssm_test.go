@@ -0,0 +1,106 @@
+package ssm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/ssm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetParametersByPath(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParametersByPath" {
+			t.Errorf("target %s", r.Header.Get("X-Amz-Target"))
+		}
+		var req struct {
+			Path           string
+			WithDecryption bool
+			NextToken      string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.WithDecryption {
+			t.Error("expected WithDecryption")
+		}
+		switch req.NextToken {
+		case "":
+			fmt.Fprintf(w, `{"Parameters":[{"Name":"%sa","Value":"1","Version":1}],"NextToken":"t1"}`, req.Path)
+		case "t1":
+			fmt.Fprintf(w, `{"Parameters":[{"Name":"%sb","Value":"2","Version":4,"LastModifiedDate":1.6E9}]}`, req.Path)
+		}
+	}))
+	defer srv.Close()
+	c := &ssm.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	params, err := c.GetParametersByPath(context.Background(), "/app/", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 2 || params[1].Name != "/app/b" || params[1].Version != 4 || params[1].LastModifiedDate.Unix() != 1600000000 {
+		t.Errorf("parameters %+v", params)
+	}
+}
+
+func TestGetParameters(t *testing.T) {
+	var calls []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Names []string }
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, len(req.Names))
+		var params []string
+		for _, n := range req.Names {
+			params = append(params, fmt.Sprintf(`{"Name":%q,"Value":"v"}`, n))
+		}
+		fmt.Fprintf(w, `{"Parameters":[%s],"InvalidParameters":["x"]}`, strings.Join(params, ","))
+	}))
+	defer srv.Close()
+	c := &ssm.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}
+
+	var names []string
+	for i := 0; i < 12; i++ {
+		names = append(names, fmt.Sprint("p", i))
+	}
+	params, invalid, err := c.GetParameters(context.Background(), names, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 12 || len(invalid) != 2 || fmt.Sprint(calls) != "[10 2]" {
+		t.Errorf("%d parameters, %d invalid, calls %v", len(params), len(invalid), calls)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSSM.GetParameter":
+			atomic.AddInt32(&gets, 1)
+			w.Write([]byte(`{"Parameter":{"Name":"p","Type":"SecureString","Value":"secret"}}`))
+		case "AmazonSSM.PutParameter":
+			w.Write([]byte(`{"Version":2}`))
+		}
+	}))
+	defer srv.Close()
+	cache := &ssm.Cache{Client: &ssm.Client{Client: &aws4.Client{Keys: &aws4.Keys{}}, URL: srv.URL}}
+
+	for i := 0; i < 3; i++ {
+		if v, err := cache.Value(context.Background(), "p"); v != "secret" || err != nil {
+			t.Fatalf("Value = %q, %v", v, err)
+		}
+	}
+	if gets != 1 {
+		t.Errorf("%d GetParameter calls", gets)
+	}
+	if _, err := cache.Put(context.Background(), &ssm.PutParameterInput{Name: "p", Value: "new", Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	cache.Value(context.Background(), "p")
+	if gets != 2 {
+		t.Errorf("%d GetParameter calls after Put", gets)
+	}
+}
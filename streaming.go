@@ -0,0 +1,128 @@
+package aws4
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// StreamingUnsignedPayloadTrailer is sent in place of the payload hash when
+// Service.StreamingTrailer is set.
+const StreamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+const (
+	streamingChunkSize = 64 << 10
+	checksumTrailer    = "x-amz-checksum-sha256"
+)
+
+var crlf = []byte("\r\n")
+
+// streamBody prepares r to be sent with its payload hash as a trailer: the
+// body is sent in aws-chunked encoding, hashed as it is read, and ends with
+// an x-amz-checksum-sha256 trailer. The headers describing it are set
+// before signing, since they are signed.
+func streamBody(r *http.Request) error {
+	if r.Header.Get("X-Amz-Content-Sha256") == StreamingUnsignedPayloadTrailer {
+		return nil // signed before, such as when retried
+	}
+	// As for http.Client, a zero ContentLength with a body is unknown.
+	if r.ContentLength <= 0 {
+		return errors.New("aws4: streaming trailer needs the ContentLength of the body")
+	}
+	n := r.ContentLength
+	if ce := r.Header.Get("Content-Encoding"); ce != "" {
+		r.Header.Set("Content-Encoding", "aws-chunked,"+ce)
+	} else {
+		r.Header.Set("Content-Encoding", "aws-chunked")
+	}
+	r.Header.Set("X-Amz-Content-Sha256", StreamingUnsignedPayloadTrailer)
+	r.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(n, 10))
+	r.Header.Set("X-Amz-Trailer", checksumTrailer)
+
+	r.ContentLength = chunkedLength(n)
+	r.Body = newChunkedBody(r.Body)
+	if getBody := r.GetBody; getBody != nil {
+		r.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newChunkedBody(body), nil
+		}
+	}
+	return nil
+}
+
+// chunkedLength returns the length of n bytes in aws-chunked encoding, with
+// the checksum trailer.
+func chunkedLength(n int64) int64 {
+	chunk := func(size int64) int64 {
+		return int64(len(strconv.FormatInt(size, 16))) + size + 2*int64(len(crlf))
+	}
+	l := n / streamingChunkSize * chunk(streamingChunkSize)
+	if rem := n % streamingChunkSize; rem > 0 {
+		l += chunk(rem)
+	}
+	trailer := len(checksumTrailer) + 1 + base64.StdEncoding.EncodedLen(sha256.Size)
+	return l + int64(len("0")+len(crlf)+trailer+2*len(crlf))
+}
+
+// A chunkedBody encodes a body in aws-chunked encoding, hashing it as it
+// goes. The chunks are served from the buffer they are read into.
+type chunkedBody struct {
+	body    io.ReadCloser
+	h       hash.Hash
+	buf     []byte
+	pending [][]byte
+	done    bool
+}
+
+func newChunkedBody(body io.ReadCloser) *chunkedBody {
+	return &chunkedBody{body: body, h: sha256.New()}
+}
+
+func (c *chunkedBody) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending[0])
+	if c.pending[0] = c.pending[0][n:]; len(c.pending[0]) == 0 {
+		c.pending = c.pending[1:]
+	}
+	return n, nil
+}
+
+// next reads the next chunk of the body, or makes the last chunk and the
+// trailer at its end.
+func (c *chunkedBody) next() error {
+	if c.buf == nil {
+		c.buf = make([]byte, streamingChunkSize)
+	}
+	n, err := io.ReadFull(c.body, c.buf)
+	if n > 0 {
+		c.h.Write(c.buf[:n])
+		size := strconv.AppendInt(nil, int64(n), 16)
+		c.pending = append(c.pending, append(size, crlf...), c.buf[:n], crlf)
+		return nil
+	}
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	sum := base64.StdEncoding.EncodeToString(c.h.Sum(nil))
+	c.pending = append(c.pending, []byte("0\r\n"+checksumTrailer+":"+sum+"\r\n\r\n"))
+	c.done = true
+	return nil
+}
+
+func (c *chunkedBody) Close() error {
+	return c.body.Close()
+}
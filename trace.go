@@ -0,0 +1,179 @@
+package aws4
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceHeader is the header that carries the AWS X-Ray trace context.
+const TraceHeader = "X-Amzn-Trace-Id"
+
+type traceKey struct{}
+
+// WithTrace returns a copy of ctx carrying the X-Ray trace header h, such as
+// the TraceHeader of an incoming request. Clients send it with the requests
+// made with the returned context, so that they join the trace:
+//
+//	ctx := aws4.WithTrace(r.Context(), r.Header.Get(aws4.TraceHeader))
+//
+// Without one, the trace of the current Lambda invocation, if any, is used.
+func WithTrace(ctx context.Context, h string) context.Context {
+	return context.WithValue(ctx, traceKey{}, h)
+}
+
+// traceHeader returns the trace header for requests made with ctx.
+func traceHeader(ctx context.Context) string {
+	if h, _ := ctx.Value(traceKey{}).(string); h != "" {
+		return h
+	}
+	return os.Getenv("_X_AMZN_TRACE_ID")
+}
+
+// parseTrace splits a trace header into its fields (Root, Parent, Sampled).
+func parseTrace(h string) map[string]string {
+	fields := make(map[string]string)
+	for _, f := range strings.Split(h, ";") {
+		if i := strings.IndexByte(f, '='); i > 0 {
+			fields[strings.TrimSpace(f[:i])] = strings.TrimSpace(f[i+1:])
+		}
+	}
+	return fields
+}
+
+// An XRayEmitter sends an X-Ray subsegment for every traced request of a
+// Client to the X-Ray daemon, so that AWS calls show up in service maps.
+// Set it as Client.XRay to use it.
+type XRayEmitter struct {
+	// Addr is the UDP address of the daemon. If empty, the UDP address of
+	// AWS_XRAY_DAEMON_ADDRESS is used, or 127.0.0.1:2000.
+	Addr string
+
+	once sync.Once
+	conn net.Conn
+}
+
+type subsegment struct {
+	Name      string  `json:"name"`
+	ID        string  `json:"id"`
+	TraceID   string  `json:"trace_id"`
+	ParentID  string  `json:"parent_id"`
+	Type      string  `json:"type"`
+	Namespace string  `json:"namespace"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Error     bool    `json:"error,omitempty"`
+	Throttle  bool    `json:"throttle,omitempty"`
+	Fault     bool    `json:"fault,omitempty"`
+	HTTP      struct {
+		Request struct {
+			Method string `json:"method"`
+			URL    string `json:"url"`
+		} `json:"request"`
+		Response struct {
+			Status int `json:"status,omitempty"`
+		} `json:"response"`
+	} `json:"http"`
+	AWS struct {
+		Operation string `json:"operation,omitempty"`
+		Region    string `json:"region"`
+	} `json:"aws"`
+}
+
+// begin sets the trace header of req, starting a subsegment for it if x is
+// not nil and the trace is sampled. It returns a function that ends the
+// subsegment.
+func (x *XRayEmitter) begin(service, region string, req *http.Request) func(*http.Response, error) {
+	h := req.Header.Get(TraceHeader)
+	if h == "" {
+		h = traceHeader(req.Context())
+	}
+	if h == "" {
+		return nil
+	}
+	fields := parseTrace(h)
+	if x == nil || fields["Root"] == "" || fields["Parent"] == "" || fields["Sampled"] == "0" {
+		req.Header.Set(TraceHeader, h)
+		return nil
+	}
+
+	s := &subsegment{
+		Name:      service,
+		ID:        newSegmentID(),
+		TraceID:   fields["Root"],
+		ParentID:  fields["Parent"],
+		Type:      "subsegment",
+		Namespace: "aws",
+		StartTime: epoch(time.Now()),
+	}
+	s.HTTP.Request.Method = req.Method
+	s.HTTP.Request.URL = req.URL.String()
+	s.AWS.Region = region
+	if t := req.Header.Get("X-Amz-Target"); t != "" {
+		s.AWS.Operation = t[strings.LastIndexByte(t, '.')+1:]
+	}
+	req.Header.Set(TraceHeader, "Root="+s.TraceID+";Parent="+s.ID+";Sampled=1")
+
+	return func(resp *http.Response, err error) {
+		s.EndTime = epoch(time.Now())
+		switch {
+		case err != nil:
+			s.Fault = true
+		case resp.StatusCode >= 500:
+			s.HTTP.Response.Status = resp.StatusCode
+			s.Fault = true
+		case resp.StatusCode >= 400:
+			s.HTTP.Response.Status = resp.StatusCode
+			s.Error = true
+			s.Throttle = resp.StatusCode == 429
+		default:
+			s.HTTP.Response.Status = resp.StatusCode
+		}
+		x.emit(s)
+	}
+}
+
+// emit sends s to the daemon. Errors are ignored: tracing never fails a
+// request.
+func (x *XRayEmitter) emit(s *subsegment) {
+	x.once.Do(func() {
+		addr := x.Addr
+		if addr == "" {
+			// Either "host:port" or "tcp:host:port udp:host:port".
+			for _, a := range strings.Fields(os.Getenv("AWS_XRAY_DAEMON_ADDRESS")) {
+				if !strings.HasPrefix(a, "tcp:") {
+					addr = strings.TrimPrefix(a, "udp:")
+				}
+			}
+		}
+		if addr == "" {
+			addr = "127.0.0.1:2000"
+		}
+		x.conn, _ = net.Dial("udp", addr)
+	})
+	if x.conn == nil {
+		return
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	x.conn.Write(append([]byte("{\"format\":\"json\",\"version\":1}\n"), b...))
+}
+
+func newSegmentID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func epoch(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,105 @@
+package aws4
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracePropagation(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(TraceHeader)
+	}))
+	defer srv.Close()
+
+	c := &Client{Keys: &Keys{}, XRay: &XRayEmitter{Addr: pc.LocalAddr().String()}}
+	trace := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("{}"))
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810.GetItem")
+	req = req.WithContext(WithTrace(context.Background(), trace))
+	resp, err := c.DoService("dynamodb", "us-east-1", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !strings.HasPrefix(got, "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=") || strings.Contains(got, "53995c3f42cd8ad8") {
+		t.Errorf("trace header %q", got)
+	}
+	if strings.Contains(req.Header.Get("Authorization"), "x-amzn-trace-id") {
+		t.Error("trace header was signed")
+	}
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(buf[:n]), "\n", 2)
+	var s subsegment
+	if err := json.Unmarshal([]byte(lines[1]), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ParentID != "53995c3f42cd8ad8" || s.AWS.Operation != "GetItem" || s.HTTP.Response.Status != 200 || !strings.Contains(got, s.ID) {
+		t.Errorf("subsegment %+v", s)
+	}
+}
+
+func TestTraceHeaderUnsigned(t *testing.T) {
+	keys := &Keys{AccessKey: "AKID", SecretKey: "secret"}
+	var auth, want string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Sign the request as received with the headers it was signed with.
+		auth = r.Header.Get("Authorization")
+		i, j := strings.Index(auth, "SignedHeaders="), strings.Index(auth, ", Signature=")
+		if i < 0 || j < i {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+		for k, v := range r.Header {
+			if k != "Authorization" {
+				req.Header[k] = v
+			}
+		}
+		// Sign reads the Date it wrote back in the format of HTTP.
+		if d, err := time.Parse(iSO8601BasicFormat, req.Header.Get("Date")); err == nil {
+			req.Header.Set("Date", d.Format(http.TimeFormat))
+		}
+		sv := &Service{Name: "dynamodb", Region: "us-east-1", SignedHeaders: strings.Split(auth[i+len("SignedHeaders="):j], ";")}
+		sv.Sign(keys, req)
+		want = req.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	c := &Client{Keys: keys, XRay: &XRayEmitter{Addr: "127.0.0.1:1"}}
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("{}"))
+	req.Header.Set(TraceHeader, "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1")
+	resp, err := c.DoService("dynamodb", "us-east-1", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if strings.Contains(req.Header.Get(TraceHeader), "53995c3f42cd8ad8") {
+		t.Errorf("trace header %q was not rewritten", req.Header.Get(TraceHeader))
+	}
+	if auth == "" || auth != want {
+		t.Errorf("signature %q, want %q", auth, want)
+	}
+}
@@ -0,0 +1,86 @@
+package aws4
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// A UserAgent builds the User-Agent header of the requests of a Client,
+// in the format of the AWS SDKs:
+//
+//	aws4-go/v1.2.0 go/go1.21.0 os/linux arch/amd64 app/myapp ft/dydb-cache
+type UserAgent struct {
+	// AppID identifies the application. If empty, AWS_SDK_UA_APP_ID is
+	// used.
+	AppID string
+
+	// Features are appended as "ft/<feature>", to tell which features of the
+	// library are in use.
+	Features []string
+
+	once sync.Once
+	s    string
+}
+
+var defaultUserAgent = &UserAgent{}
+
+// String returns the User-Agent header.
+func (u *UserAgent) String() string {
+	u.once.Do(func() {
+		s := []string{
+			"aws4-go/" + libraryVersion(),
+			"go/" + runtime.Version(),
+			"os/" + runtime.GOOS,
+			"arch/" + runtime.GOARCH,
+		}
+		app := u.AppID
+		if app == "" {
+			app = os.Getenv("AWS_SDK_UA_APP_ID")
+		}
+		if app != "" {
+			s = append(s, "app/"+uaToken(app))
+		}
+		for _, f := range u.Features {
+			s = append(s, "ft/"+uaToken(f))
+		}
+		u.s = strings.Join(s, " ")
+	})
+	return u.s
+}
+
+// libraryVersion returns the module version of this package, as recorded
+// in the build.
+func libraryVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if bi.Main.Path == "github.com/raff/aws4" {
+		return bi.Main.Version
+	}
+	for _, m := range bi.Deps {
+		if m.Path == "github.com/raff/aws4" {
+			if m.Replace != nil && m.Replace.Version != "" {
+				return m.Replace.Version
+			}
+			return m.Version
+		}
+	}
+	return "unknown"
+}
+
+// uaToken replaces the characters not allowed in a User-Agent token.
+func uaToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+			return r
+		}
+		return '-'
+	}, s)
+}
@@ -0,0 +1,32 @@
+package aws4
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer srv.Close()
+
+	c := &Client{Keys: &Keys{}, UserAgent: &UserAgent{AppID: "my app", Features: []string{"cache"}}}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := c.DoService("s3", "us-east-1", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !strings.HasPrefix(got, "aws4-go/") || !strings.HasSuffix(got, " os/"+runtime.GOOS+" arch/"+runtime.GOARCH+" app/my-app ft/cache") {
+		t.Errorf("User-Agent %q", got)
+	}
+	if strings.Contains(req.Header.Get("Authorization"), "user-agent") {
+		t.Error("User-Agent was signed")
+	}
+}
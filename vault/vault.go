@@ -0,0 +1,158 @@
+// Package vault is an aws4.Provider of credentials issued by the AWS
+// secrets engine of HashiCorp Vault.
+//
+//	p := &vault.Provider{Role: "deploy"}
+//	client := &aws4.Client{Credentials: aws4.NewCredentials(p)}
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/raff/aws4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Provider reads credentials for a role of the AWS secrets engine. When
+// they are about to expire it renews their lease, keeping the same keys,
+// and only reads new ones once the lease can't be renewed, as with STS
+// credentials.
+type Provider struct {
+	// Addr is the address of Vault. If empty, VAULT_ADDR is used.
+	Addr string
+
+	// Token is the Vault token. If empty, VAULT_TOKEN is used.
+	Token string
+
+	// Mount is the path the secrets engine is mounted at. If empty, "aws"
+	// is used.
+	Mount string
+
+	// Role is the role to read credentials for.
+	Role string
+
+	// STS reads temporary credentials from sts/<Role> rather than
+	// creds/<Role>.
+	STS bool
+
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	mu    sync.Mutex
+	keys  *aws4.Keys
+	lease lease
+}
+
+type lease struct {
+	ID        string `json:"lease_id"`
+	Duration  int64  `json:"lease_duration"`
+	Renewable bool   `json:"renewable"`
+}
+
+// An Error is an error reported by Vault.
+type Error struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("vault: %d - %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+// Retrieve implements aws4.Provider.
+func (p *Provider) Retrieve(ctx context.Context) (*aws4.Keys, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && p.lease.Renewable {
+		req := map[string]interface{}{"lease_id": p.lease.ID, "increment": p.lease.Duration}
+		var l lease
+		if err := p.do(ctx, "PUT", "/v1/sys/leases/renew", req, &l); err == nil && l.Duration > 0 {
+			p.lease = l
+			return p.keys, expiry(l), nil
+		}
+		// The lease reached its maximum TTL or was revoked.
+	}
+
+	mount := p.Mount
+	if mount == "" {
+		mount = "aws"
+	}
+	path := "creds"
+	if p.STS {
+		path = "sts"
+	}
+	var resp struct {
+		lease
+		Data json.RawMessage `json:"data"`
+	}
+	if err := p.do(ctx, "GET", "/v1/"+mount+"/"+path+"/"+p.Role, nil, &resp); err != nil {
+		return nil, time.Time{}, err
+	}
+	keys, err := aws4.KeysFromJSON(bytes.NewReader(resp.Data))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	p.keys, p.lease = keys, resp.lease
+	return keys, expiry(resp.lease), nil
+}
+
+func expiry(l lease) time.Time {
+	if l.Duration <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(l.Duration) * time.Second)
+}
+
+func (p *Provider) do(ctx context.Context, method, path string, in, out interface{}) error {
+	addr := p.Addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	token := p.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(method, strings.TrimSuffix(addr, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("X-Vault-Token", token)
+
+	cl := p.Client
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	resp, err := cl.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return &Error{resp.StatusCode, e.Errors}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}